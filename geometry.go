@@ -0,0 +1,375 @@
+package osm
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/planar"
+)
+
+// Geometry returns the annotated way as an orb.Polygon if it should be
+// considered an area, see Polygon(), or an orb.LineString otherwise.
+// The polygon ring is counter-clockwise.
+func (w *Way) Geometry() orb.Geometry {
+	ls := w.LineString()
+	if !w.Polygon() || len(ls) < 4 || ls[0] != ls[len(ls)-1] {
+		return ls
+	}
+
+	ring := orb.Ring(ls)
+	if ring.Orientation() == orb.CW {
+		ring = ring.Clone()
+		ring.Reverse()
+	}
+
+	return orb.Polygon{ring}
+}
+
+// Length returns the geodesic length of the way in meters.
+func (w *Way) Length() float64 {
+	return geo.Length(w.LineString())
+}
+
+// Area returns the geodesic area of the way in square meters.
+// Ways that are not polygons have zero area.
+func (w *Way) Area() float64 {
+	return Area(w.Geometry())
+}
+
+// Centroid returns the centroid of the way geometry.
+func (w *Way) Centroid() orb.Point {
+	return Centroid(w.Geometry())
+}
+
+// LabelPoint returns a good point to place a label for the way.
+// See the LabelPoint function for details.
+func (w *Way) LabelPoint() orb.Point {
+	return LabelPoint(w.Geometry())
+}
+
+// Geometry returns the geometry of the relation from the annotated member
+// ways. Multipolygon and boundary relations are an orb.MultiPolygon, other
+// relations the orb.MultiLineString of their way members. Unclosed rings
+// are skipped. Returns nil if there is no geometry.
+func (r *Relation) Geometry() orb.Geometry {
+	if r.Polygon() {
+		mp := r.multiPolygon()
+		if len(mp) == 0 {
+			return nil
+		}
+
+		return mp
+	}
+
+	var mls orb.MultiLineString
+	for _, m := range r.Members {
+		if m.Type != TypeWay {
+			continue
+		}
+
+		if ls := (&Way{Nodes: m.Nodes}).LineString(); len(ls) > 1 {
+			mls = append(mls, ls)
+		}
+	}
+
+	if len(mls) == 0 {
+		return nil
+	}
+
+	return mls
+}
+
+// Length returns the geodesic length of the relation geometry in meters.
+// For multipolygons this is the length of the rings.
+func (r *Relation) Length() float64 {
+	return Length(r.Geometry())
+}
+
+// Area returns the geodesic area of the relation geometry in square meters.
+func (r *Relation) Area() float64 {
+	return Area(r.Geometry())
+}
+
+// Centroid returns the centroid of the relation geometry.
+func (r *Relation) Centroid() orb.Point {
+	return Centroid(r.Geometry())
+}
+
+// LabelPoint returns a good point to place a label for the relation.
+// See the LabelPoint function for details.
+func (r *Relation) LabelPoint() orb.Point {
+	return LabelPoint(r.Geometry())
+}
+
+// multiPolygon joins the outer and inner member ways into rings.
+// Inner rings are added to the outer ring that contains them.
+func (r *Relation) multiPolygon() orb.MultiPolygon {
+	var outer, inner []orb.LineString
+	for _, m := range r.Members {
+		if m.Type != TypeWay {
+			continue
+		}
+
+		ls := (&Way{Nodes: m.Nodes}).LineString()
+		if len(ls) < 2 {
+			continue
+		}
+
+		if m.Role == "inner" {
+			inner = append(inner, ls)
+		} else if m.Role == "outer" || m.Role == "" {
+			outer = append(outer, ls)
+		}
+	}
+
+	var mp orb.MultiPolygon
+	for _, ring := range joinRings(outer) {
+		if ring.Orientation() == orb.CW {
+			ring.Reverse()
+		}
+
+		mp = append(mp, orb.Polygon{ring})
+	}
+
+	for _, ring := range joinRings(inner) {
+		if ring.Orientation() == orb.CCW {
+			ring.Reverse()
+		}
+
+		for i, p := range mp {
+			if planar.RingContains(p[0], ring[0]) {
+				mp[i] = append(p, ring)
+				break
+			}
+		}
+	}
+
+	return mp
+}
+
+// joinRings joins the lines end to end into closed rings.
+// Lines that do not form a ring are dropped.
+func joinRings(lines []orb.LineString) []orb.Ring {
+	lines = append([]orb.LineString(nil), lines...)
+
+	var rings []orb.Ring
+	for len(lines) != 0 {
+		current := lines[len(lines)-1].Clone()
+		lines = lines[:len(lines)-1]
+
+		for current[0] != current[len(current)-1] {
+			last := current[len(current)-1]
+
+			found := -1
+			for i, l := range lines {
+				if l[0] == last {
+					current = append(current, l[1:]...)
+				} else if l[len(l)-1] == last {
+					l = l.Clone()
+					l.Reverse()
+					current = append(current, l[1:]...)
+				} else {
+					continue
+				}
+
+				found = i
+				break
+			}
+
+			if found == -1 {
+				break
+			}
+
+			lines = append(lines[:found], lines[found+1:]...)
+		}
+
+		if len(current) >= 4 && current[0] == current[len(current)-1] {
+			rings = append(rings, orb.Ring(current))
+		}
+	}
+
+	return rings
+}
+
+// Length returns the geodesic length of the geometry in meters. For polygons
+// and multipolygons, e.g. assembled multipolygon relations, this is the
+// length of the rings.
+func Length(g orb.Geometry) float64 {
+	if g == nil {
+		return 0
+	}
+
+	return geo.Length(g)
+}
+
+// Area returns the geodesic area of the geometry in square meters.
+// Points and lines have zero area.
+func Area(g orb.Geometry) float64 {
+	if g == nil {
+		return 0
+	}
+
+	return geo.Area(g)
+}
+
+// Centroid returns the centroid of the geometry. It is the area weighted
+// centroid for polygons and the length weighted centroid for lines,
+// computed in the lon/lat plane.
+func Centroid(g orb.Geometry) orb.Point {
+	if g == nil {
+		return orb.Point{}
+	}
+
+	c, _ := planar.CentroidArea(g)
+	return c
+}
+
+// LabelPoint returns a good point to place a label for the geometry. For
+// polygons it is the pole of inaccessibility, the point inside the polygon
+// farthest from its boundary, of the largest polygon. For lines it is the
+// point half way along the longest line. Other geometry use the centroid.
+// The pole of inaccessibility is found to within 1/1000 of the size of
+// the polygon, in the lon/lat plane.
+func LabelPoint(g orb.Geometry) orb.Point {
+	switch g := g.(type) {
+	case nil:
+		return orb.Point{}
+	case orb.Point:
+		return g
+	case orb.LineString:
+		return midpoint(g)
+	case orb.MultiLineString:
+		var longest orb.LineString
+		max := -1.0
+		for _, ls := range g {
+			if l := geo.Length(ls); l > max {
+				longest, max = ls, l
+			}
+		}
+
+		return midpoint(longest)
+	case orb.Ring:
+		return polylabel(orb.Polygon{g})
+	case orb.Polygon:
+		return polylabel(g)
+	case orb.MultiPolygon:
+		var largest orb.Polygon
+		max := -1.0
+		for _, p := range g {
+			if a := geo.Area(p); a > max {
+				largest, max = p, a
+			}
+		}
+
+		return polylabel(largest)
+	}
+
+	return Centroid(g)
+}
+
+// midpoint returns the point half the geodesic length along the line.
+func midpoint(ls orb.LineString) orb.Point {
+	if len(ls) == 0 {
+		return orb.Point{}
+	}
+
+	half := geo.Length(ls) / 2
+	for i := 0; i < len(ls)-1; i++ {
+		d := geo.Distance(ls[i], ls[i+1])
+		if d >= half && d > 0 {
+			f := half / d
+			return orb.Point{
+				ls[i][0] + f*(ls[i+1][0]-ls[i][0]),
+				ls[i][1] + f*(ls[i+1][1]-ls[i][1]),
+			}
+		}
+
+		half -= d
+	}
+
+	return ls[len(ls)-1]
+}
+
+// polylabel finds the pole of inaccessibility of the polygon using the
+// algorithm from https://github.com/mapbox/polylabel
+func polylabel(p orb.Polygon) orb.Point {
+	if len(p) == 0 || len(p[0]) == 0 {
+		return orb.Point{}
+	}
+
+	b := p.Bound()
+	width, height := b.Max[0]-b.Min[0], b.Max[1]-b.Min[1]
+	cellSize := math.Min(width, height)
+	if cellSize == 0 {
+		return b.Min
+	}
+
+	precision := math.Max(width, height) / 1000
+
+	cells := &cellQueue{}
+	h := cellSize / 2
+	for x := b.Min[0]; x < b.Max[0]; x += cellSize {
+		for y := b.Min[1]; y < b.Max[1]; y += cellSize {
+			heap.Push(cells, newCell(orb.Point{x + h, y + h}, h, p))
+		}
+	}
+
+	// the centroid is a good first guess
+	c, _ := planar.CentroidArea(p)
+	best := newCell(c, 0, p)
+	if center := newCell(b.Center(), 0, p); center.d > best.d {
+		best = center
+	}
+
+	for cells.Len() != 0 {
+		cell := heap.Pop(cells).(*cell)
+		if cell.d > best.d {
+			best = cell
+		}
+
+		if cell.max-best.d <= precision {
+			continue
+		}
+
+		h := cell.h / 2
+		heap.Push(cells, newCell(orb.Point{cell.c[0] - h, cell.c[1] - h}, h, p))
+		heap.Push(cells, newCell(orb.Point{cell.c[0] + h, cell.c[1] - h}, h, p))
+		heap.Push(cells, newCell(orb.Point{cell.c[0] - h, cell.c[1] + h}, h, p))
+		heap.Push(cells, newCell(orb.Point{cell.c[0] + h, cell.c[1] + h}, h, p))
+	}
+
+	return best.c
+}
+
+type cell struct {
+	c   orb.Point
+	h   float64 // half the cell size
+	d   float64 // distance from the center to the polygon, negative if outside
+	max float64 // max distance to the polygon within the cell
+}
+
+func newCell(c orb.Point, h float64, p orb.Polygon) *cell {
+	d := planar.DistanceFrom(p, c)
+	if !planar.PolygonContains(p, c) {
+		d = -d
+	}
+
+	return &cell{c: c, h: h, d: d, max: d + h*math.Sqrt2}
+}
+
+// cellQueue is a max heap of cells by their max distance.
+type cellQueue []*cell
+
+func (q cellQueue) Len() int            { return len(q) }
+func (q cellQueue) Less(i, j int) bool  { return q[i].max > q[j].max }
+func (q cellQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *cellQueue) Push(x interface{}) { *q = append(*q, x.(*cell)) }
+
+func (q *cellQueue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
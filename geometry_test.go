@@ -0,0 +1,165 @@
+package osm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+func square(id NodeID, x, y, size float64) WayNodes {
+	return WayNodes{
+		{ID: id, Lon: x, Lat: y},
+		{ID: id + 1, Lon: x + size, Lat: y},
+		{ID: id + 2, Lon: x + size, Lat: y + size},
+		{ID: id + 3, Lon: x, Lat: y + size},
+		{ID: id, Lon: x, Lat: y},
+	}
+}
+
+func TestWay_Geometry(t *testing.T) {
+	w := &Way{Nodes: square(1, 1, 1, 1)}
+	if _, ok := w.Geometry().(orb.LineString); !ok {
+		t.Errorf("untagged way should be line string: %v", w.Geometry())
+	}
+
+	w.Tags = Tags{{Key: "building", Value: "yes"}}
+	p, ok := w.Geometry().(orb.Polygon)
+	if !ok {
+		t.Fatalf("should be polygon: %v", w.Geometry())
+	}
+
+	if p[0].Orientation() != orb.CCW {
+		t.Errorf("should be counter clockwise")
+	}
+
+	// clockwise input is reversed
+	w.Nodes[1], w.Nodes[3] = w.Nodes[3], w.Nodes[1]
+	p = w.Geometry().(orb.Polygon)
+	if p[0].Orientation() != orb.CCW {
+		t.Errorf("should be counter clockwise")
+	}
+
+	if w.Nodes[1].ID != 4 {
+		t.Errorf("should not modify the way nodes")
+	}
+}
+
+func TestWay_measure(t *testing.T) {
+	// about 111km on each side near the equator
+	w := &Way{
+		Nodes: square(1, 1, 0.5, 1),
+		Tags:  Tags{{Key: "building", Value: "yes"}},
+	}
+
+	if l := w.Length(); math.Abs(l-4*111195) > 1000 {
+		t.Errorf("incorrect length: %v", l)
+	}
+
+	if a := w.Area(); math.Abs(a-111195*111195) > 1e8 {
+		t.Errorf("incorrect area: %v", a)
+	}
+
+	if c := w.Centroid(); !c.Equal(orb.Point{1.5, 1}) {
+		t.Errorf("incorrect centroid: %v", c)
+	}
+
+	if p := w.LabelPoint(); math.Abs(p[0]-1.5) > 0.001 || math.Abs(p[1]-1) > 0.001 {
+		t.Errorf("incorrect label point: %v", p)
+	}
+
+	w.Tags = nil
+	if a := w.Area(); a != 0 {
+		t.Errorf("lines should have no area: %v", a)
+	}
+
+	if p := w.LabelPoint(); math.Abs(p[0]-2) > 1e-6 || math.Abs(p[1]-1.5) > 1e-3 {
+		t.Errorf("label should be half way along: %v", p)
+	}
+}
+
+func TestRelation_Geometry(t *testing.T) {
+	outer := square(1, 0.5, 0.5, 10)
+	r := &Relation{
+		Tags: Tags{{Key: "type", Value: "multipolygon"}},
+		Members: Members{
+			{Type: TypeWay, Role: "outer", Nodes: outer[:3]},
+			{Type: TypeWay, Role: "outer", Nodes: outer[2:]},
+			{Type: TypeWay, Role: "inner", Nodes: square(10, 1, 1, 4)},
+			{Type: TypeWay, Role: "outer", Nodes: square(20, 20, 20, 1)},
+			{Type: TypeWay, Role: "outer", Nodes: WayNodes{{ID: 30, Lon: 30, Lat: 30}, {ID: 31, Lon: 31, Lat: 30}}},
+		},
+	}
+
+	mp, ok := r.Geometry().(orb.MultiPolygon)
+	if !ok {
+		t.Fatalf("should be multipolygon: %v", r.Geometry())
+	}
+
+	if len(mp) != 2 {
+		t.Fatalf("unclosed rings should be skipped: %v", mp)
+	}
+
+	var big orb.Polygon
+	for _, p := range mp {
+		if p.Bound().Max[0] == 10.5 {
+			big = p
+		}
+	}
+
+	if len(big) != 2 {
+		t.Fatalf("inner ring should be in outer: %v", mp)
+	}
+
+	if big[0].Orientation() != orb.CCW || big[1].Orientation() != orb.CW {
+		t.Errorf("incorrect orientation")
+	}
+
+	// the hole is not part of the area
+	e := Area(orb.Polygon{big[0]}) - Area(orb.Polygon{big[1]}) + Area(orb.Polygon{square(20, 20, 20, 1).Bound().ToRing()})
+	if a := r.Area(); math.Abs(a-e) > 1 {
+		t.Errorf("incorrect area: %v != %v", a, e)
+	}
+
+	// label point should be outside of the hole
+	p := r.LabelPoint()
+	if p[0] > 1 && p[0] < 5 && p[1] > 1 && p[1] < 5 {
+		t.Errorf("label point in hole: %v", p)
+	}
+
+	r.Tags = Tags{{Key: "type", Value: "route"}}
+	if mls, ok := r.Geometry().(orb.MultiLineString); !ok || len(mls) != 5 {
+		t.Errorf("should be multi line string: %v", r.Geometry())
+	}
+
+	r.Members = nil
+	if g := r.Geometry(); g != nil {
+		t.Errorf("should be nil: %v", g)
+	}
+
+	if l := r.Length(); l != 0 {
+		t.Errorf("should have zero length: %v", l)
+	}
+}
+
+func TestLabelPoint(t *testing.T) {
+	// an L shape, the centroid is not ideal. The pole is equidistant
+	// from the outer edges and the inner corner at 2,2.
+	p := orb.Polygon{{
+		{0, 0}, {10, 0}, {10, 2}, {2, 2}, {2, 10}, {0, 10}, {0, 0},
+	}}
+
+	e := 2 * math.Sqrt2 / (1 + math.Sqrt2)
+	lp := LabelPoint(p)
+	if math.Abs(lp[0]-e) > 0.01 || math.Abs(lp[1]-e) > 0.01 {
+		t.Errorf("incorrect label point: %v", lp)
+	}
+
+	if lp := LabelPoint(orb.Point{1, 2}); lp != (orb.Point{1, 2}) {
+		t.Errorf("incorrect label point: %v", lp)
+	}
+
+	if lp := LabelPoint(nil); lp != (orb.Point{}) {
+		t.Errorf("incorrect label point: %v", lp)
+	}
+}
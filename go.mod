@@ -4,8 +4,10 @@ go 1.16
 
 require (
 	github.com/datadog/czlib v0.0.0-20160811164712-4bc9a24e37f2
+	github.com/gogo/protobuf v1.3.2 // indirect; used by orb/encoding/mvt, orb v0.1.3 has no go.mod
 	github.com/paulmach/orb v0.1.3
 	github.com/paulmach/protoscan v0.2.1
+	github.com/pkg/errors v0.9.1 // indirect; used by orb/encoding/mvt, orb v0.1.3 has no go.mod
 	golang.org/x/time v0.0.0-20190921001708-c4c64cad1fd0
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	google.golang.org/protobuf v1.27.1
@@ -0,0 +1,402 @@
+package osm
+
+import (
+	"context"
+)
+
+// An Index is a view of an OSM container with constant time lookups by id
+// and reverse lookups from nodes to ways and from members to relations.
+// If the container has multiple versions of an element, feature lookups
+// and reverse lookups use the latest version.
+type Index struct {
+	osm *OSM
+
+	nodes     map[NodeID]*Node
+	ways      map[WayID]*Way
+	relations map[RelationID]*Relation
+	elements  map[ElementID]Element
+
+	nodeWays map[NodeID]Ways
+	memberOf map[FeatureID]Relations
+}
+
+// NewIndex creates an index of the nodes, ways and relations in the container.
+// Changes to the container after creation are not reflected in the index.
+func NewIndex(o *OSM) *Index {
+	if o == nil {
+		o = &OSM{}
+	}
+
+	idx := &Index{
+		osm:       o,
+		nodes:     make(map[NodeID]*Node, len(o.Nodes)),
+		ways:      make(map[WayID]*Way, len(o.Ways)),
+		relations: make(map[RelationID]*Relation, len(o.Relations)),
+		elements:  make(map[ElementID]Element, len(o.Nodes)+len(o.Ways)+len(o.Relations)),
+		nodeWays:  make(map[NodeID]Ways),
+		memberOf:  make(map[FeatureID]Relations),
+	}
+
+	for _, n := range o.Nodes {
+		idx.index(n)
+	}
+
+	for _, w := range o.Ways {
+		idx.index(w)
+	}
+
+	for _, r := range o.Relations {
+		idx.index(r)
+	}
+
+	return idx
+}
+
+// OSM returns the indexed container.
+func (idx *Index) OSM() *OSM {
+	return idx.osm
+}
+
+// Add will index the element and append it to the container.
+func (idx *Index) Add(e Element) {
+	switch e := e.(type) {
+	case *Node:
+		idx.osm.Nodes = append(idx.osm.Nodes, e)
+	case *Way:
+		idx.osm.Ways = append(idx.osm.Ways, e)
+	case *Relation:
+		idx.osm.Relations = append(idx.osm.Relations, e)
+	default:
+		return
+	}
+
+	idx.index(e)
+}
+
+func (idx *Index) index(e Element) {
+	idx.elements[e.ElementID()] = e
+
+	switch e := e.(type) {
+	case *Node:
+		if c := idx.nodes[e.ID]; c == nil || c.Version <= e.Version {
+			idx.nodes[e.ID] = e
+		}
+	case *Way:
+		c := idx.ways[e.ID]
+		if c != nil && c.Version > e.Version {
+			return
+		}
+		idx.ways[e.ID] = e
+
+		if c != nil {
+			for _, wn := range c.Nodes {
+				idx.nodeWays[wn.ID] = removeWay(idx.nodeWays[wn.ID], c)
+			}
+		}
+
+		for _, wn := range e.Nodes {
+			ws := idx.nodeWays[wn.ID]
+			if len(ws) > 0 && ws[len(ws)-1] == e {
+				// closed ways, or repeated nodes, should only be included once
+				continue
+			}
+			idx.nodeWays[wn.ID] = append(ws, e)
+		}
+	case *Relation:
+		c := idx.relations[e.ID]
+		if c != nil && c.Version > e.Version {
+			return
+		}
+		idx.relations[e.ID] = e
+
+		if c != nil {
+			for _, m := range c.Members {
+				fid := m.FeatureID()
+				idx.memberOf[fid] = removeRelation(idx.memberOf[fid], c)
+			}
+		}
+
+		for _, m := range e.Members {
+			fid := m.FeatureID()
+			rs := idx.memberOf[fid]
+			if len(rs) > 0 && rs[len(rs)-1] == e {
+				continue
+			}
+			idx.memberOf[fid] = append(rs, e)
+		}
+	}
+}
+
+// removeWay returns a copy of the ways without w. The slices may have
+// been returned by NodeWays so they are not modified.
+func removeWay(ways Ways, w *Way) Ways {
+	for i := range ways {
+		if ways[i] == w {
+			result := make(Ways, 0, len(ways)-1)
+			result = append(result, ways[:i]...)
+			return append(result, ways[i+1:]...)
+		}
+	}
+
+	return ways
+}
+
+// removeRelation returns a copy of the relations without r. The slices
+// may have been returned by MemberRelations so they are not modified.
+func removeRelation(relations Relations, r *Relation) Relations {
+	for i := range relations {
+		if relations[i] == r {
+			result := make(Relations, 0, len(relations)-1)
+			result = append(result, relations[:i]...)
+			return append(result, relations[i+1:]...)
+		}
+	}
+
+	return relations
+}
+
+// Node returns the latest version of the node in the index, or nil.
+func (idx *Index) Node(id NodeID) *Node {
+	return idx.nodes[id]
+}
+
+// Way returns the latest version of the way in the index, or nil.
+func (idx *Index) Way(id WayID) *Way {
+	return idx.ways[id]
+}
+
+// Relation returns the latest version of the relation in the index, or nil.
+func (idx *Index) Relation(id RelationID) *Relation {
+	return idx.relations[id]
+}
+
+// Feature returns the latest version of the feature in the index, or nil.
+func (idx *Index) Feature(id FeatureID) Element {
+	switch id.Type() {
+	case TypeNode:
+		if n := idx.nodes[id.NodeID()]; n != nil {
+			return n
+		}
+	case TypeWay:
+		if w := idx.ways[id.WayID()]; w != nil {
+			return w
+		}
+	case TypeRelation:
+		if r := idx.relations[id.RelationID()]; r != nil {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// Element returns the element with the given id and version, or nil.
+func (idx *Index) Element(id ElementID) Element {
+	return idx.elements[id]
+}
+
+// NodeWays returns the ways that contain the node.
+func (idx *Index) NodeWays(id NodeID) Ways {
+	ws := idx.nodeWays[id]
+
+	// limit the capacity so appends by the index or the caller always copy
+	return ws[:len(ws):len(ws)]
+}
+
+// MemberRelations returns the relations the feature is a member of.
+func (idx *Index) MemberRelations(id FeatureID) Relations {
+	rs := idx.memberOf[id]
+	return rs[:len(rs):len(rs)]
+}
+
+// Missing returns the sorted ids of the way nodes and relation members
+// referenced by the indexed elements but not included in the index.
+func (idx *Index) Missing() FeatureIDs {
+	missing := make(map[FeatureID]struct{})
+	for _, w := range idx.ways {
+		for _, wn := range w.Nodes {
+			if idx.nodes[wn.ID] == nil {
+				missing[wn.FeatureID()] = struct{}{}
+			}
+		}
+	}
+
+	for _, r := range idx.relations {
+		for _, m := range r.Members {
+			fid := m.FeatureID()
+			if idx.Feature(fid) == nil {
+				missing[fid] = struct{}{}
+			}
+		}
+	}
+
+	result := make(FeatureIDs, 0, len(missing))
+	for fid := range missing {
+		result = append(result, fid)
+	}
+	result.Sort()
+
+	return result
+}
+
+// Complete returns true if all the way nodes and relation
+// members are included in the index.
+func (idx *Index) Complete() bool {
+	for _, w := range idx.ways {
+		for _, wn := range w.Nodes {
+			if idx.nodes[wn.ID] == nil {
+				return false
+			}
+		}
+	}
+
+	for _, r := range idx.relations {
+		for _, m := range r.Members {
+			if idx.Feature(m.FeatureID()) == nil {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// FetchMissing will add the latest visible version of the missing references
+// from the datasource. This is repeated for the references of the added
+// elements, e.g. the nodes of a missing way member. Returns the ids that are
+// still missing because they were not found or are deleted.
+func (idx *Index) FetchMissing(ctx context.Context, ds HistoryDatasourcer) (FeatureIDs, error) {
+	notFound := make(map[FeatureID]struct{})
+	for {
+		added := false
+
+		for _, fid := range idx.Missing() {
+			if _, ok := notFound[fid]; ok {
+				continue
+			}
+
+			e, err := latestVisible(ctx, ds, fid)
+			if err != nil && !ds.NotFound(err) {
+				return nil, err
+			}
+
+			if e == nil {
+				notFound[fid] = struct{}{}
+				continue
+			}
+
+			idx.Add(e)
+			added = true
+		}
+
+		if !added {
+			break
+		}
+	}
+
+	return idx.Missing(), nil
+}
+
+func latestVisible(ctx context.Context, ds HistoryDatasourcer, fid FeatureID) (Element, error) {
+	switch fid.Type() {
+	case TypeNode:
+		ns, err := ds.NodeHistory(ctx, fid.NodeID())
+		if err != nil {
+			return nil, err
+		}
+
+		var latest *Node
+		for _, n := range ns {
+			if latest == nil || n.Version > latest.Version {
+				latest = n
+			}
+		}
+
+		if latest != nil && latest.Visible {
+			return latest, nil
+		}
+	case TypeWay:
+		ws, err := ds.WayHistory(ctx, fid.WayID())
+		if err != nil {
+			return nil, err
+		}
+
+		var latest *Way
+		for _, w := range ws {
+			if latest == nil || w.Version > latest.Version {
+				latest = w
+			}
+		}
+
+		if latest != nil && latest.Visible {
+			return latest, nil
+		}
+	case TypeRelation:
+		rs, err := ds.RelationHistory(ctx, fid.RelationID())
+		if err != nil {
+			return nil, err
+		}
+
+		var latest *Relation
+		for _, r := range rs {
+			if latest == nil || r.Version > latest.Version {
+				latest = r
+			}
+		}
+
+		if latest != nil && latest.Visible {
+			return latest, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// ScanMissing will read the scanner and add the missing references.
+// If the stream has multiple versions of an element the highest is used.
+// Since the scanner is read once, the references of the added elements
+// are only found if they come later in the stream, e.g. member relations
+// with a larger id. The nodes of added ways will still be missing and a
+// second scan is required. Returns the ids that are still missing.
+// The scanner is not closed.
+func (idx *Index) ScanMissing(s Scanner) (FeatureIDs, error) {
+	missing := make(map[FeatureID]struct{})
+	for _, fid := range idx.Missing() {
+		missing[fid] = struct{}{}
+	}
+
+	// the version of the elements added by this scan
+	added := make(map[FeatureID]int)
+
+	for s.Scan() {
+		e, ok := s.Object().(Element)
+		if !ok {
+			continue
+		}
+
+		fid := e.FeatureID()
+		v := e.ElementID().Version()
+		if _, ok := missing[fid]; ok {
+			delete(missing, fid)
+		} else if av, ok := added[fid]; !ok || v <= av {
+			continue
+		}
+
+		idx.Add(e)
+		added[fid] = v
+
+		if r, ok := e.(*Relation); ok {
+			for _, m := range r.Members {
+				if idx.Feature(m.FeatureID()) == nil {
+					missing[m.FeatureID()] = struct{}{}
+				}
+			}
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return idx.Missing(), nil
+}
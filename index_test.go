@@ -0,0 +1,232 @@
+package osm
+
+import (
+	"context"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	o := &OSM{
+		Nodes: Nodes{
+			{ID: 1, Version: 1},
+			{ID: 2, Version: 1},
+			{ID: 2, Version: 2},
+		},
+		Ways: Ways{
+			{ID: 1, Version: 1, Nodes: WayNodes{{ID: 1}, {ID: 2}, {ID: 1}}},
+			{ID: 2, Version: 1, Nodes: WayNodes{{ID: 2}, {ID: 3}}},
+		},
+		Relations: Relations{
+			{ID: 1, Version: 1, Members: Members{
+				{Type: TypeWay, Ref: 1},
+				{Type: TypeWay, Ref: 1},
+				{Type: TypeNode, Ref: 4},
+				{Type: TypeRelation, Ref: 2},
+			}},
+		},
+	}
+
+	idx := NewIndex(o)
+
+	t.Run("lookups", func(t *testing.T) {
+		if n := idx.Node(2); n.Version != 2 {
+			t.Errorf("should return latest version: %v", n)
+		}
+
+		if e := idx.Element(NodeID(2).ElementID(1)); e != o.Nodes[1] {
+			t.Errorf("incorrect element: %v", e)
+		}
+
+		if e := idx.Feature(WayID(2).FeatureID()); e != o.Ways[1] {
+			t.Errorf("incorrect feature: %v", e)
+		}
+
+		if e := idx.Feature(RelationID(2).FeatureID()); e != nil {
+			t.Errorf("should not find feature: %v", e)
+		}
+	})
+
+	t.Run("reverse lookups", func(t *testing.T) {
+		if ws := idx.NodeWays(1); len(ws) != 1 || ws[0].ID != 1 {
+			t.Errorf("incorrect node ways: %v", ws)
+		}
+
+		if ws := idx.NodeWays(2); len(ws) != 2 {
+			t.Errorf("incorrect node ways: %v", ws)
+		}
+
+		if rs := idx.MemberRelations(WayID(1).FeatureID()); len(rs) != 1 {
+			t.Errorf("incorrect member relations: %v", rs)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if idx.Complete() {
+			t.Errorf("should not be complete")
+		}
+
+		expected := FeatureIDs{
+			NodeID(3).FeatureID(),
+			NodeID(4).FeatureID(),
+			RelationID(2).FeatureID(),
+		}
+
+		missing := idx.Missing()
+		if len(missing) != len(expected) {
+			t.Fatalf("incorrect missing: %v", missing)
+		}
+
+		for i := range expected {
+			if missing[i] != expected[i] {
+				t.Errorf("incorrect missing: %v", missing)
+			}
+		}
+	})
+
+	t.Run("newer version replaces reverse lookups", func(t *testing.T) {
+		idx := NewIndex(&OSM{Ways: Ways{{ID: 1, Version: 1, Nodes: WayNodes{{ID: 1}}}}})
+		idx.Add(&Way{ID: 1, Version: 2, Nodes: WayNodes{{ID: 2}}})
+
+		if ws := idx.NodeWays(1); len(ws) != 0 {
+			t.Errorf("should remove old version: %v", ws)
+		}
+
+		if ws := idx.NodeWays(2); len(ws) != 1 {
+			t.Errorf("should add new version: %v", ws)
+		}
+
+		if l := len(idx.OSM().Ways); l != 2 {
+			t.Errorf("should append to container: %v", l)
+		}
+	})
+}
+
+func TestIndex_FetchMissing(t *testing.T) {
+	ctx := context.Background()
+
+	history := &OSM{
+		Nodes: Nodes{
+			{ID: 3, Version: 1, Visible: true},
+			{ID: 4, Version: 1, Visible: true},
+			{ID: 4, Version: 2, Visible: false},
+			{ID: 5, Version: 1, Visible: true},
+		},
+		Relations: Relations{
+			{ID: 2, Version: 1, Visible: true, Members: Members{{Type: TypeNode, Ref: 5}}},
+		},
+	}
+
+	idx := NewIndex(&OSM{
+		Ways: Ways{{ID: 1, Nodes: WayNodes{{ID: 3}, {ID: 4}}}},
+		Relations: Relations{
+			{ID: 1, Members: Members{{Type: TypeRelation, Ref: 2}, {Type: TypeNode, Ref: 6}}},
+		},
+	})
+
+	missing, err := idx.FetchMissing(ctx, history.HistoryDatasource())
+	if err != nil {
+		t.Fatalf("fetch error: %v", err)
+	}
+
+	if len(missing) != 2 || missing[0] != NodeID(4).FeatureID() || missing[1] != NodeID(6).FeatureID() {
+		t.Errorf("incorrect missing: %v", missing)
+	}
+
+	if idx.Node(5) == nil || idx.Relation(2) == nil {
+		t.Errorf("should add references of fetched elements")
+	}
+}
+
+type sliceScanner struct {
+	objects Objects
+	offset  int
+}
+
+func (s *sliceScanner) Scan() bool     { s.offset++; return s.offset <= len(s.objects) }
+func (s *sliceScanner) Object() Object { return s.objects[s.offset-1] }
+func (s *sliceScanner) Err() error     { return nil }
+func (s *sliceScanner) Close() error   { return nil }
+
+func TestIndex_ScanMissing(t *testing.T) {
+	idx := NewIndex(&OSM{
+		Relations: Relations{
+			{ID: 1, Members: Members{{Type: TypeRelation, Ref: 2}}},
+		},
+	})
+
+	s := &sliceScanner{objects: Objects{
+		&Node{ID: 1},
+		&Way{ID: 1, Nodes: WayNodes{{ID: 1}}},
+		&Relation{ID: 2, Members: Members{{Type: TypeWay, Ref: 1}, {Type: TypeRelation, Ref: 3}}},
+		&Relation{ID: 3},
+	}}
+
+	missing, err := idx.ScanMissing(s)
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	if len(missing) != 1 || missing[0] != WayID(1).FeatureID() {
+		t.Errorf("incorrect missing: %v", missing)
+	}
+
+	if idx.Relation(3) == nil {
+		t.Errorf("should find later relation")
+	}
+}
+
+func TestIndex_ScanMissing_latestVersion(t *testing.T) {
+	idx := NewIndex(&OSM{
+		Ways: Ways{{ID: 1, Nodes: WayNodes{{ID: 1}}}},
+	})
+
+	s := &sliceScanner{objects: Objects{
+		&Node{ID: 1, Version: 1, Lat: 1},
+		&Node{ID: 1, Version: 3, Lat: 3},
+		&Node{ID: 1, Version: 2, Lat: 2},
+	}}
+
+	missing, err := idx.ScanMissing(s)
+	if err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	if len(missing) != 0 {
+		t.Errorf("incorrect missing: %v", missing)
+	}
+
+	if n := idx.Node(1); n == nil || n.Version != 3 {
+		t.Errorf("should use the highest version: %v", n)
+	}
+}
+
+func TestIndex_reverseLookupCopy(t *testing.T) {
+	w1 := &Way{ID: 1, Version: 1, Nodes: WayNodes{{ID: 1}}}
+	w2 := &Way{ID: 2, Version: 1, Nodes: WayNodes{{ID: 1}}}
+	r1 := &Relation{ID: 1, Version: 1, Members: Members{{Type: TypeNode, Ref: 1}}}
+	r2 := &Relation{ID: 2, Version: 1, Members: Members{{Type: TypeNode, Ref: 1}}}
+
+	idx := NewIndex(&OSM{Ways: Ways{w1, w2}, Relations: Relations{r1, r2}})
+
+	ways := idx.NodeWays(1)
+	relations := idx.MemberRelations(NodeID(1).FeatureID())
+
+	idx.Add(&Way{ID: 1, Version: 2, Nodes: WayNodes{{ID: 2}}})
+	idx.Add(&Relation{ID: 1, Version: 2})
+
+	if len(ways) != 2 || ways[0] != w1 || ways[1] != w2 {
+		t.Errorf("returned ways were modified: %v", ways)
+	}
+
+	if len(relations) != 2 || relations[0] != r1 || relations[1] != r2 {
+		t.Errorf("returned relations were modified: %v", relations)
+	}
+
+	if ws := idx.NodeWays(1); len(ws) != 1 || ws[0] != w2 {
+		t.Errorf("incorrect node ways: %v", ws)
+	}
+
+	if rs := idx.MemberRelations(NodeID(1).FeatureID()); len(rs) != 1 || rs[0] != r2 {
+		t.Errorf("incorrect member relations: %v", rs)
+	}
+}
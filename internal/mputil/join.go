@@ -2,6 +2,18 @@ package mputil
 
 // Join will join a set of segments into a set of connected MultiSegments.
 func Join(segments []Segment) []MultiSegment {
+	return join(segments, false)
+}
+
+// JoinDirected will join a set of segments into a set of connected
+// MultiSegments without reversing any of the segments. The end of a segment
+// is only joined to the start of another, e.g. for coastlines where the
+// direction of the ways matters.
+func JoinDirected(segments []Segment) []MultiSegment {
+	return join(segments, true)
+}
+
+func join(segments []Segment, directed bool) []MultiSegment {
 	lists := []MultiSegment{}
 	segments = compact(segments)
 
@@ -26,7 +38,7 @@ func Join(segments []Segment) []MultiSegment {
 					current = append(current, segment)
 					foundAt = i
 					break
-				} else if last.Equal(segment.Last()) {
+				} else if !directed && last.Equal(segment.Last()) {
 					// reverse it and it'll fit at the end
 					segment.Reverse()
 
@@ -41,7 +53,7 @@ func Join(segments []Segment) []MultiSegment {
 
 					foundAt = i
 					break
-				} else if first.Equal(segment.First()) {
+				} else if !directed && first.Equal(segment.First()) {
 					// reverse it and it'll fit at the start
 					segment.Reverse()
 
@@ -305,6 +305,27 @@ func TestJoin_lineString_danglingLine(t *testing.T) {
 	}
 }
 
+func TestJoinDirected(t *testing.T) {
+	input := []Segment{
+		{Index: 0, Line: orb.LineString{{1, 1}, {2, 2}}},
+		{Index: 1, Line: orb.LineString{{0, 0}, {1, 1}}},
+		{Index: 2, Line: orb.LineString{{3, 3}, {2, 2}}}, // wrong direction
+	}
+
+	expected := []MultiSegment{
+		{
+			{Index: 2, Line: orb.LineString{{3, 3}, {2, 2}}},
+		},
+		{
+			{Index: 1, Line: orb.LineString{{0, 0}, {1, 1}}},
+			{Index: 0, Line: orb.LineString{{2, 2}}},
+		},
+	}
+
+	result := JoinDirected(input)
+	compareMultiSegment(t, result, expected)
+}
+
 func compareMultiSegment(t testing.TB, result, expected []MultiSegment) {
 	t.Helper()
 
@@ -0,0 +1,89 @@
+// Package osmutil contains the helpers shared by the packages that
+// read the osm data in several passes to build way geometry.
+package osmutil
+
+import (
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+)
+
+// Scan opens a new scanner, calls the function with every object
+// and closes the scanner.
+func Scan(open func() (osm.Scanner, error), fn func(osm.Object)) error {
+	s, err := open()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	for s.Scan() {
+		fn(s.Object())
+	}
+
+	return s.Err()
+}
+
+// Locations are the node locations needed to annotate a set of ways.
+type Locations map[osm.NodeID]orb.Point
+
+// Add marks the locations of the way nodes as needed.
+func (l Locations) Add(nodes osm.WayNodes) {
+	for _, n := range nodes {
+		// NaN marks the node locations needed
+		l[n.ID] = orb.Point{math.NaN(), math.NaN()}
+	}
+}
+
+// Load reads the needed node locations in one pass over the data.
+func (l Locations) Load(open func() (osm.Scanner, error)) error {
+	return Scan(open, func(o osm.Object) {
+		n, ok := o.(*osm.Node)
+		if !ok {
+			return
+		}
+
+		if _, ok := l[n.ID]; ok {
+			l[n.ID] = n.Point()
+		}
+	})
+}
+
+// WayNodes returns a copy of the way nodes annotated with the loaded
+// locations. Nodes without a location are skipped.
+func (l Locations) WayNodes(nodes osm.WayNodes) osm.WayNodes {
+	result := make(osm.WayNodes, 0, len(nodes))
+	for _, wn := range nodes {
+		p, ok := l[wn.ID]
+		if !ok || math.IsNaN(p[0]) {
+			continue
+		}
+
+		wn.Lon, wn.Lat = p[0], p[1]
+		result = append(result, wn)
+	}
+
+	return result
+}
+
+// IndexWayNodes returns a copy of the way nodes where the nodes that
+// are not annotated get their location from the index.
+// Nodes not in the index are skipped.
+func IndexWayNodes(idx *osm.Index, nodes osm.WayNodes) osm.WayNodes {
+	result := make(osm.WayNodes, 0, len(nodes))
+	for _, wn := range nodes {
+		if wn.Lat == 0 && wn.Lon == 0 {
+			n := idx.Node(wn.ID)
+			if n == nil {
+				continue
+			}
+
+			wn.Lat, wn.Lon = n.Lat, n.Lon
+		}
+
+		result = append(result, wn)
+	}
+
+	return result
+}
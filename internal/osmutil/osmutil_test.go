@@ -0,0 +1,61 @@
+package osmutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+)
+
+func TestLocations(t *testing.T) {
+	objects := osm.Objects{
+		&osm.Node{ID: 1, Lat: 1, Lon: 2},
+		&osm.Node{ID: 2, Lat: 3, Lon: 4},
+		&osm.Node{ID: 3, Lat: 5, Lon: 6},
+	}
+
+	open := func() (osm.Scanner, error) {
+		return osmtest.NewScanner(objects), nil
+	}
+
+	locations := make(Locations)
+	locations.Add(osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 4}})
+	if err := locations.Load(open); err != nil {
+		t.Fatalf("load error: %v", err)
+	}
+
+	if _, ok := locations[3]; ok {
+		t.Errorf("should only load the needed locations")
+	}
+
+	nodes := locations.WayNodes(osm.WayNodes{{ID: 1}, {ID: 4}, {ID: 2}, {ID: 3}})
+	expected := osm.WayNodes{{ID: 1, Lat: 1, Lon: 2}, {ID: 2, Lat: 3, Lon: 4}}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("incorrect nodes: %v", nodes)
+	}
+
+	t.Run("open error", func(t *testing.T) {
+		err := errors.New("some error")
+		open := func() (osm.Scanner, error) {
+			return nil, err
+		}
+
+		if e := locations.Load(open); e != err {
+			t.Errorf("incorrect error: %v", e)
+		}
+	})
+}
+
+func TestIndexWayNodes(t *testing.T) {
+	idx := osm.NewIndex(&osm.OSM{
+		Nodes: osm.Nodes{{ID: 1, Lat: 1, Lon: 2}},
+	})
+
+	nodes := IndexWayNodes(idx, osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3, Lat: 5, Lon: 6}})
+	expected := osm.WayNodes{{ID: 1, Lat: 1, Lon: 2}, {ID: 3, Lat: 5, Lon: 6}}
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Errorf("incorrect nodes: %v", nodes)
+	}
+}
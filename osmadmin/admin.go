@@ -0,0 +1,327 @@
+// Package osmadmin builds the hierarchy of administrative boundaries, e.g.
+// country, state and city, from boundary=administrative relations and
+// finds the areas that contain a point. The hierarchy can be saved in a
+// compact binary form so it only needs to be built from the osm data once.
+package osmadmin
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/internal/osmutil"
+	"github.com/paulmach/osm/osmspatial"
+)
+
+// An Area is an administrative boundary.
+type Area struct {
+	ID         osm.RelationID
+	AdminLevel int
+	Tags       osm.Tags
+
+	// Geometry is the multipolygon assembled from the outer
+	// and inner member ways of the relation.
+	Geometry orb.MultiPolygon
+
+	// Parent is the area with the closest lower admin level that contains
+	// this area. It is nil for the top level areas, usually countries.
+	Parent   *Area
+	Children []*Area
+
+	area float64
+}
+
+// Name returns the value of the name tag.
+func (a *Area) Name() string {
+	return a.Tags.Find("name")
+}
+
+// Hierarchy is the set of administrative areas with their parent/child
+// relationships and a spatial index for point lookups.
+type Hierarchy struct {
+	// Areas are sorted by admin level and then id.
+	Areas []*Area
+
+	maxAdminLevel int
+
+	byID  map[osm.RelationID]*Area
+	index *osmspatial.Index
+}
+
+// New creates the hierarchy from the boundary=administrative relations
+// in the osm data. The member way geometry comes from the annotated
+// member ways or the ways and nodes in the data.
+func New(o *osm.OSM, opts ...Option) (*Hierarchy, error) {
+	h, err := newHierarchy(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := osm.NewIndex(o)
+	wayNodes := func(id osm.WayID) osm.WayNodes {
+		w := idx.Way(id)
+		if w == nil {
+			return nil
+		}
+
+		return osmutil.IndexWayNodes(idx, w.Nodes)
+	}
+
+	var areas []*Area
+	for _, r := range o.Relations {
+		if a := h.newArea(r, wayNodes); a != nil {
+			areas = append(areas, a)
+		}
+	}
+
+	if err := h.setAreas(areas); err != nil {
+		return nil, err
+	}
+
+	h.buildHierarchy()
+	return h, nil
+}
+
+// Build creates the hierarchy by reading the data three times, using the
+// open function to get a new scanner each time. The first pass reads the
+// boundary relations, the second their member ways and the last the node
+// locations of those ways. Only the data needed is kept in memory so it
+// works with large files, for example:
+//
+//	h, err := osmadmin.Build(func() (osm.Scanner, error) {
+//		f, err := os.Open("planet-latest.osm.pbf")
+//		if err != nil {
+//			return nil, err
+//		}
+//
+//		return osmpbf.New(context.Background(), f, 4), nil
+//	})
+//
+// The scanners are closed after each pass.
+func Build(open func() (osm.Scanner, error), opts ...Option) (*Hierarchy, error) {
+	h, err := newHierarchy(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var relations osm.Relations
+	ways := make(map[osm.WayID]osm.WayNodes)
+	err = osmutil.Scan(open, func(o osm.Object) {
+		r, ok := o.(*osm.Relation)
+		if !ok || !h.isAdmin(r) {
+			return
+		}
+
+		relations = append(relations, r)
+		for _, m := range r.Members {
+			if m.Type == osm.TypeWay {
+				ways[osm.WayID(m.Ref)] = nil
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make(osmutil.Locations)
+	err = osmutil.Scan(open, func(o osm.Object) {
+		w, ok := o.(*osm.Way)
+		if !ok {
+			return
+		}
+
+		if _, ok := ways[w.ID]; ok {
+			ways[w.ID] = w.Nodes
+			locations.Add(w.Nodes)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := locations.Load(open); err != nil {
+		return nil, err
+	}
+
+	wayNodes := func(id osm.WayID) osm.WayNodes {
+		return locations.WayNodes(ways[id])
+	}
+
+	var areas []*Area
+	for _, r := range relations {
+		if a := h.newArea(r, wayNodes); a != nil {
+			areas = append(areas, a)
+		}
+	}
+
+	if err := h.setAreas(areas); err != nil {
+		return nil, err
+	}
+
+	h.buildHierarchy()
+	return h, nil
+}
+
+func newHierarchy(opts []Option) (*Hierarchy, error) {
+	h := &Hierarchy{}
+	for _, opt := range opts {
+		if err := opt(h); err != nil {
+			return nil, err
+		}
+	}
+
+	return h, nil
+}
+
+// isAdmin returns true if the relation is an administrative boundary
+// with a valid admin level.
+func (h *Hierarchy) isAdmin(r *osm.Relation) bool {
+	if r.Tags.Find("boundary") != "administrative" {
+		return false
+	}
+
+	level, ok := adminLevel(r.Tags)
+	if !ok {
+		return false
+	}
+
+	return h.maxAdminLevel == 0 || level <= h.maxAdminLevel
+}
+
+func adminLevel(tags osm.Tags) (int, bool) {
+	level, err := strconv.Atoi(tags.Find("admin_level"))
+	if err != nil || level < 1 {
+		return 0, false
+	}
+
+	return level, true
+}
+
+// newArea assembles the area, the way nodes function is used for the
+// way members that are not annotated. Returns nil if the relation is not
+// an admin boundary or there is no valid multipolygon.
+func (h *Hierarchy) newArea(r *osm.Relation, wayNodes func(osm.WayID) osm.WayNodes) *Area {
+	if !h.isAdmin(r) {
+		return nil
+	}
+
+	// a copy with the member ways annotated for the multipolygon assembly
+	relation := &osm.Relation{
+		ID:      r.ID,
+		Tags:    osm.Tags{{Key: "type", Value: "boundary"}},
+		Members: make(osm.Members, 0, len(r.Members)),
+	}
+
+	for _, m := range r.Members {
+		if m.Type != osm.TypeWay {
+			continue
+		}
+
+		if len(m.Nodes) == 0 {
+			m.Nodes = wayNodes(osm.WayID(m.Ref))
+		}
+
+		relation.Members = append(relation.Members, m)
+	}
+
+	mp, ok := relation.Geometry().(orb.MultiPolygon)
+	if !ok || len(mp) == 0 {
+		return nil
+	}
+
+	level, _ := adminLevel(r.Tags)
+	return &Area{
+		ID:         r.ID,
+		AdminLevel: level,
+		Tags:       r.Tags,
+		Geometry:   mp,
+	}
+}
+
+// setAreas sorts the areas and creates the lookup index.
+func (h *Hierarchy) setAreas(areas []*Area) error {
+	sort.Slice(areas, func(i, j int) bool {
+		if areas[i].AdminLevel != areas[j].AdminLevel {
+			return areas[i].AdminLevel < areas[j].AdminLevel
+		}
+
+		return areas[i].ID < areas[j].ID
+	})
+
+	h.Areas = areas
+	h.byID = make(map[osm.RelationID]*Area, len(areas))
+
+	entries := make([]osmspatial.Entry, 0, len(areas))
+	for _, a := range areas {
+		a.area = osm.Area(a.Geometry)
+		h.byID[a.ID] = a
+		entries = append(entries, osmspatial.Entry{
+			Element:  &osm.Relation{ID: a.ID, Tags: a.Tags},
+			Geometry: a.Geometry,
+		})
+	}
+
+	index, err := osmspatial.FromEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	h.index = index
+	return nil
+}
+
+// buildHierarchy sets the parent of each area to the containing area
+// with the highest lower admin level, or the smallest one if there are
+// several. Containment is tested using the label point of the area.
+func (h *Hierarchy) buildHierarchy() {
+	for _, a := range h.Areas {
+		a.Parent = nil
+		a.Children = nil
+	}
+
+	for _, a := range h.Areas {
+		var parent *Area
+		for _, c := range h.Lookup(osm.LabelPoint(a.Geometry)) {
+			if c.AdminLevel >= a.AdminLevel {
+				break
+			}
+
+			parent = c
+		}
+
+		h.setParent(a, parent)
+	}
+}
+
+func (h *Hierarchy) setParent(a, parent *Area) {
+	a.Parent = parent
+	if parent != nil {
+		parent.Children = append(parent.Children, a)
+	}
+}
+
+// Area returns the area for the relation id, or nil if not found.
+func (h *Hierarchy) Area(id osm.RelationID) *Area {
+	return h.byID[id]
+}
+
+// Lookup returns the areas that contain the point, ordered from the lowest
+// admin level, usually the country, to the highest. Areas with the same
+// admin level are ordered from largest to smallest.
+func (h *Hierarchy) Lookup(p orb.Point) []*Area {
+	var result []*Area
+	for _, e := range h.index.Containing(p) {
+		result = append(result, h.byID[e.(*osm.Relation).ID])
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].AdminLevel != result[j].AdminLevel {
+			return result[i].AdminLevel < result[j].AdminLevel
+		}
+
+		return result[i].area > result[j].area
+	})
+
+	return result
+}
@@ -0,0 +1,181 @@
+package osmadmin
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+)
+
+// adds a square way from x,y with the size and returns the way id.
+func addSquare(o *osm.OSM, id osm.WayID, x, y, size float64) osm.WayID {
+	nid := osm.NodeID(id * 10)
+	points := []orb.Point{{x, y}, {x + size, y}, {x + size, y + size}, {x, y + size}}
+
+	w := &osm.Way{ID: id}
+	for i, p := range points {
+		o.Nodes = append(o.Nodes, &osm.Node{ID: nid + osm.NodeID(i), Lon: p[0], Lat: p[1]})
+		w.Nodes = append(w.Nodes, osm.WayNode{ID: nid + osm.NodeID(i)})
+	}
+	w.Nodes = append(w.Nodes, w.Nodes[0])
+	o.Ways = append(o.Ways, w)
+
+	return id
+}
+
+func admin(id osm.RelationID, level, name string, members ...osm.Member) *osm.Relation {
+	return &osm.Relation{
+		ID: id,
+		Tags: osm.Tags{
+			{Key: "admin_level", Value: level},
+			{Key: "boundary", Value: "administrative"},
+			{Key: "name", Value: name},
+			{Key: "type", Value: "boundary"},
+		},
+		Members: members,
+	}
+}
+
+func outer(id osm.WayID) osm.Member {
+	return osm.Member{Type: osm.TypeWay, Ref: int64(id), Role: "outer"}
+}
+
+func testData() *osm.OSM {
+	o := &osm.OSM{}
+	addSquare(o, 1, 1, 1, 10)    // country
+	addSquare(o, 2, 1, 1, 5)     // state west
+	addSquare(o, 3, 6, 1, 5)     // state east
+	addSquare(o, 4, 2, 2, 2)     // city in the west
+	addSquare(o, 5, 2.5, 2.5, 1) // city hole
+	addSquare(o, 6, 20, 20, 1)   // other country
+
+	o.Relations = osm.Relations{
+		admin(8, "8", "City", outer(4), osm.Member{Type: osm.TypeWay, Ref: 5, Role: "inner"}),
+		admin(1, "2", "Country", outer(1)),
+		admin(2, "4", "West", outer(2)),
+		admin(3, "4", "East", outer(3)),
+		admin(6, "2", "Other", outer(6)),
+		admin(9, "not a number", "Invalid", outer(6)),
+		{ID: 10, Tags: osm.Tags{{Key: "type", Value: "multipolygon"}}, Members: osm.Members{outer(1)}},
+	}
+
+	return o
+}
+
+func names(areas []*Area) []string {
+	var result []string
+	for _, a := range areas {
+		result = append(result, a.Name())
+	}
+
+	return result
+}
+
+func TestNew(t *testing.T) {
+	h, err := New(testData())
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	expected := []string{"Country", "Other", "West", "East", "City"}
+	if v := names(h.Areas); !reflect.DeepEqual(v, expected) {
+		t.Errorf("incorrect areas: %v", v)
+	}
+
+	checkHierarchy(t, h)
+}
+
+func checkHierarchy(t *testing.T, h *Hierarchy) {
+	t.Helper()
+
+	country := h.Area(1)
+	if country == nil || country.Parent != nil {
+		t.Fatalf("incorrect country: %v", country)
+	}
+
+	if v := names(country.Children); !reflect.DeepEqual(v, []string{"West", "East"}) {
+		t.Errorf("incorrect children: %v", v)
+	}
+
+	city := h.Area(8)
+	if city.Parent != h.Area(2) || city.AdminLevel != 8 || len(city.Geometry[0]) != 2 {
+		t.Errorf("incorrect city: %+v", city)
+	}
+
+	cases := []struct {
+		point orb.Point
+		names []string
+	}{
+		{orb.Point{2.1, 2.1}, []string{"Country", "West", "City"}},
+		{orb.Point{3, 3}, []string{"Country", "West"}}, // in the hole
+		{orb.Point{8, 3}, []string{"Country", "East"}},
+		{orb.Point{20.5, 20.5}, []string{"Other"}},
+		{orb.Point{50, 50}, nil},
+	}
+
+	for _, tc := range cases {
+		if v := names(h.Lookup(tc.point)); !reflect.DeepEqual(v, tc.names) {
+			t.Errorf("incorrect lookup for %v: %v", tc.point, v)
+		}
+	}
+}
+
+func TestNew_maxAdminLevel(t *testing.T) {
+	h, err := New(testData(), MaxAdminLevel(4))
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	if v := names(h.Lookup(orb.Point{2.1, 2.1})); !reflect.DeepEqual(v, []string{"Country", "West"}) {
+		t.Errorf("incorrect lookup: %v", v)
+	}
+
+	if _, err := New(testData(), MaxAdminLevel(0)); err == nil {
+		t.Errorf("should return error for invalid level")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	o := testData()
+
+	passes := 0
+	h, err := Build(func() (osm.Scanner, error) {
+		passes++
+		return osmtest.NewScanner(o.Objects()), nil
+	})
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+
+	if passes != 3 {
+		t.Errorf("incorrect number of passes: %v", passes)
+	}
+
+	if len(h.Areas) != 5 {
+		t.Errorf("incorrect areas: %v", names(h.Areas))
+	}
+
+	checkHierarchy(t, h)
+
+	// errors are returned
+	openErr := errors.New("open error")
+	_, err = Build(func() (osm.Scanner, error) {
+		return nil, openErr
+	})
+	if err != openErr {
+		t.Errorf("incorrect error: %v", err)
+	}
+
+	scanErr := errors.New("scan error")
+	_, err = Build(func() (osm.Scanner, error) {
+		s := osmtest.NewScanner(o.Objects())
+		s.ScanError = scanErr
+		return s, nil
+	})
+	if err != scanErr {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package osmadmin
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+)
+
+// The encoded hierarchy starts with the magic bytes and a format version.
+// Each area is then written as varints: id, admin level, parent id (0 for
+// none), the tags as length prefixed strings and the multipolygon. The
+// coordinates are stored with osm's 7 decimal precision and delta encoded.
+var magic = []byte("osmadmin\x01")
+
+const (
+	coordinateScale = 1e7
+
+	// limits when reading to protect against corrupt data.
+	maxStringLength = 1 << 20
+	maxCount        = 1 << 28
+)
+
+// ErrInvalidData is returned when reading data that is not an encoded hierarchy.
+var ErrInvalidData = errors.New("osmadmin: invalid data")
+
+// WriteTo writes the hierarchy in the compact binary form to the writer.
+func (h *Hierarchy) WriteTo(w io.Writer) (int64, error) {
+	e := &encoder{w: bufio.NewWriter(w)}
+	e.write(magic)
+
+	e.uvarint(uint64(len(h.Areas)))
+	for _, a := range h.Areas {
+		e.varint(int64(a.ID))
+		e.uvarint(uint64(a.AdminLevel))
+
+		var parent int64
+		if a.Parent != nil {
+			parent = int64(a.Parent.ID)
+		}
+		e.varint(parent)
+
+		e.uvarint(uint64(len(a.Tags)))
+		for _, t := range a.Tags {
+			e.string(t.Key)
+			e.string(t.Value)
+		}
+
+		var prev [2]int64
+		e.uvarint(uint64(len(a.Geometry)))
+		for _, p := range a.Geometry {
+			e.uvarint(uint64(len(p)))
+			for _, r := range p {
+				e.uvarint(uint64(len(r)))
+				for _, point := range r {
+					x := int64(math.Round(point[0] * coordinateScale))
+					y := int64(math.Round(point[1] * coordinateScale))
+					e.varint(x - prev[0])
+					e.varint(y - prev[1])
+					prev = [2]int64{x, y}
+				}
+			}
+		}
+	}
+
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+
+	return e.n, e.err
+}
+
+// Read reads a hierarchy written by WriteTo.
+func Read(r io.Reader) (*Hierarchy, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+
+	header := make([]byte, len(magic))
+	if _, err := io.ReadFull(d.r, header); err != nil || string(header) != string(magic) {
+		return nil, ErrInvalidData
+	}
+
+	var areas []*Area
+	parents := make(map[osm.RelationID]osm.RelationID)
+
+	count := d.count()
+	for i := 0; i < count && d.err == nil; i++ {
+		a := &Area{
+			ID:         osm.RelationID(d.varint()),
+			AdminLevel: int(d.uvarint()),
+		}
+		parents[a.ID] = osm.RelationID(d.varint())
+
+		tags := d.count()
+		for j := 0; j < tags && d.err == nil; j++ {
+			a.Tags = append(a.Tags, osm.Tag{Key: d.string(), Value: d.string()})
+		}
+
+		var prev [2]int64
+		polygons := d.count()
+		for j := 0; j < polygons && d.err == nil; j++ {
+			var p orb.Polygon
+			rings := d.count()
+			for k := 0; k < rings && d.err == nil; k++ {
+				points := d.count()
+				var ring orb.Ring
+				for l := 0; l < points && d.err == nil; l++ {
+					prev[0] += d.varint()
+					prev[1] += d.varint()
+					ring = append(ring, orb.Point{
+						float64(prev[0]) / coordinateScale,
+						float64(prev[1]) / coordinateScale,
+					})
+				}
+
+				p = append(p, ring)
+			}
+
+			a.Geometry = append(a.Geometry, p)
+		}
+
+		areas = append(areas, a)
+	}
+
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	h := &Hierarchy{}
+	if err := h.setAreas(areas); err != nil {
+		return nil, err
+	}
+
+	for _, a := range areas {
+		id := parents[a.ID]
+		if id == 0 {
+			continue
+		}
+
+		parent := h.byID[id]
+		if parent == nil {
+			return nil, fmt.Errorf("osmadmin: parent %d of area %d not found", id, a.ID)
+		}
+
+		h.setParent(a, parent)
+	}
+
+	return h, nil
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) write(b []byte) {
+	if e.err != nil {
+		return
+	}
+
+	n, err := e.w.Write(b)
+	e.n += int64(n)
+	e.err = err
+}
+
+func (e *encoder) uvarint(v uint64) {
+	l := binary.PutUvarint(e.buf[:], v)
+	e.write(e.buf[:l])
+}
+
+func (e *encoder) varint(v int64) {
+	l := binary.PutVarint(e.buf[:], v)
+	e.write(e.buf[:l])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, err := binary.ReadUvarint(d.r)
+	d.setErr(err)
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	v, err := binary.ReadVarint(d.r)
+	d.setErr(err)
+	return v
+}
+
+// count reads a length and checks it is reasonable.
+func (d *decoder) count() int {
+	v := d.uvarint()
+	if v > maxCount {
+		d.setErr(ErrInvalidData)
+		return 0
+	}
+
+	return int(v)
+}
+
+func (d *decoder) string() string {
+	l := d.uvarint()
+	if l > maxStringLength {
+		d.setErr(ErrInvalidData)
+	}
+
+	if d.err != nil {
+		return ""
+	}
+
+	b := make([]byte, l)
+	_, err := io.ReadFull(d.r, b)
+	d.setErr(err)
+
+	return string(b)
+}
+
+func (d *decoder) setErr(err error) {
+	if err == nil || d.err != nil {
+		return
+	}
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	d.err = err
+}
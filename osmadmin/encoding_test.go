@@ -0,0 +1,54 @@
+package osmadmin
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestHierarchy_WriteTo(t *testing.T) {
+	h, err := New(testData())
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	n, err := h.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	if n != int64(buf.Len()) {
+		t.Errorf("incorrect length: %v != %v", n, buf.Len())
+	}
+
+	data := buf.Bytes()
+	result, err := Read(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("read error: %v", err)
+	}
+
+	if len(result.Areas) != len(h.Areas) {
+		t.Fatalf("incorrect areas: %v", names(result.Areas))
+	}
+
+	for i, a := range result.Areas {
+		e := h.Areas[i]
+		if a.ID != e.ID || a.AdminLevel != e.AdminLevel || !reflect.DeepEqual(a.Tags, e.Tags) {
+			t.Errorf("incorrect area: %+v", a)
+		}
+
+		if !reflect.DeepEqual(a.Geometry, e.Geometry) {
+			t.Errorf("incorrect geometry: %v != %v", a.Geometry, e.Geometry)
+		}
+	}
+
+	checkHierarchy(t, result)
+
+	// truncated data
+	for _, l := range []int{0, 5, len(data) / 2, len(data) - 1} {
+		if _, err := Read(bytes.NewReader(data[:l])); err == nil {
+			t.Errorf("should return error for truncated data: %d", l)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package osmadmin
+
+import "errors"
+
+// Option is a parameter that can be used when building the hierarchy.
+type Option func(*Hierarchy) error
+
+// MaxAdminLevel skips the boundaries with a higher admin level, for example
+// 8 to include down to the municipality level in most countries. By default
+// all levels are included.
+func MaxAdminLevel(level int) Option {
+	return func(h *Hierarchy) error {
+		if level < 1 {
+			return errors.New("osmadmin: max admin level must be at least 1")
+		}
+
+		h.maxAdminLevel = level
+		return nil
+	}
+}
@@ -0,0 +1,363 @@
+// Package osmcoast assembles natural=coastline ways into rings and land
+// polygons. Coastline ways are drawn with the land on the left, so closed
+// counter-clockwise rings are islands or continents and clockwise rings
+// are water inside the land, e.g. a lagoon or an inland sea.
+//
+// Coastlines are often split across extracts. Duplicate ways are ignored,
+// small gaps between the end of one coastline and the start of another
+// are repaired and anything that can't be closed is reported. The land
+// for a bound or tile grid includes the unclosed coastlines that cross
+// it, they are closed along the edges of the bound.
+package osmcoast
+
+import (
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/internal/mputil"
+	"github.com/paulmach/osm/internal/osmutil"
+)
+
+// Coastline is the result of assembling a set of coastline ways.
+type Coastline struct {
+	// Rings are the closed coastlines, both land and water.
+	Rings []*Ring
+
+	// Unclosed are the coastlines that could not be closed into a ring.
+	// These are usually at the edge of an extract or where ways are missing.
+	Unclosed []*Line
+
+	// Repairs are the gaps that were closed, see the MaxGap option.
+	Repairs []*Repair
+
+	// Land are the land polygons built from the rings. The counter-clockwise
+	// rings are the outers and the clockwise rings the holes. It does not
+	// include the land of the unclosed coastlines, use LandPolygons for that.
+	Land orb.MultiPolygon
+
+	// water are the clockwise rings not inside any land ring,
+	// they are holes in the land of the unclosed coastlines.
+	water []orb.Ring
+}
+
+// A Ring is a closed coastline and the ways it was built from.
+type Ring struct {
+	Ring   orb.Ring
+	WayIDs []osm.WayID
+}
+
+// Land returns true if the ring is counter-clockwise, i.e. the land
+// is on the inside of the ring.
+func (r *Ring) Land() bool {
+	return r.Ring.Orientation() == orb.CCW
+}
+
+// A Line is a coastline that could not be closed into a ring.
+type Line struct {
+	LineString orb.LineString
+	WayIDs     []osm.WayID
+}
+
+// A Repair is a gap between the end of one way and the start of another,
+// or the same, way that was closed.
+type Repair struct {
+	From osm.WayID
+	To   osm.WayID
+
+	// Gap is the line added to close the gap.
+	Gap orb.LineString
+
+	// Distance is the length of the gap in meters.
+	Distance float64
+}
+
+type assembler struct {
+	maxGap float64
+}
+
+// New assembles the natural=coastline ways in the osm data. Way nodes
+// that are not annotated get their location from the nodes in the data.
+func New(o *osm.OSM, opts ...Option) (*Coastline, error) {
+	a, err := newAssembler(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	idx := osm.NewIndex(o)
+	var ways osm.Ways
+	for _, w := range o.Ways {
+		if !isCoastline(w) {
+			continue
+		}
+
+		way := *w
+		way.Nodes = osmutil.IndexWayNodes(idx, w.Nodes)
+		ways = append(ways, &way)
+	}
+
+	return a.assemble(ways), nil
+}
+
+// Build assembles the coastline by reading the data twice, using the
+// open function to get a new scanner each time. The first pass reads the
+// coastline ways and the second the node locations of those ways.
+// Only the data needed is kept in memory so it works with large files,
+// for example:
+//
+//	c, err := osmcoast.Build(func() (osm.Scanner, error) {
+//		f, err := os.Open("planet-latest.osm.pbf")
+//		if err != nil {
+//			return nil, err
+//		}
+//
+//		return osmpbf.New(context.Background(), f, 4), nil
+//	})
+//
+// The scanners are closed after each pass.
+func Build(open func() (osm.Scanner, error), opts ...Option) (*Coastline, error) {
+	a, err := newAssembler(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var ways osm.Ways
+	locations := make(osmutil.Locations)
+	err = osmutil.Scan(open, func(o osm.Object) {
+		w, ok := o.(*osm.Way)
+		if !ok || !isCoastline(w) {
+			return
+		}
+
+		ways = append(ways, w)
+		locations.Add(w.Nodes)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := locations.Load(open); err != nil {
+		return nil, err
+	}
+
+	for _, w := range ways {
+		w.Nodes = locations.WayNodes(w.Nodes)
+	}
+
+	return a.assemble(ways), nil
+}
+
+func newAssembler(opts []Option) (*assembler, error) {
+	a := &assembler{maxGap: 1}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+func isCoastline(w *osm.Way) bool {
+	return w.Tags.Find("natural") == "coastline"
+}
+
+// chain is a continuous section of coastline.
+type chain struct {
+	line   orb.LineString
+	wayIDs []osm.WayID
+}
+
+func (a *assembler) assemble(ways osm.Ways) *Coastline {
+	ways = dedup(ways)
+
+	segments := make([]mputil.Segment, 0, len(ways))
+	for i, w := range ways {
+		segments = append(segments, mputil.Segment{
+			Index: uint32(i),
+			Line:  w.LineString(),
+		})
+	}
+
+	c := &Coastline{}
+
+	var chains []*chain
+	for _, ms := range mputil.JoinDirected(segments) {
+		ch := &chain{line: ms.LineString()}
+		for _, s := range ms {
+			ch.wayIDs = append(ch.wayIDs, ways[s.Index].ID)
+		}
+
+		if ms.First().Equal(ms.Last()) {
+			c.addRing(ch)
+		} else {
+			chains = append(chains, ch)
+		}
+	}
+
+	a.repair(c, chains)
+	c.buildLand()
+
+	return c
+}
+
+// dedup removes the duplicate ways, keeping the highest version, and
+// sorts them by id so the result does not depend on the input order.
+// Duplicates are common when combining overlapping extracts.
+func dedup(ways osm.Ways) osm.Ways {
+	byID := make(map[osm.WayID]*osm.Way, len(ways))
+	for _, w := range ways {
+		if e, ok := byID[w.ID]; !ok || w.Version > e.Version {
+			byID[w.ID] = w
+		}
+	}
+
+	result := make(osm.Ways, 0, len(byID))
+	for _, w := range byID {
+		result = append(result, w)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}
+
+func (c *Coastline) addRing(ch *chain) {
+	if len(ch.line) < 4 {
+		c.Unclosed = append(c.Unclosed, &Line{LineString: ch.line, WayIDs: ch.wayIDs})
+		return
+	}
+
+	c.Rings = append(c.Rings, &Ring{Ring: orb.Ring(ch.line), WayIDs: ch.wayIDs})
+}
+
+// repair connects the end of a chain to the start of the closest chain,
+// shortest gaps first, if within the max gap. Chains that form a cycle
+// become rings, the rest are unclosed lines.
+func (a *assembler) repair(c *Coastline, chains []*chain) {
+	type gap struct {
+		from, to int
+		distance float64
+	}
+
+	var gaps []gap
+	if a.maxGap > 0 {
+		for i, from := range chains {
+			end := from.line[len(from.line)-1]
+			for j, to := range chains {
+				if i == j && len(from.line) < 3 {
+					continue
+				}
+
+				if d := geo.Distance(end, to.line[0]); d <= a.maxGap {
+					gaps = append(gaps, gap{from: i, to: j, distance: d})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(gaps, func(i, j int) bool {
+		return gaps[i].distance < gaps[j].distance
+	})
+
+	next := make([]int, len(chains))
+	for i := range next {
+		next[i] = -1
+	}
+	hasPrev := make([]bool, len(chains))
+
+	for _, g := range gaps {
+		if next[g.from] != -1 || hasPrev[g.to] {
+			continue
+		}
+
+		next[g.from] = g.to
+		hasPrev[g.to] = true
+
+		from, to := chains[g.from], chains[g.to]
+		c.Repairs = append(c.Repairs, &Repair{
+			From:     from.wayIDs[len(from.wayIDs)-1],
+			To:       to.wayIDs[0],
+			Gap:      orb.LineString{from.line[len(from.line)-1], to.line[0]},
+			Distance: g.distance,
+		})
+	}
+
+	visited := make([]bool, len(chains))
+	follow := func(start int) *chain {
+		result := &chain{}
+		for i := start; i != -1 && !visited[i]; i = next[i] {
+			visited[i] = true
+			result.line = append(result.line, chains[i].line...)
+			result.wayIDs = append(result.wayIDs, chains[i].wayIDs...)
+		}
+
+		return result
+	}
+
+	// the chains without a previous chain are the start of an unclosed line
+	for i := range chains {
+		if hasPrev[i] {
+			continue
+		}
+
+		ch := follow(i)
+		c.Unclosed = append(c.Unclosed, &Line{LineString: ch.line, WayIDs: ch.wayIDs})
+	}
+
+	// everything else is part of a cycle
+	for i := range chains {
+		if visited[i] {
+			continue
+		}
+
+		ch := follow(i)
+		ch.line = append(ch.line, ch.line[0])
+		c.addRing(ch)
+	}
+}
+
+// buildLand creates the land polygons with the counter-clockwise rings as
+// the outers. Each clockwise ring is a hole in the smallest land ring
+// that contains it.
+func (c *Coastline) buildLand() {
+	type outer struct {
+		bound orb.Bound
+		area  float64
+	}
+
+	var outers []outer
+	for _, r := range c.Rings {
+		if r.Land() {
+			outers = append(outers, outer{bound: r.Ring.Bound(), area: planar.Area(r.Ring)})
+			c.Land = append(c.Land, orb.Polygon{r.Ring})
+		}
+	}
+
+	for _, r := range c.Rings {
+		if r.Ring.Orientation() != orb.CW {
+			continue
+		}
+
+		best := -1
+		for i, o := range outers {
+			if !o.bound.Contains(r.Ring[0]) || !planar.RingContains(c.Land[i][0], r.Ring[0]) {
+				continue
+			}
+
+			if best == -1 || o.area < outers[best].area {
+				best = i
+			}
+		}
+
+		if best != -1 {
+			c.Land[best] = append(c.Land[best], r.Ring)
+		} else {
+			c.water = append(c.water, r.Ring)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package osmcoast
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+)
+
+// adds a coastline way with the points and returns the way.
+func addWay(o *osm.OSM, id osm.WayID, points ...orb.Point) *osm.Way {
+	nid := osm.NodeID(id * 10)
+	w := &osm.Way{
+		ID:   id,
+		Tags: osm.Tags{{Key: "natural", Value: "coastline"}},
+	}
+
+	for i, p := range points {
+		o.Nodes = append(o.Nodes, &osm.Node{ID: nid + osm.NodeID(i), Lon: p[0], Lat: p[1]})
+		w.Nodes = append(w.Nodes, osm.WayNode{ID: nid + osm.NodeID(i)})
+	}
+	o.Ways = append(o.Ways, w)
+
+	return w
+}
+
+func testData() *osm.OSM {
+	o := &osm.OSM{}
+
+	// island in two parts, the first node is shared
+	w := addWay(o, 1, orb.Point{1, 1}, orb.Point{3, 1}, orb.Point{3, 3})
+	w.Version = 2
+	w = addWay(o, 2, orb.Point{3, 3}, orb.Point{1, 3})
+	w.Nodes = append(w.Nodes, o.Ways[0].Nodes[0])
+
+	// lagoon in the island
+	w = addWay(o, 3, orb.Point{1.5, 1.5}, orb.Point{1.5, 2}, orb.Point{2, 2}, orb.Point{2, 1.5})
+	w.Nodes = append(w.Nodes, w.Nodes[0])
+
+	// island with a small gap
+	addWay(o, 4, orb.Point{5, 1}, orb.Point{6, 1}, orb.Point{6, 2})
+	w = addWay(o, 5, orb.Point{6, 2}, orb.Point{5, 2}, orb.Point{5.000001, 1.000001})
+	w.Nodes[0] = o.Ways[3].Nodes[2]
+
+	// unclosed
+	addWay(o, 6, orb.Point{10, 10}, orb.Point{11, 10}, orb.Point{12, 11})
+
+	// not coastline
+	w = addWay(o, 7, orb.Point{20, 20}, orb.Point{21, 20}, orb.Point{21, 21})
+	w.Nodes = append(w.Nodes, w.Nodes[0])
+	w.Tags = osm.Tags{{Key: "natural", Value: "water"}}
+
+	// an old version of way 1 from another extract
+	o.Ways = append(o.Ways, &osm.Way{
+		ID:      1,
+		Version: 1,
+		Tags:    osm.Tags{{Key: "natural", Value: "coastline"}},
+		Nodes:   o.Ways[0].Nodes[:2],
+	})
+
+	return o
+}
+
+func ringWays(c *Coastline) [][]osm.WayID {
+	var result [][]osm.WayID
+	for _, r := range c.Rings {
+		ids := append([]osm.WayID(nil), r.WayIDs...)
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		result = append(result, ids)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+func TestNew(t *testing.T) {
+	c, err := New(testData())
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	checkCoastline(t, c)
+}
+
+func checkCoastline(t *testing.T, c *Coastline) {
+	t.Helper()
+
+	expected := [][]osm.WayID{{1, 2}, {3}, {4, 5}}
+	if v := ringWays(c); !reflect.DeepEqual(v, expected) {
+		t.Errorf("incorrect rings: %v", v)
+	}
+
+	for _, r := range c.Rings {
+		if !r.Ring.Closed() {
+			t.Errorf("ring not closed: %v", r.Ring)
+		}
+
+		if land := r.WayIDs[0] != 3; r.Land() != land {
+			t.Errorf("incorrect land for %v: %v", r.WayIDs, r.Land())
+		}
+	}
+
+	if len(c.Unclosed) != 1 || !reflect.DeepEqual(c.Unclosed[0].WayIDs, []osm.WayID{6}) {
+		t.Errorf("incorrect unclosed: %v", c.Unclosed)
+	}
+
+	if len(c.Repairs) != 1 {
+		t.Fatalf("incorrect repairs: %v", c.Repairs)
+	}
+
+	r := c.Repairs[0]
+	if r.From != 5 || r.To != 4 || r.Distance <= 0 || r.Distance > 1 {
+		t.Errorf("incorrect repair: %+v", r)
+	}
+
+	if len(c.Land) != 2 {
+		t.Fatalf("incorrect land: %v", c.Land)
+	}
+
+	for _, p := range c.Land {
+		holes := 0
+		if p.Bound().Min[0] == 1 {
+			holes = 1
+		}
+
+		if len(p) != holes+1 {
+			t.Errorf("incorrect polygon: %v", p)
+		}
+	}
+}
+
+func TestNew_maxGap(t *testing.T) {
+	c, err := New(testData(), MaxGap(0))
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	if len(c.Rings) != 2 || len(c.Unclosed) != 2 || len(c.Repairs) != 0 {
+		t.Errorf("should not repair gaps: %v %v", ringWays(c), c.Repairs)
+	}
+
+	// large gap will close the unclosed way
+	c, err = New(testData(), MaxGap(300000))
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	if len(c.Rings) != 4 || len(c.Unclosed) != 0 {
+		t.Errorf("should repair all gaps: %v %v", ringWays(c), c.Unclosed)
+	}
+
+	if _, err := New(testData(), MaxGap(-1)); err == nil {
+		t.Errorf("should return error for negative gap")
+	}
+}
+
+func TestBuild(t *testing.T) {
+	o := testData()
+
+	passes := 0
+	c, err := Build(func() (osm.Scanner, error) {
+		passes++
+		return osmtest.NewScanner(o.Objects()), nil
+	})
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+
+	if passes != 2 {
+		t.Errorf("incorrect number of passes: %v", passes)
+	}
+
+	checkCoastline(t, c)
+
+	// errors are returned
+	openErr := errors.New("open error")
+	_, err = Build(func() (osm.Scanner, error) {
+		return nil, openErr
+	})
+	if err != openErr {
+		t.Errorf("incorrect error: %v", err)
+	}
+
+	scanErr := errors.New("scan error")
+	_, err = Build(func() (osm.Scanner, error) {
+		s := osmtest.NewScanner(o.Objects())
+		s.ScanError = scanErr
+		return s, nil
+	})
+	if err != scanErr {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
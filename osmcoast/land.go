@@ -0,0 +1,327 @@
+package osmcoast
+
+import (
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/clip"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/maptile/tilecover"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm/internal/mputil"
+)
+
+// LandPolygons returns the land within the bound. The land of the closed
+// rings is clipped to the bound. The unclosed coastlines, usually cut at
+// the edge of an extract, are clipped and closed along the edges of the
+// bound, counter-clockwise so the land stays on the left. If no coastline
+// crosses the bound it is all land or all water, depending on the side of
+// the closest coastline.
+//
+// The bound should be within the area of the data, coastlines that end
+// inside the bound are missing data and are ignored.
+func (c *Coastline) LandPolygons(b orb.Bound) orb.MultiPolygon {
+	var result orb.MultiPolygon
+	for _, p := range c.Land {
+		if !p.Bound().Intersects(b) {
+			continue
+		}
+
+		// clip modifies the input
+		if clipped := clip.Polygon(b, p.Clone()); clipped != nil {
+			result = append(result, clipped)
+		}
+	}
+
+	return append(result, c.openLand(b)...)
+}
+
+// LandTiles returns the land polygons clipped to each tile at the zoom
+// that covers the bound. Tiles without any land are not included.
+func (c *Coastline) LandTiles(b orb.Bound, z maptile.Zoom) map[maptile.Tile]orb.MultiPolygon {
+	result := make(map[maptile.Tile]orb.MultiPolygon)
+	for t := range tilecover.Bound(b, z) {
+		if mp := c.LandPolygons(t.Bound()); len(mp) > 0 {
+			result[t] = mp
+		}
+	}
+
+	return result
+}
+
+// openLand returns the land in the bound defined by the unclosed coastlines.
+// The water rings not inside any land ring are the holes.
+func (c *Coastline) openLand(b orb.Bound) orb.MultiPolygon {
+	if len(c.Unclosed) == 0 && len(c.water) == 0 {
+		return nil
+	}
+
+	var segments []mputil.Segment
+	add := func(ls orb.LineString) {
+		if !ls.Bound().Intersects(b) {
+			return
+		}
+
+		// clip modifies the input
+		for _, l := range clip.LineString(b, ls.Clone()) {
+			if len(l) > 1 {
+				segments = append(segments, mputil.Segment{Line: l})
+			}
+		}
+	}
+
+	for _, l := range c.Unclosed {
+		add(l.LineString)
+	}
+
+	for _, r := range c.water {
+		add(orb.LineString(r))
+	}
+
+	e := newEdge(b)
+
+	// sections of a ring split by the clipping are joined back together
+	var crossing []orb.LineString
+	var holes []orb.Ring
+	for _, ms := range mputil.JoinDirected(segments) {
+		ls := ms.LineString()
+		first, last := ls[0], ls[len(ls)-1]
+
+		if first.Equal(last) {
+			if r := orb.Ring(ls); len(r) > 3 && r.Orientation() == orb.CW {
+				holes = append(holes, r)
+			}
+		} else if e.on(first) && e.on(last) {
+			crossing = append(crossing, ls)
+		}
+	}
+
+	var outers []orb.Ring
+	if len(crossing) > 0 {
+		outers = e.close(crossing)
+	} else if c.landAt(b.Min) {
+		// nothing crosses the edge so the whole edge is on the same side
+		outers = []orb.Ring{b.ToRing()}
+	}
+
+	result := make(orb.MultiPolygon, 0, len(outers))
+	for _, r := range outers {
+		result = append(result, orb.Polygon{r})
+	}
+
+	for _, h := range holes {
+		for i, p := range result {
+			if planar.RingContains(p[0], h[0]) {
+				result[i] = append(p, h)
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// edge is the boundary of a bound. Positions on the edge are the
+// counter-clockwise distance from the bound min point.
+type edge struct {
+	bound         orb.Bound
+	width, height float64
+}
+
+func newEdge(b orb.Bound) *edge {
+	return &edge{
+		bound:  b,
+		width:  b.Max[0] - b.Min[0],
+		height: b.Max[1] - b.Min[1],
+	}
+}
+
+// on returns true if the point, inside the bound, is on the edge.
+func (e *edge) on(p orb.Point) bool {
+	return p[0] == e.bound.Min[0] || p[0] == e.bound.Max[0] ||
+		p[1] == e.bound.Min[1] || p[1] == e.bound.Max[1]
+}
+
+func (e *edge) position(p orb.Point) float64 {
+	b := e.bound
+	switch {
+	case p[1] == b.Min[1]:
+		return p[0] - b.Min[0]
+	case p[0] == b.Max[0]:
+		return e.width + p[1] - b.Min[1]
+	case p[1] == b.Max[1]:
+		return e.width + e.height + b.Max[0] - p[0]
+	}
+
+	return 2*e.width + e.height + b.Max[1] - p[1]
+}
+
+// close connects the lines, that start and end on the edge, into rings by
+// following the edge counter-clockwise from the end of each line to the
+// start of the next one. Rings that don't close, because of inconsistent
+// data like crossing coastlines, are dropped.
+func (e *edge) close(lines []orb.LineString) []orb.Ring {
+	perimeter := 2 * (e.width + e.height)
+	b := e.bound
+	corners := []orb.Point{b.Min, {b.Max[0], b.Min[1]}, b.Max, {b.Min[0], b.Max[1]}}
+
+	starts := make([]float64, len(lines))
+	for i, l := range lines {
+		starts[i] = e.position(l[0])
+	}
+
+	// distance along the edge, counter-clockwise
+	distance := func(from, to float64) float64 {
+		d := to - from
+		if d < 0 {
+			d += perimeter
+		}
+
+		return d
+	}
+
+	var result []orb.Ring
+	used := make([]bool, len(lines))
+	for i := range lines {
+		if used[i] {
+			continue
+		}
+
+		var ring orb.Ring
+		for current := i; ; {
+			used[current] = true
+			ring = append(ring, lines[current]...)
+
+			end := e.position(ring[len(ring)-1])
+			next, dist := -1, 0.0
+			for j, s := range starts {
+				if d := distance(end, s); next == -1 || d < dist {
+					next, dist = j, d
+				}
+			}
+
+			type corner struct {
+				point    orb.Point
+				distance float64
+			}
+
+			var between []corner
+			for _, p := range corners {
+				if d := distance(end, e.position(p)); d > 0 && d < dist {
+					between = append(between, corner{point: p, distance: d})
+				}
+			}
+
+			sort.Slice(between, func(i, j int) bool {
+				return between[i].distance < between[j].distance
+			})
+
+			for _, c := range between {
+				ring = append(ring, c.point)
+			}
+
+			if next == i {
+				ring = append(ring, ring[0])
+				break
+			}
+
+			if used[next] {
+				ring = nil
+				break
+			}
+
+			current = next
+		}
+
+		if len(ring) > 3 {
+			result = append(result, ring)
+		}
+	}
+
+	return result
+}
+
+// landAt returns true if the point is on the left, land, side of the
+// closest unclosed coastline or water ring. The land of the closed rings
+// is not included, it is clipped separately.
+func (c *Coastline) landAt(p orb.Point) bool {
+	s := &sideSearch{point: p, best: math.Inf(1)}
+	for _, r := range c.water {
+		s.search(orb.LineString(r), true)
+	}
+
+	for _, l := range c.Unclosed {
+		s.search(l.LineString, false)
+	}
+
+	return s.land
+}
+
+type sideSearch struct {
+	point orb.Point
+	best  float64
+	land  bool
+}
+
+func (s *sideSearch) search(ls orb.LineString, closed bool) {
+	for i := 0; i < len(ls)-1; i++ {
+		a, b := ls[i], ls[i+1]
+
+		t := segmentParam(s.point, a, b)
+		q := orb.Point{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1])}
+		d := planar.DistanceSquared(s.point, q)
+		if d >= s.best {
+			continue
+		}
+		s.best = d
+
+		switch {
+		case t == 0 && (i > 0 || closed):
+			prev := len(ls) - 2
+			if i > 0 {
+				prev = i - 1
+			}
+			s.land = leftOfVertex(s.point, ls[prev], a, b)
+		case t == 1 && (i+2 < len(ls) || closed):
+			next := 1
+			if i+2 < len(ls) {
+				next = i + 2
+			}
+			s.land = leftOfVertex(s.point, a, b, ls[next])
+		default:
+			s.land = cross(a, b, s.point) > 0
+		}
+	}
+}
+
+// segmentParam returns the position, from 0 to 1, of the point
+// on the segment closest to p.
+func segmentParam(p, a, b orb.Point) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	l := dx*dx + dy*dy
+	if l == 0 {
+		return 0
+	}
+
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / l
+	return math.Max(0, math.Min(1, t))
+}
+
+// leftOfVertex returns true if p is on the left of the path u, v, w where
+// v is the closest point. For a left turn it must be left of both segments,
+// for a right turn it only needs to be left of one.
+func leftOfVertex(p, u, v, w orb.Point) bool {
+	l1 := cross(u, v, p) > 0
+	l2 := cross(v, w, p) > 0
+	if cross(u, v, w) > 0 {
+		return l1 && l2
+	}
+
+	return l1 || l2
+}
+
+// cross is positive if p is on the left of the line from a to b.
+func cross(a, b, p orb.Point) float64 {
+	return (b[0]-a[0])*(p[1]-a[1]) - (b[1]-a[1])*(p[0]-a[0])
+}
@@ -0,0 +1,167 @@
+package osmcoast
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+)
+
+func TestCoastline_LandPolygons(t *testing.T) {
+	c, err := New(testData())
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	// the west part of the first island, including half the lagoon
+	b := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1.75, 4}}
+	mp := c.LandPolygons(b)
+	if len(mp) != 1 {
+		t.Fatalf("incorrect polygons: %v", mp)
+	}
+
+	if a := planar.Area(mp); a < 1.374 || a > 1.376 {
+		t.Errorf("incorrect area: %v", a)
+	}
+
+	// clipping should not modify the land
+	if c.Land[0].Bound().Max[0] != 3 {
+		t.Errorf("land was modified: %v", c.Land[0])
+	}
+
+	// closest to the outside of the first island
+	b = orb.Bound{Min: orb.Point{-10, -10}, Max: orb.Point{-9, -9}}
+	if mp := c.LandPolygons(b); len(mp) != 0 {
+		t.Errorf("should not have land: %v", mp)
+	}
+
+	// land is on the left of the unclosed way
+	b = orb.Bound{Min: orb.Point{30, 30}, Max: orb.Point{31, 31}}
+	if mp := c.LandPolygons(b); len(mp) != 1 || planar.Area(mp) != 1 {
+		t.Errorf("should be all land: %v", mp)
+	}
+}
+
+func TestCoastline_LandPolygons_unclosed(t *testing.T) {
+	bound := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{10, 10}}
+
+	cases := []struct {
+		name  string
+		lines []orb.LineString
+		bound orb.Bound
+		area  float64
+	}{
+		{
+			name:  "straight with lake",
+			lines: []orb.LineString{{{-1, 5}, {11, 5}}, {{4, 7}, {4, 8}, {5, 8}, {5, 7}, {4, 7}}},
+			bound: bound,
+			area:  49,
+		},
+		{
+			name:  "lake crossing the edge",
+			lines: []orb.LineString{{{-1, 5}, {11, 5}}, {{4, 9}, {4, 11}, {5, 11}, {5, 9}, {4, 9}}},
+			bound: bound,
+			area:  49,
+		},
+		{
+			name:  "no crossing on land",
+			lines: []orb.LineString{{{-1, 5}, {11, 5}}, {{4, 7}, {4, 8}, {5, 8}, {5, 7}, {4, 7}}},
+			bound: orb.Bound{Min: orb.Point{0, 6}, Max: orb.Point{10, 10}},
+			area:  39,
+		},
+		{
+			name:  "no crossing on water",
+			lines: []orb.LineString{{{-1, 5}, {11, 5}}},
+			bound: orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{10, 4}},
+			area:  0,
+		},
+		{
+			name:  "bay",
+			lines: []orb.LineString{{{3, -1}, {3, 5}, {6, 5}, {6, -1}}},
+			bound: bound,
+			area:  85,
+		},
+		{
+			name:  "strip",
+			lines: []orb.LineString{{{-1, 3}, {11, 3}}, {{11, 7}, {-1, 7}}},
+			bound: bound,
+			area:  40,
+		},
+		{
+			name:  "ends inside the bound",
+			lines: []orb.LineString{{{-1, 5}, {5, 5}}},
+			bound: bound,
+			area:  0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			o := &osm.OSM{}
+			for i, l := range tc.lines {
+				w := addWay(o, osm.WayID(i+1), l...)
+				if l[0] == l[len(l)-1] {
+					w.Nodes[len(w.Nodes)-1] = w.Nodes[0]
+				}
+			}
+
+			c, err := New(o)
+			if err != nil {
+				t.Fatalf("new error: %v", err)
+			}
+
+			mp := c.LandPolygons(tc.bound)
+			if a := planar.Area(mp); a != tc.area {
+				t.Errorf("incorrect area: %v != %v", a, tc.area)
+				t.Logf("%v", mp)
+			}
+
+			for _, p := range mp {
+				if p[0].Orientation() != orb.CCW {
+					t.Errorf("outer ring should be counter-clockwise: %v", p[0])
+				}
+			}
+		})
+	}
+}
+
+func TestCoastline_LandTiles(t *testing.T) {
+	c, err := New(testData())
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	tiles := c.LandTiles(orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{7, 3}}, 8)
+	if len(tiles) == 0 {
+		t.Fatalf("should have tiles")
+	}
+
+	total := 0.0
+	for tile, mp := range tiles {
+		if tile.Z != 8 {
+			t.Errorf("incorrect zoom: %v", tile)
+		}
+
+		tb := tile.Bound().Pad(1e-9)
+		if b := mp.Bound(); !tb.Contains(b.Min) || !tb.Contains(b.Max) {
+			t.Errorf("land not in tile %v: %v", tile, mp)
+		}
+
+		total += planar.Area(mp)
+	}
+
+	// island minus the lagoon and the small island
+	if total < 4.74 || total > 4.76 {
+		t.Errorf("incorrect total area: %v", total)
+	}
+
+	if _, ok := tiles[maptile.At(orb.Point{4.5, 0.1}, 8)]; !ok {
+		t.Errorf("should include tiles with land")
+	}
+
+	if _, ok := tiles[maptile.At(orb.Point{6.5, 2.9}, 8)]; ok {
+		t.Errorf("should not include tiles without land")
+	}
+}
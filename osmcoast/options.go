@@ -0,0 +1,20 @@
+package osmcoast
+
+import "errors"
+
+// Option is a parameter that can be used when assembling the coastline.
+type Option func(*assembler) error
+
+// MaxGap sets the largest gap, in meters, between the end of a coastline
+// and the start of another, or itself, that will be closed. The default
+// is 1 meter. Zero will not repair any gaps.
+func MaxGap(meters float64) Option {
+	return func(a *assembler) error {
+		if meters < 0 {
+			return errors.New("osmcoast: max gap must not be negative")
+		}
+
+		a.maxGap = meters
+		return nil
+	}
+}
@@ -0,0 +1,468 @@
+// Package osmexpire computes the map tiles touched by a change, as a
+// list of dirty tiles that need to be rerendered. The tiles can be
+// written in the expire list format, one z/x/y line per tile.
+package osmexpire
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/maptile/tilecover"
+	"github.com/paulmach/osm"
+)
+
+// ErrStoreRequired is returned when expiring an osm.Change without a location store.
+var ErrStoreRequired = errors.New("osmexpire: location store required")
+
+// An Expirer collects the tiles touched by changes over a zoom range.
+// Tiles are expired for the old and new geometry of nodes and ways.
+// Relations expire the geometry of their node and way members,
+// sub relations are not expanded.
+type Expirer struct {
+	minZoom, maxZoom maptile.Zoom
+
+	store LocationStore
+	tiles maptile.Set // at max zoom
+}
+
+// New creates an expirer for the zoom range, inclusive.
+func New(minZoom, maxZoom maptile.Zoom, opts ...Option) (*Expirer, error) {
+	if minZoom > maxZoom {
+		return nil, fmt.Errorf("osmexpire: min zoom %d greater than max zoom %d", minZoom, maxZoom)
+	}
+
+	e := &Expirer{
+		minZoom: minZoom,
+		maxZoom: maxZoom,
+		tiles:   make(maptile.Set),
+	}
+
+	for _, o := range opts {
+		if err := o(e); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// change is the old and new state of the elements in a diff or change.
+type change struct {
+	oldNodes map[osm.NodeID]*osm.Node
+	newNodes map[osm.NodeID]*osm.Node
+	oldWays  map[osm.WayID]*osm.Way
+	newWays  map[osm.WayID]*osm.Way
+
+	oldRelations map[osm.RelationID]*osm.Relation
+	newRelations map[osm.RelationID]*osm.Relation
+}
+
+func newChange() *change {
+	return &change{
+		oldNodes:     make(map[osm.NodeID]*osm.Node),
+		newNodes:     make(map[osm.NodeID]*osm.Node),
+		oldWays:      make(map[osm.WayID]*osm.Way),
+		newWays:      make(map[osm.WayID]*osm.Way),
+		oldRelations: make(map[osm.RelationID]*osm.Relation),
+		newRelations: make(map[osm.RelationID]*osm.Relation),
+	}
+}
+
+func (c *change) addOld(o *osm.OSM) {
+	if o == nil {
+		return
+	}
+
+	for _, n := range o.Nodes {
+		c.oldNodes[n.ID] = n
+	}
+
+	for _, w := range o.Ways {
+		c.oldWays[w.ID] = w
+	}
+
+	for _, r := range o.Relations {
+		c.oldRelations[r.ID] = r
+	}
+}
+
+func (c *change) addNew(o *osm.OSM, deleted bool) {
+	if o == nil {
+		return
+	}
+
+	// deleted elements have no new geometry but are
+	// tracked so the old version is expired.
+	for _, n := range o.Nodes {
+		if deleted {
+			c.newNodes[n.ID] = nil
+		} else {
+			c.newNodes[n.ID] = n
+		}
+	}
+
+	for _, w := range o.Ways {
+		if deleted {
+			c.newWays[w.ID] = nil
+		} else {
+			c.newWays[w.ID] = w
+		}
+	}
+
+	for _, r := range o.Relations {
+		if deleted {
+			c.newRelations[r.ID] = nil
+		} else {
+			c.newRelations[r.ID] = r
+		}
+	}
+}
+
+// AddDiff expires the tiles of the old and new geometry of the elements
+// in the diff, for example one created with annotate.Change.
+// If the way nodes of the diff are not annotated with their locations
+// the node locations are found in the diff or the location store.
+func (e *Expirer) AddDiff(ctx context.Context, diff *osm.Diff) error {
+	c := newChange()
+	for _, a := range diff.Actions {
+		switch a.Type {
+		case osm.ActionCreate:
+			c.addNew(a.OSM, false)
+		case osm.ActionModify:
+			c.addOld(a.Old)
+			c.addNew(a.New, false)
+		case osm.ActionDelete:
+			c.addOld(a.Old)
+			c.addNew(a.New, true)
+		}
+	}
+
+	return e.expire(ctx, c)
+}
+
+// AddChange expires the tiles of the old and new geometry of the
+// elements in the change. The old node locations and ways are found in
+// the location store, so it must contain the data before the change.
+// Old versions of relations are not known so only their new members
+// are expired.
+func (e *Expirer) AddChange(ctx context.Context, oc *osm.Change) error {
+	if e.store == nil {
+		return ErrStoreRequired
+	}
+
+	c := newChange()
+	c.addNew(oc.Create, false)
+	c.addNew(oc.Modify, false)
+	c.addNew(oc.Delete, true)
+
+	for id := range c.newNodes {
+		p, err := e.store.NodeLocation(ctx, id)
+		if e.store.NotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		c.oldNodes[id] = &osm.Node{ID: id, Lon: p[0], Lat: p[1]}
+	}
+
+	if ws, ok := e.store.(WayStore); ok {
+		for id := range c.newWays {
+			w, err := ws.Way(ctx, id)
+			if e.store.NotFound(err) {
+				continue
+			}
+
+			if err != nil {
+				return err
+			}
+
+			c.oldWays[id] = w
+		}
+	}
+
+	return e.expire(ctx, c)
+}
+
+func (e *Expirer) expire(ctx context.Context, c *change) error {
+	for id, n := range c.oldNodes {
+		e.AddGeometry(n.Point())
+
+		if nn := c.newNodes[id]; nn == nil || nn.Point() != n.Point() {
+			if err := e.nodeWays(ctx, c, id); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, n := range c.newNodes {
+		if n != nil {
+			e.AddGeometry(n.Point())
+		}
+	}
+
+	for _, w := range c.oldWays {
+		if err := e.way(ctx, c, w, true); err != nil {
+			return err
+		}
+	}
+
+	for _, w := range c.newWays {
+		if w == nil {
+			continue
+		}
+
+		if err := e.way(ctx, c, w, false); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range c.oldRelations {
+		if err := e.relation(ctx, c, r, true); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range c.newRelations {
+		if r == nil {
+			continue
+		}
+
+		if err := e.relation(ctx, c, r, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// nodeWays expires the ways that reference a node that moved or was deleted.
+// Ways in the change are already expired.
+func (e *Expirer) nodeWays(ctx context.Context, c *change, id osm.NodeID) error {
+	ws, ok := e.store.(WayStore)
+	if !ok {
+		return nil
+	}
+
+	ways, err := ws.NodeWays(ctx, id)
+	if err != nil && !e.store.NotFound(err) {
+		return err
+	}
+
+	for _, w := range ways {
+		if _, ok := c.newWays[w.ID]; ok {
+			continue
+		}
+
+		if err := e.way(ctx, c, w, true); err != nil {
+			return err
+		}
+
+		if err := e.way(ctx, c, w, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Expirer) way(ctx context.Context, c *change, w *osm.Way, old bool) error {
+	ls := make(orb.LineString, 0, len(w.Nodes))
+	for _, wn := range w.Nodes {
+		p, ok, err := e.location(ctx, c, wn, old)
+		if err != nil {
+			return err
+		}
+
+		if ok {
+			ls = append(ls, p)
+		}
+	}
+
+	e.AddGeometry(ls)
+	return nil
+}
+
+func (e *Expirer) relation(ctx context.Context, c *change, r *osm.Relation, old bool) error {
+	for _, m := range r.Members {
+		switch m.Type {
+		case osm.TypeNode:
+			p, ok, err := e.location(ctx, c, osm.WayNode{ID: osm.NodeID(m.Ref), Lat: m.Lat, Lon: m.Lon}, old)
+			if err != nil {
+				return err
+			}
+
+			if ok {
+				e.AddGeometry(p)
+			}
+		case osm.TypeWay:
+			w, err := e.memberWay(ctx, c, m, old)
+			if err != nil {
+				return err
+			}
+
+			if w == nil {
+				continue
+			}
+
+			if err := e.way(ctx, c, w, old); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *Expirer) memberWay(ctx context.Context, c *change, m osm.Member, old bool) (*osm.Way, error) {
+	id := osm.WayID(m.Ref)
+	if len(m.Nodes) > 0 {
+		return &osm.Way{ID: id, Nodes: m.Nodes}, nil
+	}
+
+	if !old {
+		if w, ok := c.newWays[id]; ok {
+			return w, nil
+		}
+	} else if w, ok := c.oldWays[id]; ok {
+		return w, nil
+	}
+
+	ws, ok := e.store.(WayStore)
+	if !ok {
+		return nil, nil
+	}
+
+	w, err := ws.Way(ctx, id)
+	if e.store.NotFound(err) {
+		return nil, nil
+	}
+
+	return w, err
+}
+
+// location returns the old or new location of the node. The order is the
+// location of an annotated way node, the node in the change and the store.
+func (e *Expirer) location(ctx context.Context, c *change, wn osm.WayNode, old bool) (orb.Point, bool, error) {
+	if wn.Lat != 0 || wn.Lon != 0 {
+		return wn.Point(), true, nil
+	}
+
+	nodes := c.oldNodes
+	if !old {
+		nodes = c.newNodes
+	}
+
+	if n, ok := nodes[wn.ID]; ok {
+		if n == nil {
+			return orb.Point{}, false, nil
+		}
+
+		return n.Point(), true, nil
+	}
+
+	if e.store == nil {
+		return orb.Point{}, false, nil
+	}
+
+	p, err := e.store.NodeLocation(ctx, wn.ID)
+	if e.store.NotFound(err) {
+		return orb.Point{}, false, nil
+	}
+
+	if err != nil {
+		return orb.Point{}, false, err
+	}
+
+	return p, true, nil
+}
+
+// AddGeometry expires the tiles covered by the geometry.
+// Polygons expire all the tiles they cover.
+func (e *Expirer) AddGeometry(g orb.Geometry) {
+	switch g := g.(type) {
+	case orb.Point:
+		e.tiles[maptile.At(g, e.maxZoom)] = true
+	case orb.LineString:
+		if len(g) == 0 {
+			return
+		}
+
+		// the cover skips zero length lines
+		e.tiles[maptile.At(g[0], e.maxZoom)] = true
+		e.tiles.Merge(tilecover.LineString(g, e.maxZoom))
+	default:
+		e.tiles.Merge(tilecover.Geometry(g, e.maxZoom))
+	}
+}
+
+// Tiles returns the expired tiles over the zoom range,
+// ordered by zoom, x and then y.
+func (e *Expirer) Tiles() maptile.Tiles {
+	set := make(maptile.Set, len(e.tiles))
+	for t := range e.tiles {
+		for {
+			set[t] = true
+			if t.Z <= e.minZoom {
+				break
+			}
+
+			t = t.Parent()
+		}
+	}
+
+	tiles := make(maptile.Tiles, 0, len(set))
+	for t := range set {
+		tiles = append(tiles, t)
+	}
+
+	sort.Slice(tiles, func(i, j int) bool {
+		if tiles[i].Z != tiles[j].Z {
+			return tiles[i].Z < tiles[j].Z
+		}
+
+		if tiles[i].X != tiles[j].X {
+			return tiles[i].X < tiles[j].X
+		}
+
+		return tiles[i].Y < tiles[j].Y
+	})
+
+	return tiles
+}
+
+// Reset removes all the expired tiles.
+func (e *Expirer) Reset() {
+	e.tiles = make(maptile.Set)
+}
+
+// WriteTo writes the expired tiles in the expire list format,
+// one z/x/y line per tile.
+func (e *Expirer) WriteTo(w io.Writer) (int64, error) {
+	return WriteList(w, e.Tiles())
+}
+
+// WriteList writes the tiles in the expire list format,
+// one z/x/y line per tile.
+func WriteList(w io.Writer, tiles maptile.Tiles) (int64, error) {
+	bw := bufio.NewWriter(w)
+
+	var total int64
+	for _, t := range tiles {
+		n, err := fmt.Fprintf(bw, "%d/%d/%d\n", t.Z, t.X, t.Y)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, bw.Flush()
+}
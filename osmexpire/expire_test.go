@@ -0,0 +1,307 @@
+package osmexpire
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/annotate"
+)
+
+// tile size at zoom 10 is about 0.35 degrees.
+func testStore() *IndexStore {
+	return NewIndexStore(&osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lon: 0.1, Lat: 0.1},
+			{ID: 2, Version: 1, Lon: 0.5, Lat: 0.1},
+			{ID: 3, Version: 1, Lon: 10.1, Lat: 10.1},
+			{ID: 4, Version: 1, Lon: 20.1, Lat: -20.1},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		},
+		Relations: osm.Relations{
+			{ID: 1, Version: 1, Members: osm.Members{
+				{Type: osm.TypeNode, Ref: 4},
+			}},
+		},
+	})
+}
+
+func tiles(z maptile.Zoom, points ...orb.Point) maptile.Tiles {
+	var result maptile.Tiles
+	for _, p := range points {
+		result = append(result, maptile.At(p, z))
+	}
+
+	return result
+}
+
+func TestExpirer_AddChange(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("moved node expires ways", func(t *testing.T) {
+		e, err := New(10, 10, Store(testStore()))
+		if err != nil {
+			t.Fatalf("new error: %v", err)
+		}
+
+		err = e.AddChange(ctx, &osm.Change{
+			Modify: &osm.OSM{Nodes: osm.Nodes{{ID: 3, Version: 2, Lon: 10.9, Lat: 10.1}}},
+		})
+		if err != nil {
+			t.Fatalf("add error: %v", err)
+		}
+
+		expected := tiles(10, orb.Point{10.1, 10.1}, orb.Point{10.9, 10.1})
+		if v := e.Tiles(); !reflect.DeepEqual(v, expected) {
+			t.Errorf("incorrect tiles: %v", v)
+		}
+
+		// node 2 is part of way 1 so the whole way is expired
+		e.Reset()
+		err = e.AddChange(ctx, &osm.Change{
+			Modify: &osm.OSM{Nodes: osm.Nodes{{ID: 2, Version: 2, Lon: 0.5, Lat: 0.5}}},
+		})
+		if err != nil {
+			t.Fatalf("add error: %v", err)
+		}
+
+		expected = tiles(10,
+			orb.Point{0.1, 0.1}, orb.Point{0.5, 0.1}, orb.Point{0.5, 0.5},
+			orb.Point{0.1, 0.5}, // the new diagonal way crosses this tile
+		)
+		if v := e.Tiles(); len(v) != 4 || !sameTiles(v, expected) {
+			t.Errorf("incorrect tiles: %v", v)
+		}
+	})
+
+	t.Run("unmoved node does not expire ways", func(t *testing.T) {
+		e, _ := New(10, 10, Store(testStore()))
+		err := e.AddChange(ctx, &osm.Change{
+			Modify: &osm.OSM{Nodes: osm.Nodes{{ID: 2, Version: 2, Lon: 0.5, Lat: 0.1,
+				Tags: osm.Tags{{Key: "amenity", Value: "cafe"}}}}},
+		})
+		if err != nil {
+			t.Fatalf("add error: %v", err)
+		}
+
+		expected := tiles(10, orb.Point{0.5, 0.1})
+		if v := e.Tiles(); !reflect.DeepEqual(v, expected) {
+			t.Errorf("incorrect tiles: %v", v)
+		}
+	})
+
+	t.Run("way with nodes in store and change", func(t *testing.T) {
+		e, _ := New(10, 10, Store(testStore()))
+		err := e.AddChange(ctx, &osm.Change{
+			Create: &osm.OSM{
+				Nodes: osm.Nodes{{ID: 10, Version: 1, Lon: 20.1, Lat: 20.1}},
+				Ways:  osm.Ways{{ID: 2, Version: 1, Nodes: osm.WayNodes{{ID: 3}, {ID: 10}}}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("add error: %v", err)
+		}
+
+		v := e.Tiles()
+		if !sameTiles(v, tiles(10, orb.Point{10.1, 10.1}, orb.Point{20.1, 20.1})) {
+			t.Errorf("should include ends: %v", v)
+		}
+
+		// the diagonal line crosses many tiles
+		if len(v) < 20 {
+			t.Errorf("should cover line: %v", len(v))
+		}
+	})
+
+	t.Run("delete way", func(t *testing.T) {
+		e, _ := New(10, 10, Store(testStore()))
+		err := e.AddChange(ctx, &osm.Change{
+			Delete: &osm.OSM{Ways: osm.Ways{{ID: 1, Version: 2}}},
+		})
+		if err != nil {
+			t.Fatalf("add error: %v", err)
+		}
+
+		expected := tiles(10, orb.Point{0.1, 0.1}, orb.Point{0.5, 0.1})
+		if v := e.Tiles(); !sameTiles(v, expected) || len(v) != 2 {
+			t.Errorf("incorrect tiles: %v", v)
+		}
+	})
+
+	t.Run("relation", func(t *testing.T) {
+		e, _ := New(10, 10, Store(testStore()))
+		err := e.AddChange(ctx, &osm.Change{
+			Modify: &osm.OSM{Relations: osm.Relations{{ID: 1, Version: 2, Members: osm.Members{
+				{Type: osm.TypeNode, Ref: 4},
+				{Type: osm.TypeWay, Ref: 1},
+				{Type: osm.TypeRelation, Ref: 5},
+			}}}},
+		})
+		if err != nil {
+			t.Fatalf("add error: %v", err)
+		}
+
+		expected := tiles(10, orb.Point{0.1, 0.1}, orb.Point{0.5, 0.1}, orb.Point{20.1, -20.1})
+		if v := e.Tiles(); !sameTiles(v, expected) || len(v) != 3 {
+			t.Errorf("incorrect tiles: %v", v)
+		}
+	})
+
+	t.Run("store required", func(t *testing.T) {
+		e, _ := New(10, 10)
+		if err := e.AddChange(ctx, &osm.Change{}); err != ErrStoreRequired {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+}
+
+func TestExpirer_AddDiff(t *testing.T) {
+	ctx := context.Background()
+
+	history := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Visible: true, Lon: 0.1, Lat: 0.1},
+			{ID: 2, Version: 1, Visible: true, Lon: 0.5, Lat: 0.1},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1, Visible: true, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		},
+	}
+
+	change := &osm.Change{
+		Modify: &osm.OSM{
+			Nodes: osm.Nodes{{ID: 1, Version: 2, Lon: 0.1, Lat: 0.5}},
+		},
+		Delete: &osm.OSM{
+			Ways: osm.Ways{{ID: 1, Version: 2}},
+		},
+	}
+
+	diff, err := annotate.Change(ctx, change, history.HistoryDatasource())
+	if err != nil {
+		t.Fatalf("annotate error: %v", err)
+	}
+
+	// the old node 2 location comes from the store, the old node 1
+	// location comes from the diff.
+	e, _ := New(9, 10, Store(NewIndexStore(history)))
+	if err := e.AddDiff(ctx, diff); err != nil {
+		t.Fatalf("add error: %v", err)
+	}
+
+	expected := tiles(10, orb.Point{0.1, 0.1}, orb.Point{0.5, 0.1}, orb.Point{0.1, 0.5})
+	expected = append(expected, maptile.At(orb.Point{0.1, 0.1}, 9))
+	if v := e.Tiles(); !sameTiles(v, expected) || len(v) != 4 {
+		t.Errorf("incorrect tiles: %v", v)
+	}
+
+	// without a store only the diff locations are used
+	e, _ = New(10, 10)
+	if err := e.AddDiff(ctx, diff); err != nil {
+		t.Fatalf("add error: %v", err)
+	}
+
+	expected = tiles(10, orb.Point{0.1, 0.1}, orb.Point{0.1, 0.5})
+	if v := e.Tiles(); !sameTiles(v, expected) || len(v) != 2 {
+		t.Errorf("incorrect tiles: %v", v)
+	}
+}
+
+func TestExpirer_AddDiff_annotated(t *testing.T) {
+	diff := &osm.Diff{
+		Actions: osm.Actions{
+			{
+				Type: osm.ActionModify,
+				Old: &osm.OSM{Ways: osm.Ways{{ID: 1, Version: 1, Nodes: osm.WayNodes{
+					{ID: 1, Lon: 0.1, Lat: 0.1}, {ID: 2, Lon: 0.5, Lat: 0.1},
+				}}}},
+				New: &osm.OSM{Ways: osm.Ways{{ID: 1, Version: 2, Nodes: osm.WayNodes{
+					{ID: 1, Lon: 0.1, Lat: 0.1}, {ID: 3, Lon: 0.1, Lat: 0.5},
+				}}}},
+			},
+			{
+				Type: osm.ActionCreate,
+				OSM: &osm.OSM{Relations: osm.Relations{{ID: 1, Version: 1, Members: osm.Members{
+					{Type: osm.TypeNode, Ref: 5, Lon: 20.1, Lat: 20.1},
+					{Type: osm.TypeWay, Ref: 6, Nodes: osm.WayNodes{{ID: 7, Lon: -20.1, Lat: 20.1}}},
+				}}}},
+			},
+		},
+	}
+
+	e, _ := New(10, 10)
+	if err := e.AddDiff(context.Background(), diff); err != nil {
+		t.Fatalf("add error: %v", err)
+	}
+
+	expected := tiles(10,
+		orb.Point{0.1, 0.1}, orb.Point{0.5, 0.1}, orb.Point{0.1, 0.5},
+		orb.Point{20.1, 20.1}, orb.Point{-20.1, 20.1},
+	)
+	if v := e.Tiles(); !sameTiles(v, expected) || len(v) != 5 {
+		t.Errorf("incorrect tiles: %v", v)
+	}
+}
+
+func TestExpirer_Tiles(t *testing.T) {
+	e, err := New(12, 14)
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	e.AddGeometry(orb.Point{0.001, 0.001})
+	e.AddGeometry(orb.Point{-0.001, -0.001})
+
+	v := e.Tiles()
+	expected := maptile.Tiles{
+		maptile.New(2047, 2048, 12), maptile.New(2048, 2047, 12),
+		maptile.New(4095, 4096, 13), maptile.New(4096, 4095, 13),
+		maptile.New(8191, 8192, 14), maptile.New(8192, 8191, 14),
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Errorf("incorrect tiles: %v", v)
+	}
+
+	buf := &bytes.Buffer{}
+	n, err := e.WriteTo(buf)
+	if err != nil {
+		t.Fatalf("write error: %v", err)
+	}
+
+	if n != int64(buf.Len()) {
+		t.Errorf("incorrect length: %v != %v", n, buf.Len())
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 6 || lines[0] != "12/2047/2048" || lines[5] != "14/8192/8191" {
+		t.Errorf("incorrect output: %v", lines)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(10, 5); err == nil {
+		t.Errorf("should return error for invalid zoom range")
+	}
+}
+
+func sameTiles(v, expected maptile.Tiles) bool {
+	set := make(maptile.Set)
+	for _, t := range v {
+		set[t] = true
+	}
+
+	for _, t := range expected {
+		if !set[t] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,14 @@
+package osmexpire
+
+// Option is a parameter that can be used for computing expired tiles.
+type Option func(*Expirer) error
+
+// Store sets the location store used to find the old geometry and
+// the node locations not included in the change. Required to expire
+// an osm.Change or a diff where way nodes are not annotated.
+func Store(s LocationStore) Option {
+	return func(e *Expirer) error {
+		e.store = s
+		return nil
+	}
+}
@@ -0,0 +1,74 @@
+package osmexpire
+
+import (
+	"context"
+	"errors"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+)
+
+// A LocationStore provides the node locations from before the change.
+// It is used to find the old geometry of changed elements and the
+// geometry of ways that reference nodes not included in the change.
+type LocationStore interface {
+	NodeLocation(context.Context, osm.NodeID) (orb.Point, error)
+
+	// NotFound returns true if the error is a not found error.
+	// Nodes that are not found are skipped.
+	NotFound(error) bool
+}
+
+// A WayStore is an optional extension of a LocationStore. If implemented,
+// the ways whose nodes moved are expired, as well as the way members of
+// relations that are not included in the change.
+type WayStore interface {
+	Way(context.Context, osm.WayID) (*osm.Way, error)
+	NodeWays(context.Context, osm.NodeID) (osm.Ways, error)
+}
+
+var errNotFound = errors.New("osmexpire: not found")
+
+// IndexStore is a LocationStore and WayStore backed by an in memory index
+// of the data before the change.
+type IndexStore struct {
+	*osm.Index
+}
+
+var _ LocationStore = &IndexStore{}
+var _ WayStore = &IndexStore{}
+
+// NewIndexStore creates a store from the osm data.
+func NewIndexStore(o *osm.OSM) *IndexStore {
+	return &IndexStore{Index: osm.NewIndex(o)}
+}
+
+// NodeLocation returns the location of the latest version of the node.
+func (s *IndexStore) NodeLocation(ctx context.Context, id osm.NodeID) (orb.Point, error) {
+	n := s.Index.Node(id)
+	if n == nil {
+		return orb.Point{}, errNotFound
+	}
+
+	return n.Point(), nil
+}
+
+// Way returns the latest version of the way.
+func (s *IndexStore) Way(ctx context.Context, id osm.WayID) (*osm.Way, error) {
+	w := s.Index.Way(id)
+	if w == nil {
+		return nil, errNotFound
+	}
+
+	return w, nil
+}
+
+// NodeWays returns the ways that reference the node.
+func (s *IndexStore) NodeWays(ctx context.Context, id osm.NodeID) (osm.Ways, error) {
+	return s.Index.NodeWays(id), nil
+}
+
+// NotFound returns true if the error returned is a not found error.
+func (s *IndexStore) NotFound(err error) bool {
+	return err == errNotFound
+}
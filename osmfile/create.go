@@ -0,0 +1,227 @@
+package osmfile
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/paulmach/osm"
+)
+
+var (
+	// ErrUnsupportedFormat is returned when creating a file of a format
+	// that can not be written, currently pbf and bzip2 compression.
+	ErrUnsupportedFormat = errors.New("osmfile: writing format not supported")
+
+	// ErrChangeFile is returned when calling Write on an osmChange writer
+	// or WriteAction on a non-change writer.
+	ErrChangeFile = errors.New("osmfile: use WriteAction for osmChange files only")
+)
+
+// Writer wraps the format specific writer and includes the format
+// of the file. It is returned by Create.
+type Writer struct {
+	writer
+	Format Format
+}
+
+// writer is the interface of the format specific writers.
+type writer interface {
+	Write(osm.Object) error
+	WriteAction(osm.ActionType, osm.Object) error
+	Close() error
+}
+
+// Create creates the file and returns a writer for the format defined by
+// the file extension, see FormatFromName. It is the counterpart of Open.
+// Only osm xml, optionally gzip compressed, can be written, pbf and bzip2
+// files return ErrUnsupportedFormat and the file is not created.
+// Closing the writer will close the file.
+func Create(name string) (*Writer, error) {
+	format := FormatFromName(name)
+	if format.Encoding == EncodingUnknown {
+		return nil, ErrUnknownFormat
+	}
+
+	w, err := CreateXML(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Writer{writer: w, Format: format}, nil
+}
+
+// XMLWriter streams osm objects to a file in the osm xml or osmChange format.
+// Writing pbf files or bzip2 compression is not supported.
+type XMLWriter struct {
+	// Change is true for osmChange documents.
+	Change bool
+
+	buf     *bufio.Writer
+	encoder *xml.Encoder
+	closers []io.Closer
+
+	started bool
+	action  osm.ActionType
+}
+
+// CreateXML creates the file and returns a writer for the osm xml format
+// defined by the file extension, i.e. *.osm, *.osc or *.osh with an
+// optional .gz suffix. Other extensions return ErrUnsupportedFormat and
+// the file is not created. Closing the writer will close the file.
+func CreateXML(name string) (*XMLWriter, error) {
+	format := FormatFromName(name)
+	if format.Encoding != EncodingXML || format.Compression == CompressionBzip2 {
+		return nil, ErrUnsupportedFormat
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var w io.Writer = f
+	var closers []io.Closer
+	if format.Compression == CompressionGzip {
+		gw := gzip.NewWriter(f)
+		closers = append(closers, gw)
+		w = gw
+	}
+
+	writer := NewXMLWriter(w, format.Change)
+	writer.closers = append(closers, f)
+	return writer, nil
+}
+
+// NewXMLWriter returns a writer of osm xml, or osmChange if change is true.
+// The writer must be closed to finish the document, this does not close
+// the underlying writer.
+func NewXMLWriter(w io.Writer, change bool) *XMLWriter {
+	writer := &XMLWriter{
+		Change: change,
+		buf:    bufio.NewWriter(w),
+	}
+	writer.encoder = xml.NewEncoder(writer.buf)
+	writer.encoder.Indent("", "  ")
+
+	return writer
+}
+
+// Write writes the object to an osm xml file.
+func (w *XMLWriter) Write(o osm.Object) error {
+	if w.Change {
+		return ErrChangeFile
+	}
+
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	return w.encoder.Encode(o)
+}
+
+// WriteAction writes the object into the action section of an
+// osmChange file. Consecutive objects with the same action are written
+// into the same section.
+func (w *XMLWriter) WriteAction(action osm.ActionType, o osm.Object) error {
+	if !w.Change {
+		return ErrChangeFile
+	}
+
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	if w.action != action {
+		if err := w.endAction(); err != nil {
+			return err
+		}
+
+		se := xml.StartElement{Name: xml.Name{Local: string(action)}}
+		if err := w.encoder.EncodeToken(se); err != nil {
+			return err
+		}
+		w.action = action
+	}
+
+	return w.encoder.Encode(o)
+}
+
+func (w *XMLWriter) start() error {
+	if w.started {
+		return nil
+	}
+	w.started = true
+
+	name := "osm"
+	if w.Change {
+		name = "osmChange"
+	}
+
+	se := xml.StartElement{
+		Name: xml.Name{Local: name},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "version"}, Value: "0.6"}},
+	}
+
+	if _, err := w.buf.WriteString(xml.Header); err != nil {
+		return err
+	}
+
+	return w.encoder.EncodeToken(se)
+}
+
+func (w *XMLWriter) endAction() error {
+	if w.action == "" {
+		return nil
+	}
+
+	err := w.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: string(w.action)}})
+	w.action = ""
+	return err
+}
+
+// Close finishes the document and flushes the data. It closes
+// the compressor and the file if created with Create.
+func (w *XMLWriter) Close() error {
+	err := w.finish()
+	for _, c := range w.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	w.closers = nil
+
+	return err
+}
+
+func (w *XMLWriter) finish() error {
+	if err := w.start(); err != nil {
+		return err
+	}
+
+	if err := w.endAction(); err != nil {
+		return err
+	}
+
+	name := "osm"
+	if w.Change {
+		name = "osmChange"
+	}
+
+	if err := w.encoder.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}}); err != nil {
+		return err
+	}
+
+	if err := w.encoder.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := w.buf.WriteString("\n"); err != nil {
+		return err
+	}
+
+	return w.buf.Flush()
+}
@@ -0,0 +1,140 @@
+package osmfile
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestCreateXML(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	t.Run("osm gzip", func(t *testing.T) {
+		name := filepath.Join(dir, "data.osm.gz")
+		w, err := CreateXML(name)
+		if err != nil {
+			t.Fatalf("create error: %v", err)
+		}
+
+		objects := osm.Objects{
+			&osm.Node{ID: 1, Lat: 1, Lon: 2, Visible: true},
+			&osm.Way{ID: 2, Nodes: osm.WayNodes{{ID: 1}}},
+		}
+
+		for _, o := range objects {
+			if err := w.Write(o); err != nil {
+				t.Fatalf("write error: %v", err)
+			}
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatalf("close error: %v", err)
+		}
+
+		s, err := Open(ctx, name)
+		if err != nil {
+			t.Fatalf("open error: %v", err)
+		}
+		defer s.Close()
+
+		if s.Format.Compression != CompressionGzip {
+			t.Errorf("incorrect format: %+v", s.Format)
+		}
+
+		var result osm.Objects
+		for s.Scan() {
+			result = append(result, s.Object())
+		}
+
+		if len(result) != 2 || result[0].ObjectID() != objects[0].ObjectID() || result[1].ObjectID() != objects[1].ObjectID() {
+			t.Errorf("incorrect objects: %v", result)
+		}
+	})
+
+	t.Run("change", func(t *testing.T) {
+		buf := &bytes.Buffer{}
+		w := NewXMLWriter(buf, true)
+
+		if err := w.Write(&osm.Node{ID: 1}); err != ErrChangeFile {
+			t.Errorf("incorrect error: %v", err)
+		}
+
+		w.WriteAction(osm.ActionCreate, &osm.Node{ID: 1})
+		w.WriteAction(osm.ActionCreate, &osm.Node{ID: 2})
+		w.WriteAction(osm.ActionDelete, &osm.Way{ID: 3})
+		if err := w.Close(); err != nil {
+			t.Fatalf("close error: %v", err)
+		}
+
+		c := &osm.Change{}
+		if err := xml.Unmarshal(buf.Bytes(), c); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+
+		if len(c.Create.Nodes) != 2 || len(c.Delete.Ways) != 1 || c.Modify != nil {
+			t.Errorf("incorrect change: %v", buf.String())
+		}
+	})
+
+	t.Run("create", func(t *testing.T) {
+		name := filepath.Join(dir, "data.osc")
+		w, err := Create(name)
+		if err != nil {
+			t.Fatalf("create error: %v", err)
+		}
+
+		if !w.Format.Change || w.Format.Encoding != EncodingXML {
+			t.Errorf("incorrect format: %+v", w.Format)
+		}
+
+		if err := w.WriteAction(osm.ActionModify, &osm.Node{ID: 1}); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+
+		if err := w.Close(); err != nil {
+			t.Fatalf("close error: %v", err)
+		}
+
+		s, err := Open(ctx, name)
+		if err != nil {
+			t.Fatalf("open error: %v", err)
+		}
+		defer s.Close()
+
+		if !s.Format.Change {
+			t.Errorf("incorrect format: %+v", s.Format)
+		}
+
+		if _, err := Create(filepath.Join(dir, "a.txt")); err != ErrUnknownFormat {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		if _, err := Create(filepath.Join(dir, "a.osm.pbf")); err != ErrUnsupportedFormat {
+			t.Errorf("incorrect error: %v", err)
+		}
+
+		if _, err := Create(filepath.Join(dir, "a.osc.bz2")); err != ErrUnsupportedFormat {
+			t.Errorf("incorrect error: %v", err)
+		}
+
+		if _, err := CreateXML(filepath.Join(dir, "a.osm.pbf")); err != ErrUnsupportedFormat {
+			t.Errorf("incorrect error: %v", err)
+		}
+
+		if _, err := CreateXML(filepath.Join(dir, "a.osm.bz2")); err != ErrUnsupportedFormat {
+			t.Errorf("incorrect error: %v", err)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "a.osm.pbf")); !os.IsNotExist(err) {
+			t.Errorf("should not create file: %v", err)
+		}
+	})
+}
@@ -0,0 +1,131 @@
+package osmfile
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+
+	"github.com/paulmach/osm/osmpbf"
+)
+
+// Encoding is the data format of a file.
+type Encoding string
+
+// The supported encodings.
+const (
+	EncodingUnknown Encoding = ""
+	EncodingXML     Encoding = "xml"
+	EncodingPBF     Encoding = "pbf"
+)
+
+// Compression is the compression wrapping the data.
+// PBF files are not wrapped, their blocks are compressed internally.
+type Compression string
+
+// The supported compressions.
+const (
+	CompressionNone  Compression = ""
+	CompressionGzip  Compression = "gzip"
+	CompressionBzip2 Compression = "bzip2"
+)
+
+// Format describes the format of an osm data file.
+type Format struct {
+	Encoding    Encoding
+	Compression Compression
+
+	// Change is true for osmChange files, i.e. *.osc files.
+	Change bool
+
+	// History is true for files with all the versions of the elements,
+	// i.e. *.osh files or pbf files with the HistoricalInformation feature.
+	History bool
+
+	// Header is the header of pbf files.
+	Header *osmpbf.Header
+}
+
+// FormatFromName returns the format based on the file extension.
+// Supports *.osm, *.osc, *.osh and *.pbf with optional .gz or .bz2 suffixes.
+func FormatFromName(name string) Format {
+	f := Format{}
+
+	name = strings.ToLower(filepath.Base(name))
+	switch {
+	case strings.HasSuffix(name, ".gz"):
+		f.Compression = CompressionGzip
+		name = strings.TrimSuffix(name, ".gz")
+	case strings.HasSuffix(name, ".bz2"):
+		f.Compression = CompressionBzip2
+		name = strings.TrimSuffix(name, ".bz2")
+	}
+
+	switch filepath.Ext(name) {
+	case ".pbf":
+		f.Encoding = EncodingPBF
+		f.History = filepath.Ext(strings.TrimSuffix(name, ".pbf")) == ".osh"
+	case ".osm", ".xml":
+		f.Encoding = EncodingXML
+	case ".osc":
+		f.Encoding = EncodingXML
+		f.Change = true
+	case ".osh":
+		f.Encoding = EncodingXML
+		f.History = true
+	}
+
+	return f
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// sniffCompression returns the compression based on the magic bytes
+// at the start of the data.
+func sniffCompression(data []byte) (Compression, bool) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return CompressionGzip, true
+	case bytes.HasPrefix(data, bzip2Magic):
+		return CompressionBzip2, true
+	}
+
+	return CompressionNone, false
+}
+
+// sniffEncoding returns the encoding, and if it is a change file, based
+// on the start of the uncompressed data. PBF files start with the size of the
+// first blob header followed by the blob type, "OSMHeader" or "OSMData".
+func sniffEncoding(data []byte) (Encoding, bool, bool) {
+	if len(data) > 8 && data[0] == 0 && data[4] == 0x0a {
+		start := data[6:]
+		if bytes.HasPrefix(start, []byte("OSMHeader")) || bytes.HasPrefix(start, []byte("OSMData")) {
+			return EncodingPBF, false, true
+		}
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) == 0 || data[0] != '<' {
+		return EncodingUnknown, false, false
+	}
+
+	// find the first non-declaration, non-comment element
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '<')
+		if i == -1 {
+			break
+		}
+		data = data[i+1:]
+
+		if len(data) > 0 && (data[0] == '?' || data[0] == '!') {
+			continue
+		}
+
+		return EncodingXML, bytes.HasPrefix(data, []byte("osmChange")), true
+	}
+
+	return EncodingXML, false, true
+}
@@ -0,0 +1,74 @@
+package osmfile
+
+import (
+	"testing"
+)
+
+func TestFormatFromName(t *testing.T) {
+	cases := []struct {
+		name   string
+		format Format
+	}{
+		{name: "a.osm", format: Format{Encoding: EncodingXML}},
+		{name: "dir/A.OSM.GZ", format: Format{Encoding: EncodingXML, Compression: CompressionGzip}},
+		{name: "andorra-latest.osm.bz2", format: Format{Encoding: EncodingXML, Compression: CompressionBzip2}},
+		{name: "minute.osc.gz", format: Format{Encoding: EncodingXML, Compression: CompressionGzip, Change: true}},
+		{name: "delaware-latest.osm.pbf", format: Format{Encoding: EncodingPBF}},
+		{name: "history.osh.pbf", format: Format{Encoding: EncodingPBF, History: true}},
+		{name: "history.osh.bz2", format: Format{Encoding: EncodingXML, Compression: CompressionBzip2, History: true}},
+		{name: "data.json", format: Format{}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			f := FormatFromName(tc.name)
+			if f != tc.format {
+				t.Errorf("incorrect format: %+v", f)
+			}
+		})
+	}
+}
+
+func TestSniffEncoding(t *testing.T) {
+	cases := []struct {
+		name     string
+		data     string
+		encoding Encoding
+		change   bool
+	}{
+		{
+			name:     "pbf header",
+			data:     "\x00\x00\x00\x0d\x0a\x09OSMHeader\x18",
+			encoding: EncodingPBF,
+		},
+		{
+			name:     "pbf data",
+			data:     "\x00\x00\x00\x0d\x0a\x07OSMData\x18\x00",
+			encoding: EncodingPBF,
+		},
+		{
+			name:     "osm xml",
+			data:     "<?xml version='1.0' encoding='UTF-8'?>\n<osm version=\"0.6\">",
+			encoding: EncodingXML,
+		},
+		{
+			name:     "osmChange xml",
+			data:     "\xef\xbb\xbf  <?xml version='1.0'?><!-- comment --><osmChange version=\"0.6\">",
+			encoding: EncodingXML,
+			change:   true,
+		},
+		{
+			name: "json",
+			data: `{"elements": []}`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			e, change, ok := sniffEncoding([]byte(tc.data))
+			if e != tc.encoding || change != tc.change || ok != (tc.encoding != EncodingUnknown) {
+				t.Errorf("incorrect sniff: %v %v %v", e, change, ok)
+			}
+		})
+	}
+}
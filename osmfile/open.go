@@ -0,0 +1,174 @@
+// Package osmfile opens osm data files of any supported format and
+// compression with a single entry point. Create is the counterpart
+// for writing osm xml files.
+package osmfile
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"github.com/paulmach/osm/osmxml"
+)
+
+// ErrUnknownFormat is returned if the format of the data could not be determined.
+var ErrUnknownFormat = errors.New("osmfile: unknown format")
+
+// sniffSize is the number of bytes read to detect the format.
+const sniffSize = 512
+
+var _ osm.Scanner = &Scanner{}
+
+// Scanner wraps the format specific scanner and includes information
+// about the format of the data.
+type Scanner struct {
+	osm.Scanner
+	Format Format
+
+	closers []io.Closer
+}
+
+// Open opens the file and returns a scanner for the detected format.
+// The format is detected using the magic bytes at the start of the data,
+// the file extension is used if the bytes are inconclusive.
+// Closing the scanner will close the file.
+func Open(ctx context.Context, name string) (*Scanner, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := NewScanner(ctx, f, name)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s.closers = append(s.closers, f)
+	return s, nil
+}
+
+// NewScanner returns a scanner for the detected format of the data in r.
+// The name is optional and is used as a hint if the format can not
+// be detected from the data. The reader is not closed by the scanner.
+func NewScanner(ctx context.Context, r io.Reader, name string) (*Scanner, error) {
+	format := FormatFromName(name)
+	s := &Scanner{}
+
+	br := bufio.NewReader(r)
+	data, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+
+	if c, ok := sniffCompression(data); ok {
+		format.Compression = c
+	} else if len(data) > 0 {
+		format.Compression = CompressionNone
+	}
+
+	var reader io.Reader = br
+	switch format.Compression {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		s.closers = append(s.closers, gr)
+		reader = gr
+	case CompressionBzip2:
+		reader = bzip2.NewReader(br)
+	}
+
+	if format.Compression != CompressionNone {
+		br = bufio.NewReader(reader)
+		reader = br
+
+		data, err = br.Peek(sniffSize)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			s.close()
+			return nil, err
+		}
+	}
+
+	if e, change, ok := sniffEncoding(data); ok {
+		format.Encoding = e
+		format.Change = change
+	}
+
+	switch format.Encoding {
+	case EncodingPBF:
+		scanner := osmpbf.New(ctx, reader, runtime.GOMAXPROCS(-1))
+		header, err := scanner.Header()
+		if err != nil {
+			scanner.Close()
+			s.close()
+			return nil, err
+		}
+
+		format.Header = header
+		if hasFeature(header, "HistoricalInformation") {
+			format.History = true
+		}
+
+		s.Scanner = scanner
+	case EncodingXML:
+		s.Scanner = osmxml.NewParallel(ctx, reader, runtime.GOMAXPROCS(-1))
+	default:
+		s.close()
+		return nil, ErrUnknownFormat
+	}
+
+	s.Format = format
+	return s, nil
+}
+
+func hasFeature(h *osmpbf.Header, feature string) bool {
+	if h == nil {
+		return false
+	}
+
+	for _, f := range h.RequiredFeatures {
+		if f == feature {
+			return true
+		}
+	}
+
+	for _, f := range h.OptionalFeatures {
+		if f == feature {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Close closes the underlying scanner, any decompressors
+// and the file if opened with Open.
+func (s *Scanner) Close() error {
+	err := s.Scanner.Close()
+	if cerr := s.close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func (s *Scanner) close() error {
+	var err error
+	for _, c := range s.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	s.closers = nil
+
+	return err
+}
@@ -0,0 +1,73 @@
+package osmfile
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("bzip2 xml", func(t *testing.T) {
+		s, err := Open(ctx, "../testdata/andorra-latest.osm.bz2")
+		if err != nil {
+			t.Fatalf("open error: %v", err)
+		}
+		defer s.Close()
+
+		expected := Format{Encoding: EncodingXML, Compression: CompressionBzip2}
+		if s.Format != expected {
+			t.Errorf("incorrect format: %+v", s.Format)
+		}
+
+		count := 0
+		for s.Scan() && count < 10 {
+			count++
+		}
+
+		if err := s.Err(); err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+
+		if count != 10 {
+			t.Errorf("incorrect count: %v", count)
+		}
+	})
+
+	t.Run("change file", func(t *testing.T) {
+		s, err := Open(ctx, "../testdata/minute_871.osc")
+		if err != nil {
+			t.Fatalf("open error: %v", err)
+		}
+		defer s.Close()
+
+		if !s.Format.Change || s.Format.Encoding != EncodingXML {
+			t.Errorf("incorrect format: %+v", s.Format)
+		}
+	})
+
+	t.Run("extension is overridden by content", func(t *testing.T) {
+		s, err := NewScanner(ctx, strings.NewReader(`<osm><node id="1"/></osm>`), "data.osm.pbf")
+		if err != nil {
+			t.Fatalf("open error: %v", err)
+		}
+		defer s.Close()
+
+		if s.Format.Encoding != EncodingXML {
+			t.Errorf("incorrect format: %+v", s.Format)
+		}
+
+		if !s.Scan() {
+			t.Fatalf("should scan node: %v", s.Err())
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := NewScanner(ctx, bytes.NewReader([]byte(`{}`)), "")
+		if err != ErrUnknownFormat {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+}
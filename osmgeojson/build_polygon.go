@@ -32,7 +32,7 @@ func (ctx *context) buildPolygon(relation *osm.Relation) *geojson.Feature {
 			outerCount++
 		}
 
-		way := ctx.wayMap[osm.WayID(m.Ref)]
+		way := ctx.getWay(osm.WayID(m.Ref))
 		if way == nil {
 			if len(m.Nodes) != 0 {
 				way = &osm.Way{
@@ -0,0 +1,176 @@
+package osmgeojson
+
+import (
+	"fmt"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/internal/mputil"
+)
+
+// A RelationMember is a member of a relation with its geometry.
+type RelationMember struct {
+	osm.Member
+
+	// Geometry is a point for nodes, a line string for ways and the
+	// geometry of the relation feature for relations. It is nil if the
+	// member, or its geometry, is not in the data.
+	Geometry orb.Geometry
+}
+
+// A RelationBuilderFunc returns the geometry of a relation using the geometry
+// of its members. Returning nil will skip the relation.
+type RelationBuilderFunc func(r *osm.Relation, members []RelationMember) orb.Geometry
+
+// defaultRelationBuilders are used for the relation types
+// other than route, multipolygon and boundary.
+var defaultRelationBuilders = map[string]RelationBuilderFunc{
+	"restriction":      BuildMemberCollection,
+	"site":             BuildMemberCollection,
+	"associatedStreet": BuildMemberCollection,
+	"public_transport": BuildMemberCollection,
+	"route_master":     BuildMemberCollection,
+	"waterway":         BuildJoinedLines,
+}
+
+// BuildMemberCollection returns a geometry collection of the members
+// that have geometry.
+func BuildMemberCollection(r *osm.Relation, members []RelationMember) orb.Geometry {
+	var collection orb.Collection
+	for _, m := range members {
+		if m.Geometry != nil {
+			collection = append(collection, m.Geometry)
+		}
+	}
+
+	if len(collection) == 0 {
+		return nil
+	}
+
+	return collection
+}
+
+// BuildJoinedLines joins the way members end to end into a line string,
+// or a multi line string if they are not connected.
+func BuildJoinedLines(r *osm.Relation, members []RelationMember) orb.Geometry {
+	lines := make([]mputil.Segment, 0, len(members))
+	for _, m := range members {
+		ls, ok := m.Geometry.(orb.LineString)
+		if m.Type != osm.TypeWay || !ok || len(ls) == 0 {
+			continue
+		}
+
+		lines = append(lines, mputil.Segment{
+			Orientation: m.Orientation,
+			Line:        ls,
+		})
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return joinedLines(lines)
+}
+
+func joinedLines(lines []mputil.Segment) orb.Geometry {
+	lineSections := mputil.Join(lines)
+	if len(lineSections) == 1 {
+		return lineSections[0].LineString()
+	}
+
+	mls := make(orb.MultiLineString, 0, len(lineSections))
+	for _, ls := range lineSections {
+		mls = append(mls, ls.LineString())
+	}
+
+	return mls
+}
+
+func (ctx *context) buildRelation(relation *osm.Relation, fn RelationBuilderFunc) *geojson.Feature {
+	if ctx.building[relation.ID] {
+		// relation is a member of itself
+		return nil
+	}
+
+	if ctx.building == nil {
+		ctx.building = make(map[osm.RelationID]bool)
+	}
+	ctx.building[relation.ID] = true
+	defer delete(ctx.building, relation.ID)
+
+	members, tainted := ctx.relationMembers(relation)
+	geometry := fn(relation, members)
+	if geometry == nil {
+		return nil
+	}
+
+	f := geojson.NewFeature(geometry)
+	if !ctx.noID {
+		f.ID = fmt.Sprintf("relation/%d", relation.ID)
+	}
+
+	f.Properties["id"] = int(relation.ID)
+	f.Properties["type"] = "relation"
+
+	if tainted {
+		f.Properties["tainted"] = true
+	}
+
+	f.Properties["tags"] = relation.Tags.Map()
+	ctx.addMetaProperties(f.Properties, relation)
+
+	return f
+}
+
+// relationMembers returns the members with their geometry. Tainted
+// is true if any of the member geometry is missing or incomplete.
+func (ctx *context) relationMembers(relation *osm.Relation) ([]RelationMember, bool) {
+	tainted := false
+	members := make([]RelationMember, 0, len(relation.Members))
+	for _, m := range relation.Members {
+		rm := RelationMember{Member: m}
+		switch m.Type {
+		case osm.TypeNode:
+			if m.Lat != 0 || m.Lon != 0 {
+				rm.Geometry = m.Point()
+			} else if n := ctx.getNode(osm.NodeID(m.Ref)); n != nil {
+				rm.Geometry = n.Point()
+			}
+		case osm.TypeWay:
+			way := ctx.getWay(osm.WayID(m.Ref))
+			if way == nil && len(m.Nodes) != 0 {
+				way = &osm.Way{ID: osm.WayID(m.Ref), Nodes: m.Nodes}
+			}
+
+			if way != nil {
+				ls, t := ctx.wayToLineString(way)
+				if t {
+					tainted = true
+				}
+
+				if len(ls) > 1 {
+					rm.Geometry = ls
+				}
+			}
+		case osm.TypeRelation:
+			if r := ctx.relationMap[osm.RelationID(m.Ref)]; r != nil {
+				if f := ctx.relationToFeature(r); f != nil {
+					rm.Geometry = f.Geometry
+					if f.Properties["tainted"] == true {
+						tainted = true
+					}
+				}
+			}
+		}
+
+		if rm.Geometry == nil {
+			tainted = true
+		}
+
+		members = append(members, rm)
+	}
+
+	return members, tainted
+}
@@ -0,0 +1,221 @@
+package osmgeojson
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+func relationTestData(relationType string, members osm.Members) *osm.OSM {
+	return &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 0, Lon: 0},
+			{ID: 2, Version: 1, Lat: 0, Lon: 1},
+			{ID: 3, Version: 1, Lat: 0, Lon: 2},
+			{ID: 4, Version: 1, Lat: 1, Lon: 1, Tags: osm.Tags{{Key: "addr:housenumber", Value: "1"}}},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}, Tags: osm.Tags{{Key: "waterway", Value: "river"}}},
+			{ID: 2, Version: 1, Nodes: osm.WayNodes{{ID: 3}, {ID: 2}}, Tags: osm.Tags{{Key: "waterway", Value: "river"}}},
+		},
+		Relations: osm.Relations{
+			{ID: 1, Version: 1, Members: members,
+				Tags: osm.Tags{{Key: "type", Value: relationType}}},
+		},
+	}
+}
+
+func relationFeature(t *testing.T, fc *geojson.FeatureCollection) *geojson.Feature {
+	t.Helper()
+
+	for _, f := range fc.Features {
+		if f.Properties["type"] == "relation" {
+			return f
+		}
+	}
+
+	return nil
+}
+
+func TestConvert_relationTypes(t *testing.T) {
+	members := osm.Members{
+		{Type: osm.TypeWay, Ref: 1, Role: "street"},
+		{Type: osm.TypeNode, Ref: 4, Role: "house"},
+	}
+
+	for _, tt := range []string{"restriction", "site", "associatedStreet", "public_transport", "route_master"} {
+		t.Run(tt, func(t *testing.T) {
+			fc, err := Convert(relationTestData(tt, members))
+			if err != nil {
+				t.Fatalf("convert error: %v", err)
+			}
+
+			f := relationFeature(t, fc)
+			if f == nil {
+				t.Fatalf("relation should be a feature")
+			}
+
+			c, ok := f.Geometry.(orb.Collection)
+			if !ok || len(c) != 2 {
+				t.Fatalf("incorrect geometry: %v", f.Geometry)
+			}
+
+			if _, ok := c[0].(orb.LineString); !ok {
+				t.Errorf("way should be line string: %v", c[0])
+			}
+
+			if c[1] != (orb.Point{1, 1}) {
+				t.Errorf("incorrect node: %v", c[1])
+			}
+
+			if f.ID != "relation/1" || f.Properties["tainted"] != nil {
+				t.Errorf("incorrect properties: %v %v", f.ID, f.Properties)
+			}
+
+			// the member ways are not skipped
+			if len(fc.Features) != 4 {
+				t.Errorf("incorrect number of features: %v", len(fc.Features))
+			}
+		})
+	}
+
+	// unknown types are skipped
+	fc, err := Convert(relationTestData("unknown", members))
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	if f := relationFeature(t, fc); f != nil {
+		t.Errorf("should skip unknown types: %v", f)
+	}
+}
+
+func TestConvert_waterwayRelation(t *testing.T) {
+	o := relationTestData("waterway", osm.Members{
+		{Type: osm.TypeWay, Ref: 1, Role: "main_stream"},
+		{Type: osm.TypeWay, Ref: 2, Role: "main_stream"},
+		{Type: osm.TypeWay, Ref: 3, Role: "main_stream"},
+	})
+
+	fc, err := Convert(o)
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	f := relationFeature(t, fc)
+	if ls, ok := f.Geometry.(orb.LineString); !ok || len(ls) != 3 {
+		t.Errorf("ways should be joined: %v", f.Geometry)
+	}
+
+	if f.Properties["tainted"] != true {
+		t.Errorf("should be tainted for missing way")
+	}
+}
+
+func TestConvert_nestedRelations(t *testing.T) {
+	o := relationTestData("route", osm.Members{
+		{Type: osm.TypeWay, Ref: 1},
+	})
+
+	o.Relations = append(o.Relations,
+		&osm.Relation{ID: 2, Version: 1,
+			Tags: osm.Tags{{Key: "type", Value: "route_master"}},
+			Members: osm.Members{
+				{Type: osm.TypeRelation, Ref: 1},
+				{Type: osm.TypeRelation, Ref: 2}, // itself
+			},
+		},
+	)
+
+	fc, err := Convert(o)
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	var master *geojson.Feature
+	for _, f := range fc.Features {
+		if f.ID == "relation/2" {
+			master = f
+		}
+	}
+
+	if master == nil {
+		t.Fatalf("route master should be a feature")
+	}
+
+	c, ok := master.Geometry.(orb.Collection)
+	if !ok || len(c) != 1 {
+		t.Fatalf("incorrect geometry: %v", master.Geometry)
+	}
+
+	if _, ok := c[0].(orb.LineString); !ok {
+		t.Errorf("should include route geometry: %v", c[0])
+	}
+
+	if master.Properties["tainted"] != true {
+		t.Errorf("cycle should be tainted")
+	}
+}
+
+func TestRelationBuilder(t *testing.T) {
+	o := relationTestData("custom", osm.Members{
+		{Type: osm.TypeNode, Ref: 1},
+		{Type: osm.TypeNode, Ref: 3},
+	})
+
+	// first member only
+	builder := func(r *osm.Relation, members []RelationMember) orb.Geometry {
+		return members[0].Geometry
+	}
+
+	fc, err := Convert(o, RelationBuilder("custom", builder))
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	f := relationFeature(t, fc)
+	if f == nil || f.Geometry != (orb.Point{0, 0}) {
+		t.Errorf("incorrect feature: %v", f)
+	}
+
+	// can remove a default
+	o = relationTestData("site", osm.Members{{Type: osm.TypeNode, Ref: 4}})
+	fc, err = Convert(o, RelationBuilder("site", nil))
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	if f := relationFeature(t, fc); f != nil {
+		t.Errorf("should skip type: %v", f)
+	}
+}
+
+func TestConvert_relationSinglePointWay(t *testing.T) {
+	o := relationTestData("site", osm.Members{
+		{Type: osm.TypeWay, Ref: 3},
+		{Type: osm.TypeNode, Ref: 4},
+	})
+	o.Ways = append(o.Ways, &osm.Way{ID: 3, Version: 1, Nodes: osm.WayNodes{{ID: 1}}})
+
+	fc, err := Convert(o)
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	f := relationFeature(t, fc)
+	if f == nil {
+		t.Fatalf("relation should be a feature")
+	}
+
+	// the single point way is not a line string
+	c, ok := f.Geometry.(orb.Collection)
+	if !ok || len(c) != 1 || c[0].GeoJSONType() != "Point" {
+		t.Errorf("incorrect geometry: %v", f.Geometry)
+	}
+
+	if f.Properties["tainted"] != true {
+		t.Errorf("should be tainted")
+	}
+}
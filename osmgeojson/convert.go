@@ -14,14 +14,27 @@ type context struct {
 	noMeta                 bool
 	noRelationMembership   bool
 	includeInvalidPolygons bool
+	textSequence           bool
+
+	areaRules        osm.AreaRules
+	tagMapper        func(geojson.Properties) osm.Tags
+	relationBuilders map[string]RelationBuilderFunc
 
 	osm       *osm.OSM
 	skippable map[osm.WayID]struct{}
 
+	// used when converting a scanner
+	store Store
+	err   error
+
 	relationMember map[osm.FeatureID][]*relationSummary
 	wayMember      map[osm.NodeID]struct{}
 	nodeMap        map[osm.NodeID]*osm.Node
 	wayMap         map[osm.WayID]*osm.Way
+	relationMap    map[osm.RelationID]*osm.Relation
+
+	// relations being built, to stop member cycles
+	building map[osm.RelationID]bool
 }
 
 type relationSummary struct {
@@ -44,6 +57,8 @@ func Convert(o *osm.OSM, opts ...Option) (*geojson.FeatureCollection, error) {
 		}
 	}
 
+	// all the data is in o, the store is only used for scanners
+	ctx.store = nil
 	ctx.wayMap = make(map[osm.WayID]*osm.Way, len(o.Ways))
 	for _, w := range ctx.osm.Ways {
 		ctx.wayMap[w.ID] = w
@@ -56,9 +71,54 @@ func Convert(o *osm.OSM, opts ...Option) (*geojson.FeatureCollection, error) {
 		}
 	}
 
-	// figure out relation membership map
-	ctx.relationMember = make(map[osm.FeatureID][]*relationSummary)
+	ctx.buildRelationMembership(ctx.osm.Relations)
+
+	features := make([]*geojson.Feature, 0, len(ctx.osm.Relations)+len(ctx.osm.Ways))
+
+	// relations
 	for _, relation := range ctx.osm.Relations {
+		feature := ctx.relationToFeature(relation)
+		if feature != nil {
+			features = append(features, feature)
+		}
+	}
+
+	for _, way := range ctx.osm.Ways {
+		// should skip only skippable relation members
+		if _, skip := ctx.skippable[way.ID]; skip {
+			continue
+		}
+
+		feature := ctx.wayToFeature(way)
+		if feature != nil {
+			features = append(features, feature)
+		}
+	}
+
+	for _, node := range ctx.osm.Nodes {
+		if ctx.skipNode(node) {
+			continue
+		}
+
+		feature := ctx.nodeToFeature(node)
+		if feature != nil {
+			features = append(features, feature)
+		}
+	}
+
+	fc := geojson.NewFeatureCollection()
+	fc.Features = features
+
+	return fc, nil
+}
+
+// buildRelationMembership figures out the relation membership map.
+func (ctx *context) buildRelationMembership(relations osm.Relations) {
+	ctx.relationMap = make(map[osm.RelationID]*osm.Relation, len(relations))
+	ctx.relationMember = make(map[osm.FeatureID][]*relationSummary)
+	for _, relation := range relations {
+		ctx.relationMap[relation.ID] = relation
+
 		var tags map[string]string
 		for _, m := range relation.Members {
 			if ctx.noRelationMembership && m.Type != osm.TypeNode {
@@ -71,7 +131,7 @@ func Convert(o *osm.OSM, opts ...Option) (*geojson.FeatureCollection, error) {
 				// We only need to store the way membership for ways that are
 				// present. eg. relations could have thousands of members but only
 				// a few in set of osm.
-				if _, ok := ctx.wayMap[osm.WayID(m.Ref)]; !ok {
+				if ctx.getWay(osm.WayID(m.Ref)) == nil {
 					continue
 				}
 			}
@@ -88,70 +148,71 @@ func Convert(o *osm.OSM, opts ...Option) (*geojson.FeatureCollection, error) {
 			})
 		}
 	}
+}
 
-	features := make([]*geojson.Feature, 0, len(ctx.osm.Relations)+len(ctx.osm.Ways))
-
-	// relations
-	for _, relation := range ctx.osm.Relations {
-		tt := relation.Tags.Find("type")
-		if tt == "route" {
-			feature := ctx.buildRouteLineString(relation)
-			if feature != nil {
-				features = append(features, feature)
-			}
-		} else if tt == "multipolygon" || tt == "boundary" {
-			feature := ctx.buildPolygon(relation)
-			if feature != nil {
-				features = append(features, feature)
-			}
+func (ctx *context) relationToFeature(relation *osm.Relation) *geojson.Feature {
+	tt := relation.Tags.Find("type")
+	if fn, ok := ctx.relationBuilders[tt]; ok {
+		if fn == nil {
+			return nil
 		}
 
-		// NOTE: we skip/ignore relation that aren't multipolygons, boundaries or routes
+		return ctx.buildRelation(relation, fn)
 	}
 
-	for _, way := range ctx.osm.Ways {
-		// should skip only skippable relation members
-		if _, skip := ctx.skippable[way.ID]; skip {
-			continue
-		}
+	if tt == "route" {
+		return ctx.buildRouteLineString(relation)
+	} else if ctx.relationPolygon(relation) {
+		return ctx.buildPolygon(relation)
+	} else if tt == "boundary" {
+		// boundaries that are not areas, using the custom rules, are lines
+		return ctx.buildRelation(relation, BuildJoinedLines)
+	}
 
-		feature := ctx.wayToFeature(way)
-		if feature != nil {
-			features = append(features, feature)
-		}
+	if fn := defaultRelationBuilders[tt]; fn != nil {
+		return ctx.buildRelation(relation, fn)
 	}
 
-	for _, node := range ctx.osm.Nodes {
-		// should NOT skip if any are true:
-		//   not a member of a way.
-		//   a member of a relation member
-		//   has any interesting tags
-		// should skip if all are true:
-		//   a member of a way.
-		//   not a member of a relation member
-		//   does not have any interesting tags
-		if _, ok := ctx.wayMember[node.ID]; ok &&
-			len(ctx.relationMember[node.FeatureID()]) == 0 &&
-			!hasInterestingTags(node.Tags, nil) {
-			continue
-		}
+	// NOTE: we skip/ignore relation types without a builder
+	return nil
+}
 
-		feature := ctx.nodeToFeature(node)
-		if feature != nil {
-			features = append(features, feature)
-		}
-	}
+// skipNode returns true if the node should not be a feature.
+func (ctx *context) skipNode(node *osm.Node) bool {
+	// should NOT skip if any are true:
+	//   not a member of a way.
+	//   a member of a relation member
+	//   has any interesting tags
+	// should skip if all are true:
+	//   a member of a way.
+	//   not a member of a relation member
+	//   does not have any interesting tags
+	return len(ctx.relationMember[node.FeatureID()]) == 0 &&
+		!hasInterestingTags(node.Tags, nil) &&
+		ctx.isWayMember(node.ID)
+}
 
-	fc := geojson.NewFeatureCollection()
-	fc.Features = features
+func (ctx *context) isWayMember(id osm.NodeID) bool {
+	if ctx.store != nil {
+		ok, err := ctx.store.WayMember(id)
+		ctx.setErr(err)
+		return ok
+	}
 
-	return fc, nil
+	_, ok := ctx.wayMember[id]
+	return ok
 }
 
 // getNode will find the node in the set.
 // This allows to lazily create the node map only if
 // the nodes+ways aren't augmented (ie. include the lat/lon on them).
 func (ctx *context) getNode(id osm.NodeID) *osm.Node {
+	if ctx.store != nil {
+		n, err := ctx.store.Node(id)
+		ctx.setErr(err)
+		return n
+	}
+
 	if ctx.nodeMap == nil {
 		ctx.nodeMap = make(map[osm.NodeID]*osm.Node, len(ctx.osm.Nodes))
 		for _, n := range ctx.osm.Nodes {
@@ -162,6 +223,24 @@ func (ctx *context) getNode(id osm.NodeID) *osm.Node {
 	return ctx.nodeMap[id]
 }
 
+func (ctx *context) getWay(id osm.WayID) *osm.Way {
+	if ctx.store != nil {
+		w, err := ctx.store.Way(id)
+		ctx.setErr(err)
+		return w
+	}
+
+	return ctx.wayMap[id]
+}
+
+// setErr keeps the first store error, the conversion
+// stops after the current feature.
+func (ctx *context) setErr(err error) {
+	if err != nil && ctx.err == nil {
+		ctx.err = err
+	}
+}
+
 func (ctx *context) nodeToFeature(n *osm.Node) *geojson.Feature {
 	// our definition of empty, ill defined
 	if n.Lon == 0 && n.Lat == 0 && n.Version == 0 {
@@ -206,7 +285,7 @@ func (ctx *context) wayToFeature(w *osm.Way) *geojson.Feature {
 	}
 
 	var f *geojson.Feature
-	if w.Polygon() {
+	if ctx.polygon(w) {
 		p := orb.Polygon{toRing(ls)}
 		reorient(p)
 		f = geojson.NewFeature(p)
@@ -230,6 +309,24 @@ func (ctx *context) wayToFeature(w *osm.Way) *geojson.Feature {
 	return f
 }
 
+// polygon returns true if the way is an area using the custom area rules.
+func (ctx *context) polygon(w *osm.Way) bool {
+	if ctx.areaRules == nil {
+		return w.Polygon()
+	}
+
+	return w.PolygonWithRules(ctx.areaRules)
+}
+
+// relationPolygon returns true if the relation is an area using the custom area rules.
+func (ctx *context) relationPolygon(r *osm.Relation) bool {
+	if ctx.areaRules == nil {
+		return r.Polygon()
+	}
+
+	return r.PolygonWithRules(ctx.areaRules)
+}
+
 func (ctx *context) buildRouteLineString(relation *osm.Relation) *geojson.Feature {
 	lines := make([]mputil.Segment, 0, 10)
 	tainted := false
@@ -238,7 +335,7 @@ func (ctx *context) buildRouteLineString(relation *osm.Relation) *geojson.Featur
 			continue
 		}
 
-		way := ctx.wayMap[osm.WayID(m.Ref)]
+		way := ctx.getWay(osm.WayID(m.Ref))
 		if way == nil {
 			tainted = true
 			continue
@@ -269,20 +366,7 @@ func (ctx *context) buildRouteLineString(relation *osm.Relation) *geojson.Featur
 		return nil
 	}
 
-	lineSections := mputil.Join(lines)
-
-	var geometry orb.Geometry
-	if len(lineSections) == 1 {
-		geometry = lineSections[0].LineString()
-	} else {
-		mls := make(orb.MultiLineString, 0, len(lines))
-		for _, ls := range lineSections {
-			mls = append(mls, ls.LineString())
-		}
-		geometry = mls
-	}
-
-	f := geojson.NewFeature(geometry)
+	f := geojson.NewFeature(joinedLines(lines))
 	if !ctx.noID {
 		f.ID = fmt.Sprintf("relation/%d", relation.ID)
 	}
@@ -9,6 +9,7 @@ import (
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
 )
 
 func TestConvert(t *testing.T) {
@@ -649,6 +650,20 @@ func testConvert(t *testing.T, rawXML string, expected *geojson.FeatureCollectio
 	raw := jsonLoop(t, fc)
 	expectedRaw := jsonLoop(t, expected)
 
+	// the scanner conversion should match
+	scanned := geojson.NewFeatureCollection()
+	err = ConvertScanner(osmtest.NewScanner(o.Objects()), func(f *geojson.Feature) error {
+		scanned.Append(f)
+		return nil
+	}, opts...)
+	if err != nil {
+		t.Fatalf("convert scanner error: %v", err)
+	}
+
+	if v := jsonLoop(t, scanned); !reflect.DeepEqual(v, raw) {
+		t.Errorf("scanner conversion not equal")
+	}
+
 	if !reflect.DeepEqual(raw, expectedRaw) {
 		if len(raw.Features) != len(expectedRaw.Features) {
 			t.Logf("%v", jsonMarshalIndent(t, raw))
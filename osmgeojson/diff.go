@@ -0,0 +1,261 @@
+package osmgeojson
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+// Values of the "change" property of modified elements.
+const (
+	ChangeTagsOnly        = "tags_only"
+	ChangeGeometryOnly    = "geometry_only"
+	ChangeTagsAndGeometry = "tags_and_geometry"
+	ChangeOther           = "other"
+)
+
+type diffFeature struct {
+	element osm.Element
+	feature *geojson.Feature
+}
+
+// ConvertDiff converts the old and new versions of the elements in the diff,
+// for example from annotate.Change, to geojson features. The features have
+// the same properties as Convert plus "action" (create, modify or delete),
+// "state" (old or new) and "changeset". Modified elements also have a "change"
+// property with the tags only, geometry only, tags and geometry or other
+// classification of the change.
+//
+// Way geometry is built from the annotated way node locations, or the nodes
+// in the same side of the diff. Multipolygon, boundary and route relations
+// are assembled from the member ways in the diff or the member nodes.
+// Other relations are a collection of their member geometry.
+func ConvertDiff(diff *osm.Diff, opts ...Option) (*geojson.FeatureCollection, error) {
+	oldOSM, newOSM := &osm.OSM{}, &osm.OSM{}
+	for _, a := range diff.Actions {
+		switch a.Type {
+		case osm.ActionCreate:
+			appendOSM(newOSM, a.OSM)
+		case osm.ActionModify:
+			appendOSM(oldOSM, a.Old)
+			appendOSM(newOSM, a.New)
+		case osm.ActionDelete:
+			appendOSM(oldOSM, a.Old)
+		}
+	}
+
+	oldCtx, err := newDiffContext(oldOSM, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	newCtx, err := newDiffContext(newOSM, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	fc := geojson.NewFeatureCollection()
+	for _, a := range diff.Actions {
+		switch a.Type {
+		case osm.ActionCreate:
+			for _, df := range newCtx.diffFeatures(a.OSM) {
+				fc.Append(diffProperties(df.feature, a.Type, "new", df.element))
+			}
+		case osm.ActionModify:
+			newFeatures := newCtx.diffFeatures(a.New)
+			for _, odf := range oldCtx.diffFeatures(a.Old) {
+				var ndf *diffFeature
+				for i := range newFeatures {
+					if newFeatures[i].element.FeatureID() == odf.element.FeatureID() {
+						ndf = &newFeatures[i]
+						break
+					}
+				}
+
+				change := ChangeOther
+				if ndf != nil {
+					change = classifyChange(odf, *ndf)
+				}
+
+				if odf.feature != nil {
+					f := diffProperties(odf.feature, a.Type, "old", odf.element)
+					f.Properties["change"] = change
+					fc.Append(f)
+				}
+
+				if ndf != nil && ndf.feature != nil {
+					f := diffProperties(ndf.feature, a.Type, "new", ndf.element)
+					f.Properties["change"] = change
+					fc.Append(f)
+				}
+			}
+		case osm.ActionDelete:
+			for _, df := range oldCtx.diffFeatures(a.Old) {
+				fc.Append(diffProperties(df.feature, a.Type, "old", df.element))
+			}
+		}
+	}
+
+	// features that could not be built are nil
+	features := fc.Features[:0]
+	for _, f := range fc.Features {
+		if f != nil {
+			features = append(features, f)
+		}
+	}
+	fc.Features = features
+
+	return fc, nil
+}
+
+func appendOSM(o *osm.OSM, e *osm.OSM) {
+	if e == nil {
+		return
+	}
+
+	o.Nodes = append(o.Nodes, e.Nodes...)
+	o.Ways = append(o.Ways, e.Ways...)
+	o.Relations = append(o.Relations, e.Relations...)
+}
+
+// newDiffContext creates a context for one side, old or new, of the diff.
+func newDiffContext(o *osm.OSM, opts []Option) (*context, error) {
+	ctx := &context{
+		osm:       o,
+		skippable: make(map[osm.WayID]struct{}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx.store = nil
+	ctx.wayMap = make(map[osm.WayID]*osm.Way, len(o.Ways))
+	for _, w := range o.Ways {
+		ctx.wayMap[w.ID] = w
+	}
+
+	ctx.buildRelationMembership(o.Relations)
+	return ctx, nil
+}
+
+func (ctx *context) diffFeatures(o *osm.OSM) []diffFeature {
+	if o == nil {
+		return nil
+	}
+
+	var result []diffFeature
+	for _, n := range o.Nodes {
+		result = append(result, diffFeature{element: n, feature: ctx.nodeToFeature(n)})
+	}
+
+	for _, w := range o.Ways {
+		result = append(result, diffFeature{element: w, feature: ctx.wayToFeature(w)})
+	}
+
+	for _, r := range o.Relations {
+		result = append(result, diffFeature{element: r, feature: ctx.diffRelationFeature(r)})
+	}
+
+	return result
+}
+
+func (ctx *context) diffRelationFeature(r *osm.Relation) *geojson.Feature {
+	if fn, ok := ctx.relationBuilders[r.Tags.Find("type")]; ok && fn == nil {
+		// the type was explicitly skipped with the RelationBuilder option
+		return nil
+	}
+
+	f := ctx.relationToFeature(r)
+	if f == nil {
+		f = ctx.buildMemberCollection(r)
+		if f == nil {
+			return nil
+		}
+	}
+
+	// old style multipolygons take the properties of the outer way,
+	// in a diff the feature is always the relation.
+	if !ctx.noID {
+		f.ID = fmt.Sprintf("relation/%d", r.ID)
+	}
+	f.Properties["id"] = int(r.ID)
+	f.Properties["type"] = "relation"
+	f.Properties["tags"] = r.Tags.Map()
+	ctx.addMetaProperties(f.Properties, r)
+
+	return f
+}
+
+// buildMemberCollection returns a geometry collection of the member
+// node points and member way lines.
+func (ctx *context) buildMemberCollection(r *osm.Relation) *geojson.Feature {
+	return ctx.buildRelation(r, BuildMemberCollection)
+}
+
+// diffProperties adds the diff properties to a copy of the feature.
+func diffProperties(f *geojson.Feature, action osm.ActionType, state string, e osm.Element) *geojson.Feature {
+	if f == nil {
+		return nil
+	}
+
+	result := *f
+	result.Properties = f.Properties.Clone()
+	if id, ok := f.ID.(string); ok {
+		result.ID = id + "/" + state
+	}
+
+	result.Properties["action"] = string(action)
+	result.Properties["state"] = state
+
+	switch e := e.(type) {
+	case *osm.Node:
+		result.Properties["changeset"] = int(e.ChangesetID)
+	case *osm.Way:
+		result.Properties["changeset"] = int(e.ChangesetID)
+	case *osm.Relation:
+		result.Properties["changeset"] = int(e.ChangesetID)
+	}
+
+	return &result
+}
+
+func classifyChange(old, current diffFeature) string {
+	tagsChanged := !reflect.DeepEqual(elementTags(old.element).Map(), elementTags(current.element).Map())
+
+	var geometryChanged bool
+	if old.feature == nil || current.feature == nil {
+		geometryChanged = old.feature != current.feature
+	} else {
+		geometryChanged = !orb.Equal(old.feature.Geometry, current.feature.Geometry)
+	}
+
+	switch {
+	case tagsChanged && geometryChanged:
+		return ChangeTagsAndGeometry
+	case tagsChanged:
+		return ChangeTagsOnly
+	case geometryChanged:
+		return ChangeGeometryOnly
+	}
+
+	return ChangeOther
+}
+
+func elementTags(e osm.Element) osm.Tags {
+	switch e := e.(type) {
+	case *osm.Node:
+		return e.Tags
+	case *osm.Way:
+		return e.Tags
+	case *osm.Relation:
+		return e.Tags
+	}
+
+	return nil
+}
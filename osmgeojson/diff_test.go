@@ -0,0 +1,206 @@
+package osmgeojson
+
+import (
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+func TestConvertDiff(t *testing.T) {
+	diff := &osm.Diff{
+		Actions: osm.Actions{
+			{
+				Type: osm.ActionCreate,
+				OSM: &osm.OSM{Nodes: osm.Nodes{
+					{ID: 1, Version: 1, ChangesetID: 10, Lat: 1, Lon: 2, Tags: osm.Tags{{Key: "amenity", Value: "cafe"}}},
+				}},
+			},
+			{
+				// tag only
+				Type: osm.ActionModify,
+				Old: &osm.OSM{Nodes: osm.Nodes{
+					{ID: 2, Version: 1, ChangesetID: 5, Lat: 1, Lon: 2, Tags: osm.Tags{{Key: "shop", Value: "bakery"}}},
+				}},
+				New: &osm.OSM{Nodes: osm.Nodes{
+					{ID: 2, Version: 2, ChangesetID: 10, Lat: 1, Lon: 2, Tags: osm.Tags{{Key: "shop", Value: "butcher"}}},
+				}},
+			},
+			{
+				// geometry only, annotated way nodes
+				Type: osm.ActionModify,
+				Old: &osm.OSM{Ways: osm.Ways{
+					{ID: 3, Version: 1, ChangesetID: 5, Tags: osm.Tags{{Key: "highway", Value: "primary"}},
+						Nodes: osm.WayNodes{{ID: 1, Lat: 1, Lon: 1}, {ID: 2, Lat: 1, Lon: 2}}},
+				}},
+				New: &osm.OSM{Ways: osm.Ways{
+					{ID: 3, Version: 2, ChangesetID: 10, Tags: osm.Tags{{Key: "highway", Value: "primary"}},
+						Nodes: osm.WayNodes{{ID: 1, Lat: 1, Lon: 1}, {ID: 2, Lat: 2, Lon: 2}}},
+				}},
+			},
+			{
+				Type: osm.ActionDelete,
+				Old: &osm.OSM{Nodes: osm.Nodes{
+					{ID: 4, Version: 3, ChangesetID: 7, Lat: 3, Lon: 4, Tags: osm.Tags{{Key: "amenity", Value: "bench"}}},
+				}},
+				New: &osm.OSM{Nodes: osm.Nodes{
+					{ID: 4, Version: 4, ChangesetID: 10},
+				}},
+			},
+		},
+	}
+
+	fc, err := ConvertDiff(diff, NoMeta(true), NoRelationMembership(true))
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	type expected struct {
+		id        string
+		action    string
+		state     string
+		changeset int
+		change    string
+	}
+
+	cases := []expected{
+		{"node/1/new", "create", "new", 10, ""},
+		{"node/2/old", "modify", "old", 5, ChangeTagsOnly},
+		{"node/2/new", "modify", "new", 10, ChangeTagsOnly},
+		{"way/3/old", "modify", "old", 5, ChangeGeometryOnly},
+		{"way/3/new", "modify", "new", 10, ChangeGeometryOnly},
+		{"node/4/old", "delete", "old", 7, ""},
+	}
+
+	if len(fc.Features) != len(cases) {
+		t.Fatalf("incorrect number of features: %v", len(fc.Features))
+	}
+
+	for i, tc := range cases {
+		f := fc.Features[i]
+		if f.ID != tc.id {
+			t.Errorf("%d: incorrect id: %v", i, f.ID)
+		}
+
+		if v := f.Properties["action"]; v != tc.action {
+			t.Errorf("%d: incorrect action: %v", i, v)
+		}
+
+		if v := f.Properties["state"]; v != tc.state {
+			t.Errorf("%d: incorrect state: %v", i, v)
+		}
+
+		if v := f.Properties["changeset"]; v != tc.changeset {
+			t.Errorf("%d: incorrect changeset: %v", i, v)
+		}
+
+		if v, _ := f.Properties["change"].(string); v != tc.change {
+			t.Errorf("%d: incorrect change: %v", i, v)
+		}
+	}
+
+	if ls := fc.Features[4].Geometry.(orb.LineString); ls[1] != (orb.Point{2, 2}) {
+		t.Errorf("incorrect new geometry: %v", ls)
+	}
+}
+
+func TestConvertDiff_relations(t *testing.T) {
+	oldWay := &osm.Way{ID: 1, Version: 1,
+		Nodes: osm.WayNodes{
+			{ID: 4, Lat: 0, Lon: 0.1}, {ID: 1, Lat: 0, Lon: 1}, {ID: 2, Lat: 1, Lon: 1},
+			{ID: 3, Lat: 1, Lon: 0}, {ID: 4, Lat: 0, Lon: 0.1},
+		}}
+
+	// the way nodes are not annotated, the locations come from the diff
+	newWay := &osm.Way{ID: 1, Version: 2, Tags: osm.Tags{{Key: "building", Value: "yes"}},
+		Nodes: osm.WayNodes{{ID: 4}, {ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}}
+
+	diff := &osm.Diff{
+		Actions: osm.Actions{
+			{
+				Type: osm.ActionModify,
+				Old:  &osm.OSM{Nodes: osm.Nodes{{ID: 4, Version: 1, Lat: 0, Lon: 0.1}}},
+				New:  &osm.OSM{Nodes: osm.Nodes{{ID: 4, Version: 2, Lat: 0, Lon: 0}}},
+			},
+			{
+				Type: osm.ActionCreate,
+				OSM: &osm.OSM{Nodes: osm.Nodes{
+					{ID: 1, Version: 1, Lat: 0, Lon: 1},
+					{ID: 2, Version: 1, Lat: 1, Lon: 1},
+					{ID: 3, Version: 1, Lat: 1, Lon: 0},
+				}},
+			},
+			{
+				Type: osm.ActionModify,
+				Old:  &osm.OSM{Ways: osm.Ways{oldWay}},
+				New:  &osm.OSM{Ways: osm.Ways{newWay}},
+			},
+			{
+				Type: osm.ActionCreate,
+				OSM: &osm.OSM{Relations: osm.Relations{
+					{ID: 1, Version: 1, Tags: osm.Tags{{Key: "type", Value: "multipolygon"}, {Key: "landuse", Value: "grass"}},
+						Members: osm.Members{{Type: osm.TypeWay, Ref: 1, Role: "outer"}}},
+					{ID: 2, Version: 1, Tags: osm.Tags{{Key: "type", Value: "site"}},
+						Members: osm.Members{{Type: osm.TypeNode, Ref: 4}, {Type: osm.TypeWay, Ref: 1}}},
+				}},
+			},
+		},
+	}
+
+	fc, err := ConvertDiff(diff)
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	features := make(map[string]*geojson.Feature)
+	for _, f := range fc.Features {
+		features[f.ID.(string)] = f
+	}
+
+	// the old way is a line, the new way a polygon using the new node
+	if _, ok := features["way/1/old"].Geometry.(orb.LineString); !ok {
+		t.Errorf("old way should be line: %v", features["way/1/old"].Geometry)
+	}
+
+	nw := features["way/1/new"]
+	p, ok := nw.Geometry.(orb.Polygon)
+	if !ok || p[0][0] != (orb.Point{0, 0}) {
+		t.Errorf("new way should be polygon: %v", nw.Geometry)
+	}
+
+	if v := nw.Properties["change"]; v != ChangeTagsAndGeometry {
+		t.Errorf("incorrect change: %v", v)
+	}
+
+	if v := features["node/4/new"].Properties["change"]; v != ChangeGeometryOnly {
+		t.Errorf("incorrect change: %v", v)
+	}
+
+	// the multipolygon is the relation, not the outer way
+	mp := features["relation/1/new"]
+	if _, ok := mp.Geometry.(orb.Polygon); !ok {
+		t.Errorf("should be polygon: %v", mp.Geometry)
+	}
+
+	if v := mp.Properties["tags"].(map[string]string)["landuse"]; v != "grass" {
+		t.Errorf("should have relation tags: %v", mp.Properties)
+	}
+
+	site := features["relation/2/new"]
+	if c, ok := site.Geometry.(orb.Collection); !ok || len(c) != 2 {
+		t.Errorf("should be member collection: %v", site.Geometry)
+	}
+
+	// types skipped with a nil builder are not included, the same as Convert
+	fc, err = ConvertDiff(diff, RelationBuilder("site", nil))
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	for _, f := range fc.Features {
+		if f.ID == "relation/2/new" {
+			t.Errorf("should skip site relation: %v", f.Geometry)
+		}
+	}
+}
@@ -1,5 +1,10 @@
 package osmgeojson
 
+import (
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
 // An Option is a setting for creating the geojson.
 type Option func(*context) error
 
@@ -38,3 +43,60 @@ func IncludeInvalidPolygons(yes bool) Option {
 		return nil
 	}
 }
+
+// AreaRules sets the rules used to decide if closed ways and boundary
+// relations are polygons. Boundary relations that are not areas are
+// converted to lines. The default is osm.DefaultAreaRules().
+func AreaRules(rules osm.AreaRules) Option {
+	return func(ctx *context) error {
+		ctx.areaRules = rules
+		return nil
+	}
+}
+
+// UseStore sets the node and way store used by ConvertScanner and Stream.
+// The default is an in memory store. Convert and ConvertDiff ignore the
+// store and only use the data passed in.
+func UseStore(s Store) Option {
+	return func(ctx *context) error {
+		ctx.store = s
+		return nil
+	}
+}
+
+// TextSequence will write the features as GeoJSON Text Sequences, RFC 8142,
+// instead of newline-delimited json. Each feature is prefixed by the
+// record separator character. Only used by Stream.
+func TextSequence(yes bool) Option {
+	return func(ctx *context) error {
+		ctx.textSequence = yes
+		return nil
+	}
+}
+
+// TagMapper sets the function used by ToOSM and ToChange to map the
+// feature properties to osm tags. Default is DefaultTagMapper.
+func TagMapper(fn func(geojson.Properties) osm.Tags) Option {
+	return func(ctx *context) error {
+		ctx.tagMapper = fn
+		return nil
+	}
+}
+
+// RelationBuilder sets the function used to build the geometry of relations
+// with the type tag value, replacing the default behavior. By default route,
+// multipolygon and boundary relations are built as in osmtogeojson.
+// The restriction, site, associatedStreet, public_transport and route_master
+// types use BuildMemberCollection and waterway uses BuildJoinedLines.
+// Other types are skipped unless a builder is set. A nil function will
+// skip the type.
+func RelationBuilder(relationType string, fn RelationBuilderFunc) Option {
+	return func(ctx *context) error {
+		if ctx.relationBuilders == nil {
+			ctx.relationBuilders = make(map[string]RelationBuilderFunc)
+		}
+
+		ctx.relationBuilders[relationType] = fn
+		return nil
+	}
+}
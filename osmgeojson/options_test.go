@@ -4,6 +4,7 @@ import (
 	"encoding/xml"
 	"testing"
 
+	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/geojson"
 	"github.com/paulmach/osm"
 )
@@ -162,3 +163,129 @@ func convertXML(t *testing.T, data string, opts ...Option) *geojson.FeatureColle
 
 	return fc
 }
+
+func TestOptionAreaRules(t *testing.T) {
+	o := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 0, Lon: 0},
+			{ID: 2, Version: 1, Lat: 0, Lon: 1},
+			{ID: 3, Version: 1, Lat: 1, Lon: 1},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1,
+				Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 1}},
+				Tags:  osm.Tags{{Key: "highway", Value: "pedestrian"}}},
+		},
+	}
+
+	fc, err := Convert(o)
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	if _, ok := fc.Features[0].Geometry.(orb.LineString); !ok {
+		t.Errorf("should be line string: %v", fc.Features[0].Geometry)
+	}
+
+	rules := osm.DefaultAreaRules().Set(osm.AreaRule{
+		Key:       "highway",
+		Condition: osm.AreaWhitelist,
+		Values:    []string{"pedestrian"},
+	})
+
+	fc, err = Convert(o, AreaRules(rules))
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	if _, ok := fc.Features[0].Geometry.(orb.Polygon); !ok {
+		t.Errorf("should be polygon: %v", fc.Features[0].Geometry)
+	}
+}
+
+func TestOptionAreaRules_relation(t *testing.T) {
+	o := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 0, Lon: 0},
+			{ID: 2, Version: 1, Lat: 0, Lon: 1},
+			{ID: 3, Version: 1, Lat: 1, Lon: 1},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 1}}},
+		},
+		Relations: osm.Relations{
+			{ID: 1, Version: 1,
+				Members: osm.Members{{Type: osm.TypeWay, Ref: 1, Role: "outer"}},
+				Tags: osm.Tags{
+					{Key: "type", Value: "boundary"},
+					{Key: "boundary", Value: "maritime"},
+				}},
+		},
+	}
+
+	geometry := func(fc *geojson.FeatureCollection) orb.Geometry {
+		for _, f := range fc.Features {
+			if f.Properties["type"] == "relation" {
+				return f.Geometry
+			}
+		}
+
+		return nil
+	}
+
+	fc, err := Convert(o)
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	if g, ok := geometry(fc).(orb.Polygon); !ok {
+		t.Errorf("should be polygon: %v", g)
+	}
+
+	// only administrative boundaries are areas
+	rules := osm.DefaultAreaRules().Set(osm.AreaRule{
+		Key:       "boundary",
+		Condition: osm.AreaWhitelist,
+		Values:    []string{"administrative"},
+	})
+
+	fc, err = Convert(o, AreaRules(rules))
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	if g, ok := geometry(fc).(orb.LineString); !ok {
+		t.Errorf("should be line string: %v", g)
+	}
+}
+
+func TestOptionUseStore(t *testing.T) {
+	o := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 1, Lon: 1},
+			{ID: 2, Version: 1, Lat: 2, Lon: 2},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		},
+	}
+
+	// the store should be ignored by convert
+	store := NewMemoryStore()
+	store.PutNode(&osm.Node{ID: 1, Version: 2, Lat: 5, Lon: 5})
+	store.PutNode(&osm.Node{ID: 3, Version: 1, Lat: 6, Lon: 6})
+
+	fc, err := Convert(o, UseStore(store))
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	if len(fc.Features) != 1 {
+		t.Fatalf("incorrect features: %v", len(fc.Features))
+	}
+
+	expected := orb.LineString{{1, 1}, {2, 2}}
+	if ls := fc.Features[0].Geometry; !orb.Equal(ls, expected) {
+		t.Errorf("incorrect geometry: %v", ls)
+	}
+}
@@ -0,0 +1,102 @@
+package osmgeojson
+
+import "github.com/paulmach/osm"
+
+// A Store holds the nodes and ways while converting a scanner.
+// Nodes and ways are needed for the geometry of ways and relations
+// and are converted to features after the relations are known.
+// A disk backed store can be used for large areas.
+type Store interface {
+	PutNode(*osm.Node) error
+	PutWay(*osm.Way) error
+
+	// Node and Way should return nil if the element is not found.
+	Node(osm.NodeID) (*osm.Node, error)
+	Way(osm.WayID) (*osm.Way, error)
+
+	// WayMember returns true if the node is part of a way in the store.
+	WayMember(osm.NodeID) (bool, error)
+
+	// ForEachNode and ForEachWay should call the function for the
+	// elements in the order they were added.
+	ForEachNode(func(*osm.Node) error) error
+	ForEachWay(func(*osm.Way) error) error
+}
+
+// MemoryStore is an in memory Store.
+type MemoryStore struct {
+	nodes osm.Nodes
+	ways  osm.Ways
+
+	nodeMap   map[osm.NodeID]*osm.Node
+	wayMap    map[osm.WayID]*osm.Way
+	wayMember map[osm.NodeID]struct{}
+}
+
+var _ Store = &MemoryStore{}
+
+// NewMemoryStore creates a new in memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		nodeMap:   make(map[osm.NodeID]*osm.Node),
+		wayMap:    make(map[osm.WayID]*osm.Way),
+		wayMember: make(map[osm.NodeID]struct{}),
+	}
+}
+
+// PutNode adds the node to the store.
+func (s *MemoryStore) PutNode(n *osm.Node) error {
+	s.nodes = append(s.nodes, n)
+	s.nodeMap[n.ID] = n
+	return nil
+}
+
+// PutWay adds the way to the store.
+func (s *MemoryStore) PutWay(w *osm.Way) error {
+	s.ways = append(s.ways, w)
+	s.wayMap[w.ID] = w
+
+	for _, wn := range w.Nodes {
+		s.wayMember[wn.ID] = struct{}{}
+	}
+
+	return nil
+}
+
+// Node returns the node or nil if not found.
+func (s *MemoryStore) Node(id osm.NodeID) (*osm.Node, error) {
+	return s.nodeMap[id], nil
+}
+
+// Way returns the way or nil if not found.
+func (s *MemoryStore) Way(id osm.WayID) (*osm.Way, error) {
+	return s.wayMap[id], nil
+}
+
+// WayMember returns true if the node is part of a way.
+func (s *MemoryStore) WayMember(id osm.NodeID) (bool, error) {
+	_, ok := s.wayMember[id]
+	return ok, nil
+}
+
+// ForEachNode calls the function for each node in the order they were added.
+func (s *MemoryStore) ForEachNode(fn func(*osm.Node) error) error {
+	for _, n := range s.nodes {
+		if err := fn(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ForEachWay calls the function for each way in the order they were added.
+func (s *MemoryStore) ForEachWay(fn func(*osm.Way) error) error {
+	for _, w := range s.ways {
+		if err := fn(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
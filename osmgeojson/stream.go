@@ -0,0 +1,136 @@
+package osmgeojson
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+// recordSeparator prefixes each feature in a GeoJSON Text Sequence.
+const recordSeparator = 0x1e
+
+// ConvertScanner reads the objects from the scanner and calls the function
+// for each feature, one at a time. Nodes and ways are put in the store and
+// relations are kept in memory. Way and node features depend on the
+// relations they are members of, so no features are output until the
+// scanner is done. The features, properties and order are the same as
+// Convert. The scanner is not closed.
+func ConvertScanner(s osm.Scanner, fn func(*geojson.Feature) error, opts ...Option) error {
+	ctx := &context{
+		skippable: make(map[osm.WayID]struct{}),
+	}
+
+	for _, opt := range opts {
+		if err := opt(ctx); err != nil {
+			return err
+		}
+	}
+
+	if ctx.store == nil {
+		ctx.store = NewMemoryStore()
+	}
+
+	var relations osm.Relations
+	for s.Scan() {
+		var err error
+		switch o := s.Object().(type) {
+		case *osm.Node:
+			err = ctx.store.PutNode(o)
+		case *osm.Way:
+			err = ctx.store.PutWay(o)
+		case *osm.Relation:
+			relations = append(relations, o)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return err
+	}
+
+	ctx.buildRelationMembership(relations)
+	if ctx.err != nil {
+		return ctx.err
+	}
+
+	emit := func(f *geojson.Feature) error {
+		if ctx.err != nil {
+			return ctx.err
+		}
+
+		if f == nil {
+			return nil
+		}
+
+		return fn(f)
+	}
+
+	for _, relation := range relations {
+		if err := emit(ctx.relationToFeature(relation)); err != nil {
+			return err
+		}
+	}
+
+	err := ctx.store.ForEachWay(func(way *osm.Way) error {
+		// should skip only skippable relation members
+		if _, skip := ctx.skippable[way.ID]; skip {
+			return nil
+		}
+
+		return emit(ctx.wayToFeature(way))
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.store.ForEachNode(func(node *osm.Node) error {
+		if ctx.skipNode(node) {
+			return ctx.err
+		}
+
+		return emit(ctx.nodeToFeature(node))
+	})
+}
+
+// Stream converts the objects from the scanner using ConvertScanner and
+// writes the features as newline-delimited json, or GeoJSON Text Sequences
+// if the TextSequence option is set. The scanner is not closed.
+func Stream(w io.Writer, s osm.Scanner, opts ...Option) error {
+	ctx := &context{}
+	for _, opt := range opts {
+		if err := opt(ctx); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	err := ConvertScanner(s, func(f *geojson.Feature) error {
+		data, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+
+		if ctx.textSequence {
+			if err := bw.WriteByte(recordSeparator); err != nil {
+				return err
+			}
+		}
+
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+
+		return bw.WriteByte('\n')
+	}, opts...)
+	if err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,147 @@
+package osmgeojson
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+)
+
+func TestStream(t *testing.T) {
+	o := parseFile(t, "testdata/benchmark.osm")
+
+	fc, err := Convert(o)
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = Stream(buf, osmtest.NewScanner(o.Objects()))
+	if err != nil {
+		t.Fatalf("stream error: %v", err)
+	}
+
+	var features []interface{}
+	scanner := bufio.NewScanner(buf)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var f interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+
+		features = append(features, f)
+	}
+
+	expected := jsonLoop(t, fc).Features
+	if len(features) != len(expected) {
+		t.Fatalf("incorrect number of features: %v != %v", len(features), len(expected))
+	}
+
+	if !reflect.DeepEqual(features, expected) {
+		t.Errorf("features not equal")
+	}
+}
+
+func TestStream_textSequence(t *testing.T) {
+	o := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 1, Lon: 2},
+			{ID: 2, Version: 1, Lat: 3, Lon: 4},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	err := Stream(buf, osmtest.NewScanner(o.Objects()), TextSequence(true), NoMeta(true))
+	if err != nil {
+		t.Fatalf("stream error: %v", err)
+	}
+
+	records := bytes.Split(buf.Bytes(), []byte{recordSeparator})
+	if len(records) != 3 || len(records[0]) != 0 {
+		t.Fatalf("incorrect records: %q", buf.String())
+	}
+
+	for _, r := range records[1:] {
+		if r[len(r)-1] != '\n' {
+			t.Errorf("record should end with newline: %q", r)
+		}
+
+		f, err := geojson.UnmarshalFeature(r)
+		if err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+
+		if f.Properties["type"] != "node" {
+			t.Errorf("incorrect feature: %v", f.Properties)
+		}
+	}
+}
+
+type errorStore struct {
+	*MemoryStore
+	err error
+}
+
+func (s *errorStore) Way(id osm.WayID) (*osm.Way, error) {
+	return nil, s.err
+}
+
+func TestConvertScanner_errors(t *testing.T) {
+	o := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 1, Lon: 2},
+			{ID: 2, Version: 1, Lat: 3, Lon: 4},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		},
+		Relations: osm.Relations{
+			{ID: 1, Version: 1, Members: osm.Members{{Type: osm.TypeWay, Ref: 1}},
+				Tags: osm.Tags{{Key: "type", Value: "route"}}},
+		},
+	}
+
+	noop := func(*geojson.Feature) error { return nil }
+
+	t.Run("store error", func(t *testing.T) {
+		store := &errorStore{MemoryStore: NewMemoryStore(), err: errors.New("store error")}
+		err := ConvertScanner(osmtest.NewScanner(o.Objects()), noop, UseStore(store))
+		if err != store.err {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+
+	t.Run("scanner error", func(t *testing.T) {
+		scanner := osmtest.NewScanner(o.Objects())
+		scanner.ScanError = errors.New("scan error")
+
+		err := ConvertScanner(scanner, noop)
+		if err != scanner.ScanError {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+
+	t.Run("function error", func(t *testing.T) {
+		fnErr := errors.New("fn error")
+
+		count := 0
+		err := ConvertScanner(osmtest.NewScanner(o.Objects()), func(*geojson.Feature) error {
+			count++
+			return fnErr
+		})
+		if err != fnErr {
+			t.Errorf("incorrect error: %v", err)
+		}
+
+		if count != 1 {
+			t.Errorf("should stop after error: %v", count)
+		}
+	})
+}
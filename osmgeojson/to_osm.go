@@ -0,0 +1,289 @@
+package osmgeojson
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+// builder creates osm objects with negative placeholder ids.
+type builder struct {
+	tagMapper func(geojson.Properties) osm.Tags
+
+	osm *osm.OSM
+
+	// nodes are shared by coordinate, each node can be
+	// used by only one point feature
+	vertices map[orb.Point]*osm.Node
+	points   map[osm.NodeID]bool
+
+	nodeID     osm.NodeID
+	wayID      osm.WayID
+	relationID osm.RelationID
+}
+
+// ToOSM converts the features to osm objects, the reverse of Convert.
+// Points become nodes, line strings become ways, polygons become closed ways
+// and multipolygons or polygons with holes become multipolygon relations.
+// The way nodes are shared by coordinate, including with point features.
+// Lines with less than 2 distinct points and rings with less than 3
+// return an error. New objects have negative ids.
+// The feature properties are mapped to tags using DefaultTagMapper
+// or the function set by the TagMapper option.
+func ToOSM(fc *geojson.FeatureCollection, opts ...Option) (*osm.OSM, error) {
+	ctx := &context{}
+	for _, opt := range opts {
+		if err := opt(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	b := &builder{
+		tagMapper: ctx.tagMapper,
+		osm:       &osm.OSM{},
+		vertices:  make(map[orb.Point]*osm.Node),
+		points:    make(map[osm.NodeID]bool),
+	}
+
+	if b.tagMapper == nil {
+		b.tagMapper = DefaultTagMapper
+	}
+
+	for i, f := range fc.Features {
+		tags := b.tagMapper(f.Properties)
+		if err := b.geometry(f.Geometry, tags); err != nil {
+			return nil, fmt.Errorf("osmgeojson: feature index %d: %v", i, err)
+		}
+	}
+
+	return b.osm, nil
+}
+
+// ToChange converts the features to osm objects, see ToOSM,
+// and returns them as creates of an osm change.
+func ToChange(fc *geojson.FeatureCollection, opts ...Option) (*osm.Change, error) {
+	o, err := ToOSM(fc, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &osm.Change{Create: o}, nil
+}
+
+// DefaultTagMapper maps the properties to tags. If the properties have
+// a "tags" object, as created by Convert, only those values are used.
+// Otherwise all the string, number and boolean properties are tags.
+// The tags are sorted by key.
+func DefaultTagMapper(props geojson.Properties) osm.Tags {
+	var values map[string]interface{}
+	switch t := props["tags"].(type) {
+	case map[string]string:
+		values = make(map[string]interface{}, len(t))
+		for k, v := range t {
+			values[k] = v
+		}
+	case map[string]interface{}:
+		values = t
+	default:
+		values = props
+	}
+
+	tags := make(osm.Tags, 0, len(values))
+	for k, v := range values {
+		switch v := v.(type) {
+		case string:
+			tags = append(tags, osm.Tag{Key: k, Value: v})
+		case float64:
+			tags = append(tags, osm.Tag{Key: k, Value: strconv.FormatFloat(v, 'f', -1, 64)})
+		case bool, int, int64:
+			tags = append(tags, osm.Tag{Key: k, Value: fmt.Sprint(v)})
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Key < tags[j].Key
+	})
+
+	return tags
+}
+
+func (b *builder) geometry(g orb.Geometry, tags osm.Tags) error {
+	switch g := g.(type) {
+	case orb.Point:
+		b.point(g, tags)
+	case orb.MultiPoint:
+		for _, p := range g {
+			b.point(p, tags)
+		}
+	case orb.LineString:
+		_, err := b.way(g, tags)
+		return err
+	case orb.MultiLineString:
+		for _, ls := range g {
+			if _, err := b.way(ls, tags); err != nil {
+				return err
+			}
+		}
+	case orb.Ring:
+		return b.polygon(orb.Polygon{g}, tags)
+	case orb.Polygon:
+		return b.polygon(g, tags)
+	case orb.MultiPolygon:
+		return b.multiPolygon(g, tags)
+	case orb.Collection:
+		for _, c := range g {
+			if err := b.geometry(c, tags); err != nil {
+				return err
+			}
+		}
+	case nil:
+		return fmt.Errorf("no geometry")
+	default:
+		return fmt.Errorf("unsupported geometry type %s", g.GeoJSONType())
+	}
+
+	return nil
+}
+
+func (b *builder) node(p orb.Point, tags osm.Tags) *osm.Node {
+	b.nodeID--
+	n := &osm.Node{
+		ID:      b.nodeID,
+		Visible: true,
+		Lon:     p[0],
+		Lat:     p[1],
+		Tags:    tags,
+	}
+	b.osm.Nodes = append(b.osm.Nodes, n)
+
+	return n
+}
+
+// point creates the node of a point feature. The node at the coordinate
+// is used if it is not already the node of another point feature.
+func (b *builder) point(p orb.Point, tags osm.Tags) {
+	n, ok := b.vertices[p]
+	if !ok || b.points[n.ID] {
+		n = b.node(p, tags)
+		if !ok {
+			b.vertices[p] = n
+		}
+	}
+
+	n.Tags = tags
+	b.points[n.ID] = true
+}
+
+// vertex returns the shared node at the coordinate.
+func (b *builder) vertex(p orb.Point) osm.NodeID {
+	if n, ok := b.vertices[p]; ok {
+		return n.ID
+	}
+
+	n := b.node(p, nil)
+	b.vertices[p] = n
+
+	return n.ID
+}
+
+func (b *builder) way(ls orb.LineString, tags osm.Tags) (osm.WayID, error) {
+	// remove repeated points
+	points := make(orb.LineString, 0, len(ls))
+	for _, p := range ls {
+		if len(points) == 0 || points[len(points)-1] != p {
+			points = append(points, p)
+		}
+	}
+
+	if len(points) < 2 {
+		return 0, fmt.Errorf("line string must have at least 2 distinct points")
+	}
+
+	nodes := make(osm.WayNodes, 0, len(points))
+	for _, p := range points {
+		nodes = append(nodes, osm.WayNode{ID: b.vertex(p)})
+	}
+
+	b.wayID--
+	b.osm.Ways = append(b.osm.Ways, &osm.Way{
+		ID:      b.wayID,
+		Visible: true,
+		Nodes:   nodes,
+		Tags:    tags,
+	})
+
+	return b.wayID, nil
+}
+
+func (b *builder) ring(r orb.Ring, tags osm.Tags) (osm.WayID, error) {
+	ls := orb.LineString(r)
+	if len(r) > 0 && !r.Closed() {
+		ls = append(ls[:len(ls):len(ls)], r[0])
+	}
+
+	distinct := make(map[orb.Point]struct{}, len(ls))
+	for _, p := range ls {
+		distinct[p] = struct{}{}
+	}
+
+	if len(distinct) < 3 {
+		return 0, fmt.Errorf("ring must have at least 3 distinct points")
+	}
+
+	return b.way(ls, tags)
+}
+
+func (b *builder) polygon(p orb.Polygon, tags osm.Tags) error {
+	if len(p) == 1 {
+		_, err := b.ring(p[0], tags)
+		return err
+	}
+
+	return b.multiPolygon(orb.MultiPolygon{p}, tags)
+}
+
+func (b *builder) multiPolygon(mp orb.MultiPolygon, tags osm.Tags) error {
+	var members osm.Members
+	for _, p := range mp {
+		for i, r := range p {
+			role := "inner"
+			if i == 0 {
+				role = "outer"
+			}
+
+			id, err := b.ring(r, nil)
+			if err != nil {
+				return err
+			}
+
+			members = append(members, osm.Member{
+				Type: osm.TypeWay,
+				Ref:  int64(id),
+				Role: role,
+			})
+		}
+	}
+
+	relationTags := make(osm.Tags, 0, len(tags)+1)
+	relationTags = append(relationTags, tags...)
+	if relationTags.Find("type") == "" {
+		relationTags = append(relationTags, osm.Tag{Key: "type", Value: "multipolygon"})
+		sort.Slice(relationTags, func(i, j int) bool {
+			return relationTags[i].Key < relationTags[j].Key
+		})
+	}
+
+	b.relationID--
+	b.osm.Relations = append(b.osm.Relations, &osm.Relation{
+		ID:      b.relationID,
+		Visible: true,
+		Members: members,
+		Tags:    relationTags,
+	})
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package osmgeojson
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/osm"
+)
+
+func TestToOSM(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+
+	cafe := geojson.NewFeature(orb.Point{1, 1})
+	cafe.Properties["amenity"] = "cafe"
+	cafe.Properties["seats"] = 20.0
+	cafe.Properties["outdoor"] = true
+	cafe.Properties["ignored"] = map[string]interface{}{"a": "b"}
+	fc.Append(cafe)
+
+	// the roads share the 2,2 node
+	road := geojson.NewFeature(orb.LineString{{1, 2}, {2, 2}, {2, 2}, {3, 2}})
+	road.Properties["highway"] = "primary"
+	fc.Append(road)
+
+	road = geojson.NewFeature(orb.LineString{{2, 2}, {2, 3}})
+	road.Properties["highway"] = "service"
+	fc.Append(road)
+
+	building := geojson.NewFeature(orb.Polygon{{{5, 5}, {6, 5}, {6, 6}, {5, 6}}})
+	building.Properties["building"] = "yes"
+	fc.Append(building)
+
+	o, err := ToOSM(fc)
+	if err != nil {
+		t.Fatalf("to osm error: %v", err)
+	}
+
+	// 1 cafe + 4 road nodes + 4 building nodes
+	if len(o.Nodes) != 9 {
+		t.Errorf("incorrect number of nodes: %v", len(o.Nodes))
+	}
+
+	for i, n := range o.Nodes {
+		if n.ID != osm.NodeID(-i-1) {
+			t.Errorf("incorrect id: %v", n.ID)
+		}
+	}
+
+	expectedTags := osm.Tags{
+		{Key: "amenity", Value: "cafe"},
+		{Key: "outdoor", Value: "true"},
+		{Key: "seats", Value: "20"},
+	}
+	if n := o.Nodes[0]; !reflect.DeepEqual(n.Tags, expectedTags) || n.Point() != (orb.Point{1, 1}) {
+		t.Errorf("incorrect cafe: %+v", n)
+	}
+
+	if len(o.Ways) != 3 {
+		t.Fatalf("incorrect number of ways: %v", len(o.Ways))
+	}
+
+	if ids := o.Ways[0].Nodes.NodeIDs(); !reflect.DeepEqual(ids, []osm.NodeID{-2, -3, -4}) {
+		t.Errorf("repeated point should be removed: %v", ids)
+	}
+
+	if ids := o.Ways[1].Nodes.NodeIDs(); !reflect.DeepEqual(ids, []osm.NodeID{-3, -5}) {
+		t.Errorf("incorrect shared nodes: %v", ids)
+	}
+
+	if w := o.Ways[2]; !w.Polygon() || len(w.Nodes) != 5 || w.Nodes[0].ID != w.Nodes[4].ID {
+		t.Errorf("should be closed way: %v", w.Nodes)
+	}
+}
+
+func TestToOSM_multiPolygon(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+
+	p := orb.Polygon{
+		{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}},
+		{{1, 1}, {1, 2}, {2, 2}, {2, 1}, {1, 1}},
+	}
+
+	park := geojson.NewFeature(p)
+	park.Properties["leisure"] = "park"
+	fc.Append(park)
+
+	landuse := geojson.NewFeature(orb.MultiPolygon{
+		{{{10, 10}, {11, 10}, {11, 11}, {10, 10}}},
+		{{{20, 20}, {21, 20}, {21, 21}, {20, 20}}},
+	})
+	landuse.Properties["landuse"] = "forest"
+	fc.Append(landuse)
+
+	o, err := ToOSM(fc)
+	if err != nil {
+		t.Fatalf("to osm error: %v", err)
+	}
+
+	if len(o.Relations) != 2 {
+		t.Fatalf("incorrect relations: %v", o.Relations)
+	}
+
+	r := o.Relations[0]
+	expectedTags := osm.Tags{{Key: "leisure", Value: "park"}, {Key: "type", Value: "multipolygon"}}
+	if r.ID != -1 || !reflect.DeepEqual(r.Tags, expectedTags) {
+		t.Errorf("incorrect relation: %+v", r)
+	}
+
+	expectedMembers := osm.Members{
+		{Type: osm.TypeWay, Ref: -1, Role: "outer"},
+		{Type: osm.TypeWay, Ref: -2, Role: "inner"},
+	}
+	if !reflect.DeepEqual(r.Members, expectedMembers) {
+		t.Errorf("incorrect members: %v", r.Members)
+	}
+
+	// member ways have no tags
+	for _, w := range o.Ways {
+		if len(w.Tags) != 0 {
+			t.Errorf("member ways should not have tags: %v", w.Tags)
+		}
+	}
+
+	if len(o.Relations[1].Members) != 2 {
+		t.Errorf("incorrect members: %v", o.Relations[1].Members)
+	}
+
+	// back to geojson should be the same polygon
+	result, err := Convert(o, NoID(true), NoMeta(true), NoRelationMembership(true))
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	if len(result.Features) != 2 {
+		t.Fatalf("incorrect features: %v", len(result.Features))
+	}
+
+	if g := result.Features[0].Geometry; !orb.Equal(g, p) {
+		t.Errorf("incorrect geometry: %v", g)
+	}
+}
+
+func TestToOSM_convertRoundTrip(t *testing.T) {
+	o := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Lat: 1, Lon: 2, Tags: osm.Tags{{Key: "amenity", Value: "cafe"}}},
+			{ID: 2, Version: 1, Lat: 3, Lon: 4},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}, Tags: osm.Tags{{Key: "highway", Value: "primary"}}},
+		},
+	}
+
+	fc, err := Convert(o)
+	if err != nil {
+		t.Fatalf("convert error: %v", err)
+	}
+
+	// the tags property from convert should be used after a json round trip
+	data, err := json.Marshal(fc)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+
+	fc, err = geojson.UnmarshalFeatureCollection(data)
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	result, err := ToOSM(fc)
+	if err != nil {
+		t.Fatalf("to osm error: %v", err)
+	}
+
+	if len(result.Ways) != 1 || !reflect.DeepEqual(result.Ways[0].Tags, o.Ways[0].Tags) {
+		t.Errorf("incorrect ways: %v", result.Ways)
+	}
+
+	// the cafe node is the first way node
+	if len(result.Nodes) != 2 || !reflect.DeepEqual(result.Nodes[0].Tags, o.Nodes[0].Tags) {
+		t.Errorf("incorrect nodes: %v", result.Nodes)
+	}
+
+	if id := result.Ways[0].Nodes[0].ID; id != result.Nodes[0].ID {
+		t.Errorf("way should use the cafe node: %v", id)
+	}
+}
+
+func TestToChange(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	f := geojson.NewFeature(orb.Point{1, 2})
+	f.Properties["name"] = "Main"
+	f.Properties["ref"] = "A1"
+	fc.Append(f)
+
+	mapper := func(props geojson.Properties) osm.Tags {
+		return osm.Tags{{Key: "name", Value: props.MustString("name")}}
+	}
+
+	c, err := ToChange(fc, TagMapper(mapper))
+	if err != nil {
+		t.Fatalf("to change error: %v", err)
+	}
+
+	if c.Create == nil || len(c.Create.Nodes) != 1 {
+		t.Fatalf("incorrect create: %v", c.Create)
+	}
+
+	n := c.Create.Nodes[0]
+	if !reflect.DeepEqual(n.Tags, osm.Tags{{Key: "name", Value: "Main"}}) {
+		t.Errorf("incorrect tags: %v", n.Tags)
+	}
+
+	if n.ID != -1 || !n.Visible || n.Lon != 1 || n.Lat != 2 {
+		t.Errorf("incorrect node: %+v", n)
+	}
+}
+
+func TestToOSM_errors(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+	fc.Append(geojson.NewFeature(orb.Bound{}))
+
+	if _, err := ToOSM(fc); err == nil {
+		t.Errorf("should return error for unsupported geometry")
+	}
+
+	fc = geojson.NewFeatureCollection()
+	fc.Append(&geojson.Feature{})
+
+	if _, err := ToOSM(fc); err == nil {
+		t.Errorf("should return error for no geometry")
+	}
+
+	degenerate := []orb.Geometry{
+		orb.LineString{{1, 1}},
+		orb.LineString{{1, 1}, {1, 1}},
+		orb.MultiLineString{{{1, 1}, {2, 2}}, {{3, 3}}},
+		orb.Polygon{{{1, 1}, {2, 2}, {1, 1}}},
+		orb.Polygon{{{1, 1}, {2, 2}, {3, 3}, {1, 1}}, {{1, 1}, {1, 1}}},
+	}
+
+	for _, g := range degenerate {
+		fc = geojson.NewFeatureCollection()
+		fc.Append(geojson.NewFeature(g))
+
+		if _, err := ToOSM(fc); err == nil {
+			t.Errorf("should return error for %v", g)
+		}
+	}
+}
+
+func TestToOSM_sharedPoints(t *testing.T) {
+	fc := geojson.NewFeatureCollection()
+
+	// point before the line
+	f := geojson.NewFeature(orb.Point{1, 1})
+	f.Properties["barrier"] = "gate"
+	fc.Append(f)
+
+	fc.Append(geojson.NewFeature(orb.LineString{{1, 1}, {2, 2}, {3, 3}}))
+
+	// point after the line
+	f = geojson.NewFeature(orb.Point{3, 3})
+	f.Properties["highway"] = "crossing"
+	fc.Append(f)
+
+	// a second point at the same coordinate is a separate node
+	f = geojson.NewFeature(orb.Point{3, 3})
+	f.Properties["amenity"] = "bench"
+	fc.Append(f)
+
+	o, err := ToOSM(fc)
+	if err != nil {
+		t.Fatalf("to osm error: %v", err)
+	}
+
+	if len(o.Nodes) != 4 {
+		t.Fatalf("incorrect number of nodes: %v", len(o.Nodes))
+	}
+
+	nodes := o.Ways[0].Nodes
+	if nodes[0].ID != o.Nodes[0].ID || o.Nodes[0].Tags.Find("barrier") != "gate" {
+		t.Errorf("line should use the gate node: %v", nodes)
+	}
+
+	last := o.Nodes[2]
+	if nodes[2].ID != last.ID || last.Tags.Find("highway") != "crossing" {
+		t.Errorf("crossing should use the line node: %v", last)
+	}
+
+	if n := o.Nodes[3]; n.Tags.Find("amenity") != "bench" || n.Point() != (orb.Point{3, 3}) {
+		t.Errorf("incorrect bench: %v", n)
+	}
+}
@@ -0,0 +1,160 @@
+package osmjson
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/paulmach/osm"
+)
+
+// ErrBoundsAfterElements is returned when trying to encode bounds
+// after the elements have started.
+var ErrBoundsAfterElements = errors.New("osmjson: bounds must be encoded before other elements")
+
+// ErrEncoderClosed is returned when encoding after the encoder is closed.
+var ErrEncoderClosed = errors.New("osmjson: encoder closed")
+
+// An Encoder writes osm objects as OSM JSON to an output stream.
+// Objects are marshalled one at a time using osm.CustomJSONMarshaler
+// if it is set, so the whole document never needs to be in memory.
+type Encoder struct {
+	w      io.Writer
+	ndjson bool
+
+	header  *Header
+	bounds  *osm.Bounds
+	started bool
+	closed  bool
+	count   int
+}
+
+// NewEncoder returns a new encoder that writes an OSM JSON document to w.
+// The header values are written before the elements, it can be nil.
+// The encoder must be closed to write the end of the document.
+func NewEncoder(w io.Writer, header *Header) *Encoder {
+	if header == nil {
+		header = &Header{}
+	}
+
+	return &Encoder{
+		w:      w,
+		header: header,
+	}
+}
+
+// NewNDJSONEncoder returns a new encoder that writes newline-delimited
+// OSM JSON to w, i.e. one element, with a "type" attribute, per line.
+// Bounds are not elements and will be skipped.
+func NewNDJSONEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:      w,
+		ndjson: true,
+	}
+}
+
+// Encode writes the json encoding of the object to the stream.
+// Bounds are written as part of the document header so must be
+// encoded before any other objects.
+func (e *Encoder) Encode(o osm.Object) error {
+	if e.closed {
+		return ErrEncoderClosed
+	}
+
+	if b, ok := o.(*osm.Bounds); ok {
+		if e.ndjson {
+			return nil
+		}
+
+		if e.started {
+			return ErrBoundsAfterElements
+		}
+
+		e.bounds = b
+		return nil
+	}
+
+	data, err := marshalJSON(o)
+	if err != nil {
+		return err
+	}
+
+	if e.ndjson {
+		data = append(data, '\n')
+		_, err = e.w.Write(data)
+		return err
+	}
+
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	if e.count > 0 {
+		if _, err := e.w.Write([]byte(",\n")); err != nil {
+			return err
+		}
+	}
+	e.count++
+
+	_, err = e.w.Write(data)
+	return err
+}
+
+// Close writes the end of the document. It does not close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+
+	if e.ndjson {
+		return nil
+	}
+
+	if err := e.start(); err != nil {
+		return err
+	}
+
+	_, err := e.w.Write([]byte("\n]}\n"))
+	return err
+}
+
+// start writes the header and the start of the elements array.
+func (e *Encoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	data, err := marshalJSON(e.header)
+	if err != nil {
+		return err
+	}
+
+	// remove the closing brace so the elements can be added
+	data = bytes.TrimSpace(data)
+	data = data[:len(data)-1]
+	if len(data) > 1 {
+		data = append(data, ',')
+	}
+
+	if e.bounds != nil {
+		b, err := marshalJSON(jsonBounds{
+			MinLat: e.bounds.MinLat,
+			MinLon: e.bounds.MinLon,
+			MaxLat: e.bounds.MaxLat,
+			MaxLon: e.bounds.MaxLon,
+		})
+		if err != nil {
+			return err
+		}
+
+		data = append(data, `"bounds":`...)
+		data = append(data, b...)
+		data = append(data, ',')
+	}
+
+	data = append(data, `"elements":[`+"\n"...)
+	_, err = e.w.Write(data)
+	return err
+}
@@ -0,0 +1,219 @@
+package osmjson
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmxml"
+)
+
+func TestEncoder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	e := NewEncoder(buf, &Header{Version: "0.6", Generator: "osm-go"})
+
+	objects := osm.Objects{
+		&osm.Bounds{MinLat: 1, MinLon: 2, MaxLat: 3, MaxLon: 4},
+		&osm.Node{ID: 1, Lat: 1.5, Lon: 2.5, Tags: osm.Tags{{Key: "amenity", Value: "cafe"}}},
+		&osm.Way{ID: 2, Nodes: osm.WayNodes{{ID: 1}, {ID: 3}}},
+		&osm.Relation{ID: 3, Members: osm.Members{{Type: osm.TypeWay, Ref: 2, Role: "outer"}}},
+	}
+
+	for _, o := range objects {
+		if err := e.Encode(o); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	// is valid json that can be read the usual way
+	o := &osm.OSM{}
+	if err := json.Unmarshal(buf.Bytes(), &o); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	if o.Version != "0.6" || o.Generator != "osm-go" {
+		t.Errorf("incorrect header: %v %v", o.Version, o.Generator)
+	}
+
+	if len(o.Nodes) != 1 || len(o.Ways) != 1 || len(o.Relations) != 1 {
+		t.Errorf("incorrect objects: %v", o.Objects())
+	}
+
+	scanned := scanAll(t, New(context.Background(), bytes.NewReader(buf.Bytes())))
+	if !reflect.DeepEqual(osm.Objects(scanned), objects) {
+		t.Errorf("scanned objects not equal")
+		t.Logf("%v", scanned)
+		t.Logf("%v", objects)
+	}
+
+	if err := e.Encode(&osm.Node{ID: 4}); err != ErrEncoderClosed {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
+
+func TestEncoder_empty(t *testing.T) {
+	buf := &bytes.Buffer{}
+	e := NewEncoder(buf, nil)
+	if err := e.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	o := &osm.OSM{}
+	if err := json.Unmarshal(buf.Bytes(), &o); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	if len(o.Objects()) != 0 {
+		t.Errorf("should be empty: %v", o.Objects())
+	}
+}
+
+func TestEncoder_boundsAfterElements(t *testing.T) {
+	e := NewEncoder(&bytes.Buffer{}, nil)
+	if err := e.Encode(&osm.Node{ID: 1}); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+
+	err := e.Encode(&osm.Bounds{})
+	if err != ErrBoundsAfterElements {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
+
+func TestNewNDJSONEncoder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	e := NewNDJSONEncoder(buf)
+
+	objects := osm.Objects{
+		&osm.Bounds{MinLat: 1, MinLon: 2, MaxLat: 3, MaxLon: 4},
+		&osm.Node{ID: 1, Lat: 1.5, Lon: 2.5},
+		&osm.Way{ID: 2, Nodes: osm.WayNodes{{ID: 1}, {ID: 3}}},
+	}
+
+	for _, o := range objects {
+		if err := e.Encode(o); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	if l := bytes.Count(buf.Bytes(), []byte("\n")); l != 2 {
+		t.Errorf("incorrect number of lines: %v", l)
+	}
+
+	scanned := scanAll(t, NewNDJSON(context.Background(), bytes.NewReader(buf.Bytes())))
+	if !reflect.DeepEqual(osm.Objects(scanned), objects[1:]) {
+		t.Errorf("scanned objects not equal")
+	}
+}
+
+type testCodec struct {
+	marshal   int
+	unmarshal int
+}
+
+func (c *testCodec) Marshal(v interface{}) ([]byte, error) {
+	c.marshal++
+	return json.Marshal(v)
+}
+
+func (c *testCodec) Unmarshal(data []byte, v interface{}) error {
+	c.unmarshal++
+	return json.Unmarshal(data, v)
+}
+
+func TestEncoder_customCodec(t *testing.T) {
+	c := &testCodec{}
+	osm.CustomJSONMarshaler = c
+	osm.CustomJSONUnmarshaler = c
+	defer func() {
+		osm.CustomJSONMarshaler = nil
+		osm.CustomJSONUnmarshaler = nil
+	}()
+
+	buf := &bytes.Buffer{}
+	e := NewNDJSONEncoder(buf)
+	if err := e.Encode(&osm.Node{ID: 1}); err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+
+	if c.marshal == 0 {
+		t.Errorf("should use custom marshaler")
+	}
+
+	scanAll(t, NewNDJSON(context.Background(), buf))
+	if c.unmarshal == 0 {
+		t.Errorf("should use custom unmarshaler")
+	}
+}
+
+func TestEncoder_roundTrip(t *testing.T) {
+	f, err := os.Open("../testdata/changeset_38162206.osc")
+	if err != nil {
+		t.Fatalf("could not open file: %v", err)
+	}
+	defer f.Close()
+
+	xmlScanner := osmxml.New(context.Background(), f)
+	defer xmlScanner.Close()
+
+	buf := &bytes.Buffer{}
+	e := NewEncoder(buf, nil)
+
+	var expected []osm.Object
+	for xmlScanner.Scan() {
+		o := xmlScanner.Object()
+		expected = append(expected, o)
+
+		if err := e.Encode(o); err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+	}
+
+	if err := xmlScanner.Err(); err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	if err := e.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	scanned := scanAll(t, New(context.Background(), buf))
+	if len(scanned) != len(expected) {
+		t.Fatalf("incorrect number of objects: %v != %v", len(scanned), len(expected))
+	}
+
+	// json tags are an object so the order is not kept
+	for i := range expected {
+		sortTags(expected[i])
+		sortTags(scanned[i])
+		if !reflect.DeepEqual(scanned[i], expected[i]) {
+			t.Errorf("object %d not equal", i)
+			t.Logf("%+v", scanned[i])
+			t.Logf("%+v", expected[i])
+			return
+		}
+	}
+}
+
+func sortTags(o osm.Object) {
+	switch o := o.(type) {
+	case *osm.Node:
+		o.Tags.SortByKeyValue()
+	case *osm.Way:
+		o.Tags.SortByKeyValue()
+	case *osm.Relation:
+		o.Tags.SortByKeyValue()
+	}
+}
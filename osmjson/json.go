@@ -0,0 +1,85 @@
+package osmjson
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// Header is the information about the data that comes
+// before, or after, the elements in an OSM JSON document.
+type Header struct {
+	// JSON APIs can return version as a string or number,
+	// converted to string for consistency.
+	Version     string `json:"version,omitempty"`
+	Generator   string `json:"generator,omitempty"`
+	Copyright   string `json:"copyright,omitempty"`
+	Attribution string `json:"attribution,omitempty"`
+	License     string `json:"license,omitempty"`
+}
+
+// jsonBounds is the bounds as returned by the osm api.
+type jsonBounds struct {
+	MinLat float64 `json:"minlat"`
+	MinLon float64 `json:"minlon"`
+	MaxLat float64 `json:"maxlat"`
+	MaxLon float64 `json:"maxlon"`
+}
+
+func marshalJSON(v interface{}) ([]byte, error) {
+	if osm.CustomJSONMarshaler == nil {
+		return json.Marshal(v)
+	}
+
+	return osm.CustomJSONMarshaler.Marshal(v)
+}
+
+func unmarshalJSON(data []byte, v interface{}) error {
+	if osm.CustomJSONUnmarshaler == nil {
+		return json.Unmarshal(data, v)
+	}
+
+	return osm.CustomJSONUnmarshaler.Unmarshal(data, v)
+}
+
+type typeStruct struct {
+	Type string `json:"type"`
+}
+
+// unmarshalElement decodes the element into the correct type using the
+// "type" attribute, the same as osm.OSM.UnmarshalJSON.
+func unmarshalElement(index int, data []byte) (osm.Object, error) {
+	ts := typeStruct{}
+	if err := unmarshalJSON(data, &ts); err != nil {
+		return nil, err
+	}
+
+	if ts.Type == "" {
+		return nil, fmt.Errorf("osmjson: could not find type in element index %d", index)
+	}
+
+	var o osm.Object
+	switch ts.Type {
+	case "node":
+		o = &osm.Node{}
+	case "way":
+		o = &osm.Way{}
+	case "relation":
+		o = &osm.Relation{}
+	case "changeset":
+		o = &osm.Changeset{}
+	case "note":
+		o = &osm.Note{}
+	case "user":
+		o = &osm.User{}
+	default:
+		return nil, fmt.Errorf("osmjson: unknown type of '%s' for element index %d", ts.Type, index)
+	}
+
+	if err := unmarshalJSON(data, o); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
@@ -0,0 +1,276 @@
+package osmjson
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/paulmach/osm"
+)
+
+var _ osm.Scanner = &Scanner{}
+
+type scanState int
+
+const (
+	stateStart scanState = iota
+	stateElements
+	stateDone
+)
+
+// Scanner provides a convenient interface reading a stream of osm data
+// from an OSM JSON document, as returned by Overpass or the OSM API, or
+// from newline-delimited OSM JSON elements. Successive calls to the
+// Scan method will step through the data.
+//
+// Only the current element is kept in memory. The elements are decoded
+// using osm.CustomJSONUnmarshaler if it is set.
+//
+// Scanning stops unrecoverably at EOF, the first I/O error, the first json error or
+// the context being cancelled. When a scan stops, the reader may have advanced
+// arbitrarily far past the last token.
+//
+// The Scanner API is based on bufio.Scanner
+// https://golang.org/pkg/bufio/#Scanner
+type Scanner struct {
+	ctx    context.Context
+	done   context.CancelFunc
+	closed bool
+
+	decoder *json.Decoder
+	ndjson  bool
+	state   scanState
+	header  Header
+
+	raw    json.RawMessage
+	index  int
+	bounds *osm.Bounds
+
+	next osm.Object
+	err  error
+}
+
+// New returns a new Scanner to read the `elements` of the
+// OSM JSON document in r.
+func New(ctx context.Context, r io.Reader) *Scanner {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s := &Scanner{
+		decoder: json.NewDecoder(r),
+	}
+
+	s.ctx, s.done = context.WithCancel(ctx)
+	return s
+}
+
+// NewNDJSON returns a new Scanner to read newline-delimited OSM JSON
+// from r, i.e. one element, with a "type" attribute, per line.
+func NewNDJSON(ctx context.Context, r io.Reader) *Scanner {
+	s := New(ctx, r)
+	s.ndjson = true
+	s.state = stateElements
+
+	return s
+}
+
+// Header returns the information that comes before the elements in the document.
+// Values after the elements are included once the scanner has reached the end.
+// The header will be empty for newline-delimited data.
+func (s *Scanner) Header() (*Header, error) {
+	if s.state == stateStart && s.err == nil {
+		s.err = s.readKeys()
+	}
+
+	if s.err != nil && s.err != io.EOF {
+		return nil, s.err
+	}
+
+	return &s.header, nil
+}
+
+// Close causes all future calls to Scan to return false.
+// Does not close the underlying reader.
+func (s *Scanner) Close() error {
+	s.closed = true
+	s.done()
+
+	return nil
+}
+
+// Scan advances the Scanner to the next element, which will then be available
+// through the Object method. It returns false when the scan stops, either
+// by reaching the end of the input, an io error, a json error or the context
+// being cancelled. After Scan returns false, the Err method will return any
+// error that occurred during scanning, except if it was io.EOF, Err will
+// return nil.
+func (s *Scanner) Scan() bool {
+	if s.err != nil || s.ctx.Err() != nil {
+		return false
+	}
+
+	if s.state == stateStart {
+		s.err = s.readKeys()
+	}
+
+	if s.bounds != nil {
+		s.next = s.bounds
+		s.bounds = nil
+		return true
+	}
+
+	if s.err != nil {
+		return false
+	}
+
+	if s.state == stateElements {
+		if s.ndjson {
+			s.err = s.decoder.Decode(&s.raw)
+		} else if s.decoder.More() {
+			s.err = s.decoder.Decode(&s.raw)
+		} else {
+			// end of the elements array, there may be more header values
+			s.err = s.expectDelim(']')
+			if s.err == nil {
+				s.err = s.readKeys()
+			}
+
+			return s.Scan()
+		}
+
+		if s.err != nil {
+			return false
+		}
+
+		s.next, s.err = unmarshalElement(s.index, s.raw)
+		s.index++
+		return s.err == nil
+	}
+
+	s.err = io.EOF
+	return false
+}
+
+// readKeys reads the top level keys of the document until the start of
+// the elements array or the end of the document.
+func (s *Scanner) readKeys() error {
+	dec := s.decoder
+
+	if s.state == stateStart {
+		if err := s.expectDelim('{'); err != nil {
+			return err
+		}
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("osmjson: expected object key, got %v", t)
+		}
+
+		switch key {
+		case "version":
+			// can be a string or number
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return err
+			}
+
+			if v != nil {
+				s.header.Version = fmt.Sprintf("%v", v)
+			}
+		case "generator":
+			err = dec.Decode(&s.header.Generator)
+		case "copyright":
+			err = dec.Decode(&s.header.Copyright)
+		case "attribution":
+			err = dec.Decode(&s.header.Attribution)
+		case "license":
+			err = dec.Decode(&s.header.License)
+		case "bounds":
+			b := jsonBounds{}
+			err = dec.Decode(&b)
+			s.bounds = &osm.Bounds{
+				MinLat: b.MinLat,
+				MaxLat: b.MaxLat,
+				MinLon: b.MinLon,
+				MaxLon: b.MaxLon,
+			}
+		case "elements":
+			if err := s.expectDelim('['); err != nil {
+				return err
+			}
+
+			s.state = stateElements
+			return nil
+		default:
+			err = dec.Decode(&s.raw)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.expectDelim('}'); err != nil {
+		return err
+	}
+
+	s.state = stateDone
+	return nil
+}
+
+func (s *Scanner) expectDelim(d json.Delim) error {
+	t, err := s.decoder.Token()
+	if err == io.EOF && d != '{' {
+		return io.ErrUnexpectedEOF
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if t != d {
+		return fmt.Errorf("osmjson: expected %v, got %v", d, t)
+	}
+
+	return nil
+}
+
+// Object returns the most recent token generated by a call to Scan
+// as a new osm.Object. This interface is implemented by:
+//
+//	*osm.Bounds
+//	*osm.Node
+//	*osm.Way
+//	*osm.Relation
+//	*osm.Changeset
+//	*osm.Note
+//	*osm.User
+func (s *Scanner) Object() osm.Object {
+	return s.next
+}
+
+// Err returns the first non-EOF error that was encountered by the Scanner.
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.closed {
+		return osm.ErrScannerClosed
+	}
+
+	return s.ctx.Err()
+}
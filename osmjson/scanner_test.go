@@ -0,0 +1,246 @@
+package osmjson
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+const overpassData = `{
+  "version": 0.6,
+  "generator": "Overpass API 0.7.56.9 76e5016d",
+  "osm3s": {
+    "timestamp_osm_base": "2021-03-31T18:58:02Z",
+    "copyright": "The data included in this document is from www.openstreetmap.org."
+  },
+  "elements": [
+    {"type": "node", "id": 1, "lat": 1.5, "lon": 2.5, "tags": {"amenity": "cafe"}},
+    {"type": "way", "id": 2, "nodes": [1, 3], "tags": {"highway": "residential"}},
+    {"tags": {"type": "route"}, "type": "relation", "id": 3, "members": [
+      {"type": "way", "ref": 2, "role": "forward"}
+    ]}
+  ],
+  "remark": "runtime remark"
+}`
+
+func scanAll(t testing.TB, scanner *Scanner) []osm.Object {
+	t.Helper()
+	defer scanner.Close()
+
+	var result []osm.Object
+	for scanner.Scan() {
+		result = append(result, scanner.Object())
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	return result
+}
+
+func TestScanner(t *testing.T) {
+	scanner := New(context.Background(), strings.NewReader(overpassData))
+	objects := scanAll(t, scanner)
+
+	expected := &osm.OSM{}
+	if err := json.Unmarshal([]byte(overpassData), &expected); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	if !reflect.DeepEqual(osm.Objects(objects), expected.Objects()) {
+		t.Errorf("objects not equal")
+		t.Logf("%+v", objects)
+		t.Logf("%+v", expected.Objects())
+	}
+
+	header, err := scanner.Header()
+	if err != nil {
+		t.Fatalf("header error: %v", err)
+	}
+
+	if header.Version != "0.6" {
+		t.Errorf("incorrect version: %v", header.Version)
+	}
+
+	if header.Generator != "Overpass API 0.7.56.9 76e5016d" {
+		t.Errorf("incorrect generator: %v", header.Generator)
+	}
+}
+
+func TestScanner_Header(t *testing.T) {
+	data := `{
+		"version": "0.6",
+		"generator": "OpenStreetMap server",
+		"copyright": "OpenStreetMap and contributors",
+		"attribution": "http://www.openstreetmap.org/copyright",
+		"license": "http://opendatacommons.org/licenses/odbl/1-0/",
+		"bounds": {"minlat": 1, "minlon": 2, "maxlat": 3, "maxlon": 4},
+		"elements": [{"type": "node", "id": 1}]
+	}`
+
+	scanner := New(context.Background(), strings.NewReader(data))
+	defer scanner.Close()
+
+	header, err := scanner.Header()
+	if err != nil {
+		t.Fatalf("header error: %v", err)
+	}
+
+	expected := &Header{
+		Version:     "0.6",
+		Generator:   "OpenStreetMap server",
+		Copyright:   osm.Copyright,
+		Attribution: osm.Attribution,
+		License:     osm.License,
+	}
+	if !reflect.DeepEqual(header, expected) {
+		t.Errorf("incorrect header: %+v", header)
+	}
+
+	objects := scanAll(t, scanner)
+	if len(objects) != 2 {
+		t.Fatalf("incorrect objects: %v", objects)
+	}
+
+	bounds := &osm.Bounds{MinLat: 1, MinLon: 2, MaxLat: 3, MaxLon: 4}
+	if !reflect.DeepEqual(objects[0], bounds) {
+		t.Errorf("incorrect bounds: %v", objects[0])
+	}
+
+	if id := objects[1].ObjectID(); id != osm.NodeID(1).ObjectID(0) {
+		t.Errorf("incorrect id: %v", id)
+	}
+}
+
+func TestScanner_noElements(t *testing.T) {
+	scanner := New(context.Background(), strings.NewReader(`{"version": "0.6"}`))
+	objects := scanAll(t, scanner)
+
+	if len(objects) != 0 {
+		t.Errorf("should have no objects: %v", objects)
+	}
+
+	header, _ := scanner.Header()
+	if header.Version != "0.6" {
+		t.Errorf("incorrect version: %v", header.Version)
+	}
+}
+
+func TestScanner_errors(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		err  string
+	}{
+		{
+			name: "no type",
+			data: `{"elements": [{"type": "node", "id": 1}, {"id": 2}]}`,
+			err:  "osmjson: could not find type in element index 1",
+		},
+		{
+			name: "unknown type",
+			data: `{"elements": [{"type": "area", "id": 1}]}`,
+			err:  "osmjson: unknown type of 'area' for element index 0",
+		},
+		{
+			name: "not an object",
+			data: `[{"type": "node", "id": 1}]`,
+			err:  "osmjson: expected {, got [",
+		},
+		{
+			name: "elements not an array",
+			data: `{"elements": {"type": "node", "id": 1}}`,
+			err:  "osmjson: expected [, got {",
+		},
+		{
+			name: "truncated",
+			data: `{"elements": [{"type": "node", "id": 1}, {"type": "no`,
+			err:  "unexpected EOF",
+		},
+		{
+			name: "truncated after elements",
+			data: `{"elements": [{"type": "node", "id": 1}]`,
+			err:  "unexpected end of JSON input",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			scanner := New(context.Background(), strings.NewReader(tc.data))
+			defer scanner.Close()
+
+			for scanner.Scan() {
+			}
+
+			if err := scanner.Err(); err == nil || err.Error() != tc.err {
+				t.Errorf("incorrect error: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewNDJSON(t *testing.T) {
+	data := `{"type": "node", "id": 1, "lat": 1.5, "lon": 2.5}
+{"type": "way", "id": 2, "nodes": [1, 3]}
+
+{"type": "relation", "id": 3}
+`
+
+	objects := scanAll(t, NewNDJSON(context.Background(), strings.NewReader(data)))
+
+	expected := []osm.ObjectID{
+		osm.NodeID(1).ObjectID(0),
+		osm.WayID(2).ObjectID(0),
+		osm.RelationID(3).ObjectID(0),
+	}
+
+	if len(objects) != len(expected) {
+		t.Fatalf("incorrect objects: %v", objects)
+	}
+
+	for i := range expected {
+		if id := objects[i].ObjectID(); id != expected[i] {
+			t.Errorf("incorrect id: %v != %v", id, expected[i])
+		}
+	}
+}
+
+func TestScanner_Close(t *testing.T) {
+	scanner := New(context.Background(), strings.NewReader(overpassData))
+	if !scanner.Scan() {
+		t.Fatalf("should scan first object: %v", scanner.Err())
+	}
+
+	scanner.Close()
+	if scanner.Scan() {
+		t.Errorf("should not scan after close")
+	}
+
+	if scanner.Err() != osm.ErrScannerClosed {
+		t.Errorf("incorrect error: %v", scanner.Err())
+	}
+}
+
+func TestScanner_context(t *testing.T) {
+	ctx, done := context.WithCancel(context.Background())
+	scanner := New(ctx, strings.NewReader(overpassData))
+	defer scanner.Close()
+
+	if !scanner.Scan() {
+		t.Fatalf("should scan first object: %v", scanner.Err())
+	}
+
+	done()
+	if scanner.Scan() {
+		t.Errorf("should not scan after cancel")
+	}
+
+	if scanner.Err() != context.Canceled {
+		t.Errorf("incorrect error: %v", scanner.Err())
+	}
+}
@@ -0,0 +1,117 @@
+package osmmvt
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+)
+
+// Config defines the layers of the tiles and how they are generated.
+// It can be loaded from json.
+type Config struct {
+	Layers []*Layer `json:"layers"`
+
+	// Extent is the size of the tile coordinate space.
+	// Default is 4096, the mvt.DefaultExtent.
+	Extent uint32 `json:"extent,omitempty"`
+
+	// Buffer is the size of the area around the tile, in extent units,
+	// included in the tile when clipping. A common value is 64.
+	Buffer float64 `json:"buffer,omitempty"`
+
+	// SimplifyThreshold is the Douglas-Peucker threshold, in extent units,
+	// used to simplify the geometry. Since it is in extent units the data
+	// is simplified more at lower zooms. A common value is 1.
+	// Lines and polygons smaller than the threshold are removed.
+	SimplifyThreshold float64 `json:"simplify_threshold,omitempty"`
+
+	// Gzip will compress the encoded tiles.
+	Gzip bool `json:"gzip,omitempty"`
+}
+
+// A Layer defines the osm features included in a vector tile layer.
+type Layer struct {
+	Name string `json:"name"`
+
+	// Tags selects the features with any of the tag keys. If values
+	// are given the tag must have one of the values.
+	// For example: {"building": [], "highway": ["primary", "secondary"]}
+	Tags map[string][]string `json:"tags,omitempty"`
+
+	// Filter can be used for more complicated selection rules.
+	// If set, a feature must also match the filter.
+	Filter func(osm.Tags) bool `json:"-"`
+
+	// Attributes are the tag keys included as feature properties.
+	Attributes []string `json:"attributes,omitempty"`
+
+	// MinZoom and MaxZoom is the zoom range of the layer, inclusive.
+	// A nil MaxZoom means there is no maximum, it is a pointer
+	// so a layer can be limited to zoom 0.
+	MinZoom maptile.Zoom  `json:"minzoom,omitempty"`
+	MaxZoom *maptile.Zoom `json:"maxzoom,omitempty"`
+}
+
+// Match returns true if the tags match the layer selection rules.
+func (l *Layer) Match(tags osm.Tags) bool {
+	if len(l.Tags) == 0 && l.Filter == nil {
+		return false
+	}
+
+	if len(l.Tags) > 0 && !l.matchTags(tags) {
+		return false
+	}
+
+	return l.Filter == nil || l.Filter(tags)
+}
+
+func (l *Layer) matchTags(tags osm.Tags) bool {
+	for _, t := range tags {
+		values, ok := l.Tags[t.Key]
+		if !ok {
+			continue
+		}
+
+		if len(values) == 0 {
+			return true
+		}
+
+		for _, v := range values {
+			if v == t.Value {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (l *Layer) inZoom(z maptile.Zoom) bool {
+	return z >= l.MinZoom && (l.MaxZoom == nil || z <= *l.MaxZoom)
+}
+
+func (c *Config) validate() error {
+	if len(c.Layers) == 0 {
+		return errors.New("osmmvt: no layers defined")
+	}
+
+	names := make(map[string]bool, len(c.Layers))
+	for _, l := range c.Layers {
+		if l.Name == "" {
+			return errors.New("osmmvt: layer name required")
+		}
+
+		if names[l.Name] {
+			return fmt.Errorf("osmmvt: duplicate layer name %s", l.Name)
+		}
+		names[l.Name] = true
+
+		if l.MaxZoom != nil && *l.MaxZoom < l.MinZoom {
+			return fmt.Errorf("osmmvt: layer %s max zoom less than min zoom", l.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,357 @@
+// Package osmmvt generates Mapbox Vector Tiles from osm data.
+// The geometry is built using osmgeojson, including the assembly of
+// multipolygons, and the features are mapped into layers using their tags.
+package osmmvt
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/geojson"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/orb/simplify"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmgeojson"
+)
+
+// A Tiler creates vector tiles for a set of osm data.
+type Tiler struct {
+	config   Config
+	features []*feature
+}
+
+type feature struct {
+	geometry orb.Geometry
+	bound    orb.Bound
+	id       uint64
+
+	// the layers the feature is part of and the properties for each.
+	layers     []int
+	properties []geojson.Properties
+}
+
+// New creates a tiler for the osm data. The data is converted to geometry
+// up front, ways and relations require their nodes to be included.
+func New(o *osm.OSM, config *Config) (*Tiler, error) {
+	if config == nil {
+		return nil, errors.New("osmmvt: config required")
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	t := &Tiler{config: *config}
+	if t.config.Extent == 0 {
+		t.config.Extent = mvt.DefaultExtent
+	}
+
+	fc, err := osmgeojson.Convert(o,
+		osmgeojson.NoID(true),
+		osmgeojson.NoMeta(true),
+		osmgeojson.NoRelationMembership(true),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range fc.Features {
+		if f := t.newFeature(f); f != nil {
+			t.features = append(t.features, f)
+		}
+	}
+
+	return t, nil
+}
+
+// FromScanner reads all the objects of the scanner into memory
+// and creates a tiler. The scanner is not closed.
+func FromScanner(s osm.Scanner, config *Config) (*Tiler, error) {
+	o := &osm.OSM{}
+	for s.Scan() {
+		o.Append(s.Object())
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return New(o, config)
+}
+
+func (t *Tiler) newFeature(f *geojson.Feature) *feature {
+	tagMap, _ := f.Properties["tags"].(map[string]string)
+	tags := osm.Tags{}
+	for k, v := range tagMap {
+		tags = append(tags, osm.Tag{Key: k, Value: v})
+	}
+	tags.SortByKeyValue()
+
+	result := &feature{
+		geometry: f.Geometry,
+		bound:    f.Geometry.Bound(),
+		id:       featureID(f.Properties),
+	}
+
+	for i, l := range t.config.Layers {
+		if !l.Match(tags) {
+			continue
+		}
+
+		props := geojson.Properties{}
+		for _, k := range l.Attributes {
+			if v, ok := tagMap[k]; ok {
+				props[k] = v
+			}
+		}
+
+		result.layers = append(result.layers, i)
+		result.properties = append(result.properties, props)
+	}
+
+	if len(result.layers) == 0 {
+		return nil
+	}
+
+	return result
+}
+
+// featureID returns the osm id times 10 plus 1, 2 or 3 for nodes,
+// ways and relations. This keeps the ids unique across the types.
+func featureID(props geojson.Properties) uint64 {
+	id, _ := props["id"].(int)
+	if id < 0 {
+		return 0
+	}
+
+	var code uint64
+	switch props["type"] {
+	case "node":
+		code = 1
+	case "way":
+		code = 2
+	case "relation":
+		code = 3
+	}
+
+	return uint64(id)*10 + code
+}
+
+// Layers returns the projected, clipped and simplified layers of the tile.
+// Layers with no features are not included.
+func (t *Tiler) Layers(tile maptile.Tile) mvt.Layers {
+	bound := tile.Bound(t.config.Buffer / float64(t.config.Extent))
+
+	var features []int
+	for i, f := range t.features {
+		if f.bound.Intersects(bound) {
+			features = append(features, i)
+		}
+	}
+
+	return t.layers(tile, features)
+}
+
+func (t *Tiler) layers(tile maptile.Tile, features []int) mvt.Layers {
+	layers := make(mvt.Layers, len(t.config.Layers))
+	for i, l := range t.config.Layers {
+		layers[i] = &mvt.Layer{
+			Name:    l.Name,
+			Version: 2,
+			Extent:  t.config.Extent,
+		}
+	}
+
+	for _, fi := range features {
+		f := t.features[fi]
+		for i, li := range f.layers {
+			if !t.config.Layers[li].inZoom(tile.Z) {
+				continue
+			}
+
+			gf := geojson.NewFeature(orb.Clone(f.geometry))
+			gf.ID = f.id
+			gf.Properties = f.properties[i]
+
+			layers[li].Features = append(layers[li].Features, gf)
+		}
+	}
+
+	buffer := t.config.Buffer
+	extent := float64(t.config.Extent)
+	clip := orb.Bound{
+		Min: orb.Point{-buffer, -buffer},
+		Max: orb.Point{extent + buffer, extent + buffer},
+	}
+
+	result := layers[:0]
+	for _, l := range layers {
+		if len(l.Features) == 0 {
+			continue
+		}
+
+		l.ProjectToTile(tile)
+		l.Clip(clip)
+		if t.config.SimplifyThreshold > 0 {
+			l.Simplify(simplify.DouglasPeucker(t.config.SimplifyThreshold))
+			l.RemoveEmpty(t.config.SimplifyThreshold, t.config.SimplifyThreshold)
+		} else {
+			l.RemoveEmpty(0, 0)
+		}
+
+		if len(l.Features) == 0 {
+			continue
+		}
+
+		for _, f := range l.Features {
+			reorient(f.Geometry)
+		}
+
+		result = append(result, l)
+	}
+
+	return result
+}
+
+// reorient sets the ring orientation required by the vector tile spec.
+// The projection flips the y axis so the exterior rings have a positive
+// area, counter clockwise, in tile coordinates.
+func reorient(g orb.Geometry) {
+	switch g := g.(type) {
+	case orb.Polygon:
+		reorientPolygon(g)
+	case orb.MultiPolygon:
+		for _, p := range g {
+			reorientPolygon(p)
+		}
+	}
+}
+
+func reorientPolygon(p orb.Polygon) {
+	for i, r := range p {
+		o := r.Orientation()
+		if (i == 0 && o == orb.CW) || (i > 0 && o == orb.CCW) {
+			r.Reverse()
+		}
+	}
+}
+
+// Tile returns the encoded vector tile. Returns nil if the tile is empty.
+func (t *Tiler) Tile(tile maptile.Tile) ([]byte, error) {
+	return t.marshal(t.Layers(tile))
+}
+
+func (t *Tiler) marshal(layers mvt.Layers) ([]byte, error) {
+	if len(layers) == 0 {
+		return nil, nil
+	}
+
+	if t.config.Gzip {
+		return mvt.MarshalGzipped(layers)
+	}
+
+	return mvt.Marshal(layers)
+}
+
+// Tiles encodes all the non-empty tiles that intersect the bound for the
+// zoom range, inclusive. The tiles are passed to the function, ordered by
+// zoom, x and then y. Returning an error will stop the tiling.
+func (t *Tiler) Tiles(bound orb.Bound, minZoom, maxZoom maptile.Zoom, fn func(maptile.Tile, []byte) error) error {
+	for z := minZoom; z <= maxZoom; z++ {
+		index := t.index(bound, z)
+
+		tiles := make([]maptile.Tile, 0, len(index))
+		for tile := range index {
+			tiles = append(tiles, tile)
+		}
+
+		sort.Slice(tiles, func(i, j int) bool {
+			if tiles[i].X != tiles[j].X {
+				return tiles[i].X < tiles[j].X
+			}
+
+			return tiles[i].Y < tiles[j].Y
+		})
+
+		for _, tile := range tiles {
+			data, err := t.marshal(t.layers(tile, index[tile]))
+			if err != nil {
+				return err
+			}
+
+			if data == nil {
+				continue
+			}
+
+			if err := fn(tile, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// index returns the features for each tile at the zoom that
+// also intersects the bound. Uses the feature bounds so
+// it can include features that are not in the tile.
+func (t *Tiler) index(bound orb.Bound, z maptile.Zoom) map[maptile.Tile][]int {
+	buffer := t.config.Buffer / float64(t.config.Extent)
+	minTile, maxTile := tileRange(bound, z, 0)
+
+	index := make(map[maptile.Tile][]int)
+	for i, f := range t.features {
+		if !f.bound.Intersects(bound) {
+			continue
+		}
+
+		min, max := tileRange(f.bound, z, buffer)
+		if min.X < minTile.X {
+			min.X = minTile.X
+		}
+		if min.Y < minTile.Y {
+			min.Y = minTile.Y
+		}
+		if max.X > maxTile.X {
+			max.X = maxTile.X
+		}
+		if max.Y > maxTile.Y {
+			max.Y = maxTile.Y
+		}
+
+		for x := min.X; x <= max.X; x++ {
+			for y := min.Y; y <= max.Y; y++ {
+				tile := maptile.New(x, y, z)
+				index[tile] = append(index[tile], i)
+			}
+		}
+	}
+
+	return index
+}
+
+// tileRange returns the min and max tiles that cover the bound
+// plus a buffer as a fraction of a tile.
+func tileRange(b orb.Bound, z maptile.Zoom, buffer float64) (maptile.Tile, maptile.Tile) {
+	// tile y increases to the south
+	min := maptile.Fraction(orb.Point{b.Min[0], b.Max[1]}, z)
+	max := maptile.Fraction(orb.Point{b.Max[0], b.Min[1]}, z)
+
+	last := float64(uint32(1)<<z) - 1
+	clamp := func(v float64) uint32 {
+		if v < 0 {
+			return 0
+		}
+
+		if v > last {
+			return uint32(last)
+		}
+
+		return uint32(v)
+	}
+
+	return maptile.New(clamp(min[0]-buffer), clamp(min[1]-buffer), z),
+		maptile.New(clamp(max[0]+buffer), clamp(max[1]+buffer), z)
+}
@@ -0,0 +1,400 @@
+package osmmvt
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/encoding/mvt"
+	"github.com/paulmach/orb/maptile"
+	"github.com/paulmach/osm"
+)
+
+// testData is a small area in the tile 14/8192/8191, just north east of 0,0.
+func testData() *osm.OSM {
+	o := &osm.OSM{}
+
+	node := func(id osm.NodeID, lon, lat float64, tags ...osm.Tag) {
+		o.Nodes = append(o.Nodes, &osm.Node{ID: id, Version: 1, Lon: lon, Lat: lat, Tags: tags})
+	}
+
+	// a cafe
+	node(1, 0.001, 0.001, osm.Tag{Key: "amenity", Value: "cafe"}, osm.Tag{Key: "name", Value: "Joe's"})
+
+	// building way
+	node(2, 0.002, 0.002)
+	node(3, 0.003, 0.002)
+	node(4, 0.003, 0.003)
+	node(5, 0.002, 0.003)
+	o.Ways = append(o.Ways, &osm.Way{
+		ID: 10, Version: 1,
+		Nodes: osm.WayNodes{{ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}, {ID: 2}},
+		Tags:  osm.Tags{{Key: "building", Value: "yes"}},
+	})
+
+	// road crossing many tiles
+	node(6, 0.0005, 0.0005)
+	node(7, 0.1, 0.0005)
+	o.Ways = append(o.Ways, &osm.Way{
+		ID: 11, Version: 1,
+		Nodes: osm.WayNodes{{ID: 6}, {ID: 7}},
+		Tags:  osm.Tags{{Key: "highway", Value: "primary"}, {Key: "name", Value: "Main"}},
+	})
+
+	// multipolygon building with a hole
+	node(20, 0.004, 0.004)
+	node(21, 0.008, 0.004)
+	node(22, 0.008, 0.008)
+	node(23, 0.004, 0.008)
+	node(24, 0.005, 0.005)
+	node(25, 0.006, 0.005)
+	node(26, 0.006, 0.006)
+	node(27, 0.005, 0.006)
+	o.Ways = append(o.Ways,
+		&osm.Way{ID: 20, Version: 1, Nodes: osm.WayNodes{{ID: 20}, {ID: 21}, {ID: 22}}},
+		&osm.Way{ID: 21, Version: 1, Nodes: osm.WayNodes{{ID: 22}, {ID: 23}, {ID: 20}}},
+		&osm.Way{ID: 22, Version: 1, Nodes: osm.WayNodes{{ID: 24}, {ID: 25}, {ID: 26}, {ID: 27}, {ID: 24}}},
+	)
+	o.Relations = append(o.Relations, &osm.Relation{
+		ID: 30, Version: 1,
+		Members: osm.Members{
+			{Type: osm.TypeWay, Ref: 20, Role: "outer"},
+			{Type: osm.TypeWay, Ref: 21, Role: "outer"},
+			{Type: osm.TypeWay, Ref: 22, Role: "inner"},
+		},
+		Tags: osm.Tags{{Key: "type", Value: "multipolygon"}, {Key: "building", Value: "school"}},
+	})
+
+	return o
+}
+
+func testConfig() *Config {
+	return &Config{
+		Buffer:            64,
+		SimplifyThreshold: 1,
+		Layers: []*Layer{
+			{
+				Name:       "roads",
+				Tags:       map[string][]string{"highway": {"primary", "secondary"}},
+				Attributes: []string{"highway", "name"},
+			},
+			{
+				Name:       "buildings",
+				Tags:       map[string][]string{"building": nil},
+				Attributes: []string{"building"},
+				MinZoom:    14,
+			},
+			{
+				Name:       "pois",
+				Tags:       map[string][]string{"amenity": nil},
+				Attributes: []string{"amenity", "name"},
+			},
+		},
+	}
+}
+
+func decodeTile(t testing.TB, data []byte) map[string]*mvt.Layer {
+	t.Helper()
+
+	layers, err := mvt.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	result := make(map[string]*mvt.Layer)
+	for _, l := range layers {
+		result[l.Name] = l
+	}
+
+	return result
+}
+
+func TestTiler_Tile(t *testing.T) {
+	tiler, err := New(testData(), testConfig())
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	tile := maptile.At(orb.Point{0.001, 0.001}, 14)
+	data, err := tiler.Tile(tile)
+	if err != nil {
+		t.Fatalf("tile error: %v", err)
+	}
+
+	layers := decodeTile(t, data)
+	if len(layers) != 3 {
+		t.Fatalf("incorrect layers: %v", layers)
+	}
+
+	// roads
+	roads := layers["roads"]
+	if len(roads.Features) != 1 {
+		t.Fatalf("incorrect roads: %v", roads.Features)
+	}
+
+	road := roads.Features[0]
+	if road.ID != float64(112) {
+		t.Errorf("incorrect id: %v", road.ID)
+	}
+
+	if road.Properties["name"] != "Main" || road.Properties["highway"] != "primary" {
+		t.Errorf("incorrect properties: %v", road.Properties)
+	}
+
+	// clipped to the tile plus buffer
+	ls := road.Geometry.(orb.LineString)
+	if max := ls.Bound().Max[0]; max != 4096+64 {
+		t.Errorf("road not clipped: %v", max)
+	}
+
+	// buildings
+	buildings := layers["buildings"]
+	if len(buildings.Features) != 2 {
+		t.Fatalf("incorrect buildings: %v", buildings.Features)
+	}
+
+	for _, f := range buildings.Features {
+		switch f.ID.(float64) {
+		case 102: // way
+			if _, ok := f.Geometry.(orb.Polygon); !ok {
+				t.Errorf("way should be polygon: %T", f.Geometry)
+			}
+		case 303: // relation
+			p, ok := f.Geometry.(orb.Polygon)
+			if !ok || len(p) != 2 {
+				t.Errorf("multipolygon should be polygon with hole: %v", f.Geometry)
+			}
+
+			if f.Properties["building"] != "school" {
+				t.Errorf("incorrect properties: %v", f.Properties)
+			}
+		default:
+			t.Errorf("incorrect feature id: %v", f.ID)
+		}
+	}
+
+	// pois
+	pois := layers["pois"]
+	if len(pois.Features) != 1 || pois.Features[0].ID != float64(11) {
+		t.Fatalf("incorrect pois: %v", pois.Features)
+	}
+
+	if _, ok := pois.Features[0].Properties["building"]; ok {
+		t.Errorf("should only have layer attributes: %v", pois.Features[0].Properties)
+	}
+}
+
+func TestTiler_Tile_zoom(t *testing.T) {
+	tiler, err := New(testData(), testConfig())
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	layers := tiler.Layers(maptile.At(orb.Point{0.001, 0.001}, 13))
+	for _, l := range layers {
+		if l.Name == "buildings" {
+			t.Errorf("buildings should not be included at zoom 13")
+		}
+	}
+
+	// way out zoomed, the small features are simplified away
+	layers = tiler.Layers(maptile.At(orb.Point{0.001, 0.001}, 2))
+	if len(layers) != 2 {
+		t.Errorf("incorrect layers: %v", len(layers))
+	}
+
+	for _, l := range layers {
+		if l.Name == "roads" {
+			ls := l.Features[0].Geometry.(orb.LineString)
+			if len(ls) != 2 {
+				t.Errorf("incorrect road: %v", ls)
+			}
+		}
+	}
+
+	// empty tile
+	data, err := tiler.Tile(maptile.New(0, 0, 10))
+	if err != nil {
+		t.Fatalf("tile error: %v", err)
+	}
+
+	if data != nil {
+		t.Errorf("should be nil for empty tile")
+	}
+}
+
+func TestTiler_Tiles(t *testing.T) {
+	config := testConfig()
+	config.Gzip = true
+
+	tiler, err := New(testData(), config)
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	bound := orb.Bound{Min: orb.Point{0, 0}, Max: orb.Point{1, 1}}
+
+	var tiles []maptile.Tile
+	err = tiler.Tiles(bound, 12, 14, func(tile maptile.Tile, data []byte) error {
+		tiles = append(tiles, tile)
+
+		layers, err := mvt.UnmarshalGzipped(data)
+		if err != nil {
+			t.Fatalf("unmarshal error: %v", err)
+		}
+
+		if len(layers) == 0 {
+			t.Errorf("tile should not be empty: %v", tile)
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("tiles error: %v", err)
+	}
+
+	// the road covers 0.1 degrees, about 5 z14 tiles, and at lower
+	// zooms is within the buffer of the tiles to the south
+	count := map[maptile.Zoom]int{}
+	for i, tile := range tiles {
+		count[tile.Z]++
+
+		if i > 0 && tiles[i-1].Z == tile.Z && tiles[i-1].X > tile.X {
+			t.Errorf("tiles not sorted: %v %v", tiles[i-1], tile)
+		}
+	}
+
+	expected := map[maptile.Zoom]int{12: 4, 13: 6, 14: 5}
+	for z, c := range expected {
+		if count[z] != c {
+			t.Errorf("incorrect number of tiles at %d: %v != %v", z, count[z], c)
+		}
+	}
+
+	// every tile should also be returned by Tile
+	for _, tile := range tiles {
+		if data, _ := tiler.Tile(tile); data == nil {
+			t.Errorf("tile %v should not be empty", tile)
+		}
+	}
+}
+
+func TestConfig_json(t *testing.T) {
+	data := []byte(`{
+		"extent": 512,
+		"layers": [
+			{"name": "roads", "tags": {"highway": []}, "attributes": ["name"], "minzoom": 10}
+		]
+	}`)
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	tiler, err := New(testData(), config)
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	layers := tiler.Layers(maptile.At(orb.Point{0.001, 0.001}, 14))
+	if len(layers) != 1 || layers[0].Extent != 512 {
+		t.Fatalf("incorrect layers: %v", layers)
+	}
+
+	if p := layers[0].Features[0].Properties; len(p) != 1 || p["name"] != "Main" {
+		t.Errorf("incorrect properties: %v", p)
+	}
+}
+
+func zoom(z maptile.Zoom) *maptile.Zoom {
+	return &z
+}
+
+func TestConfig_maxZoom(t *testing.T) {
+	data := []byte(`{
+		"layers": [
+			{"name": "overview", "tags": {"highway": []}, "maxzoom": 0},
+			{"name": "roads", "tags": {"highway": []}}
+		]
+	}`)
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	tiler, err := New(testData(), config)
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	// a zero max zoom limits the layer to zoom 0
+	layers := tiler.Layers(maptile.At(orb.Point{0.001, 0.001}, 0))
+	if len(layers) != 2 {
+		t.Errorf("incorrect layers at zoom 0: %v", len(layers))
+	}
+
+	layers = tiler.Layers(maptile.At(orb.Point{0.001, 0.001}, 1))
+	if len(layers) != 1 || layers[0].Name != "roads" {
+		t.Errorf("incorrect layers at zoom 1: %v", layers)
+	}
+}
+
+func TestConfig_validate(t *testing.T) {
+	cases := []struct {
+		name   string
+		config *Config
+	}{
+		{
+			name:   "no layers",
+			config: &Config{},
+		},
+		{
+			name:   "no name",
+			config: &Config{Layers: []*Layer{{}}},
+		},
+		{
+			name:   "duplicate",
+			config: &Config{Layers: []*Layer{{Name: "a"}, {Name: "a"}}},
+		},
+		{
+			name:   "zoom",
+			config: &Config{Layers: []*Layer{{Name: "a", MinZoom: 10, MaxZoom: zoom(5)}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := New(testData(), tc.config); err == nil {
+				t.Errorf("should return error")
+			}
+		})
+	}
+}
+
+func TestLayer_Match(t *testing.T) {
+	l := &Layer{
+		Tags: map[string][]string{"highway": {"primary"}, "railway": nil},
+		Filter: func(tags osm.Tags) bool {
+			return tags.Find("access") != "private"
+		},
+	}
+
+	cases := []struct {
+		tags  osm.Tags
+		match bool
+	}{
+		{osm.Tags{{Key: "highway", Value: "primary"}}, true},
+		{osm.Tags{{Key: "highway", Value: "service"}}, false},
+		{osm.Tags{{Key: "railway", Value: "rail"}}, true},
+		{osm.Tags{{Key: "railway", Value: "rail"}, {Key: "access", Value: "private"}}, false},
+		{osm.Tags{{Key: "building", Value: "yes"}}, false},
+	}
+
+	for _, tc := range cases {
+		if v := l.Match(tc.tags); v != tc.match {
+			t.Errorf("%v: incorrect match: %v", tc.tags, v)
+		}
+	}
+}
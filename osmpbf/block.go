@@ -0,0 +1,389 @@
+package osmpbf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf/internal/osmpbf"
+	"google.golang.org/protobuf/proto"
+)
+
+// A Block is a raw file block of a pbf file. The encoded blob is kept
+// as is so blocks can be copied between files without being decoded.
+type Block struct {
+	// Type is "OSMHeader" or "OSMData".
+	Type      string
+	IndexData []byte
+
+	// Offset is the number of bytes into the reader where the block starts.
+	// It is not used when writing.
+	Offset int64
+
+	// encoded Blob message, and the decoded version if needed
+	data []byte
+	blob *osmpbf.Blob
+}
+
+// NewBlock creates a block of the given type from the uncompressed data,
+// i.e. an encoded HeaderBlock or PrimitiveBlock.
+// The data will be zlib compressed if compress is true.
+func NewBlock(typ string, data []byte, compress bool) (*Block, error) {
+	b := &Block{Type: typ}
+	if err := b.setData(data, compress); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// NewHeaderBlock creates a compressed OSMHeader block for the header.
+func NewHeaderBlock(h *Header) (*Block, error) {
+	data, err := proto.Marshal(encodeOSMHeader(h))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBlock(osmHeaderType, data, true)
+}
+
+// Size returns the number of bytes the block will use in a file.
+func (b *Block) Size() (int64, error) {
+	header, err := b.blobHeader()
+	if err != nil {
+		return 0, err
+	}
+
+	return 4 + int64(len(header)) + int64(len(b.data)), nil
+}
+
+// Compressed returns true if the block data is compressed.
+func (b *Block) Compressed() (bool, error) {
+	blob, err := b.decodeBlob()
+	if err != nil {
+		return false, err
+	}
+
+	return blob.Raw == nil, nil
+}
+
+// Data returns the uncompressed data of the block, an encoded
+// HeaderBlock or PrimitiveBlock.
+func (b *Block) Data() ([]byte, error) {
+	blob, err := b.decodeBlob()
+	if err != nil {
+		return nil, err
+	}
+
+	return getData(blob, nil)
+}
+
+// Decompress will store the block data uncompressed.
+func (b *Block) Decompress() error {
+	data, err := b.Data()
+	if err != nil {
+		return err
+	}
+
+	return b.setData(data, false)
+}
+
+// Compress will store the block data zlib compressed.
+func (b *Block) Compress() error {
+	data, err := b.Data()
+	if err != nil {
+		return err
+	}
+
+	return b.setData(data, true)
+}
+
+// Header decodes the header of an OSMHeader block.
+func (b *Block) Header() (*Header, error) {
+	if b.Type != osmHeaderType {
+		return nil, fmt.Errorf("osmpbf: block of type %s is not a header", b.Type)
+	}
+
+	blob, err := b.decodeBlob()
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeOSMHeader(blob)
+}
+
+// Objects decodes the objects of an OSMData block.
+func (b *Block) Objects() ([]osm.Object, error) {
+	if b.Type != osmDataType {
+		return nil, fmt.Errorf("osmpbf: block of type %s is not data", b.Type)
+	}
+
+	blob, err := b.decodeBlob()
+	if err != nil {
+		return nil, err
+	}
+
+	dd := &dataDecoder{scanner: &Scanner{}}
+	return dd.Decode(blob)
+}
+
+func (b *Block) decodeBlob() (*osmpbf.Blob, error) {
+	if b.blob != nil {
+		return b.blob, nil
+	}
+
+	blob := &osmpbf.Blob{}
+	if err := proto.Unmarshal(b.data, blob); err != nil {
+		return nil, err
+	}
+
+	b.blob = blob
+	return blob, nil
+}
+
+func (b *Block) setData(data []byte, compress bool) error {
+	if len(data) > math.MaxInt32 {
+		return errors.New("osmpbf: block data too large")
+	}
+
+	blob := &osmpbf.Blob{}
+	if compress {
+		buf := &bytes.Buffer{}
+		zw := zlib.NewWriter(buf)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+
+		if err := zw.Close(); err != nil {
+			return err
+		}
+
+		blob.RawSize = proto.Int32(int32(len(data)))
+		blob.ZlibData = buf.Bytes()
+	} else {
+		blob.Raw = data
+		if blob.Raw == nil {
+			blob.Raw = []byte{}
+		}
+	}
+
+	encoded, err := proto.Marshal(blob)
+	if err != nil {
+		return err
+	}
+
+	if len(encoded) >= maxBlobSize {
+		return errors.New("blob size >= 32Mb")
+	}
+
+	b.data = encoded
+	b.blob = blob
+	return nil
+}
+
+func (b *Block) blobHeader() ([]byte, error) {
+	header := &osmpbf.BlobHeader{
+		Type:      proto.String(b.Type),
+		Indexdata: b.IndexData,
+		Datasize:  proto.Int32(int32(len(b.data))),
+	}
+
+	data, err := proto.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) >= maxBlobHeaderSize {
+		return nil, errors.New("blobHeader size >= 64Kb")
+	}
+
+	return data, nil
+}
+
+// BlockReader reads the raw file blocks of a pbf file.
+type BlockReader struct {
+	decoder *decoder
+	sizeBuf []byte
+}
+
+// NewBlockReader returns a new BlockReader to read from r.
+func NewBlockReader(r io.Reader) *BlockReader {
+	return &BlockReader{
+		decoder: &decoder{r: r},
+		sizeBuf: make([]byte, 4),
+	}
+}
+
+// Next reads the next block. The end of the input is reported by an io.EOF error.
+func (br *BlockReader) Next() (*Block, error) {
+	dec := br.decoder
+
+	size, err := dec.readBlobHeaderSize(br.sizeBuf)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := dec.readBlobHeader(make([]byte, size))
+	if err != nil {
+		return nil, noEOF(err)
+	}
+
+	data := make([]byte, header.GetDatasize())
+	if _, err := io.ReadFull(dec.r, data); err != nil {
+		return nil, noEOF(err)
+	}
+
+	b := &Block{
+		Type:      header.GetType(),
+		IndexData: header.GetIndexdata(),
+		Offset:    dec.bytesRead,
+		data:      data,
+	}
+
+	dec.bytesRead += 4 + int64(size) + int64(len(data))
+	return b, nil
+}
+
+// a partial block is unexpected
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// BlockWriter writes raw file blocks to create a pbf file.
+type BlockWriter struct {
+	w       io.Writer
+	written int64
+}
+
+// NewBlockWriter returns a new BlockWriter that writes to w.
+func NewBlockWriter(w io.Writer) *BlockWriter {
+	return &BlockWriter{w: w}
+}
+
+// Write writes the block. The first block of a file should be an OSMHeader block.
+func (bw *BlockWriter) Write(b *Block) error {
+	header, err := b.blobHeader()
+	if err != nil {
+		return err
+	}
+
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(header)))
+
+	for _, d := range [][]byte{size, header, b.data} {
+		n, err := bw.w.Write(d)
+		bw.written += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Written returns the number of bytes written.
+func (bw *BlockWriter) Written() int64 {
+	return bw.written
+}
+
+// RewriteHeader copies the pbf data from r to w, replacing the header with the
+// result of the update function. The data blocks are copied without being decoded.
+// The update function is called with an empty header if the data does not start with one.
+func RewriteHeader(r io.Reader, w io.Writer, update func(*Header) error) error {
+	br := NewBlockReader(r)
+	bw := NewBlockWriter(w)
+
+	first, err := br.Next()
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	header := &Header{}
+	if first != nil && first.Type == osmHeaderType {
+		header, err = first.Header()
+		if err != nil {
+			return err
+		}
+		first = nil
+	}
+
+	if err := update(header); err != nil {
+		return err
+	}
+
+	hb, err := NewHeaderBlock(header)
+	if err != nil {
+		return err
+	}
+
+	if err := bw.Write(hb); err != nil {
+		return err
+	}
+
+	b := first
+	for {
+		if b == nil {
+			b, err = br.Next()
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		if err := bw.Write(b); err != nil {
+			return err
+		}
+		b = nil
+	}
+}
+
+func encodeOSMHeader(h *Header) *osmpbf.HeaderBlock {
+	hb := &osmpbf.HeaderBlock{
+		RequiredFeatures: h.RequiredFeatures,
+		OptionalFeatures: h.OptionalFeatures,
+	}
+
+	if h.WritingProgram != "" {
+		hb.Writingprogram = proto.String(h.WritingProgram)
+	}
+
+	if h.Source != "" {
+		hb.Source = proto.String(h.Source)
+	}
+
+	if !h.ReplicationTimestamp.IsZero() {
+		hb.OsmosisReplicationTimestamp = proto.Int64(h.ReplicationTimestamp.Unix())
+	}
+
+	if h.ReplicationSeqNum != 0 {
+		hb.OsmosisReplicationSequenceNumber = proto.Int64(int64(h.ReplicationSeqNum))
+	}
+
+	if h.ReplicationBaseURL != "" {
+		hb.OsmosisReplicationBaseUrl = proto.String(h.ReplicationBaseURL)
+	}
+
+	if h.Bounds != nil {
+		// Units are always in nanodegree and do not obey granularity rules. See osmformat.proto
+		hb.Bbox = &osmpbf.HeaderBBox{
+			Left:   proto.Int64(int64(math.Round(h.Bounds.MinLon * 1e9))),
+			Right:  proto.Int64(int64(math.Round(h.Bounds.MaxLon * 1e9))),
+			Bottom: proto.Int64(int64(math.Round(h.Bounds.MinLat * 1e9))),
+			Top:    proto.Int64(int64(math.Round(h.Bounds.MaxLat * 1e9))),
+		}
+	}
+
+	return hb
+}
@@ -0,0 +1,290 @@
+package osmpbf
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+func readTestBlocks(t testing.TB, data []byte) []*Block {
+	t.Helper()
+
+	var blocks []*Block
+	br := NewBlockReader(bytes.NewReader(data))
+	for {
+		b, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("next error: %v", err)
+		}
+
+		blocks = append(blocks, b)
+	}
+
+	return blocks
+}
+
+func scanTestObjects(t testing.TB, data []byte) (*Header, []osm.Object) {
+	t.Helper()
+
+	scanner := New(context.Background(), bytes.NewReader(data), 1)
+	defer scanner.Close()
+
+	header, err := scanner.Header()
+	if err != nil {
+		t.Fatalf("header error: %v", err)
+	}
+
+	var objects []osm.Object
+	for scanner.Scan() {
+		objects = append(objects, scanner.Object())
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	return header, objects
+}
+
+func TestBlockReader(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+	blocks := readTestBlocks(t, data)
+
+	if len(blocks) != 12 {
+		t.Fatalf("incorrect number of blocks: %v", len(blocks))
+	}
+
+	if blocks[0].Type != "OSMHeader" || blocks[1].Type != "OSMData" {
+		t.Errorf("incorrect types: %v %v", blocks[0].Type, blocks[1].Type)
+	}
+
+	var offset int64
+	for i, b := range blocks {
+		if b.Offset != offset {
+			t.Errorf("block %d: incorrect offset: %v != %v", i, b.Offset, offset)
+		}
+
+		size, err := b.Size()
+		if err != nil {
+			t.Fatalf("size error: %v", err)
+		}
+		offset += size
+	}
+
+	if offset != int64(len(data)) {
+		t.Errorf("sizes do not add up: %v != %v", offset, len(data))
+	}
+
+	objects, err := blocks[11].Objects()
+	if err != nil {
+		t.Fatalf("objects error: %v", err)
+	}
+
+	if len(objects) != 3 {
+		t.Errorf("incorrect objects: %v", objects)
+	}
+
+	if _, err := blocks[0].Objects(); err == nil {
+		t.Errorf("should error for header block")
+	}
+
+	if _, err := blocks[1].Header(); err == nil {
+		t.Errorf("should error for data block")
+	}
+}
+
+func TestBlockReader_truncated(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+
+	br := NewBlockReader(bytes.NewReader(data[:len(data)-10]))
+	for {
+		_, err := br.Next()
+		if err == io.ErrUnexpectedEOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("incorrect error: %v", err)
+		}
+	}
+}
+
+func TestBlockWriter(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+	blocks := readTestBlocks(t, data)
+
+	buf := &bytes.Buffer{}
+	bw := NewBlockWriter(buf)
+	for _, b := range blocks {
+		if err := bw.Write(b); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("copied data is not the same")
+	}
+
+	if bw.Written() != int64(len(data)) {
+		t.Errorf("incorrect written: %v", bw.Written())
+	}
+}
+
+func TestBlock_Decompress(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+	_, expected := scanTestObjects(t, data)
+
+	buf := &bytes.Buffer{}
+	bw := NewBlockWriter(buf)
+	for _, b := range readTestBlocks(t, data) {
+		if err := b.Decompress(); err != nil {
+			t.Fatalf("decompress error: %v", err)
+		}
+
+		if c, _ := b.Compressed(); c {
+			t.Errorf("should be decompressed")
+		}
+
+		if err := bw.Write(b); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+
+	if buf.Len() <= len(data) {
+		t.Errorf("decompressed data should be larger: %v <= %v", buf.Len(), len(data))
+	}
+
+	_, objects := scanTestObjects(t, buf.Bytes())
+	if !reflect.DeepEqual(objects, expected) {
+		t.Errorf("decompressed objects not the same")
+	}
+
+	// and back again
+	blocks := readTestBlocks(t, buf.Bytes())
+	buf = &bytes.Buffer{}
+	bw = NewBlockWriter(buf)
+	for _, b := range blocks {
+		if err := b.Compress(); err != nil {
+			t.Fatalf("compress error: %v", err)
+		}
+
+		if c, _ := b.Compressed(); !c {
+			t.Errorf("should be compressed")
+		}
+
+		if err := bw.Write(b); err != nil {
+			t.Fatalf("write error: %v", err)
+		}
+	}
+
+	_, objects = scanTestObjects(t, buf.Bytes())
+	if !reflect.DeepEqual(objects, expected) {
+		t.Errorf("compressed objects not the same")
+	}
+}
+
+func TestBlockWriter_concat(t *testing.T) {
+	blocks := processTestBlocks()
+	d1 := testData(t, nil, blocks[:5]...)
+	d2 := testData(t, nil, blocks[5:]...)
+
+	buf := &bytes.Buffer{}
+	bw := NewBlockWriter(buf)
+	for i, d := range [][]byte{d1, d2} {
+		for _, b := range readTestBlocks(t, d) {
+			if i > 0 && b.Type == "OSMHeader" {
+				continue
+			}
+
+			if err := bw.Write(b); err != nil {
+				t.Fatalf("write error: %v", err)
+			}
+		}
+	}
+
+	_, expected := scanTestObjects(t, testData(t, nil, blocks...))
+	_, objects := scanTestObjects(t, buf.Bytes())
+	if !reflect.DeepEqual(objects, expected) {
+		t.Errorf("concatenated objects not the same")
+	}
+}
+
+func TestRewriteHeader(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+	_, expected := scanTestObjects(t, data)
+
+	ts := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+
+	buf := &bytes.Buffer{}
+	err := RewriteHeader(bytes.NewReader(data), buf, func(h *Header) error {
+		h.ReplicationTimestamp = ts
+		h.ReplicationSeqNum = 1234
+		h.Bounds = &osm.Bounds{MinLat: -1.5, MaxLat: 2, MinLon: -3, MaxLon: 4.25}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("rewrite error: %v", err)
+	}
+
+	header, objects := scanTestObjects(t, buf.Bytes())
+	if !header.ReplicationTimestamp.Equal(ts) {
+		t.Errorf("incorrect timestamp: %v", header.ReplicationTimestamp)
+	}
+
+	if header.ReplicationSeqNum != 1234 {
+		t.Errorf("incorrect seq num: %v", header.ReplicationSeqNum)
+	}
+
+	if header.Bounds.MinLat != -1.5 || header.Bounds.MaxLon != 4.25 {
+		t.Errorf("incorrect bounds: %v", header.Bounds)
+	}
+
+	if !reflect.DeepEqual(header.RequiredFeatures, []string{"OsmSchema-V0.6", "DenseNodes"}) {
+		t.Errorf("incorrect required features: %v", header.RequiredFeatures)
+	}
+
+	if !reflect.DeepEqual(objects, expected) {
+		t.Errorf("objects not the same")
+	}
+
+	// data blocks are copied as is
+	if !bytes.HasSuffix(buf.Bytes(), data[readTestBlocks(t, data)[1].Offset:]) {
+		t.Errorf("data blocks not copied")
+	}
+}
+
+func TestRewriteHeader_noHeader(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+	blocks := readTestBlocks(t, data)
+
+	buf := &bytes.Buffer{}
+	err := RewriteHeader(bytes.NewReader(data[blocks[1].Offset:]), buf, func(h *Header) error {
+		if !reflect.DeepEqual(h, &Header{}) {
+			t.Errorf("should be empty header: %v", h)
+		}
+
+		h.WritingProgram = "test"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("rewrite error: %v", err)
+	}
+
+	header, objects := scanTestObjects(t, buf.Bytes())
+	if header.WritingProgram != "test" {
+		t.Errorf("incorrect header: %v", header)
+	}
+
+	if len(objects) != 1003 {
+		t.Errorf("incorrect number of objects: %v", len(objects))
+	}
+}
@@ -0,0 +1,355 @@
+package osmpbf
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/paulmach/osm"
+)
+
+// ErrProcessorStarted is returned if Run is called more than once.
+var ErrProcessorStarted = errors.New("osmpbf: processor already run")
+
+// Batch is the set of objects decoded from one data block of the file.
+type Batch struct {
+	// Index is the position of the data block in the file, starting at 0.
+	Index int
+
+	// Offset is the number of bytes into the reader where the block starts.
+	Offset int64
+
+	Objects []osm.Object
+}
+
+// Processor decodes pbf data and passes the objects to handlers running on
+// `procs` goroutines. Each goroutine decodes a full data block and then calls
+// the handlers for the objects in that block, so the objects are never
+// serialized into a single stream like with the Scanner.
+//
+// The handlers are called in parallel and must be safe for concurrent use.
+// Objects within a block are handled in file order by the same goroutine.
+type Processor struct {
+	// Skip element types that are not needed. The data is skipped
+	// at the encoded protobuf level, but each block still needs to be decompressed.
+	SkipNodes     bool
+	SkipWays      bool
+	SkipRelations bool
+
+	// If the Filter function is false, the element will be skipped
+	// at the decoding level. See the Scanner for more details.
+	FilterNode     func(*osm.Node) bool
+	FilterWay      func(*osm.Way) bool
+	FilterRelation func(*osm.Relation) bool
+
+	// Node, Way and Relation are called for each element of the type.
+	// Returning an error stops the processing.
+	Node     func(*osm.Node) error
+	Way      func(*osm.Way) error
+	Relation func(*osm.Relation) error
+
+	// Batch is called with all the objects of a block after the per type
+	// handlers. It is called in parallel, the returned value is passed to Result.
+	Batch func(*Batch) (interface{}, error)
+
+	// Result is called from the goroutine calling Run with the values
+	// returned by Batch, or nil if Batch is not defined. If Ordered is true
+	// the values are passed in file order, otherwise as the blocks are completed.
+	// Ordering requires the results of the completed blocks to be kept in memory
+	// until the earlier blocks are done.
+	Result  func(interface{}) error
+	Ordered bool
+
+	ctx   context.Context
+	procs int
+
+	decoder *decoder
+	started bool
+	ran     bool
+	header  *Header
+	err     error
+
+	// the first block, if not a header
+	first *iPair
+
+	sizeBuf, headerBuf, blobBuf []byte
+
+	// newHandler returns the function that decodes and handles a block
+	// for one of the goroutines. Defaults to decoding into osm objects.
+	newHandler func() func(processorJob) (interface{}, error)
+}
+
+// processorJob is a block that needs to be decoded and handled.
+type processorJob struct {
+	index int
+	pair  iPair
+}
+
+// processorResult is the value returned by Batch for a block.
+type processorResult struct {
+	index int
+	value interface{}
+}
+
+// NewProcessor returns a new Processor to read from r using procs goroutines.
+// The handlers should be defined before calling Run.
+func NewProcessor(ctx context.Context, r io.Reader, procs int) *Processor {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if procs < 1 {
+		procs = 1
+	}
+
+	return &Processor{
+		ctx:     ctx,
+		procs:   procs,
+		decoder: newDecoder(ctx, nil, r),
+	}
+}
+
+// Header returns the pbf file header with interesting information
+// about how it was created. The header will be nil if the data does
+// not start with one, e.g. when starting mid-file.
+func (p *Processor) Header() (*Header, error) {
+	p.start()
+	return p.header, p.err
+}
+
+func (p *Processor) start() {
+	if p.started {
+		return
+	}
+	p.started = true
+
+	p.sizeBuf = make([]byte, 4)
+	p.headerBuf = make([]byte, maxBlobHeaderSize)
+	p.blobBuf = make([]byte, maxBlobSize)
+
+	blobHeader, blob, err := p.decoder.readFileBlock(p.sizeBuf, p.headerBuf, p.blobBuf)
+	if err == io.EOF {
+		return
+	}
+
+	if err != nil {
+		p.err = err
+		return
+	}
+
+	if blobHeader.GetType() == osmHeaderType {
+		p.header, p.err = decodeOSMHeader(blob)
+		return
+	}
+
+	// On restart the first block may not be a header and will need to be processed.
+	p.first = &iPair{Offset: 0, Blob: blob}
+}
+
+// Run reads all the data and calls the handlers. It blocks until all the
+// data is processed, a handler returns an error or the context is cancelled.
+// It returns the first error encountered. Run can only be called once.
+func (p *Processor) Run() error {
+	if p.ran {
+		return ErrProcessorStarted
+	}
+	p.ran = true
+
+	defer p.decoder.Close()
+
+	p.start()
+	if p.err != nil {
+		return p.err
+	}
+
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+
+	var (
+		once sync.Once
+		err  error
+	)
+	fail := func(e error) {
+		once.Do(func() {
+			err = e
+			cancel()
+		})
+	}
+
+	jobs := make(chan processorJob, p.procs)
+	results := make(chan processorResult, p.procs)
+
+	// read the blocks
+	go func() {
+		defer close(jobs)
+
+		index := 0
+		if p.first != nil {
+			select {
+			case jobs <- processorJob{index: index, pair: *p.first}:
+			case <-ctx.Done():
+				return
+			}
+			index++
+		}
+
+		for ctx.Err() == nil {
+			offset := p.decoder.bytesRead
+			blobHeader, blob, err := p.decoder.readFileBlock(p.sizeBuf, p.headerBuf, p.blobBuf)
+			if err == io.EOF {
+				return
+			}
+
+			if err == nil && blobHeader.GetType() != osmDataType {
+				err = fmt.Errorf("unexpected fileblock of type %s", blobHeader.GetType())
+			}
+
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			select {
+			case jobs <- processorJob{index: index, pair: iPair{Offset: offset, Blob: blob}}:
+			case <-ctx.Done():
+				return
+			}
+			index++
+		}
+	}()
+
+	// decode and handle the blocks
+	newHandler := p.newHandler
+	if newHandler == nil {
+		newHandler = p.objectHandler
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(p.procs)
+	for i := 0; i < p.procs; i++ {
+		handle := newHandler()
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				if ctx.Err() != nil {
+					continue // drain the jobs so the reader can exit
+				}
+
+				v, err := handle(job)
+				if err != nil {
+					fail(err)
+					continue
+				}
+
+				if p.Result == nil {
+					continue
+				}
+
+				select {
+				case results <- processorResult{index: job.index, value: v}:
+				case <-ctx.Done():
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// pass the results to the caller
+	next := 0
+	pending := make(map[int]interface{})
+	for r := range results {
+		if ctx.Err() != nil {
+			continue
+		}
+
+		if !p.Ordered {
+			if err := p.Result(r.value); err != nil {
+				fail(err)
+			}
+			continue
+		}
+
+		pending[r.index] = r.value
+		for {
+			v, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if err := p.Result(v); err != nil {
+				fail(err)
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return p.ctx.Err()
+}
+
+func (p *Processor) objectHandler() func(processorJob) (interface{}, error) {
+	dd := &dataDecoder{
+		scanner: &Scanner{
+			SkipNodes:      p.SkipNodes,
+			SkipWays:       p.SkipWays,
+			SkipRelations:  p.SkipRelations,
+			FilterNode:     p.FilterNode,
+			FilterWay:      p.FilterWay,
+			FilterRelation: p.FilterRelation,
+		},
+	}
+
+	return func(job processorJob) (interface{}, error) {
+		return p.process(dd, job)
+	}
+}
+
+func (p *Processor) process(dd *dataDecoder, job processorJob) (interface{}, error) {
+	objects, err := dd.Decode(job.pair.Blob)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range objects {
+		switch o := o.(type) {
+		case *osm.Node:
+			if p.Node != nil {
+				err = p.Node(o)
+			}
+		case *osm.Way:
+			if p.Way != nil {
+				err = p.Way(o)
+			}
+		case *osm.Relation:
+			if p.Relation != nil {
+				err = p.Relation(o)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.Batch == nil {
+		return nil, nil
+	}
+
+	return p.Batch(&Batch{
+		Index:   job.index,
+		Offset:  job.pair.Offset,
+		Objects: objects,
+	})
+}
@@ -0,0 +1,236 @@
+package osmpbf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+func processTestBlocks() [][]osm.Object {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var blocks [][]osm.Object
+	for b := 0; b < 10; b++ {
+		var block []osm.Object
+		for i := 0; i < 100; i++ {
+			id := b*100 + i + 1
+			block = append(block, &osm.Node{
+				ID: osm.NodeID(id), Version: 1, Visible: true, Timestamp: ts,
+				Lat: 1, Lon: 2, Tags: osm.Tags{{Key: "k", Value: "v"}},
+			})
+		}
+		blocks = append(blocks, block)
+	}
+
+	blocks = append(blocks, []osm.Object{
+		&osm.Way{ID: 1, Version: 1, Visible: true, Timestamp: ts, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		&osm.Way{ID: 2, Version: 1, Visible: true, Timestamp: ts, Nodes: osm.WayNodes{{ID: 2}, {ID: 3}}},
+		&osm.Relation{ID: 1, Version: 1, Visible: true, Timestamp: ts,
+			Members: osm.Members{{Type: osm.TypeWay, Ref: 1, Role: "outer"}}},
+	})
+
+	return blocks
+}
+
+func TestProcessor(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+
+	var nodes, ways, relations int64
+	p := NewProcessor(context.Background(), bytes.NewReader(data), 4)
+	p.Node = func(n *osm.Node) error {
+		atomic.AddInt64(&nodes, 1)
+		return nil
+	}
+	p.Way = func(w *osm.Way) error {
+		atomic.AddInt64(&ways, 1)
+		return nil
+	}
+	p.Relation = func(r *osm.Relation) error {
+		atomic.AddInt64(&relations, 1)
+		return nil
+	}
+
+	if err := p.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if nodes != 1000 || ways != 2 || relations != 1 {
+		t.Errorf("incorrect counts: %v %v %v", nodes, ways, relations)
+	}
+
+	if err := p.Run(); err != ErrProcessorStarted {
+		t.Errorf("should not run twice: %v", err)
+	}
+}
+
+func TestProcessor_Header(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+
+	p := NewProcessor(context.Background(), bytes.NewReader(data), 2)
+	header, err := p.Header()
+	if err != nil {
+		t.Fatalf("header error: %v", err)
+	}
+
+	if len(header.RequiredFeatures) != 2 {
+		t.Errorf("incorrect header: %v", header)
+	}
+
+	var count int64
+	p.Node = func(n *osm.Node) error {
+		atomic.AddInt64(&count, 1)
+		return nil
+	}
+
+	if err := p.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if count != 1000 {
+		t.Errorf("header should not be processed twice: %v", count)
+	}
+}
+
+func TestProcessor_ordered(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+
+	p := NewProcessor(context.Background(), bytes.NewReader(data), 4)
+	p.Ordered = true
+	p.Batch = func(b *Batch) (interface{}, error) {
+		// later blocks finish first
+		time.Sleep(time.Duration(11-b.Index) * time.Millisecond)
+		return b.Objects[0].ObjectID(), nil
+	}
+
+	var ids []osm.ObjectID
+	p.Result = func(v interface{}) error {
+		ids = append(ids, v.(osm.ObjectID))
+		return nil
+	}
+
+	if err := p.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if len(ids) != 11 {
+		t.Fatalf("incorrect number of results: %v", len(ids))
+	}
+
+	for i := 1; i < len(ids); i++ {
+		if ids[i-1] >= ids[i] {
+			t.Errorf("results not ordered: %v", ids)
+			break
+		}
+	}
+}
+
+func TestProcessor_batchOffsets(t *testing.T) {
+	blocks := processTestBlocks()
+	data := testData(t, nil, blocks...)
+
+	var (
+		lock    sync.Mutex
+		offsets = make(map[int]int64)
+	)
+
+	p := NewProcessor(context.Background(), bytes.NewReader(data), 3)
+	p.Batch = func(b *Batch) (interface{}, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		offsets[b.Index] = b.Offset
+		return nil, nil
+	}
+
+	if err := p.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if len(offsets) != len(blocks) {
+		t.Fatalf("incorrect number of batches: %v", len(offsets))
+	}
+
+	// restart mid-file at the 4th block
+	p = NewProcessor(context.Background(), bytes.NewReader(data[offsets[3]:]), 3)
+	p.Ordered = true
+
+	var first osm.ObjectID
+	p.Batch = func(b *Batch) (interface{}, error) {
+		return b.Objects[0].ObjectID(), nil
+	}
+	p.Result = func(v interface{}) error {
+		if first == 0 {
+			first = v.(osm.ObjectID)
+		}
+		return nil
+	}
+
+	header, err := p.Header()
+	if err != nil || header != nil {
+		t.Errorf("should not have header: %v %v", header, err)
+	}
+
+	if err := p.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if first != blocks[3][0].ObjectID() {
+		t.Errorf("incorrect first object: %v", first)
+	}
+}
+
+func TestProcessor_errors(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+
+	t.Run("handler", func(t *testing.T) {
+		herr := errors.New("handler error")
+
+		p := NewProcessor(context.Background(), bytes.NewReader(data), 4)
+		p.Node = func(n *osm.Node) error {
+			if n.ID == 550 {
+				return herr
+			}
+			return nil
+		}
+
+		if err := p.Run(); err != herr {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+
+	t.Run("result", func(t *testing.T) {
+		rerr := errors.New("result error")
+
+		p := NewProcessor(context.Background(), bytes.NewReader(data), 4)
+		p.Result = func(v interface{}) error {
+			return rerr
+		}
+
+		if err := p.Run(); err != rerr {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		p := NewProcessor(context.Background(), bytes.NewReader(data[:len(data)-10]), 4)
+		if err := p.Run(); err == nil {
+			t.Errorf("expected error")
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		p := NewProcessor(ctx, bytes.NewReader(data), 4)
+		if err := p.Run(); err != context.Canceled {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+}
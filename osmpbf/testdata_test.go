@@ -0,0 +1,199 @@
+package osmpbf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf/internal/osmpbf"
+	"google.golang.org/protobuf/proto"
+)
+
+// testData encodes a small pbf file with a header followed by one
+// data block per set of objects. Nodes are written as dense nodes.
+func testData(t testing.TB, header *osmpbf.HeaderBlock, blocks ...[]osm.Object) []byte {
+	t.Helper()
+
+	if header == nil {
+		header = &osmpbf.HeaderBlock{
+			RequiredFeatures: []string{"OsmSchema-V0.6", "DenseNodes"},
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	writeTestBlock(t, buf, osmHeaderType, header)
+
+	for _, objects := range blocks {
+		writeTestBlock(t, buf, osmDataType, testPrimitiveBlock(objects))
+	}
+
+	return buf.Bytes()
+}
+
+func writeTestBlock(t testing.TB, buf *bytes.Buffer, typ string, m proto.Message) {
+	t.Helper()
+
+	data, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+
+	zbuf := &bytes.Buffer{}
+	zw := zlib.NewWriter(zbuf)
+	zw.Write(data)
+	zw.Close()
+
+	blob, err := proto.Marshal(&osmpbf.Blob{
+		RawSize:  proto.Int32(int32(len(data))),
+		ZlibData: zbuf.Bytes(),
+	})
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+
+	blobHeader, err := proto.Marshal(&osmpbf.BlobHeader{
+		Type:     proto.String(typ),
+		Datasize: proto.Int32(int32(len(blob))),
+	})
+	if err != nil {
+		t.Fatalf("marshal error: %v", err)
+	}
+
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(blobHeader)))
+
+	buf.Write(size)
+	buf.Write(blobHeader)
+	buf.Write(blob)
+}
+
+type testStringTable struct {
+	s     []string
+	index map[string]int
+}
+
+func (st *testStringTable) Index(s string) int {
+	if i, ok := st.index[s]; ok {
+		return i
+	}
+
+	st.index[s] = len(st.s)
+	st.s = append(st.s, s)
+	return st.index[s]
+}
+
+func testPrimitiveBlock(objects []osm.Object) *osmpbf.PrimitiveBlock {
+	st := &testStringTable{s: []string{""}, index: map[string]int{"": 0}}
+	group := &osmpbf.PrimitiveGroup{}
+
+	dense := &osmpbf.DenseNodes{Denseinfo: &osmpbf.DenseInfo{}}
+	var pid, plat, plon, pts, pcs int64
+	var puid, psid int32
+	for _, o := range objects {
+		n, ok := o.(*osm.Node)
+		if !ok {
+			continue
+		}
+
+		lat := int64(math.Round(n.Lat * 1e7))
+		lon := int64(math.Round(n.Lon * 1e7))
+		ts := n.Timestamp.Unix()
+		sid := int32(st.Index(n.User))
+
+		dense.Id = append(dense.Id, int64(n.ID)-pid)
+		dense.Lat = append(dense.Lat, lat-plat)
+		dense.Lon = append(dense.Lon, lon-plon)
+
+		info := dense.Denseinfo
+		info.Version = append(info.Version, int32(n.Version))
+		info.Timestamp = append(info.Timestamp, ts-pts)
+		info.Changeset = append(info.Changeset, int64(n.ChangesetID)-pcs)
+		info.Uid = append(info.Uid, int32(n.UserID)-puid)
+		info.UserSid = append(info.UserSid, sid-psid)
+		info.Visible = append(info.Visible, n.Visible)
+
+		for _, t := range n.Tags {
+			dense.KeysVals = append(dense.KeysVals, int32(st.Index(t.Key)), int32(st.Index(t.Value)))
+		}
+		dense.KeysVals = append(dense.KeysVals, 0)
+
+		pid, plat, plon = int64(n.ID), lat, lon
+		pts, pcs, puid, psid = ts, int64(n.ChangesetID), int32(n.UserID), sid
+	}
+
+	if len(dense.Id) > 0 {
+		group.Dense = dense
+	}
+
+	for _, o := range objects {
+		switch o := o.(type) {
+		case *osm.Way:
+			w := &osmpbf.Way{
+				Id:   proto.Int64(int64(o.ID)),
+				Info: testInfo(st, o.Version, o.Timestamp.Unix(), o.ChangesetID, o.UserID, o.User, o.Visible),
+			}
+			w.Keys, w.Vals = testTags(st, o.Tags)
+
+			var prev int64
+			for _, wn := range o.Nodes {
+				w.Refs = append(w.Refs, int64(wn.ID)-prev)
+				prev = int64(wn.ID)
+			}
+
+			group.Ways = append(group.Ways, w)
+		case *osm.Relation:
+			r := &osmpbf.Relation{
+				Id:   proto.Int64(int64(o.ID)),
+				Info: testInfo(st, o.Version, o.Timestamp.Unix(), o.ChangesetID, o.UserID, o.User, o.Visible),
+			}
+			r.Keys, r.Vals = testTags(st, o.Tags)
+
+			var prev int64
+			for _, m := range o.Members {
+				r.Memids = append(r.Memids, m.Ref-prev)
+				prev = m.Ref
+				r.RolesSid = append(r.RolesSid, int32(st.Index(m.Role)))
+
+				switch m.Type {
+				case osm.TypeNode:
+					r.Types = append(r.Types, osmpbf.Relation_NODE)
+				case osm.TypeWay:
+					r.Types = append(r.Types, osmpbf.Relation_WAY)
+				case osm.TypeRelation:
+					r.Types = append(r.Types, osmpbf.Relation_RELATION)
+				}
+			}
+
+			group.Relations = append(group.Relations, r)
+		}
+	}
+
+	return &osmpbf.PrimitiveBlock{
+		Stringtable:    &osmpbf.StringTable{S: st.s},
+		Primitivegroup: []*osmpbf.PrimitiveGroup{group},
+	}
+}
+
+func testInfo(st *testStringTable, version int, ts int64, cs osm.ChangesetID, uid osm.UserID, user string, visible bool) *osmpbf.Info {
+	return &osmpbf.Info{
+		Version:   proto.Int32(int32(version)),
+		Timestamp: proto.Int64(ts),
+		Changeset: proto.Int64(int64(cs)),
+		Uid:       proto.Int32(int32(uid)),
+		UserSid:   proto.Uint32(uint32(st.Index(user))),
+		Visible:   proto.Bool(visible),
+	}
+}
+
+func testTags(st *testStringTable, tags osm.Tags) ([]uint32, []uint32) {
+	var keys, vals []uint32
+	for _, t := range tags {
+		keys = append(keys, uint32(st.Index(t.Key)))
+		vals = append(vals, uint32(st.Index(t.Value)))
+	}
+
+	return keys, vals
+}
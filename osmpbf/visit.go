@@ -0,0 +1,718 @@
+package osmpbf
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf/internal/osmpbf"
+	"github.com/paulmach/protoscan"
+)
+
+// StringTable is the string table of a data block. The first entry is
+// always empty. The views reference strings by their index in this table.
+// The values point into the decompressed block data and must be copied
+// if kept after the callback returns.
+type StringTable [][]byte
+
+// String returns a copy of the string at the index.
+func (st StringTable) String(i uint32) string {
+	return string(st[i])
+}
+
+// Info contains the metadata of the element in a view.
+type Info struct {
+	Version     int
+	Timestamp   time.Time
+	ChangesetID osm.ChangesetID
+	UserID      osm.UserID
+	Visible     bool
+
+	// UserIndex is the index of the user name in the string table.
+	UserIndex uint32
+}
+
+// TagsView contains the tags of the element in a view as
+// parallel arrays of indexes into the string table.
+type TagsView struct {
+	Keys    []uint32
+	Vals    []uint32
+	Strings StringTable
+}
+
+// Find returns the value for the key, or nil if not found.
+// The value is not copied.
+func (tv *TagsView) Find(key string) []byte {
+	for i, k := range tv.Keys {
+		if string(tv.Strings[k]) == key {
+			return tv.Strings[tv.Vals[i]]
+		}
+	}
+
+	return nil
+}
+
+// HasTag returns true if a tag exists for the given key.
+func (tv *TagsView) HasTag(key string) bool {
+	for _, k := range tv.Keys {
+		if string(tv.Strings[k]) == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Tags returns a copy of the tags.
+func (tv *TagsView) Tags() osm.Tags {
+	if len(tv.Keys) == 0 {
+		return nil
+	}
+
+	tags := make(osm.Tags, len(tv.Keys))
+	for i := range tv.Keys {
+		tags[i] = osm.Tag{
+			Key:   tv.Strings.String(tv.Keys[i]),
+			Value: tv.Strings.String(tv.Vals[i]),
+		}
+	}
+
+	return tags
+}
+
+// NodeView is a view of a node in a data block.
+// It is reused and only valid during the callback.
+type NodeView struct {
+	ID  osm.NodeID
+	Lat float64
+	Lon float64
+	Info
+	TagsView
+}
+
+// Node returns a copy of the node as an osm.Node.
+func (v *NodeView) Node() *osm.Node {
+	return &osm.Node{
+		ID:          v.ID,
+		Lat:         v.Lat,
+		Lon:         v.Lon,
+		User:        v.Strings.String(v.UserIndex),
+		UserID:      v.UserID,
+		Visible:     v.Visible,
+		Version:     v.Version,
+		ChangesetID: v.ChangesetID,
+		Timestamp:   v.Timestamp,
+		Tags:        v.Tags(),
+	}
+}
+
+// WayView is a view of a way in a data block.
+// It is reused and only valid during the callback.
+type WayView struct {
+	ID osm.WayID
+	Info
+	TagsView
+
+	Refs []osm.NodeID
+
+	// Lats and Lons are the node locations for files
+	// with the LocationsOnWays feature, empty otherwise.
+	Lats []float64
+	Lons []float64
+}
+
+// Way returns a copy of the way as an osm.Way.
+func (v *WayView) Way() *osm.Way {
+	w := &osm.Way{
+		ID:          v.ID,
+		User:        v.Strings.String(v.UserIndex),
+		UserID:      v.UserID,
+		Visible:     v.Visible,
+		Version:     v.Version,
+		ChangesetID: v.ChangesetID,
+		Timestamp:   v.Timestamp,
+		Tags:        v.Tags(),
+	}
+
+	if len(v.Refs) > 0 {
+		w.Nodes = make(osm.WayNodes, len(v.Refs))
+		for i, id := range v.Refs {
+			w.Nodes[i].ID = id
+			if i < len(v.Lats) && i < len(v.Lons) {
+				w.Nodes[i].Lat = v.Lats[i]
+				w.Nodes[i].Lon = v.Lons[i]
+			}
+		}
+	}
+
+	return w
+}
+
+// RelationView is a view of a relation in a data block. The members
+// are parallel arrays. It is reused and only valid during the callback.
+type RelationView struct {
+	ID osm.RelationID
+	Info
+	TagsView
+
+	MemberTypes []osm.Type
+	MemberRefs  []int64
+	MemberRoles []uint32
+}
+
+// Relation returns a copy of the relation as an osm.Relation.
+func (v *RelationView) Relation() *osm.Relation {
+	r := &osm.Relation{
+		ID:          v.ID,
+		User:        v.Strings.String(v.UserIndex),
+		UserID:      v.UserID,
+		Visible:     v.Visible,
+		Version:     v.Version,
+		ChangesetID: v.ChangesetID,
+		Timestamp:   v.Timestamp,
+		Tags:        v.Tags(),
+	}
+
+	if len(v.MemberRefs) > 0 {
+		r.Members = make(osm.Members, len(v.MemberRefs))
+		for i := range v.MemberRefs {
+			r.Members[i] = osm.Member{
+				Type: v.MemberTypes[i],
+				Ref:  v.MemberRefs[i],
+				Role: v.Strings.String(v.MemberRoles[i]),
+			}
+		}
+	}
+
+	return r
+}
+
+// Visitor is a low level alternative to the Scanner and Processor. Instead of
+// allocating osm objects for every element, the callbacks are called with
+// views that are reused for every element. The caller must copy what it keeps.
+//
+// Element types without a callback are skipped at the encoded protobuf level.
+// The callbacks are called from `procs` goroutines and must be safe for
+// concurrent use. Elements within a block are visited in file order.
+type Visitor struct {
+	Node     func(*NodeView) error
+	Way      func(*WayView) error
+	Relation func(*RelationView) error
+
+	processor *Processor
+}
+
+// NewVisitor returns a new Visitor to read from r using procs goroutines.
+// The callbacks should be defined before calling Run.
+func NewVisitor(ctx context.Context, r io.Reader, procs int) *Visitor {
+	v := &Visitor{processor: NewProcessor(ctx, r, procs)}
+	v.processor.newHandler = v.newHandler
+	return v
+}
+
+// Header returns the pbf file header with interesting information
+// about how it was created.
+func (v *Visitor) Header() (*Header, error) {
+	return v.processor.Header()
+}
+
+// Run reads all the data and calls the callbacks. It blocks until all the
+// data is visited, a callback returns an error or the context is cancelled.
+// Run can only be called once.
+func (v *Visitor) Run() error {
+	return v.processor.Run()
+}
+
+func (v *Visitor) newHandler() func(processorJob) (interface{}, error) {
+	vd := &visitDecoder{visitor: v}
+	return func(job processorJob) (interface{}, error) {
+		return nil, vd.Decode(job.pair.Blob)
+	}
+}
+
+// visitDecoder decodes OSMData blobs into reused views.
+type visitDecoder struct {
+	visitor *Visitor
+	data    []byte
+
+	strings StringTable
+
+	granularity     int64
+	dateGranularity int64
+	latOffset       int64
+	lonOffset       int64
+
+	block, group, element, info *protoscan.Message
+
+	node     NodeView
+	way      WayView
+	relation RelationView
+
+	// dense node buffers
+	ids, lats, lons, timestamps, changesets []int64
+	versions, uids, usids, keyvals          []int32
+	visibles                                []bool
+
+	// way and relation buffers
+	refs, memids []int64
+	roles, types []int32
+}
+
+func (dec *visitDecoder) Decode(blob *osmpbf.Blob) error {
+	var err error
+	dec.data, err = getData(blob, dec.data)
+	if err != nil {
+		return err
+	}
+
+	dec.strings = dec.strings[:0]
+	dec.granularity = 100
+	dec.dateGranularity = 1000
+	dec.latOffset = 0
+	dec.lonOffset = 0
+
+	dec.block = message(dec.block, dec.data)
+	for dec.block.Next() {
+		var err error
+		switch dec.block.FieldNumber() {
+		case 1:
+			err = dec.scanStringTable()
+		case 17:
+			var v int32
+			v, err = dec.block.Int32()
+			dec.granularity = int64(v)
+		case 18:
+			var v int32
+			v, err = dec.block.Int32()
+			dec.dateGranularity = int64(v)
+		case 19:
+			dec.latOffset, err = dec.block.Int64()
+		case 20:
+			dec.lonOffset, err = dec.block.Int64()
+		default:
+			dec.block.Skip()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if dec.block.Err() != nil {
+		return dec.block.Err()
+	}
+
+	// the groups need the string table, offsets and granularities
+	dec.block.Reset(nil)
+	for dec.block.Next() {
+		if dec.block.FieldNumber() != 2 {
+			dec.block.Skip()
+			continue
+		}
+
+		var err error
+		dec.group, err = dec.block.Message(dec.group)
+		if err != nil {
+			return err
+		}
+
+		if err := dec.scanPrimitiveGroup(); err != nil {
+			return err
+		}
+	}
+
+	return dec.block.Err()
+}
+
+// message returns a protoscan message for the data, reusing msg if possible.
+func message(msg *protoscan.Message, data []byte) *protoscan.Message {
+	if msg == nil {
+		return protoscan.New(data)
+	}
+
+	msg.Reset(data)
+	return msg
+}
+
+func (dec *visitDecoder) scanStringTable() error {
+	var err error
+	dec.element, err = dec.block.Message(dec.element)
+	if err != nil {
+		return err
+	}
+
+	for dec.element.Next() {
+		if dec.element.FieldNumber() != 1 {
+			dec.element.Skip()
+			continue
+		}
+
+		s, err := dec.element.Bytes()
+		if err != nil {
+			return err
+		}
+		dec.strings = append(dec.strings, s)
+	}
+
+	return dec.element.Err()
+}
+
+func (dec *visitDecoder) scanPrimitiveGroup() error {
+	v := dec.visitor
+	for dec.group.Next() {
+		var err error
+		switch fn := dec.group.FieldNumber(); {
+		case fn == 1:
+			return errors.New("osmpbf: nodes are not supported, currently untested")
+		case fn == 2 && v.Node != nil:
+			err = dec.scanDenseNodes()
+		case fn == 3 && v.Way != nil:
+			err = dec.scanWay()
+		case fn == 4 && v.Relation != nil:
+			err = dec.scanRelation()
+		default:
+			dec.group.Skip()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return dec.group.Err()
+}
+
+func (dec *visitDecoder) scanDenseNodes() error {
+	var err error
+	dec.element, err = dec.group.Message(dec.element)
+	if err != nil {
+		return err
+	}
+
+	dec.ids, dec.lats, dec.lons = dec.ids[:0], dec.lats[:0], dec.lons[:0]
+	dec.versions, dec.timestamps, dec.changesets = dec.versions[:0], dec.timestamps[:0], dec.changesets[:0]
+	dec.uids, dec.usids, dec.visibles = dec.uids[:0], dec.usids[:0], dec.visibles[:0]
+	dec.keyvals = dec.keyvals[:0]
+
+	msg := dec.element
+	for msg.Next() {
+		var err error
+		switch msg.FieldNumber() {
+		case 1:
+			dec.ids, err = msg.RepeatedSint64(dec.ids)
+		case 5:
+			err = dec.scanDenseInfo()
+		case 8:
+			dec.lats, err = msg.RepeatedSint64(dec.lats)
+		case 9:
+			dec.lons, err = msg.RepeatedSint64(dec.lons)
+		case 10:
+			dec.keyvals, err = msg.RepeatedInt32(dec.keyvals)
+		default:
+			msg.Skip()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if msg.Err() != nil {
+		return msg.Err()
+	}
+
+	if len(dec.lats) != len(dec.ids) || len(dec.lons) != len(dec.ids) {
+		return errors.New("osmpbf: dense node locations do not match ids")
+	}
+
+	n := &dec.node
+	n.Strings = dec.strings
+
+	var id, lat, lon, timestamp, changeset int64
+	var uid, usid int32
+	kv := 0
+	for i := range dec.ids {
+		id += dec.ids[i]
+		lat += dec.lats[i]
+		lon += dec.lons[i]
+
+		n.ID = osm.NodeID(id)
+		n.Lat = 1e-9 * float64(dec.latOffset+(dec.granularity*lat))
+		n.Lon = 1e-9 * float64(dec.lonOffset+(dec.granularity*lon))
+
+		n.Info = Info{Visible: true}
+		if i < len(dec.versions) {
+			n.Version = int(dec.versions[i])
+		}
+
+		if i < len(dec.timestamps) {
+			timestamp += dec.timestamps[i]
+			n.Timestamp = dec.timestamp(timestamp)
+		}
+
+		if i < len(dec.changesets) {
+			changeset += dec.changesets[i]
+			n.ChangesetID = osm.ChangesetID(changeset)
+		}
+
+		if i < len(dec.uids) {
+			uid += dec.uids[i]
+			n.UserID = osm.UserID(uid)
+		}
+
+		if i < len(dec.usids) {
+			usid += dec.usids[i]
+			n.UserIndex = uint32(usid)
+		}
+
+		if i < len(dec.visibles) {
+			n.Visible = dec.visibles[i]
+		}
+
+		// tags, could be missing if all nodes are tagless
+		n.Keys, n.Vals = n.Keys[:0], n.Vals[:0]
+		for kv < len(dec.keyvals) {
+			k := dec.keyvals[kv]
+			kv++
+			if k == 0 || kv >= len(dec.keyvals) {
+				break
+			}
+
+			n.Keys = append(n.Keys, uint32(k))
+			n.Vals = append(n.Vals, uint32(dec.keyvals[kv]))
+			kv++
+		}
+
+		if err := dec.visitor.Node(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (dec *visitDecoder) scanDenseInfo() error {
+	var err error
+	dec.info, err = dec.element.Message(dec.info)
+	if err != nil {
+		return err
+	}
+
+	msg := dec.info
+	for msg.Next() {
+		var err error
+		switch msg.FieldNumber() {
+		case 1:
+			dec.versions, err = msg.RepeatedInt32(dec.versions)
+		case 2:
+			dec.timestamps, err = msg.RepeatedSint64(dec.timestamps)
+		case 3:
+			dec.changesets, err = msg.RepeatedSint64(dec.changesets)
+		case 4:
+			dec.uids, err = msg.RepeatedSint32(dec.uids)
+		case 5:
+			dec.usids, err = msg.RepeatedSint32(dec.usids)
+		case 6:
+			dec.visibles, err = msg.RepeatedBool(dec.visibles)
+		default:
+			msg.Skip()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return msg.Err()
+}
+
+func (dec *visitDecoder) timestamp(t int64) time.Time {
+	millisec := time.Duration(t*dec.dateGranularity) * time.Millisecond
+	return time.Unix(0, millisec.Nanoseconds()).UTC()
+}
+
+// scanInfo reads the non-dense info of a way or relation.
+func (dec *visitDecoder) scanInfo(info *Info) error {
+	var err error
+	dec.info, err = dec.element.Message(dec.info)
+	if err != nil {
+		return err
+	}
+
+	msg := dec.info
+	for msg.Next() {
+		var err error
+		switch msg.FieldNumber() {
+		case 1:
+			var v int32
+			v, err = msg.Int32()
+			info.Version = int(v)
+		case 2:
+			var v int64
+			v, err = msg.Int64()
+			info.Timestamp = dec.timestamp(v)
+		case 3:
+			var v int64
+			v, err = msg.Int64()
+			info.ChangesetID = osm.ChangesetID(v)
+		case 4:
+			var v int32
+			v, err = msg.Int32()
+			info.UserID = osm.UserID(v)
+		case 5:
+			info.UserIndex, err = msg.Uint32()
+		case 6:
+			info.Visible, err = msg.Bool()
+		default:
+			msg.Skip()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return msg.Err()
+}
+
+func (dec *visitDecoder) scanWay() error {
+	var err error
+	dec.element, err = dec.group.Message(dec.element)
+	if err != nil {
+		return err
+	}
+
+	w := &dec.way
+	w.ID = 0
+	w.Info = Info{Visible: true}
+	w.Strings = dec.strings
+	w.Keys, w.Vals = w.Keys[:0], w.Vals[:0]
+	w.Refs, w.Lats, w.Lons = w.Refs[:0], w.Lats[:0], w.Lons[:0]
+	dec.refs, dec.lats, dec.lons = dec.refs[:0], dec.lats[:0], dec.lons[:0]
+
+	msg := dec.element
+	for msg.Next() {
+		var err error
+		switch msg.FieldNumber() {
+		case 1:
+			var v int64
+			v, err = msg.Int64()
+			w.ID = osm.WayID(v)
+		case 2:
+			w.Keys, err = msg.RepeatedUint32(w.Keys)
+		case 3:
+			w.Vals, err = msg.RepeatedUint32(w.Vals)
+		case 4:
+			err = dec.scanInfo(&w.Info)
+		case 8:
+			dec.refs, err = msg.RepeatedSint64(dec.refs)
+		case 9:
+			dec.lats, err = msg.RepeatedSint64(dec.lats)
+		case 10:
+			dec.lons, err = msg.RepeatedSint64(dec.lons)
+		default:
+			msg.Skip()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if msg.Err() != nil {
+		return msg.Err()
+	}
+
+	var ref int64
+	for _, v := range dec.refs {
+		ref += v // delta encoding
+		w.Refs = append(w.Refs, osm.NodeID(ref))
+	}
+
+	var lat, lon int64
+	if len(dec.lats) == len(dec.refs) && len(dec.lons) == len(dec.refs) {
+		for i := range dec.lats {
+			lat += dec.lats[i]
+			lon += dec.lons[i]
+			w.Lats = append(w.Lats, 1e-9*float64(dec.latOffset+(dec.granularity*lat)))
+			w.Lons = append(w.Lons, 1e-9*float64(dec.lonOffset+(dec.granularity*lon)))
+		}
+	}
+
+	return dec.visitor.Way(w)
+}
+
+func (dec *visitDecoder) scanRelation() error {
+	var err error
+	dec.element, err = dec.group.Message(dec.element)
+	if err != nil {
+		return err
+	}
+
+	r := &dec.relation
+	r.ID = 0
+	r.Info = Info{Visible: true}
+	r.Strings = dec.strings
+	r.Keys, r.Vals = r.Keys[:0], r.Vals[:0]
+	r.MemberTypes, r.MemberRefs, r.MemberRoles = r.MemberTypes[:0], r.MemberRefs[:0], r.MemberRoles[:0]
+	dec.roles, dec.memids, dec.types = dec.roles[:0], dec.memids[:0], dec.types[:0]
+
+	msg := dec.element
+	for msg.Next() {
+		var err error
+		switch msg.FieldNumber() {
+		case 1:
+			var v int64
+			v, err = msg.Int64()
+			r.ID = osm.RelationID(v)
+		case 2:
+			r.Keys, err = msg.RepeatedUint32(r.Keys)
+		case 3:
+			r.Vals, err = msg.RepeatedUint32(r.Vals)
+		case 4:
+			err = dec.scanInfo(&r.Info)
+		case 8:
+			dec.roles, err = msg.RepeatedInt32(dec.roles)
+		case 9:
+			dec.memids, err = msg.RepeatedSint64(dec.memids)
+		case 10:
+			dec.types, err = msg.RepeatedInt32(dec.types)
+		default:
+			msg.Skip()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if msg.Err() != nil {
+		return msg.Err()
+	}
+
+	if len(dec.memids) != len(dec.roles) || len(dec.types) != len(dec.roles) {
+		return errors.New("osmpbf: relation member arrays have different lengths")
+	}
+
+	var ref int64
+	for i := range dec.memids {
+		ref += dec.memids[i] // delta encoding
+		r.MemberRefs = append(r.MemberRefs, ref)
+		r.MemberRoles = append(r.MemberRoles, uint32(dec.roles[i]))
+
+		switch osmpbf.Relation_MemberType(dec.types[i]) {
+		case osmpbf.Relation_NODE:
+			r.MemberTypes = append(r.MemberTypes, osm.TypeNode)
+		case osmpbf.Relation_WAY:
+			r.MemberTypes = append(r.MemberTypes, osm.TypeWay)
+		case osmpbf.Relation_RELATION:
+			r.MemberTypes = append(r.MemberTypes, osm.TypeRelation)
+		default:
+			r.MemberTypes = append(r.MemberTypes, "")
+		}
+	}
+
+	return dec.visitor.Relation(r)
+}
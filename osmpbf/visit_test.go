@@ -0,0 +1,287 @@
+package osmpbf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+func visitTestObjects() []osm.Object {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	return []osm.Object{
+		&osm.Node{ID: 1, Version: 2, Visible: true, Timestamp: ts, ChangesetID: 10,
+			UserID: 5, User: "alice", Lat: 1.5, Lon: -2.25},
+		&osm.Node{ID: 3, Version: 1, Visible: false, Timestamp: ts.Add(time.Hour), ChangesetID: 12,
+			UserID: 6, User: "bob", Lat: 1.75, Lon: -2.5, Tags: osm.Tags{{Key: "amenity", Value: "cafe"}, {Key: "name", Value: "Joe's"}}},
+		&osm.Node{ID: 4, Version: 3, Visible: true, Timestamp: ts, ChangesetID: 11,
+			UserID: 5, User: "alice", Lat: -1, Lon: 2, Tags: osm.Tags{{Key: "name", Value: "alice"}}},
+		&osm.Way{ID: 7, Version: 1, Visible: true, Timestamp: ts, ChangesetID: 10, UserID: 5, User: "alice",
+			Nodes: osm.WayNodes{{ID: 1}, {ID: 3}, {ID: 4}, {ID: 1}},
+			Tags:  osm.Tags{{Key: "building", Value: "yes"}}},
+		&osm.Way{ID: 8, Version: 2, Visible: false, Timestamp: ts, ChangesetID: 13, UserID: 6, User: "bob"},
+		&osm.Relation{ID: 9, Version: 4, Visible: true, Timestamp: ts, ChangesetID: 14, UserID: 6, User: "bob",
+			Tags: osm.Tags{{Key: "type", Value: "multipolygon"}},
+			Members: osm.Members{
+				{Type: osm.TypeWay, Ref: 7, Role: "outer"},
+				{Type: osm.TypeNode, Ref: 3, Role: ""},
+				{Type: osm.TypeRelation, Ref: 2, Role: "subarea"},
+			}},
+	}
+}
+
+func TestVisitor(t *testing.T) {
+	objects := visitTestObjects()
+	data := testData(t, nil, objects)
+
+	var result []osm.Object
+	v := NewVisitor(context.Background(), bytes.NewReader(data), 1)
+	v.Node = func(n *NodeView) error {
+		result = append(result, n.Node())
+		return nil
+	}
+	v.Way = func(w *WayView) error {
+		result = append(result, w.Way())
+		return nil
+	}
+	v.Relation = func(r *RelationView) error {
+		result = append(result, r.Relation())
+		return nil
+	}
+
+	if err := v.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if len(result) != len(objects) {
+		t.Fatalf("incorrect number of objects: %v", len(result))
+	}
+
+	for i := range objects {
+		if !reflect.DeepEqual(result[i], objects[i]) {
+			t.Errorf("incorrect object %d", i)
+			t.Logf("%+v", result[i])
+			t.Logf("%+v", objects[i])
+		}
+	}
+}
+
+func TestVisitor_matchesScanner(t *testing.T) {
+	blocks := processTestBlocks()
+	blocks = append(blocks, visitTestObjects())
+	data := testData(t, nil, blocks...)
+
+	scanner := New(context.Background(), bytes.NewReader(data), 1)
+	defer scanner.Close()
+
+	var expected []osm.Object
+	for scanner.Scan() {
+		expected = append(expected, scanner.Object())
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scanner error: %v", err)
+	}
+
+	var result []osm.Object
+	v := NewVisitor(context.Background(), bytes.NewReader(data), 1)
+	v.Node = func(n *NodeView) error {
+		result = append(result, n.Node())
+		return nil
+	}
+	v.Way = func(w *WayView) error {
+		result = append(result, w.Way())
+		return nil
+	}
+	v.Relation = func(r *RelationView) error {
+		result = append(result, r.Relation())
+		return nil
+	}
+
+	if err := v.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("visitor does not match scanner")
+	}
+}
+
+func TestVisitor_skip(t *testing.T) {
+	data := testData(t, nil, visitTestObjects())
+
+	var (
+		lock  sync.Mutex
+		names []string
+	)
+
+	v := NewVisitor(context.Background(), bytes.NewReader(data), 2)
+	v.Node = func(n *NodeView) error {
+		if name := n.Find("name"); name != nil {
+			lock.Lock()
+			names = append(names, string(name))
+			lock.Unlock()
+		}
+		return nil
+	}
+
+	if err := v.Run(); err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+
+	if !reflect.DeepEqual(names, []string{"Joe's", "alice"}) {
+		t.Errorf("incorrect names: %v", names)
+	}
+}
+
+func TestVisitor_error(t *testing.T) {
+	data := testData(t, nil, processTestBlocks()...)
+
+	verr := errors.New("visit error")
+	v := NewVisitor(context.Background(), bytes.NewReader(data), 4)
+
+	var count int64
+	v.Node = func(n *NodeView) error {
+		if atomic.AddInt64(&count, 1) == 200 {
+			return verr
+		}
+		return nil
+	}
+
+	if err := v.Run(); err != verr {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
+
+func TestTagsView(t *testing.T) {
+	tv := &TagsView{
+		Keys:    []uint32{1, 3},
+		Vals:    []uint32{2, 4},
+		Strings: StringTable{[]byte(""), []byte("a"), []byte("b"), []byte("c"), []byte("d")},
+	}
+
+	if v := string(tv.Find("c")); v != "d" {
+		t.Errorf("incorrect value: %v", v)
+	}
+
+	if v := tv.Find("b"); v != nil {
+		t.Errorf("should not find value: %v", v)
+	}
+
+	if !tv.HasTag("a") || tv.HasTag("d") {
+		t.Errorf("incorrect has tag")
+	}
+
+	expected := osm.Tags{{Key: "a", Value: "b"}, {Key: "c", Value: "d"}}
+	if tags := tv.Tags(); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("incorrect tags: %v", tags)
+	}
+}
+
+func BenchmarkLondon_visitor(b *testing.B) {
+	f, err := os.Open(London)
+	if err != nil {
+		b.Fatalf("could not open file: %v", err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Seek(0, 0)
+
+		var nodes, ways, relations int64
+		v := NewVisitor(context.Background(), f, 4)
+		v.Node = func(*NodeView) error {
+			atomic.AddInt64(&nodes, 1)
+			return nil
+		}
+		v.Way = func(*WayView) error {
+			atomic.AddInt64(&ways, 1)
+			return nil
+		}
+		v.Relation = func(*RelationView) error {
+			atomic.AddInt64(&relations, 1)
+			return nil
+		}
+
+		if err := v.Run(); err != nil {
+			b.Fatalf("run error: %v", err)
+		}
+
+		if nodes != 2729006 {
+			b.Errorf("wrong number of nodes, got %v", nodes)
+		}
+
+		if ways != 459055 {
+			b.Errorf("wrong number of ways, got %v", ways)
+		}
+
+		if relations != 12833 {
+			b.Errorf("wrong number of relations, got %v", relations)
+		}
+	}
+}
+
+func benchmarkData(b *testing.B) []byte {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	var blocks [][]osm.Object
+	for i := 0; i < 20; i++ {
+		var block []osm.Object
+		for j := 0; j < 8000; j++ {
+			block = append(block, &osm.Node{
+				ID: osm.NodeID(i*8000 + j + 1), Version: 1, Visible: true, Timestamp: ts,
+				Lat: float64(j) / 1000, Lon: float64(i) / 1000, User: "user",
+				Tags: osm.Tags{{Key: "highway", Value: "crossing"}},
+			})
+		}
+		blocks = append(blocks, block)
+	}
+
+	return testData(b, nil, blocks...)
+}
+
+func BenchmarkGenerated_scanner(b *testing.B) {
+	data := benchmarkData(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scanner := New(context.Background(), bytes.NewReader(data), 4)
+		nodes, _, _ := benchmarkScanner(b, scanner)
+		if nodes != 160000 {
+			b.Errorf("wrong number of nodes, got %v", nodes)
+		}
+		scanner.Close()
+	}
+}
+
+func BenchmarkGenerated_visitor(b *testing.B) {
+	data := benchmarkData(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var nodes int64
+		v := NewVisitor(context.Background(), bytes.NewReader(data), 4)
+		v.Node = func(*NodeView) error {
+			atomic.AddInt64(&nodes, 1)
+			return nil
+		}
+
+		if err := v.Run(); err != nil {
+			b.Fatalf("run error: %v", err)
+		}
+
+		if nodes != 160000 {
+			b.Errorf("wrong number of nodes, got %v", nodes)
+		}
+	}
+}
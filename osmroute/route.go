@@ -0,0 +1,719 @@
+// Package osmroute assembles route relations into ordered, connected path
+// segments and separates the public transport stops and platforms from the
+// path. Gaps, members out of order, ways traversed against their
+// forward/backward role and PTv2 ordering problems are reported as
+// continuity errors.
+package osmroute
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/internal/mputil"
+)
+
+// ErrNotRoute is returned when assembling a relation without the type=route tag.
+var ErrNotRoute = errors.New("osmroute: relation is not a route")
+
+// A Direction is how a way member can be traversed, given by its role.
+type Direction int
+
+// The directions of path members.
+const (
+	DirectionBoth     Direction = 0
+	DirectionForward  Direction = 1
+	DirectionBackward Direction = -1
+)
+
+// An ErrorType is the kind of continuity error.
+type ErrorType string
+
+// The continuity errors found when assembling a route.
+const (
+	// ErrorGap is when the path is not connected, the ways can
+	// not be chained by their end nodes.
+	ErrorGap ErrorType = "gap"
+
+	// ErrorOrder is when a path way connects to the path but is listed
+	// before the member it follows.
+	ErrorOrder ErrorType = "out_of_order"
+
+	// ErrorWrongDirection is when a forward way must be traversed backwards
+	// or a backward way forwards to connect the path.
+	ErrorWrongDirection ErrorType = "wrong_direction"
+
+	// ErrorMissingMember is when the way, or the node locations,
+	// of a member are not in the data.
+	ErrorMissingMember ErrorType = "missing_member"
+
+	// ErrorStopOrder is when a PTv2 stop or platform comes after a path way.
+	ErrorStopOrder ErrorType = "stop_order"
+
+	// ErrorStopNotOnPath is when a PTv2 stop node is not a node of the path.
+	ErrorStopNotOnPath ErrorType = "stop_not_on_path"
+)
+
+// A ContinuityError is a problem with the route at a relation member.
+type ContinuityError struct {
+	Type ErrorType
+
+	// Index is the index of the member in the relation.
+	Index int
+
+	// Location is where the error is, if known. For gaps it is the end
+	// of the path before the gap and To is the start of the path after.
+	Location orb.Point
+	To       orb.Point
+}
+
+// Error returns a description of the error.
+func (e *ContinuityError) Error() string {
+	return fmt.Sprintf("osmroute: %s at member %d", e.Type, e.Index)
+}
+
+// A Route is an assembled route relation.
+type Route struct {
+	Relation *osm.Relation
+
+	// PTv2 is true for public_transport:version=2 routes.
+	PTv2 bool
+
+	// Segments are the connected sections of the path, in the order of
+	// their first member. A gap or missing member starts a new segment.
+	Segments []*Segment
+
+	// Stops are the stop and platform members in member order.
+	Stops []*Stop
+
+	Errors []*ContinuityError
+}
+
+// Continuous returns true if the path is one connected segment.
+func (r *Route) Continuous() bool {
+	return len(r.Segments) == 1
+}
+
+// Gaps returns the gap errors of the route.
+func (r *Route) Gaps() []*ContinuityError {
+	var result []*ContinuityError
+	for _, e := range r.Errors {
+		if e.Type == ErrorGap {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+// Geometry returns the path as a line string if it is continuous,
+// a multi line string if there are gaps, or nil if there is no path.
+func (r *Route) Geometry() orb.Geometry {
+	switch len(r.Segments) {
+	case 0:
+		return nil
+	case 1:
+		return r.Segments[0].LineString()
+	}
+
+	mls := make(orb.MultiLineString, 0, len(r.Segments))
+	for _, s := range r.Segments {
+		mls = append(mls, s.LineString())
+	}
+
+	return mls
+}
+
+// A Segment is a connected section of the route path.
+type Segment struct {
+	Ways []*PathWay
+}
+
+// LineString returns the segment ways joined end to end.
+func (s *Segment) LineString() orb.LineString {
+	var ls orb.LineString
+	for i, w := range s.Ways {
+		line := w.LineString()
+		if i > 0 && len(line) > 0 {
+			line = line[1:]
+		}
+
+		ls = append(ls, line...)
+	}
+
+	return ls
+}
+
+// A PathWay is a way member of the route path.
+type PathWay struct {
+	// Index is the index of the member in the relation.
+	Index  int
+	Member osm.Member
+
+	// Way is nil if the way was not in the data and the nodes
+	// came from the annotated member.
+	Way *osm.Way
+
+	Direction Direction
+
+	// Reversed is true if the way is traversed against its direction.
+	Reversed bool
+
+	// Nodes are the way nodes, with locations, in the direction of travel.
+	// Nodes without a location in the data are not included.
+	// For closed ways, like roundabouts, only the nodes from where the
+	// path enters to where it exits are included.
+	Nodes osm.WayNodes
+
+	closed bool
+}
+
+// LineString returns the way in the direction of travel.
+func (w *PathWay) LineString() orb.LineString {
+	ls := make(orb.LineString, 0, len(w.Nodes))
+	for _, n := range w.Nodes {
+		ls = append(ls, n.Point())
+	}
+
+	return ls
+}
+
+func (w *PathWay) first() osm.NodeID {
+	return w.Nodes[0].ID
+}
+
+func (w *PathWay) last() osm.NodeID {
+	return w.Nodes[len(w.Nodes)-1].ID
+}
+
+// wrongDirection returns true if the way is traversed against its role.
+func (w *PathWay) wrongDirection() bool {
+	return (w.Direction == DirectionForward && w.Reversed) ||
+		(w.Direction == DirectionBackward && !w.Reversed)
+}
+
+func (w *PathWay) reverse() {
+	w.Reversed = !w.Reversed
+	for i, j := 0, len(w.Nodes)-1; i < j; i, j = i+1, j-1 {
+		w.Nodes[i], w.Nodes[j] = w.Nodes[j], w.Nodes[i]
+	}
+}
+
+// rotate changes the start and end of a closed way to the node at index i.
+func (w *PathWay) rotate(i int) {
+	nodes := make(osm.WayNodes, 0, len(w.Nodes))
+	nodes = append(nodes, w.Nodes[i:]...)
+	nodes = append(nodes, w.Nodes[1:i+1]...)
+	w.Nodes = nodes
+}
+
+// indexOf returns the index of the node in the way, or -1.
+func (w *PathWay) indexOf(id osm.NodeID) int {
+	for i, n := range w.Nodes {
+		if n.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// A Stop is a stop or platform member of the route.
+type Stop struct {
+	// Index is the index of the member in the relation.
+	Index  int
+	Member osm.Member
+
+	// Platform is true for platform roles, false for stop roles.
+	Platform bool
+
+	// Geometry is a point for nodes and a line string for ways.
+	// It is nil if the member is not in the data.
+	Geometry orb.Geometry
+}
+
+type assembler struct {
+	index *osm.Index
+	route *Route
+
+	// ways are the path ways in member order,
+	// missing the member index of ways without geometry.
+	ways    []*PathWay
+	missing []int
+}
+
+// Assemble orders the way members of the route relation into connected
+// segments. The ways are chained by their shared end nodes, using the
+// same joining as the osmgeojson route geometry, so the members do not
+// need to be sorted. Ways listed out of order are reported as order errors
+// and only ways that do not connect are gaps. Ways with a forward or
+// backward role should be traversed in, or against, the direction of the
+// way, each chain is turned to have the fewest wrong direction errors.
+// Members with a stop* or platform* role are returned as stops and are not
+// part of the path. The errors are sorted by member index.
+//
+// The ways and node locations come from the data, or the annotated
+// members if the data is nil or does not include them.
+func Assemble(r *osm.Relation, o *osm.OSM) (*Route, error) {
+	if r.Tags.Find("type") != "route" {
+		return nil, ErrNotRoute
+	}
+
+	a := &assembler{
+		route: &Route{
+			Relation: r,
+			PTv2:     r.Tags.Find("public_transport:version") == "2",
+		},
+	}
+
+	if o != nil {
+		a.index = osm.NewIndex(o)
+	}
+
+	seenPath := false
+	for i, m := range r.Members {
+		if isStopRole(m.Role) {
+			a.addStop(i, m, seenPath)
+			continue
+		}
+
+		if m.Type != osm.TypeWay {
+			continue
+		}
+
+		d, ok := pathDirection(m.Role)
+		if !ok {
+			continue
+		}
+
+		seenPath = true
+		a.addWay(i, m, d)
+	}
+
+	a.buildSegments()
+	if a.route.PTv2 {
+		a.checkStopsOnPath()
+	}
+
+	sort.SliceStable(a.route.Errors, func(i, j int) bool {
+		return a.route.Errors[i].Index < a.route.Errors[j].Index
+	})
+
+	return a.route, nil
+}
+
+func isStopRole(role string) bool {
+	return strings.HasPrefix(role, "stop") || strings.HasPrefix(role, "platform")
+}
+
+// pathDirection returns the direction for the role, or false
+// if the role is not part of the path, e.g. alternative or excursion.
+func pathDirection(role string) (Direction, bool) {
+	switch role {
+	case "":
+		return DirectionBoth, true
+	case "forward":
+		return DirectionForward, true
+	case "backward":
+		return DirectionBackward, true
+	}
+
+	return DirectionBoth, false
+}
+
+func (a *assembler) addError(t ErrorType, index int, location, to orb.Point) {
+	a.route.Errors = append(a.route.Errors, &ContinuityError{
+		Type:     t,
+		Index:    index,
+		Location: location,
+		To:       to,
+	})
+}
+
+func (a *assembler) addStop(i int, m osm.Member, afterPath bool) {
+	stop := &Stop{
+		Index:    i,
+		Member:   m,
+		Platform: strings.HasPrefix(m.Role, "platform"),
+	}
+
+	switch m.Type {
+	case osm.TypeNode:
+		if p, ok := a.nodeLocation(osm.NodeID(m.Ref), m.Lat, m.Lon); ok {
+			stop.Geometry = p
+		}
+	case osm.TypeWay:
+		if nodes, _, complete := a.wayNodes(m); complete && len(nodes) > 0 {
+			stop.Geometry = (&PathWay{Nodes: nodes}).LineString()
+		}
+	}
+
+	var location orb.Point
+	if p, ok := stop.Geometry.(orb.Point); ok {
+		location = p
+	}
+
+	if stop.Geometry == nil && m.Type != osm.TypeRelation {
+		a.addError(ErrorMissingMember, i, location, orb.Point{})
+	}
+
+	if a.route.PTv2 && afterPath {
+		a.addError(ErrorStopOrder, i, location, orb.Point{})
+	}
+
+	a.route.Stops = append(a.route.Stops, stop)
+}
+
+func (a *assembler) addWay(i int, m osm.Member, d Direction) {
+	nodes, way, complete := a.wayNodes(m)
+	if len(nodes) < 2 {
+		// can't connect through a missing way, so the path
+		// continues in a new segment without a gap error.
+		a.addError(ErrorMissingMember, i, orb.Point{}, orb.Point{})
+		a.missing = append(a.missing, i)
+		return
+	}
+
+	if !complete {
+		a.addError(ErrorMissingMember, i, orb.Point{}, orb.Point{})
+	}
+
+	a.ways = append(a.ways, &PathWay{
+		Index:     i,
+		Member:    m,
+		Way:       way,
+		Direction: d,
+		Nodes:     nodes,
+		closed:    nodes[0].ID == nodes[len(nodes)-1].ID,
+	})
+}
+
+// buildSegments chains the path ways into segments. The open ways are
+// joined by their end points, then the closed ways, like roundabouts,
+// connect the chains that enter and leave them. The segments are ordered
+// by their first member.
+func (a *assembler) buildSegments() {
+	var (
+		segments []mputil.Segment
+		closed   []*PathWay
+	)
+
+	for i, pw := range a.ways {
+		if pw.closed {
+			closed = append(closed, pw)
+			continue
+		}
+
+		segments = append(segments, mputil.Segment{
+			Index: uint32(i),
+			Line:  pw.LineString(),
+		})
+	}
+
+	var chains []chain
+	for _, ms := range mputil.Join(segments) {
+		c := make(chain, 0, len(ms))
+		for _, s := range ms {
+			pw := a.ways[s.Index]
+			if s.Reversed {
+				pw.reverse()
+			}
+			c = append(c, pw)
+		}
+
+		c.orient()
+		chains = append(chains, c)
+	}
+
+	for _, pw := range closed {
+		chains = linkClosed(chains, pw)
+	}
+
+	sort.SliceStable(chains, func(i, j int) bool {
+		return chains[i].minIndex() < chains[j].minIndex()
+	})
+
+	for i, c := range chains {
+		if i > 0 {
+			prev := chains[i-1]
+			end := prev.last().Nodes[len(prev.last().Nodes)-1].Point()
+
+			// after a gap, ways that can be traversed both ways
+			// start at the end closest to the gap.
+			if len(c) == 1 && !c[0].closed && c[0].Direction == DirectionBoth &&
+				distance(end, c[0].Nodes[len(c[0].Nodes)-1].Point()) < distance(end, c[0].Nodes[0].Point()) {
+				c[0].reverse()
+			}
+
+			if !a.missingBetween(prev.maxIndex(), c.minIndex()) {
+				a.addError(ErrorGap, c[0].Index, end, c[0].Nodes[0].Point())
+			}
+		}
+
+		for j, pw := range c {
+			if j > 0 && pw.Index < c[j-1].Index {
+				a.addError(ErrorOrder, pw.Index, pw.Nodes[0].Point(), orb.Point{})
+			}
+
+			if pw.wrongDirection() {
+				a.addError(ErrorWrongDirection, pw.Index, pw.Nodes[0].Point(), orb.Point{})
+			}
+		}
+
+		a.route.Segments = append(a.route.Segments, &Segment{Ways: c})
+	}
+}
+
+// missingBetween returns true if a missing path member is between the indexes.
+func (a *assembler) missingBetween(from, to int) bool {
+	for _, i := range a.missing {
+		if from < i && i < to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// chain is a connected sequence of path ways in the direction of travel.
+type chain []*PathWay
+
+func (c chain) first() *PathWay { return c[0] }
+func (c chain) last() *PathWay  { return c[len(c)-1] }
+
+func (c chain) minIndex() int {
+	min := c[0].Index
+	for _, pw := range c[1:] {
+		if pw.Index < min {
+			min = pw.Index
+		}
+	}
+
+	return min
+}
+
+func (c chain) maxIndex() int {
+	max := c[0].Index
+	for _, pw := range c[1:] {
+		if pw.Index > max {
+			max = pw.Index
+		}
+	}
+
+	return max
+}
+
+// violations returns the number of ways traversed against their role.
+func (c chain) violations() int {
+	count := 0
+	for _, pw := range c {
+		if pw.wrongDirection() {
+			count++
+		}
+	}
+
+	return count
+}
+
+// flip changes the direction of travel of the chain.
+func (c chain) flip() {
+	for i, j := 0, len(c)-1; i < j; i, j = i+1, j-1 {
+		c[i], c[j] = c[j], c[i]
+	}
+
+	for _, pw := range c {
+		pw.reverse()
+	}
+}
+
+// flippable returns true if the chain has no ways with a direction.
+func (c chain) flippable() bool {
+	for _, pw := range c {
+		if pw.Direction != DirectionBoth {
+			return false
+		}
+	}
+
+	return true
+}
+
+// outOfOrder returns the number of ways listed before the way they follow.
+func (c chain) outOfOrder() int {
+	count := 0
+	for i := 1; i < len(c); i++ {
+		if c[i].Index < c[i-1].Index {
+			count++
+		}
+	}
+
+	return count
+}
+
+// orient turns the chain to have the fewest wrong direction ways, then the
+// fewest ways out of order. If it is the same both ways the chain starts
+// with the earlier member.
+func (c chain) orient() {
+	v, o := c.violations(), c.outOfOrder()
+	c.flip()
+
+	fv, fo := c.violations(), c.outOfOrder()
+	if fv < v || (fv == v && (fo < o || (fo == o && c.first().Index < c.last().Index))) {
+		return
+	}
+
+	c.flip()
+}
+
+// linkClosed adds the closed way to the chain that enters it and the chain
+// that leaves it. Only the nodes from where the path enters to where it exits
+// are included. If the path only enters, or leaves, the whole way is included.
+func linkClosed(chains []chain, ring *PathWay) []chain {
+	find := func(exclude int, exit bool) int {
+		touches := func(c chain) bool {
+			if exit {
+				return ring.indexOf(c.first().first()) >= 0
+			}
+			return ring.indexOf(c.last().last()) >= 0
+		}
+
+		for i, c := range chains {
+			if i != exclude && touches(c) {
+				return i
+			}
+		}
+
+		// chains without a direction can be turned around
+		for i, c := range chains {
+			if i == exclude || !c.flippable() {
+				continue
+			}
+
+			c.flip()
+			if touches(c) {
+				return i
+			}
+			c.flip()
+		}
+
+		return -1
+	}
+
+	entry := find(-1, false)
+	exit := find(entry, true)
+
+	if entry >= 0 {
+		ring.rotate(ring.indexOf(chains[entry].last().last()))
+	} else if exit >= 0 {
+		ring.rotate(ring.indexOf(chains[exit].first().first()))
+	}
+
+	if entry >= 0 && exit >= 0 {
+		if i := ring.indexOf(chains[exit].first().first()); i > 0 {
+			ring.Nodes = ring.Nodes[:i+1]
+		}
+	}
+	ring.closed = false
+
+	var linked chain
+	if entry >= 0 {
+		linked = append(linked, chains[entry]...)
+	}
+	linked = append(linked, ring)
+	if exit >= 0 {
+		linked = append(linked, chains[exit]...)
+	}
+
+	result := make([]chain, 0, len(chains)+1)
+	for i, c := range chains {
+		if i != entry && i != exit {
+			result = append(result, c)
+		}
+	}
+
+	return append(result, linked)
+}
+
+func (a *assembler) checkStopsOnPath() {
+	if len(a.route.Segments) == 0 {
+		return
+	}
+
+	onPath := make(map[osm.NodeID]struct{})
+	for _, s := range a.route.Segments {
+		for _, w := range s.Ways {
+			for _, n := range w.Nodes {
+				onPath[n.ID] = struct{}{}
+			}
+
+			if w.Way != nil {
+				for _, n := range w.Way.Nodes {
+					onPath[n.ID] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for _, stop := range a.route.Stops {
+		if stop.Platform || stop.Member.Type != osm.TypeNode {
+			continue
+		}
+
+		if _, ok := onPath[osm.NodeID(stop.Member.Ref)]; !ok {
+			p, _ := stop.Geometry.(orb.Point)
+			a.addError(ErrorStopNotOnPath, stop.Index, p, orb.Point{})
+		}
+	}
+}
+
+// wayNodes returns a copy of the way nodes with their locations. Nodes
+// without a location are dropped and complete is false.
+func (a *assembler) wayNodes(m osm.Member) (osm.WayNodes, *osm.Way, bool) {
+	var way *osm.Way
+	if a.index != nil {
+		way = a.index.Way(osm.WayID(m.Ref))
+	}
+
+	wayNodes := m.Nodes
+	if way != nil {
+		wayNodes = way.Nodes
+	}
+
+	complete := true
+	nodes := make(osm.WayNodes, 0, len(wayNodes))
+	for _, n := range wayNodes {
+		p, ok := a.nodeLocation(n.ID, n.Lat, n.Lon)
+		if !ok {
+			complete = false
+			continue
+		}
+
+		n.Lon, n.Lat = p[0], p[1]
+		nodes = append(nodes, n)
+	}
+
+	return nodes, way, complete
+}
+
+// nodeLocation returns the annotated location if set, or the node
+// location from the data.
+func (a *assembler) nodeLocation(id osm.NodeID, lat, lon float64) (orb.Point, bool) {
+	if lat != 0 || lon != 0 {
+		return orb.Point{lon, lat}, true
+	}
+
+	if a.index != nil {
+		if n := a.index.Node(id); n != nil {
+			return n.Point(), true
+		}
+	}
+
+	return orb.Point{}, false
+}
+
+func distance(p1, p2 orb.Point) float64 {
+	dx, dy := p1[0]-p2[0], p1[1]-p2[1]
+	return dx*dx + dy*dy
+}
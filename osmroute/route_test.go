@@ -0,0 +1,348 @@
+package osmroute
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+)
+
+// nodes 1-10 are along the x axis, 20-23 are a roundabout.
+func testData() *osm.OSM {
+	o := &osm.OSM{}
+	for i := 1; i <= 10; i++ {
+		o.Nodes = append(o.Nodes, &osm.Node{ID: osm.NodeID(i), Lon: float64(i), Lat: 0})
+	}
+
+	o.Nodes = append(o.Nodes,
+		&osm.Node{ID: 20, Lon: 11, Lat: 0},
+		&osm.Node{ID: 21, Lon: 12, Lat: 1},
+		&osm.Node{ID: 22, Lon: 13, Lat: 0},
+		&osm.Node{ID: 23, Lon: 12, Lat: -1},
+		&osm.Node{ID: 24, Lon: 14, Lat: 0},
+	)
+
+	o.Ways = osm.Ways{
+		{ID: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}}},
+		{ID: 2, Nodes: osm.WayNodes{{ID: 5}, {ID: 4}, {ID: 3}}}, // reversed
+		{ID: 3, Nodes: osm.WayNodes{{ID: 5}, {ID: 6}}},
+		{ID: 4, Nodes: osm.WayNodes{{ID: 7}, {ID: 8}}}, // not connected to 3
+		{ID: 5, Nodes: osm.WayNodes{{ID: 10}, {ID: 20}}},
+		{ID: 6, Nodes: osm.WayNodes{{ID: 20}, {ID: 21}, {ID: 22}, {ID: 23}, {ID: 20}}},
+		{ID: 7, Nodes: osm.WayNodes{{ID: 22}, {ID: 24}}},
+	}
+
+	return o
+}
+
+func route(members ...osm.Member) *osm.Relation {
+	return &osm.Relation{
+		ID:      1,
+		Tags:    osm.Tags{{Key: "type", Value: "route"}},
+		Members: members,
+	}
+}
+
+func wayIDs(s *Segment) []osm.WayID {
+	var ids []osm.WayID
+	for _, w := range s.Ways {
+		ids = append(ids, osm.WayID(w.Member.Ref))
+	}
+
+	return ids
+}
+
+func TestAssemble(t *testing.T) {
+	r := route(
+		osm.Member{Type: osm.TypeWay, Ref: 2},
+		osm.Member{Type: osm.TypeWay, Ref: 3},
+	)
+
+	result, err := Assemble(r, testData())
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	if !result.Continuous() || len(result.Errors) != 0 {
+		t.Fatalf("should be continuous: %v", result.Errors)
+	}
+
+	// the first way is turned around to connect to the second
+	s := result.Segments[0]
+	if !s.Ways[0].Reversed || s.Ways[1].Reversed {
+		t.Errorf("incorrect reversed")
+	}
+
+	expected := orb.LineString{{3, 0}, {4, 0}, {5, 0}, {6, 0}}
+	if ls := result.Geometry(); !orb.Equal(ls, expected) {
+		t.Errorf("incorrect geometry: %v", ls)
+	}
+}
+
+func TestAssemble_gaps(t *testing.T) {
+	r := route(
+		osm.Member{Type: osm.TypeWay, Ref: 1},
+		osm.Member{Type: osm.TypeWay, Ref: 2},
+		osm.Member{Type: osm.TypeWay, Ref: 3},
+		osm.Member{Type: osm.TypeWay, Ref: 4},
+		osm.Member{Type: osm.TypeWay, Ref: 100}, // missing
+		osm.Member{Type: osm.TypeWay, Ref: 5},
+	)
+
+	result, err := Assemble(r, testData())
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	if len(result.Segments) != 3 {
+		t.Fatalf("incorrect segments: %v", len(result.Segments))
+	}
+
+	if ids := wayIDs(result.Segments[0]); !reflect.DeepEqual(ids, []osm.WayID{1, 2, 3}) {
+		t.Errorf("incorrect first segment: %v", ids)
+	}
+
+	gaps := result.Gaps()
+	if len(gaps) != 1 {
+		t.Fatalf("incorrect gaps: %v", gaps)
+	}
+
+	if g := gaps[0]; g.Index != 3 || g.Location != (orb.Point{6, 0}) || g.To != (orb.Point{7, 0}) {
+		t.Errorf("incorrect gap: %+v", g)
+	}
+
+	if e := result.Errors[1]; e.Type != ErrorMissingMember || e.Index != 4 {
+		t.Errorf("incorrect missing error: %+v", e)
+	}
+
+	if _, ok := result.Geometry().(orb.MultiLineString); !ok {
+		t.Errorf("should be multi line string: %v", result.Geometry())
+	}
+}
+
+func TestAssemble_outOfOrder(t *testing.T) {
+	r := route(
+		osm.Member{Type: osm.TypeWay, Ref: 2},
+		osm.Member{Type: osm.TypeWay, Ref: 1},
+		osm.Member{Type: osm.TypeWay, Ref: 3},
+	)
+
+	result, err := Assemble(r, testData())
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	if !result.Continuous() || len(result.Gaps()) != 0 {
+		t.Fatalf("should be continuous: %v", result.Errors)
+	}
+
+	if ids := wayIDs(result.Segments[0]); !reflect.DeepEqual(ids, []osm.WayID{1, 2, 3}) {
+		t.Errorf("incorrect order: %v", ids)
+	}
+
+	if len(result.Errors) != 1 {
+		t.Fatalf("incorrect errors: %v", result.Errors)
+	}
+
+	// way 2 is listed before way 1
+	if e := result.Errors[0]; e.Type != ErrorOrder || e.Index != 0 || e.Location != (orb.Point{3, 0}) {
+		t.Errorf("incorrect error: %+v", e)
+	}
+
+	expected := orb.LineString{{1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}, {6, 0}}
+	if ls := result.Geometry(); !orb.Equal(ls, expected) {
+		t.Errorf("incorrect geometry: %v", ls)
+	}
+}
+
+func TestAssemble_reverseOrder(t *testing.T) {
+	// the members are sorted, but from the other end
+	r := route(
+		osm.Member{Type: osm.TypeWay, Ref: 3},
+		osm.Member{Type: osm.TypeWay, Ref: 2},
+		osm.Member{Type: osm.TypeWay, Ref: 1},
+	)
+
+	result, err := Assemble(r, testData())
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	if !result.Continuous() || len(result.Errors) != 0 {
+		t.Fatalf("should be continuous: %v", result.Errors)
+	}
+
+	expected := orb.LineString{{6, 0}, {5, 0}, {4, 0}, {3, 0}, {2, 0}, {1, 0}}
+	if ls := result.Geometry(); !orb.Equal(ls, expected) {
+		t.Errorf("incorrect geometry: %v", ls)
+	}
+}
+
+func TestAssemble_missingNodes(t *testing.T) {
+	o := testData()
+	o.Ways[2].Nodes = append(o.Ways[2].Nodes, osm.WayNode{ID: 100}) // missing
+
+	r := route(
+		osm.Member{Type: osm.TypeWay, Ref: 2},
+		osm.Member{Type: osm.TypeWay, Ref: 3},
+	)
+
+	result, err := Assemble(r, o)
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	if len(result.Errors) != 1 || result.Errors[0].Type != ErrorMissingMember {
+		t.Errorf("incorrect errors: %v", result.Errors)
+	}
+
+	expected := orb.LineString{{3, 0}, {4, 0}, {5, 0}, {6, 0}}
+	if ls := result.Geometry(); !orb.Equal(ls, expected) {
+		t.Errorf("incorrect geometry: %v", ls)
+	}
+}
+
+func TestAssemble_direction(t *testing.T) {
+	r := route(
+		osm.Member{Type: osm.TypeWay, Ref: 1, Role: "forward"},
+		osm.Member{Type: osm.TypeWay, Ref: 2, Role: "backward"},
+		osm.Member{Type: osm.TypeWay, Ref: 3, Role: "backward"},
+	)
+
+	result, err := Assemble(r, testData())
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	if !result.Continuous() {
+		t.Fatalf("should be continuous: %v", result.Errors)
+	}
+
+	if len(result.Errors) != 1 {
+		t.Fatalf("incorrect errors: %v", result.Errors)
+	}
+
+	if e := result.Errors[0]; e.Type != ErrorWrongDirection || e.Index != 2 {
+		t.Errorf("incorrect error: %+v", e)
+	}
+}
+
+func TestAssemble_roundabout(t *testing.T) {
+	r := route(
+		osm.Member{Type: osm.TypeWay, Ref: 5},
+		osm.Member{Type: osm.TypeWay, Ref: 6},
+		osm.Member{Type: osm.TypeWay, Ref: 7},
+	)
+
+	result, err := Assemble(r, testData())
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	if !result.Continuous() || len(result.Errors) != 0 {
+		t.Fatalf("should be continuous: %v", result.Errors)
+	}
+
+	ids := result.Segments[0].Ways[1].Nodes.NodeIDs()
+	if !reflect.DeepEqual(ids, []osm.NodeID{20, 21, 22}) {
+		t.Errorf("should only include the used part: %v", ids)
+	}
+
+	// the roundabout connects the ways even if listed out of order
+	r = route(
+		osm.Member{Type: osm.TypeWay, Ref: 7},
+		osm.Member{Type: osm.TypeWay, Ref: 5},
+		osm.Member{Type: osm.TypeWay, Ref: 6},
+	)
+
+	result, err = Assemble(r, testData())
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	if !result.Continuous() || len(result.Gaps()) != 0 {
+		t.Fatalf("should be continuous: %v", result.Errors)
+	}
+
+	if ids := wayIDs(result.Segments[0]); !reflect.DeepEqual(ids, []osm.WayID{5, 6, 7}) {
+		t.Errorf("incorrect order: %v", ids)
+	}
+}
+
+func TestAssemble_ptv2(t *testing.T) {
+	r := route(
+		osm.Member{Type: osm.TypeNode, Ref: 1, Role: "stop"},
+		osm.Member{Type: osm.TypeNode, Ref: 9, Role: "platform"},
+		osm.Member{Type: osm.TypeNode, Ref: 24, Role: "stop_exit_only"},
+		osm.Member{Type: osm.TypeWay, Ref: 1},
+		osm.Member{Type: osm.TypeWay, Ref: 2},
+		osm.Member{Type: osm.TypeNode, Ref: 4, Role: "stop"},
+	)
+	r.Tags = append(r.Tags, osm.Tag{Key: "public_transport:version", Value: "2"})
+
+	result, err := Assemble(r, testData())
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	if !result.PTv2 || !result.Continuous() {
+		t.Errorf("should be continuous ptv2 route")
+	}
+
+	if len(result.Stops) != 4 {
+		t.Fatalf("incorrect stops: %v", result.Stops)
+	}
+
+	if s := result.Stops[1]; !s.Platform || s.Geometry != (orb.Point{9, 0}) {
+		t.Errorf("incorrect platform: %+v", s)
+	}
+
+	types := []ErrorType{}
+	for _, e := range result.Errors {
+		types = append(types, e.Type)
+	}
+
+	// sorted by member index
+	expected := []ErrorType{ErrorStopNotOnPath, ErrorStopOrder}
+	if !reflect.DeepEqual(types, expected) {
+		t.Errorf("incorrect errors: %v", types)
+	}
+
+	if e := result.Errors[0]; e.Index != 2 || e.Location != (orb.Point{14, 0}) {
+		t.Errorf("incorrect error: %+v", e)
+	}
+}
+
+func TestAssemble_annotated(t *testing.T) {
+	r := route(
+		osm.Member{Type: osm.TypeWay, Ref: 1, Nodes: osm.WayNodes{
+			{ID: 1, Lon: 1, Lat: 1}, {ID: 2, Lon: 2, Lat: 2},
+		}},
+		osm.Member{Type: osm.TypeWay, Ref: 2, Nodes: osm.WayNodes{
+			{ID: 3, Lon: 3, Lat: 3}, {ID: 2, Lon: 2, Lat: 2},
+		}},
+	)
+
+	result, err := Assemble(r, nil)
+	if err != nil {
+		t.Fatalf("assemble error: %v", err)
+	}
+
+	expected := orb.LineString{{1, 1}, {2, 2}, {3, 3}}
+	if ls := result.Geometry(); !orb.Equal(ls, expected) {
+		t.Errorf("incorrect geometry: %v", ls)
+	}
+
+	// should not modify the member nodes
+	if r.Members[1].Nodes[0].ID != 3 {
+		t.Errorf("should not modify input")
+	}
+}
+
+func TestAssemble_notRoute(t *testing.T) {
+	_, err := Assemble(&osm.Relation{}, nil)
+	if err != ErrNotRoute {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package osmscan
+
+import (
+	"container/heap"
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// UnsortedError is returned by a merge scanner if one of the input scanners
+// is not sorted by type and then id.
+type UnsortedError struct {
+	Previous osm.ObjectID
+	Current  osm.ObjectID
+}
+
+// Error returns a pretty string of the error.
+func (e *UnsortedError) Error() string {
+	return fmt.Sprintf("osmscan: input not sorted, %v after %v", e.Current, e.Previous)
+}
+
+type mergeScanner struct {
+	scanners []osm.Scanner
+	heap     mergeHeap
+	started  bool
+
+	object osm.Object
+	err    error
+}
+
+var _ osm.Scanner = &mergeScanner{}
+
+type mergeItem struct {
+	object  osm.Object
+	key     osm.ObjectID
+	scanner int
+}
+
+type mergeHeap []*mergeItem
+
+func (h mergeHeap) Len() int      { return len(h) }
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+
+	return h[i].scanner < h[j].scanner
+}
+
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeItem)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// Merge returns a scanner that does a k-way merge of scanners sorted by
+// type, then id, i.e. nodes, ways and then relations. This is the order
+// of most osm data files, e.g. pbf extracts. Objects with the same type and id,
+// from the same or different scanners, are returned once, using the highest
+// version. Positive ids are required to maintain the sort order.
+// An *UnsortedError is returned if an input is not sorted.
+func Merge(scanners ...osm.Scanner) osm.Scanner {
+	return &mergeScanner{scanners: scanners}
+}
+
+// key returns the object id without the version.
+func key(o osm.Object) osm.ObjectID {
+	id := o.ObjectID()
+	return id - osm.ObjectID(id.Version())
+}
+
+func (s *mergeScanner) advance(i int, prev osm.ObjectID) bool {
+	scanner := s.scanners[i]
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			s.err = err
+		}
+
+		return false
+	}
+
+	o := scanner.Object()
+	k := key(o)
+	if k < prev {
+		s.err = &UnsortedError{Previous: prev, Current: k}
+		return false
+	}
+
+	heap.Push(&s.heap, &mergeItem{object: o, key: k, scanner: i})
+	return true
+}
+
+// Scan advances to the next object in the merged output.
+func (s *mergeScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	if !s.started {
+		s.started = true
+		for i := range s.scanners {
+			s.advance(i, 0)
+			if s.err != nil {
+				return false
+			}
+		}
+	}
+
+	if len(s.heap) == 0 {
+		return false
+	}
+
+	item := heap.Pop(&s.heap).(*mergeItem)
+	best := item.object
+	if s.advance(item.scanner, item.key); s.err != nil {
+		return false
+	}
+
+	// collect duplicates from all the scanners
+	for len(s.heap) > 0 && s.heap[0].key == item.key {
+		dup := heap.Pop(&s.heap).(*mergeItem)
+		if dup.object.ObjectID().Version() > best.ObjectID().Version() {
+			best = dup.object
+		}
+
+		if s.advance(dup.scanner, dup.key); s.err != nil {
+			return false
+		}
+	}
+
+	s.object = best
+	return true
+}
+
+// Object returns the current object.
+func (s *mergeScanner) Object() osm.Object {
+	return s.object
+}
+
+// Err returns the first error from the scanners or an *UnsortedError.
+func (s *mergeScanner) Err() error {
+	return s.err
+}
+
+// Close closes all the scanners.
+func (s *mergeScanner) Close() error {
+	return closeAll(s.scanners)
+}
@@ -0,0 +1,76 @@
+package osmscan
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+)
+
+func TestMerge(t *testing.T) {
+	a := osm.Objects{
+		&osm.Bounds{},
+		&osm.Node{ID: 1, Version: 1},
+		&osm.Node{ID: 3, Version: 2},
+		&osm.Way{ID: 1, Version: 5},
+		&osm.Relation{ID: 2, Version: 1},
+	}
+
+	b := osm.Objects{
+		&osm.Node{ID: 2, Version: 1},
+		&osm.Node{ID: 3, Version: 3},
+		&osm.Way{ID: 1, Version: 4},
+		&osm.Way{ID: 2, Version: 1},
+		&osm.Relation{ID: 1, Version: 1},
+	}
+
+	s := Merge(osmtest.NewScanner(a), osmtest.NewScanner(b))
+	result := scanAll(t, s)
+
+	expected := []osm.ObjectID{
+		(&osm.Bounds{}).ObjectID(),
+		osm.NodeID(1).ObjectID(1),
+		osm.NodeID(2).ObjectID(1),
+		osm.NodeID(3).ObjectID(3),
+		osm.WayID(1).ObjectID(5),
+		osm.WayID(2).ObjectID(1),
+		osm.RelationID(1).ObjectID(1),
+		osm.RelationID(2).ObjectID(1),
+	}
+
+	if len(result) != len(expected) {
+		t.Fatalf("incorrect result: %v", result)
+	}
+
+	for i := range expected {
+		if id := result[i].ObjectID(); id != expected[i] {
+			t.Errorf("incorrect object %d: %v != %v", i, id, expected[i])
+		}
+	}
+
+	t.Run("versions in one scanner", func(t *testing.T) {
+		s := Merge(osmtest.NewScanner(osm.Objects{
+			&osm.Node{ID: 1, Version: 1},
+			&osm.Node{ID: 1, Version: 2},
+		}))
+
+		result := scanAll(t, s)
+		if len(result) != 1 || result[0].ObjectID().Version() != 2 {
+			t.Errorf("incorrect result: %v", result)
+		}
+	})
+
+	t.Run("unsorted", func(t *testing.T) {
+		s := Merge(osmtest.NewScanner(osm.Objects{
+			&osm.Way{ID: 1, Version: 1},
+			&osm.Node{ID: 1, Version: 1},
+		}))
+
+		for s.Scan() {
+		}
+
+		if _, ok := s.Err().(*UnsortedError); !ok {
+			t.Errorf("incorrect error: %v", s.Err())
+		}
+	})
+}
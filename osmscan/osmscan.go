@@ -0,0 +1,173 @@
+// Package osmscan provides composable wrappers around osm.Scanner
+// to filter, transform, tee, concatenate and merge streams of objects.
+package osmscan
+
+import (
+	"github.com/paulmach/osm"
+)
+
+// A MapFunc transforms an object. Returning a nil object will skip it,
+// returning an error will stop the scan.
+type MapFunc func(osm.Object) (osm.Object, error)
+
+type mapScanner struct {
+	scanner osm.Scanner
+	f       MapFunc
+
+	object osm.Object
+	err    error
+}
+
+var _ osm.Scanner = &mapScanner{}
+
+// Map returns a scanner that applies the function to every object.
+func Map(s osm.Scanner, f MapFunc) osm.Scanner {
+	return &mapScanner{scanner: s, f: f}
+}
+
+// Filter returns a scanner that only returns the objects for
+// which the function returns true.
+func Filter(s osm.Scanner, keep func(osm.Object) bool) osm.Scanner {
+	return Map(s, func(o osm.Object) (osm.Object, error) {
+		if keep(o) {
+			return o, nil
+		}
+
+		return nil, nil
+	})
+}
+
+// Tee returns a scanner that calls each consumer with every object before
+// returning it. An error from a consumer will stop the scan.
+func Tee(s osm.Scanner, consumers ...func(osm.Object) error) osm.Scanner {
+	return Map(s, func(o osm.Object) (osm.Object, error) {
+		for _, c := range consumers {
+			if err := c(o); err != nil {
+				return nil, err
+			}
+		}
+
+		return o, nil
+	})
+}
+
+// Types returns a filter function that keeps the objects of the given types.
+func Types(types ...osm.Type) func(osm.Object) bool {
+	return func(o osm.Object) bool {
+		t := o.ObjectID().Type()
+		for _, tt := range types {
+			if t == tt {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Scan advances to the next object not skipped by the function.
+func (s *mapScanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	for s.scanner.Scan() {
+		o, err := s.f(s.scanner.Object())
+		if err != nil {
+			s.err = err
+			return false
+		}
+
+		if o != nil {
+			s.object = o
+			return true
+		}
+	}
+
+	return false
+}
+
+// Object returns the current transformed object.
+func (s *mapScanner) Object() osm.Object {
+	return s.object
+}
+
+// Err returns the error from the function or the underlying scanner.
+func (s *mapScanner) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+
+	return s.scanner.Err()
+}
+
+// Close closes the underlying scanner.
+func (s *mapScanner) Close() error {
+	return s.scanner.Close()
+}
+
+type concatScanner struct {
+	scanners []osm.Scanner
+	current  int
+	object   osm.Object
+	err      error
+}
+
+var _ osm.Scanner = &concatScanner{}
+
+// Concat returns a scanner that reads the scanners one after the other.
+func Concat(scanners ...osm.Scanner) osm.Scanner {
+	return &concatScanner{scanners: scanners}
+}
+
+// Scan advances to the next object, moving to the next scanner
+// when the current one is finished.
+func (s *concatScanner) Scan() bool {
+	s.object = nil
+	if s.err != nil {
+		return false
+	}
+
+	for s.current < len(s.scanners) {
+		scanner := s.scanners[s.current]
+		if scanner.Scan() {
+			s.object = scanner.Object()
+			return true
+		}
+
+		if err := scanner.Err(); err != nil {
+			s.err = err
+			return false
+		}
+
+		s.current++
+	}
+
+	return false
+}
+
+// Object returns the current object, or nil if Scan returned false.
+func (s *concatScanner) Object() osm.Object {
+	return s.object
+}
+
+// Err returns the first error from the scanners.
+func (s *concatScanner) Err() error {
+	return s.err
+}
+
+// Close closes all the scanners.
+func (s *concatScanner) Close() error {
+	return closeAll(s.scanners)
+}
+
+func closeAll(scanners []osm.Scanner) error {
+	var err error
+	for _, s := range scanners {
+		if cerr := s.Close(); err == nil {
+			err = cerr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,133 @@
+package osmscan
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+)
+
+func scanAll(t testing.TB, s osm.Scanner) osm.Objects {
+	t.Helper()
+
+	var result osm.Objects
+	for s.Scan() {
+		result = append(result, s.Object())
+	}
+
+	if err := s.Err(); err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	return result
+}
+
+func testObjects() osm.Objects {
+	return osm.Objects{
+		&osm.Node{ID: 1, Tags: osm.Tags{{Key: "a", Value: "b"}}},
+		&osm.Node{ID: 2},
+		&osm.Way{ID: 1},
+		&osm.Relation{ID: 1},
+	}
+}
+
+func TestFilter(t *testing.T) {
+	s := Filter(osmtest.NewScanner(testObjects()), Types(osm.TypeNode, osm.TypeRelation))
+
+	result := scanAll(t, s)
+	if len(result) != 3 {
+		t.Errorf("incorrect result: %v", result)
+	}
+
+	for _, o := range result {
+		if o.ObjectID().Type() == osm.TypeWay {
+			t.Errorf("should filter ways")
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	s := Map(osmtest.NewScanner(testObjects()), func(o osm.Object) (osm.Object, error) {
+		if n, ok := o.(*osm.Node); ok {
+			return &osm.Node{ID: n.ID + 10}, nil
+		}
+
+		return nil, nil
+	})
+
+	result := scanAll(t, s)
+	if len(result) != 2 || result[0].(*osm.Node).ID != 11 {
+		t.Errorf("incorrect result: %v", result)
+	}
+
+	t.Run("error", func(t *testing.T) {
+		mapErr := errors.New("some error")
+		s := Map(osmtest.NewScanner(testObjects()), func(o osm.Object) (osm.Object, error) {
+			return nil, mapErr
+		})
+
+		if s.Scan() {
+			t.Errorf("should not scan")
+		}
+
+		if err := s.Err(); err != mapErr {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+}
+
+func TestTee(t *testing.T) {
+	var a, b int
+	s := Tee(
+		osmtest.NewScanner(testObjects()),
+		func(o osm.Object) error { a++; return nil },
+		func(o osm.Object) error { b++; return nil },
+	)
+
+	result := scanAll(t, s)
+	if len(result) != 4 || a != 4 || b != 4 {
+		t.Errorf("incorrect counts: %v %v %v", len(result), a, b)
+	}
+}
+
+func TestConcat(t *testing.T) {
+	s := Concat(
+		osmtest.NewScanner(testObjects()[:2]),
+		osmtest.NewScanner(nil),
+		osmtest.NewScanner(testObjects()[2:]),
+	)
+
+	result := scanAll(t, s)
+	if len(result) != 4 {
+		t.Errorf("incorrect result: %v", result)
+	}
+
+	if o := s.Object(); o != nil {
+		t.Errorf("should not have object after the end: %v", o)
+	}
+
+	t.Run("no scanners", func(t *testing.T) {
+		s := Concat()
+		if s.Scan() {
+			t.Errorf("should not scan")
+		}
+
+		if o := s.Object(); o != nil {
+			t.Errorf("should not have object: %v", o)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errScanner := osmtest.NewScanner(testObjects())
+		errScanner.ScanError = errors.New("some error")
+
+		s := Concat(osmtest.NewScanner(testObjects()), errScanner)
+		for s.Scan() {
+		}
+
+		if err := s.Err(); err != errScanner.ScanError {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+}
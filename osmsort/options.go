@@ -0,0 +1,58 @@
+package osmsort
+
+import "errors"
+
+// Option is a parameter that can be used for sorting.
+type Option func(*options) error
+
+type options struct {
+	memoryLimit int64
+	maxOpenRuns int
+	tempDir     string
+}
+
+// DefaultMemoryLimit is the approximate number of bytes of objects
+// kept in memory before a sorted run is written to a temp file.
+const DefaultMemoryLimit = 256 * 1024 * 1024
+
+// MemoryLimit sets the approximate number of bytes of objects kept in
+// memory before a sorted run is written to a temp file.
+// Default is DefaultMemoryLimit.
+func MemoryLimit(bytes int64) Option {
+	return func(o *options) error {
+		if bytes <= 0 {
+			return errors.New("osmsort: memory limit must be positive")
+		}
+
+		o.memoryLimit = bytes
+		return nil
+	}
+}
+
+// DefaultMaxOpenRuns is the number of temp files that are open,
+// and merged, at the same time.
+const DefaultMaxOpenRuns = 64
+
+// MaxOpenRuns sets the maximum number of temp files that are open at the
+// same time. If there are more sorted runs they are merged in several
+// passes, each pass reads and writes all the data again.
+// Default is DefaultMaxOpenRuns.
+func MaxOpenRuns(n int) Option {
+	return func(o *options) error {
+		if n < 2 {
+			return errors.New("osmsort: max open runs must be at least 2")
+		}
+
+		o.maxOpenRuns = n
+		return nil
+	}
+}
+
+// TempDir sets the directory for the temp files of the sorted runs.
+// Default is the os.TempDir.
+func TempDir(dir string) Option {
+	return func(o *options) error {
+		o.tempDir = dir
+		return nil
+	}
+}
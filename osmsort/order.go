@@ -0,0 +1,66 @@
+// Package osmsort sorts streams of osm objects by type, id and then version
+// using temp files when the data does not fit in memory. It also verifies
+// the order of data that claims to be sorted.
+package osmsort
+
+import "github.com/paulmach/osm"
+
+// key is the sort key of an object. Ids are compared as is, so negative
+// ids will be before the positive ids of the same type.
+type key struct {
+	rank    int
+	id      int64
+	version int
+}
+
+// typeRanks is the order of the types, bounds first
+// followed by nodes, ways and then relations.
+var typeRanks = map[osm.Type]int{
+	osm.TypeBounds:    0,
+	osm.TypeNode:      1,
+	osm.TypeWay:       2,
+	osm.TypeRelation:  3,
+	osm.TypeChangeset: 4,
+	osm.TypeNote:      5,
+	osm.TypeUser:      6,
+}
+
+func keyOf(o osm.Object) key {
+	switch o := o.(type) {
+	case *osm.Bounds:
+		return key{rank: typeRanks[osm.TypeBounds]}
+	case *osm.Node:
+		return key{rank: typeRanks[osm.TypeNode], id: int64(o.ID), version: o.Version}
+	case *osm.Way:
+		return key{rank: typeRanks[osm.TypeWay], id: int64(o.ID), version: o.Version}
+	case *osm.Relation:
+		return key{rank: typeRanks[osm.TypeRelation], id: int64(o.ID), version: o.Version}
+	case *osm.Changeset:
+		return key{rank: typeRanks[osm.TypeChangeset], id: int64(o.ID)}
+	case *osm.Note:
+		return key{rank: typeRanks[osm.TypeNote], id: int64(o.ID)}
+	case *osm.User:
+		return key{rank: typeRanks[osm.TypeUser], id: int64(o.ID)}
+	}
+
+	return key{rank: len(typeRanks)}
+}
+
+func (k key) less(o key) bool {
+	if k.rank != o.rank {
+		return k.rank < o.rank
+	}
+
+	if k.id != o.id {
+		return k.id < o.id
+	}
+
+	return k.version < o.version
+}
+
+// Less returns true if object a comes before object b when sorted by
+// type, id and then version. The type order is bounds, nodes, ways,
+// relations, changesets, notes and then users.
+func Less(a, b osm.Object) bool {
+	return keyOf(a).less(keyOf(b))
+}
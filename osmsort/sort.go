@@ -0,0 +1,551 @@
+package osmsort
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/gob"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/paulmach/osm"
+)
+
+var _ osm.Scanner = &Scanner{}
+
+// Scanner reads all the objects of the input scanner and returns them sorted
+// by type, id and then version, i.e. nodes, ways and then relations.
+// Objects are sorted in memory until the memory limit is reached, then the
+// sorted run is written to a temp file. The runs are merged when scanning.
+// If there are more runs than the max open runs they are first merged,
+// in several passes if needed, into fewer larger runs.
+// The sort is stable, objects with the same key are returned in input order.
+type Scanner struct {
+	ctx    context.Context
+	done   context.CancelFunc
+	closed bool
+
+	input   osm.Scanner
+	opts    options
+	started bool
+
+	runs []*fileRun
+	heap runHeap
+
+	next osm.Object
+	err  error
+}
+
+type item struct {
+	key    key
+	object osm.Object
+}
+
+// run is a sorted sequence of objects.
+type run interface {
+	Next() (item, error)
+}
+
+type memoryRun struct {
+	items []item
+}
+
+func (r *memoryRun) Next() (item, error) {
+	if len(r.items) == 0 {
+		return item{}, io.EOF
+	}
+
+	i := r.items[0]
+	r.items = r.items[1:]
+	return i, nil
+}
+
+// fileRun is a run stored in a temp file. The file is only open
+// while the run is being merged.
+type fileRun struct {
+	name    string
+	f       *os.File
+	decoder *gob.Decoder
+}
+
+func (r *fileRun) open() error {
+	f, err := os.Open(r.name)
+	if err != nil {
+		return err
+	}
+
+	r.f = f
+	r.decoder = gob.NewDecoder(bufio.NewReader(f))
+	return nil
+}
+
+func (r *fileRun) close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	err := r.f.Close()
+	r.f = nil
+	r.decoder = nil
+	return err
+}
+
+// remove closes and deletes the temp file.
+func (r *fileRun) remove() error {
+	err := r.close()
+	if rerr := os.Remove(r.name); err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+func (r *fileRun) Next() (item, error) {
+	rec := record{}
+	if err := r.decoder.Decode(&rec); err != nil {
+		return item{}, err
+	}
+
+	o := rec.object()
+	return item{key: keyOf(o), object: o}, nil
+}
+
+// record is how objects are stored in the temp files.
+// Only one of the values is set.
+type record struct {
+	Bounds    *osm.Bounds
+	Node      *osm.Node
+	Way       *osm.Way
+	Relation  *osm.Relation
+	Changeset *osm.Changeset
+	Note      *osm.Note
+	User      *osm.User
+}
+
+func newRecord(o osm.Object) record {
+	switch o := o.(type) {
+	case *osm.Bounds:
+		return record{Bounds: o}
+	case *osm.Node:
+		return record{Node: o}
+	case *osm.Way:
+		return record{Way: o}
+	case *osm.Relation:
+		return record{Relation: o}
+	case *osm.Changeset:
+		return record{Changeset: o}
+	case *osm.Note:
+		return record{Note: o}
+	case *osm.User:
+		return record{User: o}
+	}
+
+	return record{}
+}
+
+func (r record) object() osm.Object {
+	switch {
+	case r.Bounds != nil:
+		return r.Bounds
+	case r.Node != nil:
+		return r.Node
+	case r.Way != nil:
+		return r.Way
+	case r.Relation != nil:
+		return r.Relation
+	case r.Changeset != nil:
+		return r.Changeset
+	case r.Note != nil:
+		return r.Note
+	}
+
+	return r.User
+}
+
+type runItem struct {
+	item
+	run int
+}
+
+type runHeap struct {
+	items []runItem
+	runs  []run
+}
+
+func (h *runHeap) Len() int      { return len(h.items) }
+func (h *runHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *runHeap) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if a.key != b.key {
+		return a.key.less(b.key)
+	}
+
+	// runs are in input order, this keeps the sort stable
+	return a.run < b.run
+}
+
+func (h *runHeap) Push(x interface{}) { h.items = append(h.items, x.(runItem)) }
+func (h *runHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
+
+// init sets the runs to merge and adds the first item of each to the heap.
+func (h *runHeap) init(runs []run) error {
+	h.runs = runs
+	h.items = nil
+	for i := range runs {
+		if err := h.push(i); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// next returns the next item of the merged runs.
+// Returns io.EOF when all the runs are done.
+func (h *runHeap) next() (item, error) {
+	if h.Len() == 0 {
+		return item{}, io.EOF
+	}
+
+	i := heap.Pop(h).(runItem)
+	if err := h.push(i.run); err != nil {
+		return item{}, err
+	}
+
+	return i.item, nil
+}
+
+// push adds the next item of the run to the heap.
+func (h *runHeap) push(run int) error {
+	i, err := h.runs[run].Next()
+	if err == io.EOF {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	heap.Push(h, runItem{item: i, run: run})
+	return nil
+}
+
+// New returns a scanner that returns the objects of the input sorted.
+// The input is read on the first call to Scan. Closing the scanner
+// will close the input and remove the temp files.
+func New(ctx context.Context, input osm.Scanner, opts ...Option) *Scanner {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	s := &Scanner{
+		input: input,
+		opts: options{
+			memoryLimit: DefaultMemoryLimit,
+			maxOpenRuns: DefaultMaxOpenRuns,
+		},
+	}
+	s.ctx, s.done = context.WithCancel(ctx)
+
+	for _, opt := range opts {
+		if err := opt(&s.opts); err != nil {
+			s.err = err
+			break
+		}
+	}
+
+	return s
+}
+
+// Scan advances the scanner to the next object in sorted order.
+// The first call reads and sorts the whole input.
+func (s *Scanner) Scan() bool {
+	if s.err != nil || s.ctx.Err() != nil {
+		return false
+	}
+
+	if !s.started {
+		s.started = true
+		if s.err = s.sortInput(); s.err != nil {
+			return false
+		}
+	}
+
+	i, err := s.heap.next()
+	if err != nil {
+		s.err = err
+		return false
+	}
+
+	s.next = i.object
+	return true
+}
+
+// sortInput reads the input into sorted runs, writing
+// the runs to temp files if over the memory limit.
+func (s *Scanner) sortInput() error {
+	var (
+		items []item
+		size  int64
+		count int
+	)
+
+	for s.input.Scan() {
+		count++
+		if count%10000 == 0 && s.ctx.Err() != nil {
+			return s.ctx.Err()
+		}
+
+		o := s.input.Object()
+		items = append(items, item{key: keyOf(o), object: o})
+
+		size += estimateSize(o)
+		if size >= s.opts.memoryLimit {
+			if err := s.writeRun(items); err != nil {
+				return err
+			}
+
+			items = nil
+			size = 0
+		}
+	}
+
+	if err := s.input.Err(); err != nil {
+		return err
+	}
+
+	for len(s.runs) > s.opts.maxOpenRuns {
+		if err := s.mergePass(); err != nil {
+			return err
+		}
+	}
+
+	var runs []run
+	for _, r := range s.runs {
+		if err := r.open(); err != nil {
+			return err
+		}
+		runs = append(runs, r)
+	}
+
+	// the last run is kept in memory
+	sortItems(items)
+	runs = append(runs, &memoryRun{items: items})
+
+	return s.heap.init(runs)
+}
+
+// mergePass merges the file runs in groups of max open runs. The groups
+// are consecutive runs so the merged runs stay in input order.
+func (s *Scanner) mergePass() error {
+	runs := s.runs
+
+	var merged []*fileRun
+	for start := 0; start < len(runs); start += s.opts.maxOpenRuns {
+		end := start + s.opts.maxOpenRuns
+		if end > len(runs) {
+			end = len(runs)
+		}
+
+		group := runs[start:end]
+		if len(group) == 1 {
+			merged = append(merged, group[0])
+			continue
+		}
+
+		r, err := s.merge(group)
+		if err != nil {
+			// keep track of all the files so they are removed on close
+			s.runs = append(merged, runs[start:]...)
+			return err
+		}
+		merged = append(merged, r)
+
+		for i, g := range group {
+			if err := g.remove(); err != nil {
+				s.runs = append(merged, runs[start+i+1:]...)
+				return err
+			}
+		}
+	}
+
+	s.runs = merged
+	return nil
+}
+
+// merge merges the runs into a new file run.
+func (s *Scanner) merge(runs []*fileRun) (*fileRun, error) {
+	defer func() {
+		for _, r := range runs {
+			r.close()
+		}
+	}()
+
+	h := &runHeap{}
+	rs := make([]run, 0, len(runs))
+	for _, r := range runs {
+		if err := r.open(); err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+
+	if err := h.init(rs); err != nil {
+		return nil, err
+	}
+
+	return s.createRun(func(encoder *gob.Encoder) error {
+		for count := 1; ; count++ {
+			if count%10000 == 0 && s.ctx.Err() != nil {
+				return s.ctx.Err()
+			}
+
+			i, err := h.next()
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			if err := encoder.Encode(newRecord(i.object)); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+func (s *Scanner) writeRun(items []item) error {
+	sortItems(items)
+
+	r, err := s.createRun(func(encoder *gob.Encoder) error {
+		for _, i := range items {
+			if err := encoder.Encode(newRecord(i.object)); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.runs = append(s.runs, r)
+	return nil
+}
+
+// createRun writes a temp file using the function and returns it as a
+// closed file run. The file is removed if there is an error.
+func (s *Scanner) createRun(write func(*gob.Encoder) error) (*fileRun, error) {
+	f, err := ioutil.TempFile(s.opts.tempDir, "osmsort-*.gob")
+	if err != nil {
+		return nil, err
+	}
+
+	w := bufio.NewWriter(f)
+	err = write(gob.NewEncoder(w))
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return nil, err
+	}
+
+	return &fileRun{name: f.Name()}, nil
+}
+
+func sortItems(items []item) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].key.less(items[j].key)
+	})
+}
+
+// estimateSize returns the approximate memory used by the object.
+func estimateSize(o osm.Object) int64 {
+	const (
+		objectSize = 200
+		tagSize    = 32
+		nodeSize   = 40
+		memberSize = 110
+	)
+
+	tags := func(ts osm.Tags) int64 {
+		size := int64(len(ts)) * tagSize
+		for _, t := range ts {
+			size += int64(len(t.Key) + len(t.Value))
+		}
+
+		return size
+	}
+
+	switch o := o.(type) {
+	case *osm.Node:
+		return objectSize + int64(len(o.User)) + tags(o.Tags)
+	case *osm.Way:
+		return objectSize + int64(len(o.User)) + tags(o.Tags) +
+			int64(len(o.Nodes))*nodeSize
+	case *osm.Relation:
+		size := objectSize + int64(len(o.User)) + tags(o.Tags)
+		for _, m := range o.Members {
+			size += memberSize + int64(len(m.Role)) + int64(len(m.Nodes))*nodeSize
+		}
+
+		return size
+	case *osm.Changeset:
+		return objectSize + int64(len(o.User)) + tags(o.Tags)
+	}
+
+	return objectSize
+}
+
+// Object returns the current object in sorted order.
+func (s *Scanner) Object() osm.Object {
+	return s.next
+}
+
+// Err returns the first non-EOF error from sorting or the input scanner.
+func (s *Scanner) Err() error {
+	if s.err == io.EOF {
+		return nil
+	}
+
+	if s.err != nil {
+		return s.err
+	}
+
+	if s.closed {
+		return osm.ErrScannerClosed
+	}
+
+	return s.ctx.Err()
+}
+
+// Close closes the input scanner and removes any temp files.
+func (s *Scanner) Close() error {
+	s.closed = true
+	s.done()
+
+	err := s.input.Close()
+	for _, r := range s.runs {
+		if rerr := r.remove(); err == nil {
+			err = rerr
+		}
+	}
+	s.runs = nil
+
+	return err
+}
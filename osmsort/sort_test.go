@@ -0,0 +1,231 @@
+package osmsort
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+	"github.com/paulmach/osm/osmxml"
+)
+
+func scanAll(t testing.TB, s osm.Scanner) osm.Objects {
+	t.Helper()
+
+	var result osm.Objects
+	for s.Scan() {
+		result = append(result, s.Object())
+	}
+
+	if err := s.Err(); err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	return result
+}
+
+func randomObjects(n int) osm.Objects {
+	r := rand.New(rand.NewSource(42))
+
+	var result osm.Objects
+	for i := 0; i < n; i++ {
+		id := r.Int63n(int64(n)) - 10
+		version := r.Intn(3) + 1
+		tags := osm.Tags{{Key: "index", Value: string(rune('a' + i%26))}}
+
+		switch r.Intn(3) {
+		case 0:
+			result = append(result, &osm.Node{ID: osm.NodeID(id), Version: version, Lat: 1, Lon: 2, Tags: tags})
+		case 1:
+			result = append(result, &osm.Way{ID: osm.WayID(id), Version: version, Tags: tags,
+				Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}})
+		case 2:
+			result = append(result, &osm.Relation{ID: osm.RelationID(id), Version: version, Tags: tags,
+				Members: osm.Members{{Type: osm.TypeNode, Ref: 1, Role: "stop"}}})
+		}
+	}
+
+	return result
+}
+
+func TestScanner(t *testing.T) {
+	dir := t.TempDir()
+	objects := randomObjects(5000)
+
+	expected := append(osm.Objects(nil), objects...)
+	sort.SliceStable(expected, func(i, j int) bool {
+		return Less(expected[i], expected[j])
+	})
+
+	s := New(context.Background(), osmtest.NewScanner(objects), MemoryLimit(20000), MaxOpenRuns(1000), TempDir(dir))
+	result := scanAll(t, s)
+
+	if len(s.runs) < 10 {
+		t.Errorf("should have written runs to disk: %v", len(s.runs))
+	}
+
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("incorrect sort")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("temp files not removed: %v", len(files))
+	}
+}
+
+func TestScanner_mergePasses(t *testing.T) {
+	dir := t.TempDir()
+
+	// only the order of the ids, the same key appears multiple times
+	// to check the sort stays stable across the merges
+	var objects osm.Objects
+	for i := 0; i < 2000; i++ {
+		objects = append(objects, &osm.Node{ID: osm.NodeID(i % 100), Version: 1, User: fmt.Sprint(i)})
+	}
+
+	expected := append(osm.Objects(nil), objects...)
+	sort.SliceStable(expected, func(i, j int) bool {
+		return Less(expected[i], expected[j])
+	})
+
+	s := New(context.Background(), osmtest.NewScanner(objects), MemoryLimit(5000), MaxOpenRuns(3), TempDir(dir))
+	if !s.Scan() {
+		t.Fatalf("should scan: %v", s.Err())
+	}
+
+	if len(s.runs) > 3 {
+		t.Errorf("too many runs: %v", len(s.runs))
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != len(s.runs) || len(files) < 2 {
+		t.Errorf("merged runs should be removed: %v != %v", len(files), len(s.runs))
+	}
+
+	result := append(osm.Objects{s.Object()}, scanAll(t, s)...)
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("incorrect sort")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("close error: %v", err)
+	}
+
+	files, _ = ioutil.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("temp files not removed: %v", len(files))
+	}
+}
+
+func TestScanner_order(t *testing.T) {
+	objects := osm.Objects{
+		&osm.Relation{ID: 1, Version: 1},
+		&osm.Way{ID: 2, Version: 1},
+		&osm.Node{ID: 2, Version: 2, Tags: osm.Tags{{Key: "first", Value: "yes"}}},
+		&osm.Node{ID: -1, Version: 1},
+		&osm.Node{ID: 2, Version: 1},
+		&osm.Bounds{MinLat: 1},
+		&osm.Way{ID: 1, Version: 3},
+		&osm.Node{ID: 2, Version: 2, Tags: osm.Tags{{Key: "second", Value: "yes"}}},
+	}
+
+	for _, limit := range []int64{DefaultMemoryLimit, 1} {
+		s := New(context.Background(), osmtest.NewScanner(objects), MemoryLimit(limit))
+		result := scanAll(t, s)
+		s.Close()
+
+		expected := osm.Objects{objects[5], objects[3], objects[4], objects[2], objects[7], objects[6], objects[1], objects[0]}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("limit %d: incorrect order: %v", limit, result)
+		}
+	}
+}
+
+func TestScanner_spillData(t *testing.T) {
+	f, err := os.Open("../testdata/changeset_38162206.osc")
+	if err != nil {
+		t.Fatalf("could not open file: %v", err)
+	}
+	defer f.Close()
+
+	input := scanAll(t, osmxml.New(context.Background(), f))
+
+	memory := New(context.Background(), osmtest.NewScanner(input))
+	expected := scanAll(t, memory)
+	memory.Close()
+
+	disk := New(context.Background(), osmtest.NewScanner(input), MemoryLimit(1))
+	result := scanAll(t, disk)
+	disk.Close()
+
+	if len(result) != len(expected) {
+		t.Fatalf("incorrect number of objects: %v != %v", len(result), len(expected))
+	}
+
+	for i := range expected {
+		if !reflect.DeepEqual(result[i], expected[i]) {
+			t.Errorf("object %d not equal", i)
+			t.Logf("%+v", result[i])
+			t.Logf("%+v", expected[i])
+			return
+		}
+	}
+}
+
+func TestScanner_inputError(t *testing.T) {
+	input := osmtest.NewScanner(randomObjects(10))
+	input.ScanError = errors.New("some error")
+
+	s := New(context.Background(), input)
+	defer s.Close()
+
+	if s.Scan() {
+		t.Errorf("should not scan")
+	}
+
+	if s.Err() != input.ScanError {
+		t.Errorf("incorrect error: %v", s.Err())
+	}
+}
+
+func TestScanner_optionError(t *testing.T) {
+	for _, opt := range []Option{MemoryLimit(0), MaxOpenRuns(1)} {
+		s := New(context.Background(), osmtest.NewScanner(nil), opt)
+		if s.Scan() {
+			t.Errorf("should not scan")
+		}
+
+		if s.Err() == nil {
+			t.Errorf("should return error")
+		}
+		s.Close()
+	}
+}
+
+func TestScanner_Close(t *testing.T) {
+	s := New(context.Background(), osmtest.NewScanner(randomObjects(10)))
+	if !s.Scan() {
+		t.Fatalf("should scan: %v", s.Err())
+	}
+
+	s.Close()
+	if s.Scan() {
+		t.Errorf("should not scan after close")
+	}
+
+	if s.Err() != osm.ErrScannerClosed {
+		t.Errorf("incorrect error: %v", s.Err())
+	}
+}
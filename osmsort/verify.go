@@ -0,0 +1,117 @@
+package osmsort
+
+import (
+	"context"
+	"io"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"github.com/paulmach/osm/osmscan"
+)
+
+// SortTypeThenID is the optional pbf header feature
+// of data sorted by type and then id.
+const SortTypeThenID = "Sort.Type_then_ID"
+
+// ClaimsSorted returns true if the pbf header has the
+// Sort.Type_then_ID optional feature.
+func ClaimsSorted(h *osmpbf.Header) bool {
+	if h == nil {
+		return false
+	}
+
+	for _, f := range h.OptionalFeatures {
+		if f == SortTypeThenID {
+			return true
+		}
+	}
+
+	return false
+}
+
+type verifier struct {
+	scanner osm.Scanner
+	started bool
+	prev    key
+	prevID  osm.ObjectID
+
+	err error
+}
+
+// NewVerifier returns a scanner that passes through the objects
+// and stops with an *osmscan.UnsortedError if they are not
+// sorted by type, id and then version.
+func NewVerifier(s osm.Scanner) osm.Scanner {
+	return &verifier{scanner: s}
+}
+
+// Scan advances to the next object if it is in order.
+func (v *verifier) Scan() bool {
+	if v.err != nil || !v.scanner.Scan() {
+		return false
+	}
+
+	o := v.scanner.Object()
+	k := keyOf(o)
+	if v.started && k.less(v.prev) {
+		v.err = &osmscan.UnsortedError{
+			Previous: v.prevID,
+			Current:  o.ObjectID(),
+		}
+		return false
+	}
+
+	v.started = true
+	v.prev = k
+	v.prevID = o.ObjectID()
+	return true
+}
+
+// Object returns the current object.
+func (v *verifier) Object() osm.Object {
+	return v.scanner.Object()
+}
+
+// Err returns the error of the underlying scanner or an *osmscan.UnsortedError.
+func (v *verifier) Err() error {
+	if v.err != nil {
+		return v.err
+	}
+
+	return v.scanner.Err()
+}
+
+// Close closes the underlying scanner.
+func (v *verifier) Close() error {
+	return v.scanner.Close()
+}
+
+// Verify reads all the objects of the scanner and returns an
+// *osmscan.UnsortedError if they are not sorted by type, id and then version.
+// The scanner is not closed.
+func Verify(s osm.Scanner) error {
+	v := NewVerifier(s)
+	for v.Scan() {
+	}
+
+	return v.Err()
+}
+
+// VerifyPBF reads the pbf data and returns if the header claims the data is
+// sorted. If it does, the claim is validated by reading all the objects and
+// an *osmscan.UnsortedError is returned if they are not sorted.
+func VerifyPBF(ctx context.Context, r io.Reader, procs int) (bool, error) {
+	scanner := osmpbf.New(ctx, r, procs)
+	defer scanner.Close()
+
+	header, err := scanner.Header()
+	if err != nil {
+		return false, err
+	}
+
+	if !ClaimsSorted(header) {
+		return false, nil
+	}
+
+	return true, Verify(scanner)
+}
@@ -0,0 +1,116 @@
+package osmsort
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmpbf"
+	"github.com/paulmach/osm/osmscan"
+	"github.com/paulmach/osm/osmtest"
+)
+
+func TestVerify(t *testing.T) {
+	sorted := osm.Objects{
+		&osm.Bounds{},
+		&osm.Node{ID: -2},
+		&osm.Node{ID: 1, Version: 1},
+		&osm.Node{ID: 1, Version: 2},
+		&osm.Node{ID: 3},
+		&osm.Way{ID: 1},
+		&osm.Relation{ID: 1},
+	}
+
+	if err := Verify(osmtest.NewScanner(sorted)); err != nil {
+		t.Errorf("should be sorted: %v", err)
+	}
+
+	unsorted := osm.Objects{
+		&osm.Node{ID: 1},
+		&osm.Way{ID: 1},
+		&osm.Node{ID: 2},
+	}
+
+	err := Verify(osmtest.NewScanner(unsorted))
+	if _, ok := err.(*osmscan.UnsortedError); !ok {
+		t.Fatalf("incorrect error: %v", err)
+	}
+
+	expected := &osmscan.UnsortedError{
+		Previous: osm.WayID(1).ObjectID(0),
+		Current:  osm.NodeID(2).ObjectID(0),
+	}
+	if *err.(*osmscan.UnsortedError) != *expected {
+		t.Errorf("incorrect error: %v", err)
+	}
+
+	// versions must be increasing
+	err = Verify(osmtest.NewScanner(osm.Objects{
+		&osm.Node{ID: 1, Version: 2},
+		&osm.Node{ID: 1, Version: 1},
+	}))
+	if err == nil {
+		t.Errorf("should return error")
+	}
+}
+
+func TestVerify_sortedOutput(t *testing.T) {
+	s := New(context.Background(), osmtest.NewScanner(randomObjects(1000)), MemoryLimit(5000))
+	defer s.Close()
+
+	if err := Verify(s); err != nil {
+		t.Errorf("should be sorted: %v", err)
+	}
+}
+
+func TestVerifyPBF(t *testing.T) {
+	cases := []struct {
+		name     string
+		features []string
+		claimed  bool
+	}{
+		{
+			name:     "claimed",
+			features: []string{"Has_Metadata", SortTypeThenID},
+			claimed:  true,
+		},
+		{
+			name:     "not claimed",
+			features: []string{"Has_Metadata"},
+			claimed:  false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			header := &osmpbf.Header{
+				RequiredFeatures: []string{"OsmSchema-V0.6"},
+				OptionalFeatures: tc.features,
+			}
+
+			if v := ClaimsSorted(header); v != tc.claimed {
+				t.Errorf("incorrect claim: %v", v)
+			}
+
+			block, err := osmpbf.NewHeaderBlock(header)
+			if err != nil {
+				t.Fatalf("header block error: %v", err)
+			}
+
+			buf := &bytes.Buffer{}
+			if err := osmpbf.NewBlockWriter(buf).Write(block); err != nil {
+				t.Fatalf("write error: %v", err)
+			}
+
+			claimed, err := VerifyPBF(context.Background(), buf, 1)
+			if err != nil {
+				t.Fatalf("verify error: %v", err)
+			}
+
+			if claimed != tc.claimed {
+				t.Errorf("incorrect claim: %v", claimed)
+			}
+		})
+	}
+}
@@ -0,0 +1,372 @@
+// Package osmspatial provides a packed R-tree spatial index over osm
+// elements. It supports bounding box, k-nearest and point in area queries
+// and is bulk loaded, using sort-tile-recursive packing, from osm data or
+// a scanner.
+package osmspatial
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+)
+
+// Index is a read only spatial index of osm elements.
+type Index struct {
+	store    LocationStore
+	filter   func(osm.Element) bool
+	nodeSize int
+
+	items []item
+
+	// levels[0] are the leaves, the last level is the root.
+	levels [][]node
+}
+
+type item struct {
+	element  osm.Element
+	geometry orb.Geometry
+	bound    orb.Bound
+}
+
+type node struct {
+	bound orb.Bound
+
+	// start and end are the range of children in the level below,
+	// or of the items for the leaves.
+	start, end int
+}
+
+// New creates an index of the elements in the osm data. Way geometry is
+// built from the annotated way nodes or the nodes in the data, closed ways
+// that are areas, see osm.Way.Polygon(), are polygons. Multipolygon relations
+// are assembled from their member ways. Other relations are the collection
+// of their member ways or, if they have none, their member nodes.
+func New(o *osm.OSM, opts ...Option) (*Index, error) {
+	idx, err := newIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	b := newBuilder(idx)
+	for _, n := range o.Nodes {
+		if err := b.add(ctx, n); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, w := range o.Ways {
+		if err := b.add(ctx, w); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, r := range o.Relations {
+		if err := b.add(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+
+	idx.pack()
+	return idx, nil
+}
+
+// Build creates an index of the elements from the scanner. The scanner
+// is expected to be in the usual nodes, ways then relations order. The
+// locations of the nodes, and the way nodes for relations, are kept in
+// memory while building. Use the Store option to provide the node
+// locations instead. The scanner is not closed.
+func Build(ctx context.Context, s osm.Scanner, opts ...Option) (*Index, error) {
+	idx, err := newIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	b := newBuilder(idx)
+	for s.Scan() {
+		if err := b.add(ctx, s.Object()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	idx.pack()
+	return idx, nil
+}
+
+// An Entry is an element with its geometry.
+type Entry struct {
+	Element  osm.Element
+	Geometry orb.Geometry
+}
+
+// FromEntries creates an index of elements with known geometry, for
+// example areas loaded from a file. Entries with nil geometry are skipped.
+func FromEntries(entries []Entry, opts ...Option) (*Index, error) {
+	idx, err := newIndex(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	b := newBuilder(idx)
+	for _, e := range entries {
+		if e.Geometry != nil {
+			b.insert(e.Element, e.Geometry)
+		}
+	}
+
+	idx.pack()
+	return idx, nil
+}
+
+func newIndex(opts []Option) (*Index, error) {
+	idx := &Index{nodeSize: 16}
+	for _, opt := range opts {
+		if err := opt(idx); err != nil {
+			return nil, err
+		}
+	}
+
+	return idx, nil
+}
+
+// Len returns the number of indexed elements.
+func (idx *Index) Len() int {
+	return len(idx.items)
+}
+
+type builder struct {
+	idx       *Index
+	locations map[osm.NodeID]orb.Point
+	ways      map[osm.WayID]osm.WayNodes
+}
+
+func newBuilder(idx *Index) *builder {
+	b := &builder{
+		idx:  idx,
+		ways: make(map[osm.WayID]osm.WayNodes),
+	}
+
+	if idx.store == nil {
+		b.locations = make(map[osm.NodeID]orb.Point)
+	}
+
+	return b
+}
+
+func (b *builder) add(ctx context.Context, o osm.Object) error {
+	switch e := o.(type) {
+	case *osm.Node:
+		if b.locations != nil {
+			b.locations[e.ID] = e.Point()
+		}
+
+		b.insert(e, e.Point())
+	case *osm.Way:
+		nodes, err := b.wayNodes(ctx, e.Nodes)
+		if err != nil {
+			return err
+		}
+
+		// kept for the geometry of relations
+		b.ways[e.ID] = nodes
+		if len(nodes) == 0 {
+			return nil
+		}
+
+		w := *e
+		w.Nodes = nodes
+		b.insert(e, w.Geometry())
+	case *osm.Relation:
+		g, err := b.relationGeometry(ctx, e)
+		if err != nil {
+			return err
+		}
+
+		if g != nil {
+			b.insert(e, g)
+		}
+	}
+
+	return nil
+}
+
+func (b *builder) insert(e osm.Element, g orb.Geometry) {
+	if b.idx.filter != nil && !b.idx.filter(e) {
+		return
+	}
+
+	b.idx.items = append(b.idx.items, item{
+		element:  e,
+		geometry: g,
+		bound:    g.Bound(),
+	})
+}
+
+// wayNodes returns a copy of the way nodes with their location.
+// Nodes without a location are removed.
+func (b *builder) wayNodes(ctx context.Context, wn osm.WayNodes) (osm.WayNodes, error) {
+	nodes := make(osm.WayNodes, 0, len(wn))
+	for _, n := range wn {
+		if n.Lat == 0 && n.Lon == 0 {
+			p, ok, err := b.location(ctx, n.ID)
+			if err != nil {
+				return nil, err
+			}
+
+			if !ok {
+				continue
+			}
+
+			n.Lon, n.Lat = p[0], p[1]
+		}
+
+		nodes = append(nodes, n)
+	}
+
+	return nodes, nil
+}
+
+func (b *builder) location(ctx context.Context, id osm.NodeID) (orb.Point, bool, error) {
+	if b.locations != nil {
+		p, ok := b.locations[id]
+		return p, ok, nil
+	}
+
+	p, err := b.idx.store.NodeLocation(ctx, id)
+	if b.idx.store.NotFound(err) {
+		return orb.Point{}, false, nil
+	}
+
+	if err != nil {
+		return orb.Point{}, false, err
+	}
+
+	return p, true, nil
+}
+
+func (b *builder) relationGeometry(ctx context.Context, r *osm.Relation) (orb.Geometry, error) {
+	relation := *r
+	relation.Members = make(osm.Members, len(r.Members))
+	copy(relation.Members, r.Members)
+
+	var points orb.MultiPoint
+	for i, m := range relation.Members {
+		switch m.Type {
+		case osm.TypeWay:
+			if len(m.Nodes) == 0 {
+				relation.Members[i].Nodes = b.ways[osm.WayID(m.Ref)]
+			}
+		case osm.TypeNode:
+			if m.Lat != 0 || m.Lon != 0 {
+				points = append(points, m.Point())
+				continue
+			}
+
+			p, ok, err := b.location(ctx, osm.NodeID(m.Ref))
+			if err != nil {
+				return nil, err
+			}
+
+			if ok {
+				points = append(points, p)
+			}
+		}
+	}
+
+	if g := relation.Geometry(); g != nil {
+		return g, nil
+	}
+
+	if len(points) != 0 {
+		return points, nil
+	}
+
+	return nil, nil
+}
+
+// pack bulk loads the tree. Each level is sorted into vertical slices
+// by x and then by y within each slice before grouping into the level above.
+func (idx *Index) pack() {
+	if len(idx.items) == 0 {
+		return
+	}
+
+	items := make([]item, len(idx.items))
+	for i, j := range strOrder(len(idx.items), idx.nodeSize, func(i int) orb.Bound { return idx.items[i].bound }) {
+		items[i] = idx.items[j]
+	}
+	idx.items = items
+
+	level := group(len(items), idx.nodeSize, func(i int) orb.Bound { return items[i].bound })
+	for {
+		if len(level) == 1 {
+			idx.levels = append(idx.levels, level)
+			return
+		}
+
+		sorted := make([]node, len(level))
+		for i, j := range strOrder(len(level), idx.nodeSize, func(i int) orb.Bound { return level[i].bound }) {
+			sorted[i] = level[j]
+		}
+
+		idx.levels = append(idx.levels, sorted)
+		level = group(len(sorted), idx.nodeSize, func(i int) orb.Bound { return sorted[i].bound })
+	}
+}
+
+// strOrder returns the sort-tile-recursive order of the bounds.
+func strOrder(n, nodeSize int, bound func(int) orb.Bound) []int {
+	order := make([]int, n)
+	centers := make([]orb.Point, n)
+	for i := range order {
+		order[i] = i
+		centers[i] = bound(i).Center()
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		return centers[order[i]][0] < centers[order[j]][0]
+	})
+
+	nodes := math.Ceil(float64(n) / float64(nodeSize))
+	sliceSize := int(math.Ceil(math.Sqrt(nodes))) * nodeSize
+	for i := 0; i < n; i += sliceSize {
+		end := i + sliceSize
+		if end > n {
+			end = n
+		}
+
+		slice := order[i:end]
+		sort.Slice(slice, func(i, j int) bool {
+			return centers[slice[i]][1] < centers[slice[j]][1]
+		})
+	}
+
+	return order
+}
+
+// group groups consecutive children into nodes.
+func group(n, nodeSize int, bound func(int) orb.Bound) []node {
+	nodes := make([]node, 0, (n+nodeSize-1)/nodeSize)
+	for i := 0; i < n; i += nodeSize {
+		end := i + nodeSize
+		if end > n {
+			end = n
+		}
+
+		b := bound(i)
+		for j := i + 1; j < end; j++ {
+			b = b.Union(bound(j))
+		}
+
+		nodes = append(nodes, node{bound: b, start: i, end: end})
+	}
+
+	return nodes
+}
@@ -0,0 +1,292 @@
+package osmspatial
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+)
+
+// grid of 50x50 nodes, 0.001 degrees apart.
+func gridData() *osm.OSM {
+	o := &osm.OSM{}
+	for x := 0; x < 50; x++ {
+		for y := 0; y < 50; y++ {
+			o.Nodes = append(o.Nodes, &osm.Node{
+				ID:  osm.NodeID(x*50 + y + 1),
+				Lon: 1 + float64(x)*0.001,
+				Lat: 1 + float64(y)*0.001,
+			})
+		}
+	}
+
+	return o
+}
+
+func testData() *osm.OSM {
+	return &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Lon: 1, Lat: 1},
+			{ID: 2, Lon: 2, Lat: 1},
+			{ID: 3, Lon: 2, Lat: 2},
+			{ID: 4, Lon: 1, Lat: 2},
+			{ID: 5, Lon: 5, Lat: 5, Tags: osm.Tags{{Key: "amenity", Value: "cafe"}}},
+			{ID: 6, Lon: 1.2, Lat: 1.2},
+			{ID: 7, Lon: 1.4, Lat: 1.2},
+			{ID: 8, Lon: 1.4, Lat: 1.4},
+			{ID: 9, Lon: 1.2, Lat: 1.4},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 1}},
+				Tags: osm.Tags{{Key: "landuse", Value: "forest"}}},
+			{ID: 2, Nodes: osm.WayNodes{{ID: 2}, {ID: 5}},
+				Tags: osm.Tags{{Key: "highway", Value: "primary"}}},
+			{ID: 3, Nodes: osm.WayNodes{{ID: 6}, {ID: 7}, {ID: 8}, {ID: 9}, {ID: 6}}},
+		},
+		Relations: osm.Relations{
+			{ID: 1, Tags: osm.Tags{{Key: "type", Value: "multipolygon"}, {Key: "building", Value: "yes"}},
+				Members: osm.Members{
+					{Type: osm.TypeWay, Ref: 1, Role: "outer"},
+					{Type: osm.TypeWay, Ref: 3, Role: "inner"},
+				}},
+			{ID: 2, Tags: osm.Tags{{Key: "type", Value: "site"}},
+				Members: osm.Members{{Type: osm.TypeNode, Ref: 5}}},
+		},
+	}
+}
+
+func featureIDs(elements []osm.Element) []string {
+	var ids []string
+	for _, e := range elements {
+		ids = append(ids, e.FeatureID().String())
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+func TestIndex_Query(t *testing.T) {
+	o := gridData()
+	idx, err := New(o, NodeSize(4))
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	if idx.Len() != len(o.Nodes) || len(idx.levels) < 3 {
+		t.Fatalf("incorrect index: %v items, %v levels", idx.Len(), len(idx.levels))
+	}
+
+	bounds := []orb.Bound{
+		{Min: orb.Point{1.0105, 1.0105}, Max: orb.Point{1.0205, 1.0305}},
+		{Min: orb.Point{0, 0}, Max: orb.Point{1.0005, 1.0005}},
+		{Min: orb.Point{5, 5}, Max: orb.Point{6, 6}},
+		{Min: orb.Point{0, 0}, Max: orb.Point{2, 2}},
+	}
+
+	for _, b := range bounds {
+		var expected []osm.Element
+		for _, n := range o.Nodes {
+			if b.Contains(n.Point()) {
+				expected = append(expected, n)
+			}
+		}
+
+		result := idx.Query(b)
+		if !reflect.DeepEqual(featureIDs(result), featureIDs(expected)) {
+			t.Errorf("incorrect result for %v: %d != %d", b, len(result), len(expected))
+		}
+	}
+}
+
+func TestIndex_Nearest(t *testing.T) {
+	o := gridData()
+	idx, err := New(o, NodeSize(4))
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	p := orb.Point{1.0102, 1.0204}
+	matches := idx.Nearest(p, 5)
+	if len(matches) != 5 {
+		t.Fatalf("incorrect number of matches: %v", len(matches))
+	}
+
+	distances := make([]float64, 0, len(o.Nodes))
+	for _, n := range o.Nodes {
+		distances = append(distances, geo.Distance(p, n.Point()))
+	}
+	sort.Float64s(distances)
+
+	for i, m := range matches {
+		if math.Abs(m.Distance-distances[i]) > 1e-6 {
+			t.Errorf("%d: incorrect distance: %v != %v", i, m.Distance, distances[i])
+		}
+	}
+
+	if id := matches[0].Element.FeatureID(); id != osm.NodeID(10*50+20+1).FeatureID() {
+		t.Errorf("incorrect nearest: %v", id)
+	}
+
+	if m := idx.Nearest(p, len(o.Nodes)+10); len(m) != len(o.Nodes) {
+		t.Errorf("should return all elements: %v", len(m))
+	}
+}
+
+func TestIndex_elements(t *testing.T) {
+	idx, err := New(testData())
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	t.Run("snap to way", func(t *testing.T) {
+		filtered, err := New(testData(), Filter(func(e osm.Element) bool {
+			w, ok := e.(*osm.Way)
+			return ok && w.Tags.HasTag("highway")
+		}))
+		if err != nil {
+			t.Fatalf("new error: %v", err)
+		}
+
+		m := filtered.Nearest(orb.Point{3, 2}, 1)
+		if len(m) != 1 || m[0].Element.FeatureID() != osm.WayID(2).FeatureID() {
+			t.Fatalf("incorrect match: %v", m)
+		}
+
+		// the way is from 2,1 to 5,5
+		if p := m[0].Point; math.Abs(1+(p[0]-2)*4/3-p[1]) > 1e-9 {
+			t.Errorf("point should be on the way: %v", p)
+		}
+	})
+
+	t.Run("containing", func(t *testing.T) {
+		ids := featureIDs(idx.Containing(orb.Point{1.1, 1.1}))
+		if !reflect.DeepEqual(ids, []string{"relation/1", "way/1"}) {
+			t.Errorf("incorrect areas: %v", ids)
+		}
+
+		// in the hole, way 3 is not an area
+		ids = featureIDs(idx.Containing(orb.Point{1.3, 1.3}))
+		if !reflect.DeepEqual(ids, []string{"way/1"}) {
+			t.Errorf("incorrect areas: %v", ids)
+		}
+	})
+
+	t.Run("inside area is zero distance", func(t *testing.T) {
+		for _, m := range idx.Nearest(orb.Point{1.1, 1.1}, 2) {
+			if m.Distance != 0 {
+				t.Errorf("incorrect distance: %v", m.Distance)
+			}
+		}
+	})
+
+	t.Run("relation of nodes", func(t *testing.T) {
+		ids := featureIDs(idx.Query(orb.Bound{Min: orb.Point{4.9, 4.9}, Max: orb.Point{5.1, 5.1}}))
+		if !reflect.DeepEqual(ids, []string{"node/5", "relation/2", "way/2"}) {
+			t.Errorf("incorrect result: %v", ids)
+		}
+	})
+}
+
+type testStore map[osm.NodeID]orb.Point
+
+var errNotFound = errors.New("not found")
+
+func (s testStore) NodeLocation(ctx context.Context, id osm.NodeID) (orb.Point, error) {
+	p, ok := s[id]
+	if !ok {
+		return orb.Point{}, errNotFound
+	}
+
+	return p, nil
+}
+
+func (s testStore) NotFound(err error) bool {
+	return err == errNotFound
+}
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+	o := testData()
+
+	idx, err := Build(ctx, osmtest.NewScanner(o.Objects()))
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+
+	if idx.Len() != 14 {
+		t.Errorf("incorrect number of elements: %v", idx.Len())
+	}
+
+	// ways only, the locations come from the store
+	store := testStore{}
+	for _, n := range o.Nodes {
+		store[n.ID] = n.Point()
+	}
+	delete(store, 5)
+
+	idx, err = Build(ctx, osmtest.NewScanner((&osm.OSM{Ways: o.Ways}).Objects()), Store(store))
+	if err != nil {
+		t.Fatalf("build error: %v", err)
+	}
+
+	// way 2 only has one node location
+	ids := featureIDs(idx.Query(orb.Bound{Min: orb.Point{1.9, 0.9}, Max: orb.Point{2.1, 1.1}}))
+	if !reflect.DeepEqual(ids, []string{"way/1", "way/2"}) {
+		t.Errorf("incorrect result: %v", ids)
+	}
+
+	// scanner errors are returned
+	scanner := osmtest.NewScanner(nil)
+	scanner.ScanError = errors.New("scan error")
+	if _, err := Build(ctx, scanner); err != scanner.ScanError {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
+
+func TestIndex_empty(t *testing.T) {
+	idx, err := New(&osm.OSM{})
+	if err != nil {
+		t.Fatalf("new error: %v", err)
+	}
+
+	if r := idx.Query(orb.Bound{Max: orb.Point{1, 1}}); len(r) != 0 {
+		t.Errorf("should be empty: %v", r)
+	}
+
+	if r := idx.Nearest(orb.Point{}, 1); len(r) != 0 {
+		t.Errorf("should be empty: %v", r)
+	}
+
+	if _, err := New(&osm.OSM{}, NodeSize(1)); err == nil {
+		t.Errorf("should return error for invalid node size")
+	}
+}
+
+func TestFromEntries(t *testing.T) {
+	entries := []Entry{
+		{Element: &osm.Relation{ID: 1}, Geometry: orb.Bound{Max: orb.Point{2, 2}}.ToPolygon()},
+		{Element: &osm.Relation{ID: 2}, Geometry: orb.Bound{Max: orb.Point{1, 1}}.ToPolygon()},
+		{Element: &osm.Relation{ID: 3}},
+	}
+
+	idx, err := FromEntries(entries)
+	if err != nil {
+		t.Fatalf("from entries error: %v", err)
+	}
+
+	if idx.Len() != 2 {
+		t.Errorf("should skip nil geometry: %v", idx.Len())
+	}
+
+	ids := featureIDs(idx.Containing(orb.Point{1.5, 1.5}))
+	if !reflect.DeepEqual(ids, []string{"relation/1"}) {
+		t.Errorf("incorrect result: %v", ids)
+	}
+}
@@ -0,0 +1,45 @@
+package osmspatial
+
+import (
+	"errors"
+
+	"github.com/paulmach/osm"
+)
+
+// Option is a parameter that can be used when building an index.
+type Option func(*Index) error
+
+// Store sets the location store used for the nodes of ways that are
+// not annotated. By default the locations of the nodes in the data are
+// kept in memory while building. With a store they are not kept.
+func Store(s LocationStore) Option {
+	return func(idx *Index) error {
+		idx.store = s
+		return nil
+	}
+}
+
+// Filter sets the function used to decide which elements are indexed,
+// for example only ways with a highway tag for snapping. All the node
+// locations are used to build the geometry of the ways, even if the
+// nodes are not indexed. By default all nodes, ways and relations are
+// indexed.
+func Filter(fn func(osm.Element) bool) Option {
+	return func(idx *Index) error {
+		idx.filter = fn
+		return nil
+	}
+}
+
+// NodeSize sets the max number of children of each node of the tree.
+// The default is 16.
+func NodeSize(n int) Option {
+	return func(idx *Index) error {
+		if n < 2 {
+			return errors.New("osmspatial: node size must be at least 2")
+		}
+
+		idx.nodeSize = n
+		return nil
+	}
+}
@@ -0,0 +1,224 @@
+package osmspatial
+
+import (
+	"container/heap"
+	"math"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/orb/planar"
+	"github.com/paulmach/osm"
+)
+
+// A Match is a result of a nearest query.
+type Match struct {
+	Element osm.Element
+
+	// Point is the closest point on the element geometry,
+	// for example to snap a gps point to a way.
+	Point orb.Point
+
+	// Distance is the geodesic distance to the point in meters.
+	Distance float64
+}
+
+// Query returns the elements whose bounds intersect the bound.
+func (idx *Index) Query(b orb.Bound) []osm.Element {
+	var result []osm.Element
+	idx.search(b.Intersects, func(it *item) {
+		result = append(result, it.element)
+	})
+
+	return result
+}
+
+// Containing returns the area elements, polygon ways and multipolygon
+// relations, that contain the point.
+func (idx *Index) Containing(p orb.Point) []osm.Element {
+	var result []osm.Element
+	idx.search(func(b orb.Bound) bool { return b.Contains(p) }, func(it *item) {
+		switch g := it.geometry.(type) {
+		case orb.Polygon:
+			if planar.PolygonContains(g, p) {
+				result = append(result, it.element)
+			}
+		case orb.MultiPolygon:
+			if planar.MultiPolygonContains(g, p) {
+				result = append(result, it.element)
+			}
+		}
+	})
+
+	return result
+}
+
+// search calls fn for the items with bounds that pass the test.
+func (idx *Index) search(test func(orb.Bound) bool, fn func(*item)) {
+	if len(idx.levels) == 0 {
+		return
+	}
+
+	type entry struct {
+		level, index int
+	}
+
+	top := len(idx.levels) - 1
+	stack := []entry{{level: top, index: 0}}
+	for len(stack) != 0 {
+		e := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		n := idx.levels[e.level][e.index]
+		if !test(n.bound) {
+			continue
+		}
+
+		for i := n.start; i < n.end; i++ {
+			if e.level > 0 {
+				stack = append(stack, entry{level: e.level - 1, index: i})
+			} else if test(idx.items[i].bound) {
+				fn(&idx.items[i])
+			}
+		}
+	}
+}
+
+// Nearest returns the k elements closest to the point, ordered by
+// distance. The distance is to the closest point of the geometry and is
+// zero for points inside an area.
+func (idx *Index) Nearest(p orb.Point, k int) []*Match {
+	if len(idx.levels) == 0 || k <= 0 {
+		return nil
+	}
+
+	// distances are computed with the longitude scaled for the latitude
+	// of the point. Good enough for ordering over short distances.
+	scale := math.Cos(p[1] * math.Pi / 180)
+
+	top := len(idx.levels) - 1
+	q := &queue{{level: top, index: 0}}
+
+	var result []*Match
+	for q.Len() != 0 && len(result) < k {
+		c := heap.Pop(q).(candidate)
+		if c.level < 0 {
+			result = append(result, &Match{
+				Element:  idx.items[c.index].element,
+				Point:    c.point,
+				Distance: geo.Distance(p, c.point),
+			})
+			continue
+		}
+
+		n := idx.levels[c.level][c.index]
+		for i := n.start; i < n.end; i++ {
+			if c.level == 0 {
+				point, d := closest(idx.items[i].geometry, p, scale)
+				heap.Push(q, candidate{level: -1, index: i, dist: d, point: point})
+			} else {
+				d := boundDistance(idx.levels[c.level-1][i].bound, p, scale)
+				heap.Push(q, candidate{level: c.level - 1, index: i, dist: d})
+			}
+		}
+	}
+
+	return result
+}
+
+// boundDistance returns the squared scaled distance from the point to the bound.
+func boundDistance(b orb.Bound, p orb.Point, scale float64) float64 {
+	dx := math.Max(0, math.Max(b.Min[0]-p[0], p[0]-b.Max[0])) * scale
+	dy := math.Max(0, math.Max(b.Min[1]-p[1], p[1]-b.Max[1]))
+	return dx*dx + dy*dy
+}
+
+// closest returns the closest point on the geometry and the squared scaled
+// distance to it.
+func closest(g orb.Geometry, p orb.Point, scale float64) (orb.Point, float64) {
+	switch g := g.(type) {
+	case orb.Point:
+		return g, squared(g, p, scale)
+	case orb.MultiPoint:
+		return closestOf(len(g), p, func(i int) (orb.Point, float64) {
+			return g[i], squared(g[i], p, scale)
+		})
+	case orb.LineString:
+		return closestOnLine(g, p, scale)
+	case orb.MultiLineString:
+		return closestOf(len(g), p, func(i int) (orb.Point, float64) {
+			return closestOnLine(g[i], p, scale)
+		})
+	case orb.Polygon:
+		if planar.PolygonContains(g, p) {
+			return p, 0
+		}
+
+		return closestOf(len(g), p, func(i int) (orb.Point, float64) {
+			return closestOnLine(orb.LineString(g[i]), p, scale)
+		})
+	case orb.MultiPolygon:
+		return closestOf(len(g), p, func(i int) (orb.Point, float64) {
+			return closest(g[i], p, scale)
+		})
+	}
+
+	return p, math.Inf(1)
+}
+
+func closestOf(n int, p orb.Point, fn func(int) (orb.Point, float64)) (orb.Point, float64) {
+	point, min := p, math.Inf(1)
+	for i := 0; i < n; i++ {
+		if c, d := fn(i); d < min {
+			point, min = c, d
+		}
+	}
+
+	return point, min
+}
+
+func closestOnLine(ls orb.LineString, p orb.Point, scale float64) (orb.Point, float64) {
+	if len(ls) == 1 {
+		return ls[0], squared(ls[0], p, scale)
+	}
+
+	return closestOf(len(ls)-1, p, func(i int) (orb.Point, float64) {
+		a, b := ls[i], ls[i+1]
+
+		dx, dy := (b[0]-a[0])*scale, b[1]-a[1]
+		t := 0.0
+		if l := dx*dx + dy*dy; l > 0 {
+			t = ((p[0]-a[0])*scale*dx + (p[1]-a[1])*dy) / l
+			t = math.Max(0, math.Min(1, t))
+		}
+
+		c := orb.Point{a[0] + t*(b[0]-a[0]), a[1] + t*(b[1]-a[1])}
+		return c, squared(c, p, scale)
+	})
+}
+
+func squared(a, b orb.Point, scale float64) float64 {
+	dx, dy := (a[0]-b[0])*scale, a[1]-b[1]
+	return dx*dx + dy*dy
+}
+
+// candidate is a node, or an item if level is -1, of a nearest query.
+type candidate struct {
+	level, index int
+	dist         float64
+	point        orb.Point
+}
+
+// queue is a min heap of candidates by distance.
+type queue []candidate
+
+func (q queue) Len() int            { return len(q) }
+func (q queue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q queue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *queue) Push(x interface{}) { *q = append(*q, x.(candidate)) }
+
+func (q *queue) Pop() interface{} {
+	old := *q
+	c := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return c
+}
@@ -0,0 +1,18 @@
+package osmspatial
+
+import (
+	"context"
+
+	"github.com/paulmach/orb"
+	"github.com/paulmach/osm"
+)
+
+// A LocationStore provides the locations of way nodes that are not
+// annotated, for example from an on disk cache of a planet file.
+type LocationStore interface {
+	NodeLocation(context.Context, osm.NodeID) (orb.Point, error)
+
+	// NotFound returns true if the error is a not found error.
+	// Nodes that are not found are skipped.
+	NotFound(error) bool
+}
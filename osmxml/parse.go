@@ -0,0 +1,688 @@
+package osmxml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/paulmach/osm"
+)
+
+// parse returns the object for the raw bytes of an element. Nodes, ways,
+// relations and bounds are parsed directly. The other elements, and anything
+// not supported by the direct parsing, are decoded using encoding/xml
+// so the result is always the same.
+func parse(name string, data []byte) (osm.Object, error) {
+	var p parser
+	p.reset(data)
+
+	switch name {
+	case "bounds":
+		if b, ok := p.bounds(); ok {
+			return b, nil
+		}
+
+		b := &osm.Bounds{}
+		return b, xml.Unmarshal(data, &b)
+	case "node":
+		if n, ok := p.node(); ok {
+			return n, nil
+		}
+
+		n := &osm.Node{}
+		return n, xml.Unmarshal(data, &n)
+	case "way":
+		if w, ok := p.way(); ok {
+			return w, nil
+		}
+
+		w := &osm.Way{}
+		return w, xml.Unmarshal(data, &w)
+	case "relation":
+		if r, ok := p.relation(); ok {
+			return r, nil
+		}
+
+		r := &osm.Relation{}
+		return r, xml.Unmarshal(data, &r)
+	case "changeset":
+		cs := &osm.Changeset{}
+		return cs, xml.Unmarshal(data, &cs)
+	case "note":
+		n := &osm.Note{}
+		return n, xml.Unmarshal(data, &n)
+	case "user":
+		u := &osm.User{}
+		return u, xml.Unmarshal(data, &u)
+	}
+
+	return nil, nil
+}
+
+// parser reads the tags and attributes of a raw element. It returns
+// not ok for anything it does not understand, e.g. unknown entities
+// or child elements, and the element is decoded using encoding/xml.
+type parser struct {
+	data []byte
+	pos  int
+
+	// current tag
+	tag   []byte
+	attrs []byte
+	start bool
+	empty bool
+}
+
+func (p *parser) reset(data []byte) {
+	p.data = data
+	p.pos = 0
+}
+
+// next moves to the next start or end tag, skipping text,
+// comments and cdata. Returns false at the end of the data.
+func (p *parser) next() bool {
+	for {
+		i := bytes.IndexByte(p.data[p.pos:], '<')
+		if i < 0 {
+			return false
+		}
+		p.pos += i
+
+		m := p.data[p.pos:]
+		end := 0
+		switch {
+		case bytes.HasPrefix(m, []byte("<!--")):
+			end = bytes.Index(m, []byte("-->")) + 3
+		case bytes.HasPrefix(m, []byte("<![CDATA[")):
+			end = bytes.Index(m, []byte("]]>")) + 3
+		case bytes.HasPrefix(m, []byte("<?")):
+			end = bytes.Index(m, []byte("?>")) + 2
+		default:
+			end = tagEnd(m)
+		}
+
+		if end <= 2 {
+			return false
+		}
+
+		m = m[:end]
+		p.pos += end
+
+		if markupType(m) == markupOther {
+			continue
+		}
+
+		p.tag = tagName(m)
+		p.start = m[1] != '/'
+		p.empty = selfClosing(m)
+
+		// the attributes are between the name and the closing '>' or '/>'
+		a := 1 + len(p.tag)
+		b := len(m) - 1
+		if p.empty {
+			b--
+		}
+
+		if !p.start || a > b {
+			p.attrs = nil
+		} else {
+			p.attrs = m[a:b]
+		}
+
+		return true
+	}
+}
+
+// tagEnd returns the index after the closing '>' of the tag.
+func tagEnd(m []byte) int {
+	var quote byte
+	for i, c := range m {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return i + 1
+		}
+	}
+
+	return -1
+}
+
+// attr returns the next attribute of the current tag.
+// The value is unescaped, ok is false if that was not possible.
+func (p *parser) attr() (key, value []byte, more, ok bool) {
+	a := bytes.TrimLeft(p.attrs, " \t\r\n")
+	if len(a) == 0 {
+		return nil, nil, false, true
+	}
+
+	eq := bytes.IndexByte(a, '=')
+	if eq <= 0 {
+		return nil, nil, false, false
+	}
+	key = bytes.TrimRight(a[:eq], " \t\r\n")
+
+	a = bytes.TrimLeft(a[eq+1:], " \t\r\n")
+	if len(a) == 0 || (a[0] != '"' && a[0] != '\'') {
+		return nil, nil, false, false
+	}
+
+	end := bytes.IndexByte(a[1:], a[0])
+	if end < 0 {
+		return nil, nil, false, false
+	}
+
+	value, ok = unescape(a[1 : end+1])
+	p.attrs = a[end+2:]
+
+	// namespaced attributes are not supported
+	if bytes.IndexByte(key, ':') >= 0 {
+		ok = false
+	}
+
+	return key, value, true, ok
+}
+
+// unescape replaces the entities and character references. Returns false
+// for values encoding/xml would handle differently, e.g. unknown entities.
+func unescape(v []byte) ([]byte, bool) {
+	// encoding/xml normalizes new lines and errors on '<'
+	if bytes.IndexByte(v, '\r') >= 0 || bytes.IndexByte(v, '<') >= 0 {
+		return nil, false
+	}
+
+	if bytes.IndexByte(v, '&') < 0 {
+		return v, true
+	}
+
+	result := make([]byte, 0, len(v))
+	for len(v) > 0 {
+		i := bytes.IndexByte(v, '&')
+		if i < 0 {
+			result = append(result, v...)
+			break
+		}
+
+		result = append(result, v[:i]...)
+		v = v[i:]
+
+		end := bytes.IndexByte(v, ';')
+		if end < 0 {
+			return nil, false
+		}
+
+		entity := string(v[1:end])
+		v = v[end+1:]
+
+		switch entity {
+		case "amp":
+			result = append(result, '&')
+		case "lt":
+			result = append(result, '<')
+		case "gt":
+			result = append(result, '>')
+		case "quot":
+			result = append(result, '"')
+		case "apos":
+			result = append(result, '\'')
+		default:
+			if len(entity) < 2 || entity[0] != '#' {
+				return nil, false
+			}
+
+			var (
+				n   uint64
+				err error
+			)
+			if entity[1] == 'x' {
+				n, err = strconv.ParseUint(entity[2:], 16, 32)
+			} else {
+				n, err = strconv.ParseUint(entity[1:], 10, 32)
+			}
+
+			if err != nil || !isInCharacterRange(rune(n)) {
+				return nil, false
+			}
+
+			var buf [utf8.UTFMax]byte
+			result = append(result, buf[:utf8.EncodeRune(buf[:], rune(n))]...)
+		}
+	}
+
+	return result, true
+}
+
+// isInCharacterRange checks if the rune is a valid xml character.
+func isInCharacterRange(r rune) bool {
+	return r == 0x09 ||
+		r == 0x0A ||
+		r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
+
+// children calls the function for each direct child element. It returns false
+// if the function does, or if a child element has its own children.
+func (p *parser) children(f func(name []byte) bool) bool {
+	if p.empty {
+		return true
+	}
+
+	for p.next() {
+		if !p.start {
+			// end of the element
+			return true
+		}
+
+		if !f(p.tag) {
+			return false
+		}
+
+		if p.empty {
+			continue
+		}
+
+		// the child must be closed next
+		if !p.next() || p.start {
+			return false
+		}
+	}
+
+	return false
+}
+
+// the attribute types, parsed the same way as encoding/xml.
+
+func parseInt(v []byte) (int64, bool) {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return 0, true
+	}
+
+	i, err := strconv.ParseInt(string(v), 10, 64)
+	return i, err == nil
+}
+
+func parseFloat(v []byte) (float64, bool) {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return 0, true
+	}
+
+	f, err := strconv.ParseFloat(string(v), 64)
+	return f, err == nil
+}
+
+func parseBool(v []byte) (bool, bool) {
+	v = bytes.TrimSpace(v)
+	if len(v) == 0 {
+		return false, true
+	}
+
+	b, err := strconv.ParseBool(string(v))
+	return b, err == nil
+}
+
+func parseTime(v []byte) (time.Time, bool) {
+	var t time.Time
+	err := t.UnmarshalText(v)
+	return t, err == nil
+}
+
+// elementAttrs holds the attributes shared by nodes, ways and relations.
+type elementAttrs struct {
+	ID          int64
+	User        string
+	UserID      osm.UserID
+	Visible     bool
+	Version     int
+	ChangesetID osm.ChangesetID
+	Timestamp   time.Time
+	Committed   *time.Time
+}
+
+// set sets the shared attribute. Returns not handled for other attributes
+// and not ok if the value could not be parsed.
+func (ea *elementAttrs) set(key, value []byte) (handled, ok bool) {
+	switch string(key) {
+	case "id":
+		ea.ID, ok = parseInt(value)
+	case "user":
+		ea.User, ok = string(value), true
+	case "uid":
+		var v int64
+		v, ok = parseInt(value)
+		ea.UserID = osm.UserID(v)
+	case "visible":
+		ea.Visible, ok = parseBool(value)
+	case "version":
+		var v int64
+		v, ok = parseInt(value)
+		ea.Version = int(v)
+	case "changeset":
+		var v int64
+		v, ok = parseInt(value)
+		ea.ChangesetID = osm.ChangesetID(v)
+	case "timestamp":
+		ea.Timestamp, ok = parseTime(value)
+	case "committed":
+		var t time.Time
+		t, ok = parseTime(value)
+		ea.Committed = &t
+	default:
+		return false, true
+	}
+
+	return true, ok
+}
+
+// element reads the root tag, checking the name matches exactly.
+func (p *parser) element(name string) bool {
+	return p.next() && p.start && string(p.tag) == name
+}
+
+func (p *parser) node() (*osm.Node, bool) {
+	if !p.element("node") {
+		return nil, false
+	}
+
+	var (
+		ea       elementAttrs
+		lat, lon float64
+	)
+	for {
+		key, value, more, ok := p.attr()
+		if !ok {
+			return nil, false
+		}
+
+		if !more {
+			break
+		}
+
+		if handled, ok := ea.set(key, value); handled {
+			if !ok {
+				return nil, false
+			}
+			continue
+		}
+
+		switch string(key) {
+		case "lat":
+			lat, ok = parseFloat(value)
+		case "lon":
+			lon, ok = parseFloat(value)
+		}
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	n := &osm.Node{
+		ID:          osm.NodeID(ea.ID),
+		Lat:         lat,
+		Lon:         lon,
+		User:        ea.User,
+		UserID:      ea.UserID,
+		Visible:     ea.Visible,
+		Version:     ea.Version,
+		ChangesetID: ea.ChangesetID,
+		Timestamp:   ea.Timestamp,
+		Committed:   ea.Committed,
+	}
+
+	ok := p.children(func(name []byte) bool {
+		if string(name) != "tag" {
+			return false
+		}
+
+		return p.appendTag(&n.Tags)
+	})
+
+	return n, ok
+}
+
+func (p *parser) appendTag(tags *osm.Tags) bool {
+	var t osm.Tag
+	for {
+		key, value, more, ok := p.attr()
+		if !ok {
+			return false
+		}
+
+		if !more {
+			break
+		}
+
+		switch string(key) {
+		case "k":
+			t.Key = string(value)
+		case "v":
+			t.Value = string(value)
+		}
+	}
+
+	*tags = append(*tags, t)
+	return true
+}
+
+func (p *parser) way() (*osm.Way, bool) {
+	if !p.element("way") {
+		return nil, false
+	}
+
+	var ea elementAttrs
+	for {
+		key, value, more, ok := p.attr()
+		if !ok {
+			return nil, false
+		}
+
+		if !more {
+			break
+		}
+
+		if _, ok := ea.set(key, value); !ok {
+			return nil, false
+		}
+	}
+
+	w := &osm.Way{
+		ID:          osm.WayID(ea.ID),
+		User:        ea.User,
+		UserID:      ea.UserID,
+		Visible:     ea.Visible,
+		Version:     ea.Version,
+		ChangesetID: ea.ChangesetID,
+		Timestamp:   ea.Timestamp,
+		Committed:   ea.Committed,
+	}
+
+	ok := p.children(func(name []byte) bool {
+		switch string(name) {
+		case "tag":
+			return p.appendTag(&w.Tags)
+		case "nd":
+			return p.appendWayNode(&w.Nodes)
+		}
+
+		return false
+	})
+
+	return w, ok
+}
+
+func (p *parser) appendWayNode(nodes *osm.WayNodes) bool {
+	var wn osm.WayNode
+	for {
+		key, value, more, ok := p.attr()
+		if !ok {
+			return false
+		}
+
+		if !more {
+			break
+		}
+
+		var v int64
+		switch string(key) {
+		case "ref":
+			v, ok = parseInt(value)
+			wn.ID = osm.NodeID(v)
+		case "version":
+			v, ok = parseInt(value)
+			wn.Version = int(v)
+		case "changeset":
+			v, ok = parseInt(value)
+			wn.ChangesetID = osm.ChangesetID(v)
+		case "lat":
+			wn.Lat, ok = parseFloat(value)
+		case "lon":
+			wn.Lon, ok = parseFloat(value)
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	*nodes = append(*nodes, wn)
+	return true
+}
+
+func (p *parser) relation() (*osm.Relation, bool) {
+	if !p.element("relation") {
+		return nil, false
+	}
+
+	var ea elementAttrs
+	for {
+		key, value, more, ok := p.attr()
+		if !ok {
+			return nil, false
+		}
+
+		if !more {
+			break
+		}
+
+		if _, ok := ea.set(key, value); !ok {
+			return nil, false
+		}
+	}
+
+	r := &osm.Relation{
+		ID:          osm.RelationID(ea.ID),
+		User:        ea.User,
+		UserID:      ea.UserID,
+		Visible:     ea.Visible,
+		Version:     ea.Version,
+		ChangesetID: ea.ChangesetID,
+		Timestamp:   ea.Timestamp,
+		Committed:   ea.Committed,
+	}
+
+	ok := p.children(func(name []byte) bool {
+		switch string(name) {
+		case "tag":
+			return p.appendTag(&r.Tags)
+		case "member":
+			// members with nodes are decoded by encoding/xml
+			return p.empty && p.appendMember(&r.Members)
+		}
+
+		return false
+	})
+
+	return r, ok
+}
+
+func (p *parser) appendMember(members *osm.Members) bool {
+	var m osm.Member
+	for {
+		key, value, more, ok := p.attr()
+		if !ok {
+			return false
+		}
+
+		if !more {
+			break
+		}
+
+		var v int64
+		switch string(key) {
+		case "type":
+			m.Type = osm.Type(value)
+		case "ref":
+			m.Ref, ok = parseInt(value)
+		case "role":
+			m.Role = string(value)
+		case "version":
+			v, ok = parseInt(value)
+			m.Version = int(v)
+		case "changeset":
+			v, ok = parseInt(value)
+			m.ChangesetID = osm.ChangesetID(v)
+		case "lat":
+			m.Lat, ok = parseFloat(value)
+		case "lon":
+			m.Lon, ok = parseFloat(value)
+		case "orientation":
+			ok = false
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	*members = append(*members, m)
+	return true
+}
+
+func (p *parser) bounds() (*osm.Bounds, bool) {
+	if !p.element("bounds") {
+		return nil, false
+	}
+
+	b := &osm.Bounds{}
+	for {
+		key, value, more, ok := p.attr()
+		if !ok {
+			return nil, false
+		}
+
+		if !more {
+			break
+		}
+
+		switch string(key) {
+		case "minlat":
+			b.MinLat, ok = parseFloat(value)
+		case "maxlat":
+			b.MaxLat, ok = parseFloat(value)
+		case "minlon":
+			b.MinLon, ok = parseFloat(value)
+		case "maxlon":
+			b.MaxLon, ok = parseFloat(value)
+		}
+
+		if !ok {
+			return nil, false
+		}
+	}
+
+	ok := p.children(func(name []byte) bool {
+		return false
+	})
+
+	return b, ok
+}
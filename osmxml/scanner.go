@@ -2,15 +2,17 @@ package osmxml
 
 import (
 	"context"
-	"encoding/xml"
 	"io"
-	"strings"
 
 	"github.com/paulmach/osm"
 )
 
 var _ osm.Scanner = &Scanner{}
 
+// batchSize is the number of elements parsed together by a goroutine
+// when scanning in parallel.
+const batchSize = 1000
+
 // Scanner provides a convenient interface reading a stream of osm data
 // from a file or url. Successive calls to the Scan method will step through the data.
 //
@@ -25,27 +27,71 @@ type Scanner struct {
 	done   context.CancelFunc
 	closed bool
 
-	decoder *xml.Decoder
-	next    osm.Object
-	err     error
+	tokenizer *tokenizer
+	next      osm.Object
+	err       error
+
+	// for parallel parsing
+	procs   int
+	started bool
+	outputs []chan batch
+	oIndex  int
+	current batch
+	cIndex  int
+}
+
+// batch is a set of parsed objects in the order of the data.
+// The error is returned after the objects.
+type batch struct {
+	Objects []osm.Object
+	Err     error
+}
+
+// rawBatch is a set of raw elements to be parsed.
+// The elements are stored back to back in Data.
+type rawBatch struct {
+	Names []string
+	Ends  []int
+	Data  []byte
+	Err   error
 }
 
-// New returns a new Scanner to read from r.
+// New returns a new Scanner to read from r. The data is split into elements
+// and parsed using a tokenizer specialized for the osm xml schema.
+// Elements it does not understand are decoded using encoding/xml.
 func New(ctx context.Context, r io.Reader) *Scanner {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
 	s := &Scanner{
-		decoder: xml.NewDecoder(r),
+		tokenizer: newTokenizer(r),
 	}
 
 	s.ctx, s.done = context.WithCancel(ctx)
 	return s
 }
 
+// NewParallel returns a new Scanner to read from r. The reading and splitting
+// of the data happens in its own goroutine, and the parsing of the elements is
+// done by procs goroutines. This includes the decompression if r is a
+// decompressing reader, e.g. bzip2 or gzip. The objects are returned in the order
+// of the data. The scanner must be closed to clean up the goroutines.
+func NewParallel(ctx context.Context, r io.Reader, procs int) *Scanner {
+	s := New(ctx, r)
+
+	if procs < 1 {
+		procs = 1
+	}
+	s.procs = procs
+
+	return s
+}
+
 // Close causes all future calls to Scan to return false.
-// Does not close the underlying reader.
+// Does not close the underlying reader. Close does not wait for the
+// goroutines of a parallel scanner, the reading goroutine exits once
+// its current read of the underlying reader returns.
 func (s *Scanner) Close() error {
 	s.closed = true
 	s.done()
@@ -60,68 +106,143 @@ func (s *Scanner) Close() error {
 // error that occurred during scanning, except if it was io.EOF, Err will
 // return nil.
 func (s *Scanner) Scan() bool {
-	if s.err != nil {
+	if s.err != nil || s.ctx.Err() != nil {
 		return false
 	}
 
-Loop:
-	for {
-		if s.ctx.Err() != nil {
+	if s.procs > 0 {
+		return s.scanParallel()
+	}
+
+	name, data, err := s.tokenizer.Next()
+	if err != nil {
+		s.err = err
+		return false
+	}
+
+	s.next, s.err = parse(name, data)
+	return s.err == nil
+}
+
+func (s *Scanner) scanParallel() bool {
+	if !s.started {
+		s.started = true
+		s.start()
+	}
+
+	for s.cIndex >= len(s.current.Objects) {
+		if s.current.Err != nil {
+			s.err = s.current.Err
 			return false
 		}
 
-		t, err := s.decoder.Token()
-		if err != nil {
-			s.err = err
+		var ok bool
+		select {
+		case s.current, ok = <-s.outputs[s.oIndex]:
+		case <-s.ctx.Done():
 			return false
 		}
 
-		se, ok := t.(xml.StartElement)
 		if !ok {
-			continue
+			s.err = io.EOF
+			return false
 		}
 
-		s.next = nil
-		switch strings.ToLower(se.Name.Local) {
-		case "bounds":
-			bounds := &osm.Bounds{}
-			err = s.decoder.DecodeElement(&bounds, &se)
-			s.next = bounds
-		case "node":
-			node := &osm.Node{}
-			err = s.decoder.DecodeElement(&node, &se)
-			s.next = node
-		case "way":
-			way := &osm.Way{}
-			err = s.decoder.DecodeElement(&way, &se)
-			s.next = way
-		case "relation":
-			relation := &osm.Relation{}
-			err = s.decoder.DecodeElement(&relation, &se)
-			s.next = relation
-		case "changeset":
-			cs := &osm.Changeset{}
-			err = s.decoder.DecodeElement(&cs, &se)
-			s.next = cs
-		case "note":
-			n := &osm.Note{}
-			err = s.decoder.DecodeElement(&n, &se)
-			s.next = n
-		case "user":
-			u := &osm.User{}
-			err = s.decoder.DecodeElement(&u, &se)
-			s.next = u
-		default:
-			continue Loop
-		}
+		s.oIndex = (s.oIndex + 1) % s.procs
+		s.cIndex = 0
+	}
 
-		if err != nil {
-			s.err = err
-			return false
-		}
+	s.next = s.current.Objects[s.cIndex]
+	s.cIndex++
+	return true
+}
+
+// start begins the reading goroutine that feeds batches round-robin
+// into the parsing goroutines. The outputs are read round-robin to
+// maintain the order of the objects.
+func (s *Scanner) start() {
+	var inputs []chan rawBatch
+
+	for i := 0; i < s.procs; i++ {
+		input := make(chan rawBatch, 2)
+		output := make(chan batch, 2)
+
+		go func() {
+			defer close(output)
+
+			for rb := range input {
+				b := batch{Objects: make([]osm.Object, 0, len(rb.Names))}
+
+				start := 0
+				for i, end := range rb.Ends {
+					o, err := parse(rb.Names[i], rb.Data[start:end])
+					if err != nil {
+						b.Err = err
+						break
+					}
+					b.Objects = append(b.Objects, o)
+					start = end
+				}
 
-		return true
+				if b.Err == nil {
+					b.Err = rb.Err
+				}
+
+				select {
+				case output <- b:
+				case <-s.ctx.Done():
+					return
+				}
+			}
+		}()
+
+		inputs = append(inputs, input)
+		s.outputs = append(s.outputs, output)
 	}
+
+	go func() {
+		defer func() {
+			for _, input := range inputs {
+				close(input)
+			}
+		}()
+
+		for i := 0; ; i = (i + 1) % s.procs {
+			rb := rawBatch{
+				Names: make([]string, 0, batchSize),
+				Ends:  make([]int, 0, batchSize),
+			}
+			for len(rb.Names) < batchSize {
+				name, data, err := s.tokenizer.Next()
+				if err == io.EOF {
+					break
+				}
+
+				if err != nil {
+					rb.Err = err
+					break
+				}
+
+				rb.Names = append(rb.Names, name)
+				rb.Data = append(rb.Data, data...)
+				rb.Ends = append(rb.Ends, len(rb.Data))
+			}
+
+			if len(rb.Names) == 0 && rb.Err == nil {
+				return
+			}
+
+			select {
+			case inputs[i] <- rb:
+			case <-s.ctx.Done():
+				return
+			}
+
+			if rb.Err != nil || len(rb.Names) < batchSize {
+				return
+			}
+		}
+	}()
 }
 
 // Object returns the most recent token generated by a call to Scan
@@ -0,0 +1,335 @@
+package osmxml
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// objectNames are the elements returned by the scanner.
+var objectNames = map[string]bool{
+	"bounds":    true,
+	"node":      true,
+	"way":       true,
+	"relation":  true,
+	"changeset": true,
+	"note":      true,
+	"user":      true,
+}
+
+type markupKind int
+
+const (
+	markupStart markupKind = iota
+	markupEnd
+	markupOther // comments, cdata, processing instructions and declarations
+)
+
+// errUnexpectedEOF is returned if the data ends in the middle of an element.
+var errUnexpectedEOF = errors.New("osmxml: unexpected EOF")
+
+// tokenizer splits an xml stream into the raw bytes of the osm elements.
+// It only understands enough xml to find the start and end of the elements,
+// the elements are parsed separately. The text and tags between the elements
+// are checked so malformed data returns an error, like encoding/xml.
+type tokenizer struct {
+	r   *bufio.Reader
+	buf []byte
+
+	// the open tags that contain the current position, e.g. osm or create.
+	open []string
+}
+
+func newTokenizer(r io.Reader) *tokenizer {
+	return &tokenizer{
+		r: bufio.NewReaderSize(r, 64*1024),
+	}
+}
+
+// Next returns the lower case local name and the raw bytes of the next osm
+// element. The bytes are only valid until the next call. Returns io.EOF
+// at the end of the data.
+func (t *tokenizer) Next() (string, []byte, error) {
+	for {
+		var err error
+		t.buf, err = t.readUntil(t.buf[:0], '<')
+		if err == io.EOF {
+			if err := checkText(t.buf); err != nil {
+				return "", nil, err
+			}
+
+			if len(t.open) > 0 {
+				return "", nil, errUnexpectedEOF
+			}
+
+			return "", nil, io.EOF
+		}
+
+		if err != nil {
+			return "", nil, err
+		}
+
+		if err := checkText(t.buf[:len(t.buf)-1]); err != nil {
+			return "", nil, err
+		}
+
+		t.buf = append(t.buf[:0], '<')
+		t.buf, err = t.readMarkup(t.buf)
+		if err != nil {
+			return "", nil, eof(err)
+		}
+
+		kind := markupType(t.buf)
+		if kind != markupOther && !validName(tagName(t.buf)) {
+			return "", nil, fmt.Errorf("osmxml: invalid tag %q", t.buf)
+		}
+
+		if kind == markupEnd {
+			if err := t.closeTag(); err != nil {
+				return "", nil, err
+			}
+
+			continue
+		}
+
+		if kind != markupStart {
+			continue
+		}
+
+		name := string(bytes.ToLower(localName(t.buf)))
+		if !objectNames[name] {
+			if !selfClosing(t.buf) {
+				t.open = append(t.open, string(tagName(t.buf)))
+			}
+
+			continue
+		}
+
+		if selfClosing(t.buf) {
+			return name, t.buf, nil
+		}
+
+		// capture until the matching end tag
+		depth := 1
+		for depth > 0 {
+			t.buf, err = t.readUntil(t.buf, '<')
+			if err != nil {
+				return "", nil, eof(err)
+			}
+
+			start := len(t.buf) - 1
+			t.buf, err = t.readMarkup(t.buf)
+			if err != nil {
+				return "", nil, eof(err)
+			}
+
+			switch markupType(t.buf[start:]) {
+			case markupStart:
+				if !selfClosing(t.buf[start:]) {
+					depth++
+				}
+			case markupEnd:
+				depth--
+			}
+		}
+
+		return name, t.buf, nil
+	}
+}
+
+// eof converts io.EOF into an error since the data ended mid element.
+func eof(err error) error {
+	if err == io.EOF {
+		return errUnexpectedEOF
+	}
+
+	return err
+}
+
+// closeTag checks the end tag in the buffer matches the last open tag.
+func (t *tokenizer) closeTag() error {
+	name := tagName(t.buf)
+	if len(t.open) == 0 {
+		return fmt.Errorf("osmxml: unexpected end tag </%s>", name)
+	}
+
+	last := t.open[len(t.open)-1]
+	if last != string(name) {
+		return fmt.Errorf("osmxml: tag <%s> closed by </%s>", last, name)
+	}
+
+	t.open = t.open[:len(t.open)-1]
+	return nil
+}
+
+// checkText validates the character data between tags. Entities must be
+// one of the predefined ones or a character reference and ']]>' is only
+// allowed in cdata sections.
+func checkText(text []byte) error {
+	if bytes.Contains(text, []byte("]]>")) {
+		return errors.New("osmxml: unescaped ]]> not in cdata section")
+	}
+
+	for {
+		i := bytes.IndexByte(text, '&')
+		if i < 0 {
+			return nil
+		}
+
+		text = text[i+1:]
+		end := bytes.IndexByte(text, ';')
+		if end < 0 || !validEntity(text[:end]) {
+			return errors.New("osmxml: invalid character entity")
+		}
+
+		text = text[end+1:]
+	}
+}
+
+func validEntity(e []byte) bool {
+	switch string(e) {
+	case "amp", "lt", "gt", "apos", "quot":
+		return true
+	}
+
+	if len(e) < 2 || e[0] != '#' {
+		return false
+	}
+
+	digits, hex := e[1:], false
+	if digits[0] == 'x' {
+		digits, hex = digits[1:], true
+	}
+
+	if len(digits) == 0 {
+		return false
+	}
+
+	for _, c := range digits {
+		isDigit := c >= '0' && c <= '9'
+		isHex := (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+		if !isDigit && !(hex && isHex) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validName checks the first character of a tag name.
+func validName(name []byte) bool {
+	if len(name) == 0 {
+		return false
+	}
+
+	c := name[0]
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || c >= 0x80
+}
+
+// readUntil appends the data up to and including the byte.
+func (t *tokenizer) readUntil(dst []byte, c byte) ([]byte, error) {
+	for {
+		line, err := t.r.ReadSlice(c)
+		dst = append(dst, line...)
+		if err != bufio.ErrBufferFull {
+			return dst, err
+		}
+	}
+}
+
+// readMarkup appends the rest of the markup, dst must end with the opening '<'.
+func (t *tokenizer) readMarkup(dst []byte) ([]byte, error) {
+	start := len(dst) - 1
+
+	var err error
+	for {
+		dst, err = t.readUntil(dst, '>')
+		if err != nil {
+			return dst, err
+		}
+
+		if markupComplete(dst[start:]) {
+			return dst, nil
+		}
+	}
+}
+
+// markupComplete checks if the markup, ending with a '>', is complete.
+// For example, a '>' can be in a quoted attribute value or a comment.
+func markupComplete(m []byte) bool {
+	switch {
+	case bytes.HasPrefix(m, []byte("<!--")):
+		return len(m) >= 7 && bytes.HasSuffix(m, []byte("-->"))
+	case bytes.HasPrefix(m, []byte("<![CDATA[")):
+		return len(m) >= 12 && bytes.HasSuffix(m, []byte("]]>"))
+	case bytes.HasPrefix(m, []byte("<?")):
+		return len(m) >= 4 && bytes.HasSuffix(m, []byte("?>"))
+	case bytes.HasPrefix(m, []byte("<!")):
+		// doctype, can have an internal subset in brackets
+		return bytes.Count(m, []byte("[")) == bytes.Count(m, []byte("]"))
+	}
+
+	var quote byte
+	for _, c := range m {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		}
+	}
+
+	return quote == 0
+}
+
+func markupType(m []byte) markupKind {
+	if len(m) < 2 {
+		return markupOther
+	}
+
+	switch m[1] {
+	case '/':
+		return markupEnd
+	case '!', '?':
+		return markupOther
+	}
+
+	return markupStart
+}
+
+func selfClosing(m []byte) bool {
+	return len(m) >= 2 && m[len(m)-2] == '/'
+}
+
+// tagName returns the name, including any namespace prefix, of a start or end tag.
+func tagName(m []byte) []byte {
+	i := 1
+	if len(m) > 1 && m[1] == '/' {
+		i = 2
+	}
+
+	j := i
+	for j < len(m) && !isSpace(m[j]) && m[j] != '>' && m[j] != '/' {
+		j++
+	}
+
+	return m[i:j]
+}
+
+// localName returns the name of the tag without the namespace prefix.
+func localName(m []byte) []byte {
+	name := tagName(m)
+	if i := bytes.IndexByte(name, ':'); i >= 0 {
+		return name[i+1:]
+	}
+
+	return name
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
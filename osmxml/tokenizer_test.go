@@ -0,0 +1,423 @@
+package osmxml
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+// decodeReference decodes the objects using encoding/xml,
+// the way the scanner originally worked.
+func decodeReference(t testing.TB, r io.Reader) []osm.Object {
+	t.Helper()
+
+	var result []osm.Object
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return result
+		}
+
+		if err != nil {
+			t.Fatalf("reference error: %v", err)
+		}
+
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		var o osm.Object
+		switch strings.ToLower(se.Name.Local) {
+		case "bounds":
+			o = &osm.Bounds{}
+		case "node":
+			o = &osm.Node{}
+		case "way":
+			o = &osm.Way{}
+		case "relation":
+			o = &osm.Relation{}
+		case "changeset":
+			o = &osm.Changeset{}
+		case "note":
+			o = &osm.Note{}
+		case "user":
+			o = &osm.User{}
+		default:
+			continue
+		}
+
+		if err := decoder.DecodeElement(o, &se); err != nil {
+			t.Fatalf("reference decode error: %v", err)
+		}
+		result = append(result, o)
+	}
+}
+
+func scanAll(t testing.TB, scanner *Scanner) []osm.Object {
+	t.Helper()
+	defer scanner.Close()
+
+	var result []osm.Object
+	for scanner.Scan() {
+		result = append(result, scanner.Object())
+	}
+
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scan error: %v", err)
+	}
+
+	return result
+}
+
+func compareObjects(t testing.TB, result, expected []osm.Object) {
+	t.Helper()
+
+	if len(result) != len(expected) {
+		t.Fatalf("incorrect number of objects: %d != %d", len(result), len(expected))
+	}
+
+	for i := range expected {
+		if !reflect.DeepEqual(result[i], expected[i]) {
+			t.Errorf("object %d not equal", i)
+			t.Logf("%+v", result[i])
+			t.Logf("%+v", expected[i])
+			return
+		}
+	}
+}
+
+func TestScanner_sameAsEncodingXML(t *testing.T) {
+	files := []string{
+		"../testdata/annotated_diff.xml",
+		"../testdata/changeset_38162206.osc",
+		"../testdata/changeset_38162210.osc",
+		"../testdata/minute_871.osc",
+		"../testdata/relation-updates.osm",
+		"../testdata/way-updates.osm",
+	}
+
+	for _, f := range files {
+		t.Run(f, func(t *testing.T) {
+			data, err := ioutil.ReadFile(f)
+			if err != nil {
+				t.Fatalf("could not read file: %v", err)
+			}
+
+			expected := decodeReference(t, bytes.NewReader(data))
+
+			result := scanAll(t, New(context.Background(), bytes.NewReader(data)))
+			compareObjects(t, result, expected)
+
+			result = scanAll(t, NewParallel(context.Background(), bytes.NewReader(data), 3))
+			compareObjects(t, result, expected)
+		})
+	}
+}
+
+func TestScanner_sameAsEncodingXMLAndorra(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+
+	f, err := os.Open("../testdata/andorra-latest.osm.bz2")
+	if err != nil {
+		t.Fatalf("could not open file: %v", err)
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(bzip2.NewReader(f))
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+
+	expected := decodeReference(t, bytes.NewReader(data))
+
+	result := scanAll(t, NewParallel(context.Background(), bytes.NewReader(data), 4))
+	compareObjects(t, result, expected)
+}
+
+func TestScanner_edgeCases(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "entities",
+			data: `<osm><node id="1" lat="1.5" lon="2"><tag k="name" v="A &amp; B &lt;&gt; &quot;&apos; &#65;&#x42; é"/></node></osm>`,
+		},
+		{
+			name: "doctype",
+			data: `<!DOCTYPE osm [<!ELEMENT osm ANY>]><osm><node id="1"><tag k="name" v="a&#10;b"/></node></osm>`,
+		},
+		{
+			name: "comments and cdata",
+			data: `<?xml version="1.0"?><!-- <node id="0"/> --><osm><node id="1"><!-- <tag k="a" v="b"/> --><![CDATA[ <tag> ]]><tag k="c" v="d"/></node></osm>`,
+		},
+		{
+			name: "gt in attribute",
+			data: `<osm><way id="1" user="a>b"><nd ref="1"/><nd ref="2"></nd><tag k='x' v='"y"'/></way></osm>`,
+		},
+		{
+			name: "single quotes and spaces",
+			data: "<osm><node id = '1'\n\tlat=' 1.5 ' visible=\"true\"   /></osm>",
+		},
+		{
+			name: "relation members",
+			data: `<osm><relation id="1" version="2" visible="false"><member type="way" ref="2" role="outer" lat="1" lon="2"/><member type="node" ref="3" role=""></member><tag k="type" v="multipolygon"/></relation></osm>`,
+		},
+		{
+			name: "member with nodes",
+			data: `<osm><relation id="1"><member type="way" ref="2" role="outer"><nd ref="5" lat="1" lon="2"/></member></relation></osm>`,
+		},
+		{
+			name: "member orientation",
+			data: `<osm><relation id="1"><member type="way" ref="2" role="outer" orientation="1"/></relation></osm>`,
+		},
+		{
+			name: "way updates",
+			data: `<osm><way id="1"><nd ref="1" version="2" changeset="3"/><update index="0" version="2" timestamp="2012-01-01T00:00:00Z"/></way></osm>`,
+		},
+		{
+			name: "committed",
+			data: `<osm><node id="1" timestamp="2012-01-01T00:00:00Z" committed="2012-01-02T00:00:00Z"/></osm>`,
+		},
+		{
+			name: "upper case",
+			data: `<osm><Bounds minlat="1"/><bounds minlat="1" maxlat="2" minlon="3" maxlon="4"></bounds></osm>`,
+		},
+		{
+			name: "namespace",
+			data: `<osm xmlns:x="http://example.com"><x:node id="1" x:lat="2"/><node id="2"/></osm>`,
+		},
+		{
+			name: "text",
+			data: `<osm><node id="1">text<tag k="a" v="b">more</tag></node><note><id>2</id><comments><comment><text>a &lt; b</text></comment></comments></note><user id="3"><description>hi</description></user></osm>`,
+		},
+		{
+			name: "changeset",
+			data: `<osm><changeset id="1" open="true" created_at="2016-08-03T22:40:15Z"><tag k="comment" v="c"/><discussion><comment uid="1" user="a" date="2016-08-03T22:40:15Z"><text>t</text></comment></discussion></changeset></osm>`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			expected := decodeReference(t, strings.NewReader(tc.data))
+
+			result := scanAll(t, New(context.Background(), strings.NewReader(tc.data)))
+			compareObjects(t, result, expected)
+		})
+	}
+}
+
+func TestScanner_parseError(t *testing.T) {
+	data := `<osm><node id="1"/><node id="abc"/><node id="3"/></osm>`
+
+	for _, procs := range []int{0, 2} {
+		scanner := NewParallel(context.Background(), strings.NewReader(data), procs)
+		if procs == 0 {
+			scanner = New(context.Background(), strings.NewReader(data))
+		}
+
+		if !scanner.Scan() {
+			t.Fatalf("should scan first node: %v", scanner.Err())
+		}
+
+		if scanner.Scan() {
+			t.Errorf("should not scan invalid node")
+		}
+
+		if scanner.Err() == nil {
+			t.Errorf("should return error")
+		}
+
+		scanner.Close()
+	}
+}
+
+func TestScanner_truncated(t *testing.T) {
+	data := `<osm><node id="1"/><node id="2"><tag k="a"`
+
+	scanner := New(context.Background(), strings.NewReader(data))
+	if !scanner.Scan() {
+		t.Fatalf("should scan first node: %v", scanner.Err())
+	}
+
+	if scanner.Scan() {
+		t.Errorf("should not scan partial node")
+	}
+
+	if scanner.Err() != errUnexpectedEOF {
+		t.Errorf("incorrect error: %v", scanner.Err())
+	}
+}
+
+func TestScanner_malformed(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+	}{
+		{
+			name: "invalid entity",
+			data: `<osm>a & b<node id="1"/></osm>`,
+		},
+		{
+			name: "unknown entity",
+			data: `<osm><node id="1"/>&foo;</osm>`,
+		},
+		{
+			name: "cdata end in text",
+			data: `<osm>]]><node id="1"/></osm>`,
+		},
+		{
+			name: "invalid tag name",
+			data: `<osm>< node id="1"/></osm>`,
+		},
+		{
+			name: "mismatched end tag",
+			data: `<osm><create></modify><node id="1"/></osm>`,
+		},
+		{
+			name: "unexpected end tag",
+			data: `<osm></osm></osm>`,
+		},
+		{
+			name: "unclosed tag",
+			data: `<osm><node id="1"/>`,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			decoder := xml.NewDecoder(strings.NewReader(tc.data))
+
+			var err error
+			for err == nil {
+				_, err = decoder.Token()
+			}
+
+			if err == io.EOF {
+				t.Fatalf("encoding/xml should return error")
+			}
+
+			for _, procs := range []int{0, 2} {
+				scanner := NewParallel(context.Background(), strings.NewReader(tc.data), procs)
+				if procs == 0 {
+					scanner = New(context.Background(), strings.NewReader(tc.data))
+				}
+
+				for scanner.Scan() {
+				}
+
+				if scanner.Err() == nil {
+					t.Errorf("should return error with %d procs", procs)
+				}
+
+				scanner.Close()
+			}
+		})
+	}
+}
+
+func TestNewParallel_Close(t *testing.T) {
+	f, err := os.Open("../testdata/minute_871.osc")
+	if err != nil {
+		t.Fatalf("could not open file: %v", err)
+	}
+	defer f.Close()
+
+	scanner := NewParallel(context.Background(), f, 2)
+	if !scanner.Scan() {
+		t.Fatalf("should scan first object: %v", scanner.Err())
+	}
+
+	scanner.Close()
+	if scanner.Scan() {
+		t.Errorf("should not scan after close")
+	}
+
+	if scanner.Err() != osm.ErrScannerClosed {
+		t.Errorf("incorrect error: %v", scanner.Err())
+	}
+}
+
+func TestNewParallel_Close_blockedReader(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	go w.Write([]byte(`<osm><node id="1"/>`))
+
+	scanner := NewParallel(context.Background(), r, 2)
+
+	done := make(chan bool)
+	go func() {
+		done <- scanner.Scan()
+	}()
+
+	closed := make(chan struct{})
+	go func() {
+		scanner.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("close should not wait for the reader")
+	}
+
+	if <-done {
+		t.Errorf("should not scan after close")
+	}
+}
+
+func BenchmarkAndorra_parallel(b *testing.B) {
+	f, err := os.Open("../testdata/andorra-latest.osm.bz2")
+	if err != nil {
+		b.Fatalf("could not open file: %v", err)
+	}
+	defer f.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Seek(0, 0)
+
+		scanner := NewParallel(context.Background(), bzip2.NewReader(f), 4)
+		count := 0
+		for scanner.Scan() {
+			count++
+		}
+
+		if err := scanner.Err(); err != nil {
+			b.Fatalf("scanner returned error: %v", err)
+		}
+		scanner.Close()
+	}
+}
+
+func BenchmarkAndorra_encodingXML(b *testing.B) {
+	f, err := os.Open("../testdata/andorra-latest.osm.bz2")
+	if err != nil {
+		b.Fatalf("could not open file: %v", err)
+	}
+	defer f.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Seek(0, 0)
+		decodeReference(b, bzip2.NewReader(f))
+	}
+}
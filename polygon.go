@@ -2,6 +2,7 @@ package osm
 
 import (
 	"encoding/json"
+	"fmt"
 	"sort"
 )
 
@@ -12,6 +13,12 @@ import (
 // https://wiki.openstreetmap.org/wiki/Overpass_turbo/Polygon_Features
 // and are used by osmtogeojson and overpass turbo.
 func (w *Way) Polygon() bool {
+	return w.PolygonWithRules(polyConditions)
+}
+
+// PolygonWithRules returns true if the way should be considered a closed
+// polygon area using the custom area rules instead of the defaults.
+func (w *Way) PolygonWithRules(rules AreaRules) bool {
 	if len(w.Nodes) <= 3 {
 		// need more than 3 nodes to be a polygon since first/last is repeated.
 		return false
@@ -22,28 +29,129 @@ func (w *Way) Polygon() bool {
 		return false
 	}
 
-	if area := w.Tags.Find("area"); area == "no" {
+	return rules.Area(w.Tags)
+}
+
+// AreaRules are the conditions used to decide if the tags of a closed way
+// define an area. They can be loaded from json in the format used by
+// https://wiki.openstreetmap.org/wiki/Overpass_turbo/Polygon_Features
+type AreaRules []AreaRule
+
+// An AreaRule is the area condition for a tag key. The tag is an area for
+// any value if the condition is "all", for only the values in the list if
+// "whitelist" and for all the values not in the list if "blacklist".
+// A "no" value is never an area. The values must be sorted, they are
+// sorted when loaded from json or added using AreaRules.Set.
+type AreaRule struct {
+	Key       string        `json:"key"`
+	Condition AreaCondition `json:"polygon"`
+	Values    []string      `json:"values,omitempty"`
+}
+
+// UnmarshalJSON will sort the values after decoding.
+func (r *AreaRule) UnmarshalJSON(data []byte) error {
+	type areaRule AreaRule
+	if err := json.Unmarshal(data, (*areaRule)(r)); err != nil {
+		return err
+	}
+
+	sort.Strings(r.Values)
+	return nil
+}
+
+// AreaCondition is how the values of an area rule are used.
+type AreaCondition string
+
+// The area rule conditions.
+const (
+	AreaAll       AreaCondition = "all"
+	AreaBlacklist AreaCondition = "blacklist"
+	AreaWhitelist AreaCondition = "whitelist"
+)
+
+// UnmarshalJSON will return an error for unknown conditions.
+func (c *AreaCondition) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	switch ac := AreaCondition(s); ac {
+	case AreaAll, AreaBlacklist, AreaWhitelist:
+		*c = ac
+		return nil
+	}
+
+	return fmt.Errorf("osm: unknown area condition %q", s)
+}
+
+// DefaultAreaRules returns a copy of the default area rules, the rules
+// used by overpass turbo and osmtogeojson. It can be modified to
+// create custom rules.
+func DefaultAreaRules() AreaRules {
+	rules := make(AreaRules, len(polyConditions))
+	for i, r := range polyConditions {
+		rules[i] = r
+		rules[i].Values = append([]string(nil), r.Values...)
+	}
+
+	return rules
+}
+
+// Set returns a copy of the rules with the rule for the key replaced,
+// or added if there is no rule for the key.
+func (rules AreaRules) Set(rule AreaRule) AreaRules {
+	rule.Values = append([]string(nil), rule.Values...)
+	sort.Strings(rule.Values)
+
+	result := make(AreaRules, len(rules), len(rules)+1)
+	copy(result, rules)
+
+	for i, r := range result {
+		if r.Key == rule.Key {
+			result[i] = rule
+			return result
+		}
+	}
+
+	return append(result, rule)
+}
+
+// Remove returns a copy of the rules without the rule for the key.
+func (rules AreaRules) Remove(key string) AreaRules {
+	result := make(AreaRules, 0, len(rules))
+	for _, r := range rules {
+		if r.Key != key {
+			result = append(result, r)
+		}
+	}
+
+	return result
+}
+
+// Area returns true if the tags define an area. An "area" tag
+// overrides the rules, "area=no" is never an area.
+func (rules AreaRules) Area(tags Tags) bool {
+	if area := tags.Find("area"); area == "no" {
 		return false
 	} else if area != "" {
 		return true
 	}
 
-	for _, c := range polyConditions {
-		v := w.Tags.Find(c.Key)
+	for _, r := range rules {
+		v := tags.Find(r.Key)
 		if v == "" || v == "no" {
 			continue
 		}
 
-		if c.Condition == conditionAll {
+		if r.Condition == AreaAll {
 			return true
-		} else if c.Condition == conditionWhitelist {
-			index := sort.SearchStrings(c.Values, v)
-			if index != len(c.Values) && c.Values[index] == v {
+		} else if r.Condition == AreaWhitelist {
+			if hasValue(r.Values, v) {
 				return true
 			}
-		} else if c.Condition == conditionBlacklist {
-			index := sort.SearchStrings(c.Values, v)
-			if index == len(c.Values) || c.Values[index] != v {
+		} else if r.Condition == AreaBlacklist {
+			if !hasValue(r.Values, v) {
 				return true
 			}
 		}
@@ -52,32 +160,21 @@ func (w *Way) Polygon() bool {
 	return false
 }
 
+func hasValue(values []string, v string) bool {
+	index := sort.SearchStrings(values, v)
+	return index != len(values) && values[index] == v
+}
+
 func init() {
+	// the rule values are sorted when unmarshalled
 	err := json.Unmarshal(polygonJSON, &polyConditions)
 	if err != nil {
 		// This must be valid json
 		panic(err)
 	}
-
-	for _, p := range polyConditions {
-		sort.StringSlice(p.Values).Sort()
-	}
 }
 
-var polyConditions []polyCondition
-
-type polyCondition struct {
-	Key       string        `json:"key"`
-	Condition conditionType `json:"polygon"`
-	Values    []string      `json:"values"`
-}
-type conditionType string
-
-var (
-	conditionAll       conditionType = "all"
-	conditionBlacklist conditionType = "blacklist"
-	conditionWhitelist conditionType = "whitelist"
-)
+var polyConditions AreaRules
 
 // polygonJSON holds advanced conditions for when an osm way is a polygon.
 // Sourced from: https://wiki.openstreetmap.org/wiki/Overpass_turbo/Polygon_Features
@@ -237,8 +334,27 @@ var polygonJSON = []byte(`
     }
 ]`)
 
-// Polygon returns true if the relation is of type multipolygon or boundary.
+// Polygon returns true if the relation is of type multipolygon or boundary,
+// using the default area rules. See PolygonWithRules.
 func (r *Relation) Polygon() bool {
-	t := r.Tags.Find("type")
-	return t == "multipolygon" || t == "boundary"
+	return r.PolygonWithRules(polyConditions)
+}
+
+// PolygonWithRules returns true if the relation is of type multipolygon,
+// or of type boundary and the boundary tag is an area using the custom
+// area rules. A boundary relation without a boundary tag is a polygon.
+func (r *Relation) PolygonWithRules(rules AreaRules) bool {
+	switch r.Tags.Find("type") {
+	case "multipolygon":
+		return true
+	case "boundary":
+		v := r.Tags.Find("boundary")
+		if v == "" {
+			return true
+		}
+
+		return rules.Area(Tags{{Key: "boundary", Value: v}})
+	}
+
+	return false
 }
@@ -1,6 +1,7 @@
 package osm
 
 import (
+	"encoding/json"
 	"reflect"
 	"testing"
 )
@@ -109,3 +110,203 @@ func TestWay_Polygon(t *testing.T) {
 		})
 	}
 }
+
+func TestAreaRules_json(t *testing.T) {
+	data := []byte(`[
+		{"key": "building", "polygon": "all"},
+		{"key": "highway", "polygon": "whitelist", "values": ["pedestrian", "footway"]},
+		{"key": "natural", "polygon": "blacklist", "values": ["coastline"]}
+	]`)
+
+	var rules AreaRules
+	err := json.Unmarshal(data, &rules)
+	if err != nil {
+		t.Fatalf("unmarshal error: %v", err)
+	}
+
+	cases := []struct {
+		name  string
+		tags  Tags
+		value bool
+	}{
+		{
+			name:  "all",
+			tags:  Tags{{Key: "building", Value: "house"}},
+			value: true,
+		},
+		{
+			name:  "whitelist",
+			tags:  Tags{{Key: "highway", Value: "pedestrian"}},
+			value: true,
+		},
+		{
+			name:  "unsorted whitelist",
+			tags:  Tags{{Key: "highway", Value: "footway"}},
+			value: true,
+		},
+		{
+			name:  "not in whitelist",
+			tags:  Tags{{Key: "highway", Value: "services"}},
+			value: false,
+		},
+		{
+			name:  "blacklist",
+			tags:  Tags{{Key: "natural", Value: "coastline"}},
+			value: false,
+		},
+		{
+			name:  "not in blacklist",
+			tags:  Tags{{Key: "natural", Value: "water"}},
+			value: true,
+		},
+		{
+			name:  "no rule",
+			tags:  Tags{{Key: "leisure", Value: "park"}},
+			value: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if v := rules.Area(tc.tags); v != tc.value {
+				t.Errorf("incorrect area: %v", v)
+			}
+		})
+	}
+
+	// unknown conditions are an error
+	err = json.Unmarshal([]byte(`[{"key": "a", "polygon": "some"}]`), &rules)
+	if err == nil {
+		t.Errorf("should return error for unknown condition")
+	}
+}
+
+func TestAreaRules_Set(t *testing.T) {
+	rules := DefaultAreaRules()
+	l := len(rules)
+
+	rules = rules.Set(AreaRule{Key: "highway", Condition: AreaAll})
+	if len(rules) != l {
+		t.Errorf("should replace existing rule: %v != %v", len(rules), l)
+	}
+
+	rules = rules.Set(AreaRule{Key: "highway:area", Condition: AreaAll}).Remove("building")
+	if len(rules) != l {
+		t.Errorf("should add and remove rules: %v != %v", len(rules), l)
+	}
+
+	// defaults should not be changed
+	if polyConditions[1].Condition != AreaWhitelist {
+		t.Errorf("should not modify the defaults")
+	}
+
+	w := &Way{
+		Nodes: WayNodes{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 1}},
+		Tags:  Tags{{Key: "highway", Value: "primary"}},
+	}
+
+	if w.Polygon() {
+		t.Errorf("should not be polygon with default rules")
+	}
+
+	if !w.PolygonWithRules(rules) {
+		t.Errorf("should be polygon with custom rules")
+	}
+
+	w.Tags = Tags{{Key: "building", Value: "yes"}}
+	if w.PolygonWithRules(rules) {
+		t.Errorf("should not be polygon with removed rule")
+	}
+
+	// values are sorted
+	rules = rules.Set(AreaRule{Key: "barrier", Condition: AreaWhitelist, Values: []string{"wall", "fence"}})
+	w.Tags = Tags{{Key: "barrier", Value: "fence"}}
+	if !w.PolygonWithRules(rules) {
+		t.Errorf("should be polygon with unsorted values")
+	}
+}
+
+func TestAreaRules_copy(t *testing.T) {
+	rules := AreaRules{
+		{Key: "a", Condition: AreaAll},
+		{Key: "b", Condition: AreaAll},
+	}
+
+	removed := rules.Remove("a")
+	if len(removed) != 1 || rules[0].Key != "a" || rules[1].Key != "b" {
+		t.Errorf("remove should not modify the rules: %v", rules)
+	}
+
+	set := rules[:1].Set(AreaRule{Key: "c", Condition: AreaAll})
+	if len(set) != 2 || rules[1].Key != "b" {
+		t.Errorf("set should not modify the rules: %v", rules)
+	}
+
+	set = rules.Set(AreaRule{Key: "a", Condition: AreaBlacklist})
+	if set[0].Condition != AreaBlacklist || rules[0].Condition != AreaAll {
+		t.Errorf("set should not modify the rules: %v", rules)
+	}
+}
+
+func TestRelation_PolygonWithRules(t *testing.T) {
+	rules := DefaultAreaRules().Set(AreaRule{
+		Key:       "boundary",
+		Condition: AreaBlacklist,
+		Values:    []string{"maritime"},
+	})
+
+	cases := []struct {
+		name     string
+		tags     Tags
+		defaults bool
+		custom   bool
+	}{
+		{
+			name:     "multipolygon",
+			tags:     Tags{{Key: "type", Value: "multipolygon"}},
+			defaults: true,
+			custom:   true,
+		},
+		{
+			name:     "boundary",
+			tags:     Tags{{Key: "type", Value: "boundary"}, {Key: "boundary", Value: "administrative"}},
+			defaults: true,
+			custom:   true,
+		},
+		{
+			name:     "boundary in blacklist",
+			tags:     Tags{{Key: "type", Value: "boundary"}, {Key: "boundary", Value: "maritime"}},
+			defaults: true,
+			custom:   false,
+		},
+		{
+			name:     "boundary without tag",
+			tags:     Tags{{Key: "type", Value: "boundary"}},
+			defaults: true,
+			custom:   true,
+		},
+		{
+			name:     "route",
+			tags:     Tags{{Key: "type", Value: "route"}},
+			defaults: false,
+			custom:   false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Relation{Tags: tc.tags}
+			if v := r.PolygonWithRules(DefaultAreaRules()); v != tc.defaults {
+				t.Errorf("incorrect with defaults: %v", v)
+			}
+
+			if v := r.Polygon(); v != tc.defaults {
+				t.Errorf("incorrect polygon: %v", v)
+			}
+
+			if v := r.PolygonWithRules(rules); v != tc.custom {
+				t.Errorf("incorrect with custom rules: %v", v)
+			}
+		})
+	}
+}
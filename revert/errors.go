@@ -0,0 +1,29 @@
+package revert
+
+import (
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// NoHistoryError is returned if the datasource has no history for
+// an element in the changeset.
+type NoHistoryError struct {
+	ID osm.FeatureID
+}
+
+// Error returns a pretty string of the error.
+func (e *NoHistoryError) Error() string {
+	return fmt.Sprintf("revert: element history not found for %v", e.ID)
+}
+
+// ConflictError is returned when using the Fail policy and elements
+// in the changeset were modified by later changesets.
+type ConflictError struct {
+	Conflicts Conflicts
+}
+
+// Error returns a pretty string of the error.
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("revert: %d elements modified by later changesets", len(e.Conflicts))
+}
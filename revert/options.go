@@ -0,0 +1,46 @@
+package revert
+
+import "github.com/paulmach/osm"
+
+// Option is a parameter that can be used for reverting a changeset.
+type Option func(*options) error
+
+type options struct {
+	policy      ConflictPolicy
+	changesetID osm.ChangesetID
+}
+
+// A ConflictPolicy defines what to do with elements that were modified
+// by later changesets.
+type ConflictPolicy int
+
+// The supported conflict policies.
+const (
+	// Skip will not revert conflicting elements. They are still returned
+	// in the result conflicts. This is the default.
+	Skip ConflictPolicy = iota
+
+	// Force will revert conflicting elements, overwriting any later changes.
+	Force
+
+	// Fail will return a *ConflictError if there are any conflicts.
+	Fail
+)
+
+// Policy sets how to handle elements that were modified by later changesets.
+// The default is Skip.
+func Policy(p ConflictPolicy) Option {
+	return func(o *options) error {
+		o.policy = p
+		return nil
+	}
+}
+
+// ChangesetID sets the changeset id on all the elements of the revert change.
+// The osm api requires this to be the id of an open changeset on upload.
+func ChangesetID(id osm.ChangesetID) Option {
+	return func(o *options) error {
+		o.changesetID = id
+		return nil
+	}
+}
@@ -0,0 +1,386 @@
+// Package revert computes the osmChange that undoes the edits of a changeset.
+package revert
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// Result is the output of reverting a changeset.
+type Result struct {
+	// Change undoes the changeset. Elements created in the changeset are
+	// deleted. Modified and deleted elements are restored to the version
+	// before the changeset with the version set to the current version,
+	// this is how the osm api supports "undeleting" an element.
+	Change *osm.Change
+
+	// Changes is the same revert split into changes that can be uploaded,
+	// or saved as .osc files, one after the other. The modifies come first,
+	// with relations after their relation members. Then the deletes of the
+	// relations, parents first, the ways and finally the nodes. An osmChange
+	// always encodes nodes before ways, so a single change can't delete
+	// a way and its nodes.
+	Changes []*osm.Change
+
+	// Conflicts are the elements modified by later changesets.
+	Conflicts Conflicts
+}
+
+// A Conflict is an element in the changeset that has been
+// modified by later changesets.
+type Conflict struct {
+	// ID is the last version of the element in the reverted changeset.
+	ID osm.ElementID
+
+	// Current is the latest version of the element.
+	Current osm.ElementID
+
+	// Action is what the changeset did with the element.
+	Action osm.ActionType
+
+	// ChangesetIDs are the later changesets that modified the element.
+	ChangesetIDs []osm.ChangesetID
+}
+
+// Conflicts is a set of conflicts.
+type Conflicts []*Conflict
+
+// Changeset computes the change needed to revert the given changeset
+// using the datasource to find the previous and current versions of
+// the elements. The change is typically from osmapi.ChangesetDownload.
+// Elements in the result change are sorted by type and id.
+func Changeset(
+	ctx context.Context,
+	change *osm.Change,
+	ds osm.HistoryDatasourcer,
+	opts ...Option,
+) (*Result, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make(map[osm.FeatureID]*entry)
+	addEntries(entries, change.Create, osm.ActionCreate)
+	addEntries(entries, change.Modify, osm.ActionModify)
+	addEntries(entries, change.Delete, osm.ActionDelete)
+
+	ids := make(osm.FeatureIDs, 0, len(entries))
+	for id := range entries {
+		ids = append(ids, id)
+	}
+	ids.Sort()
+
+	result := &Result{Change: &osm.Change{}}
+	for _, id := range ids {
+		e := entries[id]
+
+		history, err := loadHistory(ctx, ds, id)
+		if err != nil {
+			return nil, err
+		}
+
+		latest := history.latest()
+		if latest == nil {
+			return nil, &NoHistoryError{ID: id}
+		}
+
+		if latest.Version > e.maxVersion {
+			c := &Conflict{
+				ID:      id.ElementID(e.maxVersion),
+				Current: id.ElementID(latest.Version),
+				Action:  e.action,
+			}
+
+			for _, v := range history {
+				if v.Version > e.maxVersion {
+					c.ChangesetIDs = append(c.ChangesetIDs, v.ChangesetID)
+				}
+			}
+			result.Conflicts = append(result.Conflicts, c)
+
+			if o.policy == Skip {
+				continue
+			}
+		}
+
+		var target *version
+		if !e.created {
+			target = history.before(e.minVersion)
+		}
+
+		if target == nil || !target.Visible {
+			// element should not exist
+			if !latest.Visible {
+				continue
+			}
+
+			obj, err := restore(latest.Object, latest.Version, o.changesetID)
+			if err != nil {
+				return nil, err
+			}
+
+			result.Change.AppendDelete(obj)
+			continue
+		}
+
+		obj, err := restore(target.Object, latest.Version, o.changesetID)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Change.AppendModify(obj)
+	}
+
+	if o.policy == Fail && len(result.Conflicts) > 0 {
+		return nil, &ConflictError{Conflicts: result.Conflicts}
+	}
+
+	result.Changes = uploadOrder(result.Change)
+	return result, nil
+}
+
+// uploadOrder splits the change so each part only references elements
+// that exist after the previous parts are applied.
+func uploadOrder(c *osm.Change) []*osm.Change {
+	var result []*osm.Change
+	if m := c.Modify; m != nil {
+		result = append(result, &osm.Change{
+			Modify: &osm.OSM{
+				Nodes:     m.Nodes,
+				Ways:      m.Ways,
+				Relations: membersFirst(m.Relations),
+			},
+		})
+	}
+
+	d := c.Delete
+	if d == nil {
+		return result
+	}
+
+	if len(d.Relations) > 0 {
+		relations := membersFirst(d.Relations)
+		for i, j := 0, len(relations)-1; i < j; i, j = i+1, j-1 {
+			relations[i], relations[j] = relations[j], relations[i]
+		}
+
+		result = append(result, &osm.Change{Delete: &osm.OSM{Relations: relations}})
+	}
+
+	if len(d.Ways) > 0 {
+		result = append(result, &osm.Change{Delete: &osm.OSM{Ways: d.Ways}})
+	}
+
+	if len(d.Nodes) > 0 {
+		result = append(result, &osm.Change{Delete: &osm.OSM{Nodes: d.Nodes}})
+	}
+
+	return result
+}
+
+// membersFirst returns a copy of the relations ordered so that relations
+// come after any of the others that are members. Cycles are broken
+// using the original order.
+func membersFirst(relations osm.Relations) osm.Relations {
+	byID := make(map[osm.RelationID]*osm.Relation, len(relations))
+	for _, r := range relations {
+		byID[r.ID] = r
+	}
+
+	result := make(osm.Relations, 0, len(relations))
+	visited := make(map[osm.RelationID]bool, len(relations))
+
+	var visit func(r *osm.Relation)
+	visit = func(r *osm.Relation) {
+		if visited[r.ID] {
+			return
+		}
+		visited[r.ID] = true
+
+		for _, m := range r.Members {
+			if m.Type != osm.TypeRelation {
+				continue
+			}
+
+			if member := byID[osm.RelationID(m.Ref)]; member != nil {
+				visit(member)
+			}
+		}
+
+		result = append(result, r)
+	}
+
+	for _, r := range relations {
+		visit(r)
+	}
+
+	return result
+}
+
+type entry struct {
+	action     osm.ActionType
+	created    bool
+	minVersion int
+	maxVersion int
+}
+
+func addEntries(entries map[osm.FeatureID]*entry, o *osm.OSM, action osm.ActionType) {
+	created := action == osm.ActionCreate
+	for _, e := range o.Elements() {
+		id := e.ElementID()
+		v := id.Version()
+
+		en := entries[id.FeatureID()]
+		if en == nil {
+			entries[id.FeatureID()] = &entry{
+				action:     action,
+				created:    created,
+				minVersion: v,
+				maxVersion: v,
+			}
+			continue
+		}
+
+		if v < en.minVersion {
+			en.minVersion = v
+			en.created = created
+		}
+
+		if v > en.maxVersion {
+			en.maxVersion = v
+			en.action = action
+		}
+	}
+}
+
+type version struct {
+	Version     int
+	ChangesetID osm.ChangesetID
+	Visible     bool
+	Object      osm.Object
+}
+
+type history []*version
+
+func loadHistory(ctx context.Context, ds osm.HistoryDatasourcer, id osm.FeatureID) (history, error) {
+	var h history
+
+	switch id.Type() {
+	case osm.TypeNode:
+		nodes, err := ds.NodeHistory(ctx, id.NodeID())
+		if err != nil {
+			return nil, historyErr(ds, id, err)
+		}
+
+		for _, n := range nodes {
+			h = append(h, &version{n.Version, n.ChangesetID, n.Visible, n})
+		}
+	case osm.TypeWay:
+		ways, err := ds.WayHistory(ctx, id.WayID())
+		if err != nil {
+			return nil, historyErr(ds, id, err)
+		}
+
+		for _, w := range ways {
+			h = append(h, &version{w.Version, w.ChangesetID, w.Visible, w})
+		}
+	case osm.TypeRelation:
+		relations, err := ds.RelationHistory(ctx, id.RelationID())
+		if err != nil {
+			return nil, historyErr(ds, id, err)
+		}
+
+		for _, r := range relations {
+			h = append(h, &version{r.Version, r.ChangesetID, r.Visible, r})
+		}
+	}
+
+	return h, nil
+}
+
+func historyErr(ds osm.HistoryDatasourcer, id osm.FeatureID, err error) error {
+	if ds.NotFound(err) {
+		return &NoHistoryError{ID: id}
+	}
+
+	return err
+}
+
+func (h history) latest() *version {
+	var result *version
+	for _, v := range h {
+		if result == nil || v.Version > result.Version {
+			result = v
+		}
+	}
+
+	return result
+}
+
+// before returns the last version before the given version.
+func (h history) before(v int) *version {
+	var result *version
+	for _, c := range h {
+		if c.Version >= v {
+			continue
+		}
+
+		if result == nil || c.Version > result.Version {
+			result = c
+		}
+	}
+
+	return result
+}
+
+// restore returns a copy of the object ready for upload. Metadata
+// and annotations are removed.
+func restore(obj osm.Object, v int, cid osm.ChangesetID) (osm.Object, error) {
+	switch o := obj.(type) {
+	case *osm.Node:
+		return &osm.Node{
+			ID:          o.ID,
+			Lat:         o.Lat,
+			Lon:         o.Lon,
+			Visible:     o.Visible,
+			Version:     v,
+			ChangesetID: cid,
+			Tags:        append(osm.Tags(nil), o.Tags...),
+		}, nil
+	case *osm.Way:
+		nodes := make(osm.WayNodes, len(o.Nodes))
+		for i, wn := range o.Nodes {
+			nodes[i] = osm.WayNode{ID: wn.ID}
+		}
+
+		return &osm.Way{
+			ID:          o.ID,
+			Visible:     o.Visible,
+			Version:     v,
+			ChangesetID: cid,
+			Nodes:       nodes,
+			Tags:        append(osm.Tags(nil), o.Tags...),
+		}, nil
+	case *osm.Relation:
+		members := make(osm.Members, len(o.Members))
+		for i, m := range o.Members {
+			members[i] = osm.Member{Type: m.Type, Ref: m.Ref, Role: m.Role}
+		}
+
+		return &osm.Relation{
+			ID:          o.ID,
+			Visible:     o.Visible,
+			Version:     v,
+			ChangesetID: cid,
+			Members:     members,
+			Tags:        append(osm.Tags(nil), o.Tags...),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("revert: unsupported type %T", obj)
+}
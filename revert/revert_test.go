@@ -0,0 +1,240 @@
+package revert
+
+import (
+	"context"
+	"encoding/xml"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func testData() (*osm.Change, *osm.HistoryDatasource) {
+	change := &osm.Change{
+		Create: &osm.OSM{
+			Nodes: osm.Nodes{{ID: 3, Version: 1, ChangesetID: 10, Visible: true}},
+		},
+		Modify: &osm.OSM{
+			Nodes: osm.Nodes{{ID: 1, Version: 2, ChangesetID: 10, Lat: 5}},
+			Ways:  osm.Ways{{ID: 1, Version: 2, ChangesetID: 10, Nodes: osm.WayNodes{{ID: 1}, {ID: 3}}}},
+		},
+		Delete: &osm.OSM{
+			Nodes: osm.Nodes{{ID: 2, Version: 2, ChangesetID: 10}},
+		},
+	}
+
+	history := &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, ChangesetID: 1, Visible: true, Lat: 1, Tags: osm.Tags{{Key: "a", Value: "b"}}},
+			{ID: 1, Version: 2, ChangesetID: 10, Visible: true, Lat: 5},
+			{ID: 2, Version: 1, ChangesetID: 1, Visible: true, Lat: 2},
+			{ID: 2, Version: 2, ChangesetID: 10, Visible: false},
+			{ID: 3, Version: 1, ChangesetID: 10, Visible: true},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1, ChangesetID: 1, Visible: true, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+			{ID: 1, Version: 2, ChangesetID: 10, Visible: true, Nodes: osm.WayNodes{{ID: 1}, {ID: 3}}},
+		},
+	}
+
+	return change, history.HistoryDatasource()
+}
+
+func TestChangeset(t *testing.T) {
+	ctx := context.Background()
+	change, ds := testData()
+
+	result, err := Changeset(ctx, change, ds, ChangesetID(20))
+	if err != nil {
+		t.Fatalf("revert error: %v", err)
+	}
+
+	if len(result.Conflicts) != 0 {
+		t.Errorf("should have no conflicts: %v", result.Conflicts)
+	}
+
+	c := result.Change
+	if c.Create != nil {
+		t.Errorf("should not have creates: %v", c.Create)
+	}
+
+	// the create is deleted
+	if len(c.Delete.Nodes) != 1 {
+		t.Fatalf("incorrect deletes: %v", c.Delete.Nodes)
+	}
+
+	if n := c.Delete.Nodes[0]; n.ID != 3 || n.Version != 1 || n.ChangesetID != 20 {
+		t.Errorf("incorrect delete: %v", n)
+	}
+
+	// modify is restored and the delete is recreated
+	if len(c.Modify.Nodes) != 2 {
+		t.Fatalf("incorrect modified nodes: %v", c.Modify.Nodes)
+	}
+
+	if n := c.Modify.Nodes[0]; n.ID != 1 || n.Version != 2 || n.Lat != 1 || n.Tags.Find("a") != "b" {
+		t.Errorf("incorrect modify: %v", n)
+	}
+
+	if n := c.Modify.Nodes[1]; n.ID != 2 || n.Version != 2 || n.Lat != 2 || !n.Visible {
+		t.Errorf("incorrect undelete: %v", n)
+	}
+
+	if len(c.Modify.Ways) != 1 {
+		t.Fatalf("incorrect modified ways: %v", c.Modify.Ways)
+	}
+
+	w := c.Modify.Ways[0]
+	if w.Version != 2 || w.Nodes[1].ID != 2 {
+		t.Errorf("incorrect way: %v", w)
+	}
+
+	if _, err := xml.Marshal(c); err != nil {
+		t.Errorf("should marshal to osc: %v", err)
+	}
+}
+
+func TestChangeset_conflicts(t *testing.T) {
+	ctx := context.Background()
+
+	change, ds := testData()
+	ds.Nodes[1] = append(ds.Nodes[1], &osm.Node{ID: 1, Version: 3, ChangesetID: 11, Visible: true, Lat: 7})
+
+	t.Run("skip", func(t *testing.T) {
+		result, err := Changeset(ctx, change, ds)
+		if err != nil {
+			t.Fatalf("revert error: %v", err)
+		}
+
+		if len(result.Conflicts) != 1 {
+			t.Fatalf("incorrect conflicts: %v", result.Conflicts)
+		}
+
+		c := result.Conflicts[0]
+		if c.ID != osm.NodeID(1).ElementID(2) || c.Current != osm.NodeID(1).ElementID(3) {
+			t.Errorf("incorrect conflict: %v", c)
+		}
+
+		if c.Action != osm.ActionModify {
+			t.Errorf("incorrect action: %v", c.Action)
+		}
+
+		if len(c.ChangesetIDs) != 1 || c.ChangesetIDs[0] != 11 {
+			t.Errorf("incorrect changesets: %v", c.ChangesetIDs)
+		}
+
+		for _, n := range result.Change.Modify.Nodes {
+			if n.ID == 1 {
+				t.Errorf("should skip conflicting node")
+			}
+		}
+	})
+
+	t.Run("force", func(t *testing.T) {
+		result, err := Changeset(ctx, change, ds, Policy(Force))
+		if err != nil {
+			t.Fatalf("revert error: %v", err)
+		}
+
+		if len(result.Conflicts) != 1 {
+			t.Fatalf("incorrect conflicts: %v", result.Conflicts)
+		}
+
+		n := result.Change.Modify.Nodes[0]
+		if n.ID != 1 || n.Version != 3 || n.Lat != 1 {
+			t.Errorf("incorrect forced node: %v", n)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		_, err := Changeset(ctx, change, ds, Policy(Fail))
+		if e, ok := err.(*ConflictError); !ok || len(e.Conflicts) != 1 {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+}
+
+func TestChangeset_missingHistory(t *testing.T) {
+	ctx := context.Background()
+
+	change, ds := testData()
+	delete(ds.Ways, 1)
+
+	_, err := Changeset(ctx, change, ds)
+	if e, ok := err.(*NoHistoryError); !ok || e.ID != osm.WayID(1).FeatureID() {
+		t.Errorf("incorrect error: %v", err)
+	}
+}
+
+func TestChangeset_uploadOrder(t *testing.T) {
+	ctx := context.Background()
+
+	// a way, its nodes and relations were created
+	change := &osm.Change{
+		Create: &osm.OSM{
+			Nodes: osm.Nodes{
+				{ID: 1, Version: 1, ChangesetID: 10, Visible: true},
+				{ID: 2, Version: 1, ChangesetID: 10, Visible: true},
+			},
+			Ways: osm.Ways{
+				{ID: 1, Version: 1, ChangesetID: 10, Visible: true, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+			},
+			Relations: osm.Relations{
+				{ID: 1, Version: 1, ChangesetID: 10, Visible: true, Members: osm.Members{{Type: osm.TypeWay, Ref: 1}}},
+				{ID: 2, Version: 1, ChangesetID: 10, Visible: true, Members: osm.Members{{Type: osm.TypeRelation, Ref: 1}}},
+			},
+		},
+	}
+
+	result, err := Changeset(ctx, change, change.HistoryDatasource())
+	if err != nil {
+		t.Fatalf("revert error: %v", err)
+	}
+
+	if len(result.Changes) != 3 {
+		t.Fatalf("incorrect number of changes: %v", len(result.Changes))
+	}
+
+	relations := result.Changes[0].Delete.Relations
+	if len(relations) != 2 || relations[0].ID != 2 || relations[1].ID != 1 {
+		t.Errorf("parent relation should be deleted first: %v", relations)
+	}
+
+	if ways := result.Changes[1].Delete.Ways; len(ways) != 1 || ways[0].ID != 1 {
+		t.Errorf("incorrect way delete: %v", ways)
+	}
+
+	if nodes := result.Changes[2].Delete.Nodes; len(nodes) != 2 {
+		t.Errorf("incorrect node deletes: %v", nodes)
+	}
+
+	for _, c := range result.Changes {
+		if _, err := xml.Marshal(c); err != nil {
+			t.Errorf("should marshal to osc: %v", err)
+		}
+	}
+}
+
+func TestChangeset_uploadOrderModify(t *testing.T) {
+	ctx := context.Background()
+	change, ds := testData()
+
+	result, err := Changeset(ctx, change, ds)
+	if err != nil {
+		t.Fatalf("revert error: %v", err)
+	}
+
+	// the modifies, including the undelete of node 2 used by the
+	// restored way, are before the delete of the created node.
+	if len(result.Changes) != 2 {
+		t.Fatalf("incorrect number of changes: %v", len(result.Changes))
+	}
+
+	m := result.Changes[0].Modify
+	if m == nil || len(m.Nodes) != 2 || len(m.Ways) != 1 || result.Changes[0].Delete != nil {
+		t.Errorf("incorrect modify: %v", result.Changes[0])
+	}
+
+	if d := result.Changes[1].Delete; d == nil || len(d.Nodes) != 1 || d.Nodes[0].ID != 3 {
+		t.Errorf("incorrect delete: %v", result.Changes[1])
+	}
+}
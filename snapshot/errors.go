@@ -0,0 +1,20 @@
+package snapshot
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+// NoVisibleChildError is returned if a way node or relation member
+// is not visible at the snapshot time.
+type NoVisibleChildError struct {
+	ID        osm.FeatureID
+	Timestamp time.Time
+}
+
+// Error returns a pretty string of the error.
+func (e *NoVisibleChildError) Error() string {
+	return fmt.Sprintf("snapshot: no visible child for %v at %v", e.ID, e.Timestamp)
+}
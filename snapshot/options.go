@@ -0,0 +1,31 @@
+package snapshot
+
+import "github.com/paulmach/osm"
+
+// Option is a parameter that can be used for creating a snapshot.
+type Option func(*options) error
+
+type options struct {
+	bounds                *osm.Bounds
+	ignoreMissingChildren bool
+}
+
+// Bounds limits the snapshot to nodes within the bounds, the ways with at
+// least one of those nodes, and the relations with at least one of those nodes
+// or ways as a member.
+func Bounds(b *osm.Bounds) Option {
+	return func(o *options) error {
+		o.bounds = b
+		return nil
+	}
+}
+
+// IgnoreMissingChildren will leave way nodes and relation members unannotated
+// if they are not found or not visible at the snapshot time.
+// By default a NoVisibleChildError is returned.
+func IgnoreMissingChildren(yes bool) Option {
+	return func(o *options) error {
+		o.ignoreMissingChildren = yes
+		return nil
+	}
+}
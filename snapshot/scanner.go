@@ -0,0 +1,328 @@
+package snapshot
+
+import (
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+var _ osm.Scanner = &Scanner{}
+
+// Scanner wraps a full-history scanner and returns the elements as they
+// were at a given time. The underlying data must be sorted by type, id and
+// then version, the order of *.osh.pbf files and the osm history dumps.
+// Way nodes are annotated using the node locations seen earlier in the stream,
+// relation members are annotated with the version and changeset. Node locations
+// are kept in memory for the duration of the scan.
+// Objects that are not nodes, ways or relations are passed through.
+type Scanner struct {
+	scanner osm.Scanner
+	at      time.Time
+	opts    options
+
+	nodes    map[osm.NodeID]nodeInfo
+	members  map[osm.FeatureID]memberInfo
+	included map[osm.FeatureID]struct{}
+
+	inGroup bool
+	groupID osm.FeatureID
+	best    osm.Object
+
+	queue  []osm.Object
+	object osm.Object
+	done   bool
+	err    error
+}
+
+type nodeInfo struct {
+	Version     int
+	ChangesetID osm.ChangesetID
+	Lat, Lon    float64
+	InBounds    bool
+}
+
+type memberInfo struct {
+	Version     int
+	ChangesetID osm.ChangesetID
+}
+
+// NewScanner returns a scanner that returns the state of the data
+// at the given time.
+func NewScanner(scanner osm.Scanner, at time.Time, opts ...Option) *Scanner {
+	s := &Scanner{
+		scanner: scanner,
+		at:      at,
+		nodes:   make(map[osm.NodeID]nodeInfo),
+		members: make(map[osm.FeatureID]memberInfo),
+	}
+
+	for _, opt := range opts {
+		if err := opt(&s.opts); err != nil {
+			s.err = err
+			break
+		}
+	}
+
+	if s.opts.bounds != nil {
+		s.included = make(map[osm.FeatureID]struct{})
+	}
+
+	return s
+}
+
+// FromScanner reads the full-history scanner and returns the state of
+// the data at the given time as an osm.OSM container.
+// The scanner is not closed.
+func FromScanner(scanner osm.Scanner, at time.Time, opts ...Option) (*osm.OSM, error) {
+	s := NewScanner(scanner, at, opts...)
+
+	o := &osm.OSM{}
+	for s.Scan() {
+		o.Append(s.Object())
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// Scan advances the scanner to the next object visible at the snapshot time.
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	for len(s.queue) == 0 {
+		if s.done {
+			return false
+		}
+
+		if !s.scanner.Scan() {
+			s.done = true
+			if err := s.scanner.Err(); err != nil {
+				s.err = err
+				return false
+			}
+
+			s.flush()
+			continue
+		}
+
+		obj := s.scanner.Object()
+
+		var (
+			fid osm.FeatureID
+			ts  time.Time
+			c   *time.Time
+			v   int
+		)
+
+		switch t := obj.(type) {
+		case *osm.Node:
+			fid, ts, c, v = t.FeatureID(), t.Timestamp, t.Committed, t.Version
+		case *osm.Way:
+			fid, ts, c, v = t.FeatureID(), t.Timestamp, t.Committed, t.Version
+		case *osm.Relation:
+			fid, ts, c, v = t.FeatureID(), t.Timestamp, t.Committed, t.Version
+		default:
+			s.flush()
+			s.queue = append(s.queue, obj)
+			continue
+		}
+
+		if !s.inGroup || fid != s.groupID {
+			s.flush()
+			s.inGroup = true
+			s.groupID = fid
+		}
+
+		if effectiveTime(ts, c).After(s.at) {
+			continue
+		}
+
+		if s.best == nil || v > s.best.ObjectID().Version() {
+			s.best = obj
+		}
+	}
+
+	if s.err != nil {
+		return false
+	}
+
+	s.object = s.queue[0]
+	s.queue = s.queue[1:]
+	return true
+}
+
+// flush finishes the current feature group and queues the
+// element current at the snapshot time, if there is one.
+func (s *Scanner) flush() {
+	best := s.best
+	s.best = nil
+	s.inGroup = false
+
+	if best == nil || s.err != nil {
+		return
+	}
+
+	switch e := best.(type) {
+	case *osm.Node:
+		if !e.Visible {
+			return
+		}
+
+		info := nodeInfo{
+			Version:     e.Version,
+			ChangesetID: e.ChangesetID,
+			Lat:         e.Lat,
+			Lon:         e.Lon,
+			InBounds:    s.opts.bounds == nil || s.opts.bounds.ContainsNode(e),
+		}
+		s.nodes[e.ID] = info
+
+		if info.InBounds {
+			s.queue = append(s.queue, e)
+		}
+	case *osm.Way:
+		if !e.Visible {
+			return
+		}
+
+		w, in, err := s.resolveWay(e)
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		s.members[e.FeatureID()] = memberInfo{Version: e.Version, ChangesetID: e.ChangesetID}
+		if in {
+			s.include(e.FeatureID())
+			s.queue = append(s.queue, w)
+		}
+	case *osm.Relation:
+		if !e.Visible {
+			return
+		}
+
+		r, in, err := s.resolveRelation(e)
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		s.members[e.FeatureID()] = memberInfo{Version: e.Version, ChangesetID: e.ChangesetID}
+		if in {
+			s.include(e.FeatureID())
+			s.queue = append(s.queue, r)
+		}
+	}
+}
+
+func (s *Scanner) include(id osm.FeatureID) {
+	if s.included != nil {
+		s.included[id] = struct{}{}
+	}
+}
+
+func (s *Scanner) isIncluded(id osm.FeatureID) bool {
+	if s.included == nil {
+		return true
+	}
+
+	_, ok := s.included[id]
+	return ok
+}
+
+func (s *Scanner) resolveWay(w *osm.Way) (*osm.Way, bool, error) {
+	way := *w
+	way.Nodes = make(osm.WayNodes, len(w.Nodes))
+	way.Updates = nil
+
+	in := s.opts.bounds == nil
+	for i, wn := range w.Nodes {
+		way.Nodes[i] = osm.WayNode{ID: wn.ID}
+
+		info, ok := s.nodes[wn.ID]
+		if !ok {
+			if s.opts.ignoreMissingChildren {
+				continue
+			}
+
+			return nil, false, &NoVisibleChildError{ID: wn.FeatureID(), Timestamp: s.at}
+		}
+
+		in = in || info.InBounds
+		way.Nodes[i].Version = info.Version
+		way.Nodes[i].ChangesetID = info.ChangesetID
+		way.Nodes[i].Lat = info.Lat
+		way.Nodes[i].Lon = info.Lon
+	}
+
+	return &way, in, nil
+}
+
+// resolveRelation annotates the relation members. Relation members that
+// have not been seen yet, i.e. have a larger id, are left unannotated.
+func (s *Scanner) resolveRelation(r *osm.Relation) (*osm.Relation, bool, error) {
+	relation := *r
+	relation.Members = make(osm.Members, len(r.Members))
+	relation.Updates = nil
+
+	in := s.opts.bounds == nil
+	for i, m := range r.Members {
+		relation.Members[i] = osm.Member{Type: m.Type, Ref: m.Ref, Role: m.Role}
+
+		switch m.Type {
+		case osm.TypeNode:
+			info, ok := s.nodes[osm.NodeID(m.Ref)]
+			if !ok {
+				if s.opts.ignoreMissingChildren {
+					continue
+				}
+
+				return nil, false, &NoVisibleChildError{ID: m.FeatureID(), Timestamp: s.at}
+			}
+
+			in = in || info.InBounds
+			relation.Members[i].Version = info.Version
+			relation.Members[i].ChangesetID = info.ChangesetID
+			relation.Members[i].Lat = info.Lat
+			relation.Members[i].Lon = info.Lon
+		case osm.TypeWay, osm.TypeRelation:
+			fid := m.FeatureID()
+			info, ok := s.members[fid]
+			if !ok {
+				if m.Type == osm.TypeRelation || s.opts.ignoreMissingChildren {
+					continue
+				}
+
+				return nil, false, &NoVisibleChildError{ID: fid, Timestamp: s.at}
+			}
+
+			in = in || s.isIncluded(fid)
+			relation.Members[i].Version = info.Version
+			relation.Members[i].ChangesetID = info.ChangesetID
+		}
+	}
+
+	return &relation, in, nil
+}
+
+// Object returns the current object. Nodes, ways and relations are
+// the versions visible at the snapshot time.
+func (s *Scanner) Object() osm.Object {
+	return s.object
+}
+
+// Err returns any error from the underlying scanner or from
+// resolving way nodes and relation members.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Close closes the underlying scanner.
+func (s *Scanner) Close() error {
+	return s.scanner.Close()
+}
@@ -0,0 +1,112 @@
+package snapshot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/paulmach/osm"
+	"github.com/paulmach/osm/osmtest"
+)
+
+func TestScanner(t *testing.T) {
+	history := testHistory()
+	history.Bounds = &osm.Bounds{MinLat: -90, MaxLat: 90, MinLon: -180, MaxLon: 180}
+
+	t.Run("at time", func(t *testing.T) {
+		scanner := osmtest.NewScanner(history.Objects())
+		o, err := FromScanner(scanner, t2)
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+
+		if o.Bounds == nil {
+			t.Errorf("should pass through bounds")
+		}
+
+		if len(o.Nodes) != 3 || len(o.Ways) != 1 || len(o.Relations) != 1 {
+			t.Fatalf("incorrect result: %v %v %v", o.Nodes, o.Ways, o.Relations)
+		}
+
+		if v := o.Nodes[0].Version; v != 2 {
+			t.Errorf("incorrect node version: %v", v)
+		}
+
+		w := o.Ways[0]
+		if w.Version != 2 || len(w.Nodes) != 3 {
+			t.Errorf("incorrect way: %v", w)
+		}
+
+		if wn := w.Nodes[0]; wn.Version != 2 || wn.Lat != 2 || wn.Lon != 2 {
+			t.Errorf("incorrect way node: %v", wn)
+		}
+
+		if m := o.Relations[0].Members[1]; m.Version != 2 {
+			t.Errorf("incorrect relation member: %v", m)
+		}
+	})
+
+	t.Run("deleted elements", func(t *testing.T) {
+		scanner := osmtest.NewScanner(history.Objects())
+		o, err := FromScanner(scanner, t3)
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+
+		if len(o.Nodes) != 2 || len(o.Ways) != 1 || len(o.Relations) != 0 {
+			t.Errorf("incorrect result: %v %v %v", o.Nodes, o.Ways, o.Relations)
+		}
+	})
+
+	t.Run("bounds", func(t *testing.T) {
+		scanner := osmtest.NewScanner(history.Objects())
+		b := &osm.Bounds{MinLat: 2.5, MaxLat: 3.5, MinLon: 2.5, MaxLon: 3.5}
+
+		o, err := FromScanner(scanner, t2, Bounds(b))
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+
+		if len(o.Nodes) != 1 || o.Nodes[0].ID != 2 {
+			t.Errorf("incorrect nodes: %v", o.Nodes)
+		}
+
+		if len(o.Ways) != 1 {
+			t.Errorf("way should be included: %v", o.Ways)
+		}
+
+		if len(o.Relations) != 1 {
+			t.Errorf("relation should be included: %v", o.Relations)
+		}
+
+		b = &osm.Bounds{MinLat: 50, MaxLat: 51, MinLon: 50, MaxLon: 51}
+		scanner = osmtest.NewScanner(history.Objects())
+		o, err = FromScanner(scanner, t2, Bounds(b))
+		if err != nil {
+			t.Fatalf("scan error: %v", err)
+		}
+
+		if len(o.Nodes) != 0 || len(o.Ways) != 0 || len(o.Relations) != 0 {
+			t.Errorf("incorrect result: %v %v %v", o.Nodes, o.Ways, o.Relations)
+		}
+	})
+
+	t.Run("missing node", func(t *testing.T) {
+		objs := history.Objects()
+		scanner := osmtest.NewScanner(objs[3:])
+
+		_, err := FromScanner(scanner, t2)
+		if _, ok := err.(*NoVisibleChildError); !ok {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+
+	t.Run("scanner error", func(t *testing.T) {
+		scanner := osmtest.NewScanner(history.Objects())
+		scanner.ScanError = errors.New("some error")
+
+		_, err := FromScanner(scanner, t2)
+		if err != scanner.ScanError {
+			t.Errorf("incorrect error: %v", err)
+		}
+	})
+}
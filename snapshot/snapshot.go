@@ -0,0 +1,316 @@
+// Package snapshot materializes the state of osm data at a given point in
+// time. The data can come from a osm.HistoryDatasourcer or a full-history
+// scanner, such as an *.osh.pbf file.
+package snapshot
+
+import (
+	"context"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+// NodeAt returns the version of the node that was current at the given time.
+// Returns nil if the node did not exist or was deleted at that time.
+func NodeAt(nodes osm.Nodes, at time.Time) *osm.Node {
+	var current *osm.Node
+	for _, n := range nodes {
+		if effectiveTime(n.Timestamp, n.Committed).After(at) {
+			continue
+		}
+
+		if current == nil || n.Version > current.Version {
+			current = n
+		}
+	}
+
+	if current == nil || !current.Visible {
+		return nil
+	}
+
+	return current
+}
+
+// WayAt returns the version of the way that was current at the given time.
+// Returns nil if the way did not exist or was deleted at that time.
+// The way nodes are NOT updated, see Get for that functionality.
+func WayAt(ways osm.Ways, at time.Time) *osm.Way {
+	var current *osm.Way
+	for _, w := range ways {
+		if effectiveTime(w.Timestamp, w.Committed).After(at) {
+			continue
+		}
+
+		if current == nil || w.Version > current.Version {
+			current = w
+		}
+	}
+
+	if current == nil || !current.Visible {
+		return nil
+	}
+
+	return current
+}
+
+// RelationAt returns the version of the relation that was current at the given time.
+// Returns nil if the relation did not exist or was deleted at that time.
+func RelationAt(relations osm.Relations, at time.Time) *osm.Relation {
+	var current *osm.Relation
+	for _, r := range relations {
+		if effectiveTime(r.Timestamp, r.Committed).After(at) {
+			continue
+		}
+
+		if current == nil || r.Version > current.Version {
+			current = r
+		}
+	}
+
+	if current == nil || !current.Visible {
+		return nil
+	}
+
+	return current
+}
+
+// Get returns the state of the given features at the given time. Features that
+// did not exist, or were deleted, at that time are not included in the result.
+// Way nodes and relation members are annotated with the version, changeset
+// and location (for nodes) current at the given time. With the Bounds option
+// only the nodes in the bounds, the ways with one of those nodes and the
+// relations with one of those nodes or ways as a member are included.
+func Get(
+	ctx context.Context,
+	ds osm.HistoryDatasourcer,
+	ids osm.FeatureIDs,
+	at time.Time,
+	opts ...Option,
+) (*osm.OSM, error) {
+	o := &options{}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &osm.OSM{}
+	for _, id := range ids {
+		switch id.Type() {
+		case osm.TypeNode:
+			nodes, err := ds.NodeHistory(ctx, id.NodeID())
+			if ds.NotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			n := NodeAt(nodes, at)
+			if n != nil && (o.bounds == nil || o.bounds.ContainsNode(n)) {
+				result.Nodes = append(result.Nodes, n)
+			}
+		case osm.TypeWay:
+			ways, err := ds.WayHistory(ctx, id.WayID())
+			if ds.NotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			w := WayAt(ways, at)
+			if w == nil {
+				continue
+			}
+
+			w, in, err := resolveWay(ctx, ds, w, at, o)
+			if err != nil {
+				return nil, err
+			}
+
+			if in {
+				result.Ways = append(result.Ways, w)
+			}
+		case osm.TypeRelation:
+			relations, err := ds.RelationHistory(ctx, id.RelationID())
+			if ds.NotFound(err) {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+
+			r := RelationAt(relations, at)
+			if r == nil {
+				continue
+			}
+
+			r, in, err := resolveRelation(ctx, ds, r, at, o)
+			if err != nil {
+				return nil, err
+			}
+
+			if in {
+				result.Relations = append(result.Relations, r)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// resolveWay returns a copy of the way with the nodes annotated
+// with the values current at the given time, and if one of those
+// nodes is in the bounds.
+func resolveWay(
+	ctx context.Context,
+	ds osm.HistoryDatasourcer,
+	w *osm.Way,
+	at time.Time,
+	o *options,
+) (*osm.Way, bool, error) {
+	way := *w
+	way.Nodes = make(osm.WayNodes, len(w.Nodes))
+	way.Updates = nil
+
+	in := o.bounds == nil
+	for i, wn := range w.Nodes {
+		way.Nodes[i] = osm.WayNode{ID: wn.ID}
+
+		nodes, err := ds.NodeHistory(ctx, wn.ID)
+		if err != nil && !ds.NotFound(err) {
+			return nil, false, err
+		}
+
+		n := NodeAt(nodes, at)
+		if n == nil {
+			if o.ignoreMissingChildren {
+				continue
+			}
+
+			return nil, false, &NoVisibleChildError{
+				ID:        wn.FeatureID(),
+				Timestamp: at,
+			}
+		}
+
+		in = in || o.bounds.ContainsNode(n)
+		way.Nodes[i].Version = n.Version
+		way.Nodes[i].ChangesetID = n.ChangesetID
+		way.Nodes[i].Lat = n.Lat
+		way.Nodes[i].Lon = n.Lon
+	}
+
+	return &way, in, nil
+}
+
+// resolveRelation returns a copy of the relation with the members annotated
+// with the version and changeset current at the given time, and if one of
+// the node or way members is in the bounds. Node members also get the location.
+func resolveRelation(
+	ctx context.Context,
+	ds osm.HistoryDatasourcer,
+	r *osm.Relation,
+	at time.Time,
+	o *options,
+) (*osm.Relation, bool, error) {
+	relation := *r
+	relation.Members = make(osm.Members, len(r.Members))
+	relation.Updates = nil
+
+	in := o.bounds == nil
+	for i, m := range r.Members {
+		relation.Members[i] = osm.Member{Type: m.Type, Ref: m.Ref, Role: m.Role}
+
+		var (
+			version int
+			cid     osm.ChangesetID
+			err     error
+			found   bool
+		)
+
+		switch m.Type {
+		case osm.TypeNode:
+			var nodes osm.Nodes
+			nodes, err = ds.NodeHistory(ctx, osm.NodeID(m.Ref))
+			if n := NodeAt(nodes, at); n != nil {
+				version, cid, found = n.Version, n.ChangesetID, true
+				in = in || o.bounds.ContainsNode(n)
+				relation.Members[i].Lat = n.Lat
+				relation.Members[i].Lon = n.Lon
+			}
+		case osm.TypeWay:
+			var ways osm.Ways
+			ways, err = ds.WayHistory(ctx, osm.WayID(m.Ref))
+			if w := WayAt(ways, at); w != nil {
+				version, cid, found = w.Version, w.ChangesetID, true
+				if !in {
+					in, err = wayInBounds(ctx, ds, w, at, o.bounds)
+				}
+			}
+		case osm.TypeRelation:
+			var relations osm.Relations
+			relations, err = ds.RelationHistory(ctx, osm.RelationID(m.Ref))
+			if r := RelationAt(relations, at); r != nil {
+				version, cid, found = r.Version, r.ChangesetID, true
+			}
+		default:
+			continue
+		}
+
+		if err != nil && !ds.NotFound(err) {
+			return nil, false, err
+		}
+
+		if !found {
+			if o.ignoreMissingChildren {
+				continue
+			}
+
+			return nil, false, &NoVisibleChildError{
+				ID:        m.FeatureID(),
+				Timestamp: at,
+			}
+		}
+
+		relation.Members[i].Version = version
+		relation.Members[i].ChangesetID = cid
+	}
+
+	return &relation, in, nil
+}
+
+// wayInBounds returns true if one of the way nodes, current at the
+// given time, is in the bounds.
+func wayInBounds(
+	ctx context.Context,
+	ds osm.HistoryDatasourcer,
+	w *osm.Way,
+	at time.Time,
+	b *osm.Bounds,
+) (bool, error) {
+	for _, wn := range w.Nodes {
+		nodes, err := ds.NodeHistory(ctx, wn.ID)
+		if ds.NotFound(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+
+		if n := NodeAt(nodes, at); n != nil && b.ContainsNode(n) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// effectiveTime returns the time used to compare against the snapshot time.
+// The committed time is used if known and on or after osm.CommitInfoStart,
+// the same as the annotate package. Before that date only element
+// timestamps are reliable.
+func effectiveTime(timestamp time.Time, committed *time.Time) time.Time {
+	if committed != nil && !committed.Before(osm.CommitInfoStart) {
+		return *committed
+	}
+
+	return timestamp
+}
@@ -0,0 +1,316 @@
+package snapshot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/paulmach/osm"
+)
+
+var (
+	t1 = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+	t2 = time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	t3 = time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func testHistory() *osm.OSM {
+	return &osm.OSM{
+		Nodes: osm.Nodes{
+			{ID: 1, Version: 1, Visible: true, Timestamp: t1, Lat: 1, Lon: 1},
+			{ID: 1, Version: 2, Visible: true, Timestamp: t2, Lat: 2, Lon: 2},
+			{ID: 2, Version: 1, Visible: true, Timestamp: t1, Lat: 3, Lon: 3},
+			{ID: 3, Version: 1, Visible: true, Timestamp: t2, Lat: 4, Lon: 4},
+			{ID: 3, Version: 2, Visible: false, Timestamp: t3},
+		},
+		Ways: osm.Ways{
+			{ID: 1, Version: 1, Visible: true, Timestamp: t1, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+			{ID: 1, Version: 2, Visible: true, Timestamp: t2, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}, {ID: 3}}},
+			{ID: 1, Version: 3, Visible: true, Timestamp: t3, Nodes: osm.WayNodes{{ID: 1}, {ID: 2}}},
+		},
+		Relations: osm.Relations{
+			{ID: 1, Version: 1, Visible: true, Timestamp: t2, Members: osm.Members{
+				{Type: osm.TypeNode, Ref: 1},
+				{Type: osm.TypeWay, Ref: 1},
+			}},
+			{ID: 1, Version: 2, Visible: false, Timestamp: t3},
+		},
+	}
+}
+
+func TestNodeAt(t *testing.T) {
+	nodes := testHistory().Nodes
+
+	cases := []struct {
+		name    string
+		at      time.Time
+		version int
+	}{
+		{name: "before create", at: t1.Add(-time.Hour), version: 0},
+		{name: "on create", at: t1, version: 1},
+		{name: "between", at: t1.Add(time.Hour), version: 1},
+		{name: "latest", at: t3, version: 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := NodeAt(nodes[:2], tc.at)
+			if tc.version == 0 {
+				if n != nil {
+					t.Errorf("should not find node: %v", n)
+				}
+				return
+			}
+
+			if n == nil || n.Version != tc.version {
+				t.Errorf("incorrect node: %v", n)
+			}
+		})
+	}
+
+	t.Run("deleted", func(t *testing.T) {
+		if n := NodeAt(nodes[3:], t3); n != nil {
+			t.Errorf("should not find deleted node: %v", n)
+		}
+	})
+
+	t.Run("uses committed after commit info start", func(t *testing.T) {
+		committed := t2.Add(time.Hour)
+		ns := osm.Nodes{
+			{ID: 1, Version: 1, Visible: true, Timestamp: t1},
+			{ID: 1, Version: 2, Visible: true, Timestamp: t2, Committed: &committed},
+		}
+
+		if n := NodeAt(ns, t2); n.Version != 1 {
+			t.Errorf("incorrect version: %v", n.Version)
+		}
+
+		if n := NodeAt(ns, committed); n.Version != 2 {
+			t.Errorf("incorrect version: %v", n.Version)
+		}
+	})
+
+	t.Run("rule is per element", func(t *testing.T) {
+		// committed after commit info start, so it is used even
+		// though the query time is before
+		ts := osm.CommitInfoStart.Add(-time.Hour)
+		committed := osm.CommitInfoStart.Add(time.Hour)
+		ns := osm.Nodes{
+			{ID: 1, Version: 1, Visible: true, Timestamp: ts, Committed: &committed},
+		}
+
+		if n := NodeAt(ns, osm.CommitInfoStart.Add(-time.Minute)); n != nil {
+			t.Errorf("should use the committed time: %v", n)
+		}
+
+		// committed before commit info start, so the timestamp is used
+		early := time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC)
+		committed = early.Add(time.Hour)
+		ns = osm.Nodes{
+			{ID: 1, Version: 1, Visible: true, Timestamp: early, Committed: &committed},
+		}
+
+		if n := NodeAt(ns, early); n == nil || n.Version != 1 {
+			t.Errorf("should use the timestamp: %v", n)
+		}
+	})
+}
+
+func TestWayAt(t *testing.T) {
+	ways := testHistory().Ways
+
+	cases := []struct {
+		name    string
+		at      time.Time
+		version int
+	}{
+		{name: "before create", at: t1.Add(-time.Hour), version: 0},
+		{name: "on create", at: t1, version: 1},
+		{name: "between", at: t2.Add(time.Hour), version: 2},
+		{name: "latest", at: t3, version: 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := WayAt(ways, tc.at)
+			if tc.version == 0 {
+				if w != nil {
+					t.Errorf("should not find way: %v", w)
+				}
+				return
+			}
+
+			if w == nil || w.Version != tc.version {
+				t.Errorf("incorrect way: %v", w)
+			}
+		})
+	}
+
+	t.Run("does not update way nodes", func(t *testing.T) {
+		if w := WayAt(ways, t2); w.Nodes[0].Version != 0 || w.Nodes[0].Lat != 0 {
+			t.Errorf("should not annotate way nodes: %v", w.Nodes)
+		}
+	})
+
+	t.Run("uses committed after commit info start", func(t *testing.T) {
+		committed := t3.Add(time.Hour)
+		ws := osm.Ways{ways[1], {ID: 1, Version: 3, Visible: true, Timestamp: t3, Committed: &committed}}
+
+		if w := WayAt(ws, t3); w == nil || w.Version != 2 {
+			t.Errorf("incorrect way: %v", w)
+		}
+	})
+}
+
+func TestRelationAt(t *testing.T) {
+	relations := testHistory().Relations
+
+	cases := []struct {
+		name    string
+		at      time.Time
+		version int
+	}{
+		{name: "before create", at: t1, version: 0},
+		{name: "on create", at: t2, version: 1},
+		{name: "between", at: t2.Add(time.Hour), version: 1},
+		{name: "deleted", at: t3, version: 0},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := RelationAt(relations, tc.at)
+			if tc.version == 0 {
+				if r != nil {
+					t.Errorf("should not find relation: %v", r)
+				}
+				return
+			}
+
+			if r == nil || r.Version != tc.version {
+				t.Errorf("incorrect relation: %v", r)
+			}
+		})
+	}
+
+	t.Run("uses committed after commit info start", func(t *testing.T) {
+		committed := t3.Add(time.Hour)
+		rs := osm.Relations{relations[0], {ID: 1, Version: 2, Visible: false, Timestamp: t3, Committed: &committed}}
+
+		if r := RelationAt(rs, t3); r == nil || r.Version != 1 {
+			t.Errorf("incorrect relation: %v", r)
+		}
+	})
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	ds := testHistory().HistoryDatasource()
+
+	ids := osm.FeatureIDs{
+		osm.NodeID(3).FeatureID(),
+		osm.WayID(1).FeatureID(),
+		osm.RelationID(1).FeatureID(),
+		osm.NodeID(100).FeatureID(),
+	}
+
+	t.Run("way and relation resolved", func(t *testing.T) {
+		o, err := Get(ctx, ds, ids, t2)
+		if err != nil {
+			t.Fatalf("get error: %v", err)
+		}
+
+		if len(o.Nodes) != 1 || len(o.Ways) != 1 || len(o.Relations) != 1 {
+			t.Fatalf("incorrect result: %v %v %v", o.Nodes, o.Ways, o.Relations)
+		}
+
+		w := o.Ways[0]
+		if w.Version != 2 {
+			t.Errorf("incorrect way version: %v", w.Version)
+		}
+
+		expected := osm.WayNodes{
+			{ID: 1, Version: 2, Lat: 2, Lon: 2},
+			{ID: 2, Version: 1, Lat: 3, Lon: 3},
+			{ID: 3, Version: 1, Lat: 4, Lon: 4},
+		}
+		for i := range expected {
+			if w.Nodes[i] != expected[i] {
+				t.Errorf("incorrect way node %d: %v", i, w.Nodes[i])
+			}
+		}
+
+		r := o.Relations[0]
+		if m := r.Members[0]; m.Version != 2 || m.Lat != 2 {
+			t.Errorf("incorrect node member: %v", m)
+		}
+
+		if m := r.Members[1]; m.Version != 2 {
+			t.Errorf("incorrect way member: %v", m)
+		}
+	})
+
+	t.Run("does not modify the datasource", func(t *testing.T) {
+		_, err := Get(ctx, ds, ids, t2)
+		if err != nil {
+			t.Fatalf("get error: %v", err)
+		}
+
+		if v := ds.Ways[1][1].Nodes[0].Version; v != 0 {
+			t.Errorf("datasource way modified: %v", v)
+		}
+	})
+
+	t.Run("deleted elements are skipped", func(t *testing.T) {
+		o, err := Get(ctx, ds, ids, t3)
+		if err != nil {
+			t.Fatalf("get error: %v", err)
+		}
+
+		if len(o.Nodes) != 0 || len(o.Ways) != 1 || len(o.Relations) != 0 {
+			t.Errorf("incorrect result: %v %v %v", o.Nodes, o.Ways, o.Relations)
+		}
+	})
+
+	t.Run("bounds", func(t *testing.T) {
+		// only node 3 is in the bounds
+		b := &osm.Bounds{MinLat: 3.5, MaxLat: 4.5, MinLon: 3.5, MaxLon: 4.5}
+		o, err := Get(ctx, ds, ids, t2, Bounds(b))
+		if err != nil {
+			t.Fatalf("get error: %v", err)
+		}
+
+		// the relation is included by its way member
+		if len(o.Nodes) != 1 || len(o.Ways) != 1 || len(o.Relations) != 1 {
+			t.Errorf("incorrect result: %v %v %v", o.Nodes, o.Ways, o.Relations)
+		}
+
+		// node 3 is not part of the way at t1
+		o, err = Get(ctx, ds, ids, t1, Bounds(b))
+		if err != nil {
+			t.Fatalf("get error: %v", err)
+		}
+
+		if len(o.Nodes) != 0 || len(o.Ways) != 0 || len(o.Relations) != 0 {
+			t.Errorf("incorrect result: %v %v %v", o.Nodes, o.Ways, o.Relations)
+		}
+	})
+
+	t.Run("missing child", func(t *testing.T) {
+		ds := testHistory().HistoryDatasource()
+		delete(ds.Nodes, 2)
+
+		_, err := Get(ctx, ds, ids, t2)
+		if _, ok := err.(*NoVisibleChildError); !ok {
+			t.Errorf("incorrect error: %v", err)
+		}
+
+		o, err := Get(ctx, ds, ids, t2, IgnoreMissingChildren(true))
+		if err != nil {
+			t.Fatalf("get error: %v", err)
+		}
+
+		if wn := o.Ways[0].Nodes[1]; wn.Version != 0 || wn.Lat != 0 {
+			t.Errorf("should not annotate missing node: %v", wn)
+		}
+	})
+}
@@ -0,0 +1,18 @@
+package stats
+
+// Option is a parameter that can be used for computing statistics.
+type Option func(*options) error
+
+type options struct {
+	classKeys []string
+}
+
+// ClassKeys sets the tag keys used to classify elements.
+// The first key present on an element defines its class.
+// Default is DefaultClassKeys.
+func ClassKeys(keys ...string) Option {
+	return func(o *options) error {
+		o.classKeys = keys
+		return nil
+	}
+}
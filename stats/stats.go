@@ -0,0 +1,325 @@
+// Package stats summarizes the edits in an osm.Diff or osm.Change
+// per changeset and per user.
+package stats
+
+import (
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/osm"
+)
+
+// DefaultClassKeys are the tag keys used to classify elements. The first key
+// in the list present on an element defines its class.
+var DefaultClassKeys = []string{
+	"highway", "building", "railway", "waterway", "landuse", "natural",
+	"amenity", "shop", "leisure", "tourism", "boundary", "place", "power",
+	"barrier", "man_made", "public_transport", "route", "addr:housenumber",
+}
+
+// OtherClass is the class of tagged elements without any of the class keys.
+// Untagged elements, like most way nodes, are not counted by class.
+const OtherClass = "other"
+
+// Summary contains the statistics for the whole input
+// and broken down by changeset and user.
+type Summary struct {
+	Total      *Stats
+	Changesets map[osm.ChangesetID]*Stats
+	Users      map[osm.UserID]*Stats
+}
+
+// Stats are the statistics for a set of edits.
+type Stats struct {
+	Created  Counts `json:"created"`
+	Modified Counts `json:"modified"`
+	Deleted  Counts `json:"deleted"`
+
+	// TagsAdded, TagsRemoved and TagsChanged count the tag keys added to,
+	// removed from or with values changed on elements. All the tags of
+	// created elements are added and of deleted elements are removed.
+	TagsAdded   map[string]int `json:"tags_added"`
+	TagsRemoved map[string]int `json:"tags_removed"`
+	TagsChanged map[string]int `json:"tags_changed"`
+
+	// Highways and Buildings are the kilometers of highway and building
+	// ways added or removed. Requires way nodes to be annotated with locations.
+	Highways  Length `json:"highways_km"`
+	Buildings Length `json:"buildings_km"`
+}
+
+// Counts are the number of elements by type and class.
+type Counts struct {
+	Nodes     int            `json:"nodes"`
+	Ways      int            `json:"ways"`
+	Relations int            `json:"relations"`
+	Classes   map[string]int `json:"classes"`
+}
+
+// Length is the length, in kilometers, added or removed.
+type Length struct {
+	Added   float64 `json:"added"`
+	Removed float64 `json:"removed"`
+}
+
+// Total returns the total number of elements.
+func (c Counts) Total() int {
+	return c.Nodes + c.Ways + c.Relations
+}
+
+func newStats() *Stats {
+	return &Stats{
+		TagsAdded:   make(map[string]int),
+		TagsRemoved: make(map[string]int),
+		TagsChanged: make(map[string]int),
+	}
+}
+
+// Diff computes the statistics for a diff, for example one created by
+// annotate.Change. Way nodes should be annotated to compute lengths.
+func Diff(d *osm.Diff, opts ...Option) (*Summary, error) {
+	s, err := newSummarizer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, a := range d.Actions {
+		switch a.Type {
+		case osm.ActionCreate:
+			for _, e := range a.OSM.Elements() {
+				s.add(osm.ActionCreate, nil, e)
+			}
+		case osm.ActionModify, osm.ActionDelete:
+			olds := a.Old.Elements()
+			news := a.New.Elements()
+			for i := range news {
+				var old osm.Element
+				if i < len(olds) {
+					old = olds[i]
+				}
+
+				s.add(a.Type, old, news[i])
+			}
+		}
+	}
+
+	return s.summary, nil
+}
+
+// Change computes the statistics for a change. Without the previous versions
+// modifications will only be counted and deleted lengths and tags are unknown.
+// Use annotate.Change and the Diff function for complete statistics.
+func Change(c *osm.Change, opts ...Option) (*Summary, error) {
+	s, err := newSummarizer(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range c.Create.Elements() {
+		s.add(osm.ActionCreate, nil, e)
+	}
+
+	for _, e := range c.Modify.Elements() {
+		s.add(osm.ActionModify, nil, e)
+	}
+
+	for _, e := range c.Delete.Elements() {
+		s.add(osm.ActionDelete, nil, e)
+	}
+
+	return s.summary, nil
+}
+
+type summarizer struct {
+	options
+	summary *Summary
+}
+
+func newSummarizer(opts []Option) (*summarizer, error) {
+	s := &summarizer{
+		options: options{classKeys: DefaultClassKeys},
+		summary: &Summary{
+			Total:      newStats(),
+			Changesets: make(map[osm.ChangesetID]*Stats),
+			Users:      make(map[osm.UserID]*Stats),
+		},
+	}
+
+	for _, opt := range opts {
+		if err := opt(&s.options); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *summarizer) add(action osm.ActionType, old, new osm.Element) {
+	m := metadata(new)
+
+	cs := s.summary.Changesets[m.ChangesetID]
+	if cs == nil {
+		cs = newStats()
+		s.summary.Changesets[m.ChangesetID] = cs
+	}
+
+	us := s.summary.Users[m.UserID]
+	if us == nil {
+		us = newStats()
+		s.summary.Users[m.UserID] = us
+	}
+
+	var oldTags osm.Tags
+	var oldLen length
+	if old != nil {
+		om := metadata(old)
+		oldTags = om.Tags
+		oldLen = s.length(old, om.Tags)
+	}
+
+	newTags := m.Tags
+	if action == osm.ActionDelete {
+		// deleted elements have no tags
+		newTags = nil
+	}
+
+	class := s.class(m.Tags)
+	if action == osm.ActionDelete && old != nil {
+		class = s.class(oldTags)
+	}
+
+	// without the old version only the creates have a known length change
+	known := action == osm.ActionCreate || old != nil
+
+	var newLen length
+	if known && action != osm.ActionDelete {
+		newLen = s.length(new, newTags)
+	}
+
+	for _, st := range []*Stats{s.summary.Total, cs, us} {
+		var c *Counts
+		switch action {
+		case osm.ActionCreate:
+			c = &st.Created
+		case osm.ActionModify:
+			c = &st.Modified
+		case osm.ActionDelete:
+			c = &st.Deleted
+		default:
+			return
+		}
+
+		c.add(new.FeatureID().Type(), class)
+
+		if !known {
+			continue
+		}
+
+		st.addTags(oldTags, newTags)
+		st.Highways.add(oldLen.highway, newLen.highway)
+		st.Buildings.add(oldLen.building, newLen.building)
+	}
+}
+
+func (c *Counts) add(t osm.Type, class string) {
+	switch t {
+	case osm.TypeNode:
+		c.Nodes++
+	case osm.TypeWay:
+		c.Ways++
+	case osm.TypeRelation:
+		c.Relations++
+	}
+
+	if class == "" {
+		return
+	}
+
+	if c.Classes == nil {
+		c.Classes = make(map[string]int)
+	}
+	c.Classes[class]++
+}
+
+func (st *Stats) addTags(old, new osm.Tags) {
+	om := old.Map()
+	nm := new.Map()
+
+	for k, v := range nm {
+		ov, ok := om[k]
+		if !ok {
+			st.TagsAdded[k]++
+		} else if ov != v {
+			st.TagsChanged[k]++
+		}
+	}
+
+	for k := range om {
+		if _, ok := nm[k]; !ok {
+			st.TagsRemoved[k]++
+		}
+	}
+}
+
+func (l *Length) add(old, new float64) {
+	if d := new - old; d > 0 {
+		l.Added += d
+	} else {
+		l.Removed -= d
+	}
+}
+
+func (s *summarizer) class(tags osm.Tags) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	for _, k := range s.classKeys {
+		if tags.HasTag(k) {
+			return k
+		}
+	}
+
+	return OtherClass
+}
+
+type length struct {
+	highway  float64
+	building float64
+}
+
+// length returns the geodesic length, in kilometers, of highway and building ways.
+func (s *summarizer) length(e osm.Element, tags osm.Tags) length {
+	w, ok := e.(*osm.Way)
+	if !ok {
+		return length{}
+	}
+
+	var l length
+	if tags.HasTag("highway") {
+		l.highway = geo.Length(w.LineString()) / 1000
+	}
+
+	if v := tags.Find("building"); v != "" && v != "no" {
+		l.building = geo.Length(w.LineString()) / 1000
+	}
+
+	return l
+}
+
+type meta struct {
+	ChangesetID osm.ChangesetID
+	UserID      osm.UserID
+	Tags        osm.Tags
+}
+
+func metadata(e osm.Element) meta {
+	switch e := e.(type) {
+	case *osm.Node:
+		return meta{ChangesetID: e.ChangesetID, UserID: e.UserID, Tags: e.Tags}
+	case *osm.Way:
+		return meta{ChangesetID: e.ChangesetID, UserID: e.UserID, Tags: e.Tags}
+	case *osm.Relation:
+		return meta{ChangesetID: e.ChangesetID, UserID: e.UserID, Tags: e.Tags}
+	}
+
+	return meta{}
+}
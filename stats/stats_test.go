@@ -0,0 +1,126 @@
+package stats
+
+import (
+	"math"
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestDiff(t *testing.T) {
+	// ~111km per degree of latitude
+	road := func(v int, lat float64, tags osm.Tags) *osm.Way {
+		return &osm.Way{
+			ID: 1, Version: v, ChangesetID: osm.ChangesetID(v), UserID: 2, Visible: true,
+			Nodes: osm.WayNodes{{ID: 1, Version: 1}, {ID: 2, Version: 1, Lat: lat}},
+			Tags:  tags,
+		}
+	}
+
+	diff := &osm.Diff{
+		Actions: osm.Actions{
+			{
+				Type: osm.ActionCreate,
+				OSM: &osm.OSM{Nodes: osm.Nodes{
+					{ID: 1, ChangesetID: 2, UserID: 1, Tags: osm.Tags{{Key: "amenity", Value: "cafe"}}},
+				}},
+			},
+			{
+				Type: osm.ActionModify,
+				Old:  &osm.OSM{Ways: osm.Ways{road(1, 1, osm.Tags{{Key: "highway", Value: "path"}, {Key: "name", Value: "a"}})}},
+				New:  &osm.OSM{Ways: osm.Ways{road(2, 2, osm.Tags{{Key: "highway", Value: "track"}, {Key: "surface", Value: "dirt"}})}},
+			},
+			{
+				Type: osm.ActionDelete,
+				Old:  &osm.OSM{Ways: osm.Ways{{ID: 2, Version: 1, Tags: osm.Tags{{Key: "building", Value: "yes"}}, Nodes: osm.WayNodes{{ID: 1, Version: 1}, {ID: 2, Version: 1, Lat: 1}}}}},
+				New:  &osm.OSM{Ways: osm.Ways{{ID: 2, Version: 2, ChangesetID: 2, UserID: 1}}},
+			},
+		},
+	}
+
+	s, err := Diff(diff)
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+
+	total := s.Total
+	if total.Created.Nodes != 1 || total.Created.Classes["amenity"] != 1 {
+		t.Errorf("incorrect created: %+v", total.Created)
+	}
+
+	if total.Modified.Ways != 1 || total.Modified.Classes["highway"] != 1 {
+		t.Errorf("incorrect modified: %+v", total.Modified)
+	}
+
+	if total.Deleted.Ways != 1 || total.Deleted.Classes["building"] != 1 {
+		t.Errorf("incorrect deleted: %+v", total.Deleted)
+	}
+
+	if total.TagsAdded["surface"] != 1 || total.TagsAdded["amenity"] != 1 {
+		t.Errorf("incorrect tags added: %v", total.TagsAdded)
+	}
+
+	if total.TagsRemoved["name"] != 1 || total.TagsRemoved["building"] != 1 {
+		t.Errorf("incorrect tags removed: %v", total.TagsRemoved)
+	}
+
+	if total.TagsChanged["highway"] != 1 || len(total.TagsChanged) != 1 {
+		t.Errorf("incorrect tags changed: %v", total.TagsChanged)
+	}
+
+	if v := total.Highways.Added; math.Abs(v-111.3) > 0.1 {
+		t.Errorf("incorrect highway added: %v", v)
+	}
+
+	if v := total.Buildings.Removed; math.Abs(v-111.3) > 0.1 {
+		t.Errorf("incorrect building removed: %v", v)
+	}
+
+	if len(s.Changesets) != 1 || s.Changesets[2].Created.Total() != 1 || s.Changesets[2].Modified.Total() != 1 {
+		t.Errorf("incorrect changesets: %v", s.Changesets)
+	}
+
+	if len(s.Users) != 2 || s.Users[1].Deleted.Total() != 1 || s.Users[2].Modified.Total() != 1 {
+		t.Errorf("incorrect users: %v", s.Users)
+	}
+}
+
+func TestChange(t *testing.T) {
+	change := &osm.Change{
+		Create: &osm.OSM{
+			Ways: osm.Ways{{ID: 1, ChangesetID: 1, Tags: osm.Tags{{Key: "shop", Value: "bakery"}},
+				Nodes: osm.WayNodes{{ID: 1, Version: 1}, {ID: 2, Version: 1, Lat: 1}},
+			}},
+		},
+		Modify: &osm.OSM{
+			Ways: osm.Ways{{ID: 2, ChangesetID: 1, Tags: osm.Tags{{Key: "highway", Value: "path"}},
+				Nodes: osm.WayNodes{{ID: 1, Version: 1}, {ID: 2, Version: 1, Lat: 1}},
+			}},
+		},
+		Delete: &osm.OSM{
+			Nodes: osm.Nodes{{ID: 1, ChangesetID: 1}},
+		},
+	}
+
+	s, err := Change(change, ClassKeys("highway"))
+	if err != nil {
+		t.Fatalf("stats error: %v", err)
+	}
+
+	total := s.Total
+	if total.Created.Ways != 1 || total.Created.Classes[OtherClass] != 1 {
+		t.Errorf("incorrect created: %+v", total.Created)
+	}
+
+	if total.Modified.Ways != 1 || total.Deleted.Nodes != 1 {
+		t.Errorf("incorrect counts: %+v", total)
+	}
+
+	if total.TagsAdded["shop"] != 1 || total.TagsAdded["highway"] != 0 {
+		t.Errorf("incorrect tags added: %v", total.TagsAdded)
+	}
+
+	if total.Highways.Added != 0 {
+		t.Errorf("modified lengths should be unknown: %v", total.Highways)
+	}
+}
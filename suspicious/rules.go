@@ -0,0 +1,307 @@
+package suspicious
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/paulmach/orb/geo"
+	"github.com/paulmach/osm"
+)
+
+// DefaultKeyTags are the tags checked by the TagRemoval rule
+// if no keys are provided.
+var DefaultKeyTags = []string{
+	"name", "highway", "building", "railway", "waterway",
+	"landuse", "natural", "boundary", "admin_level", "type",
+}
+
+// MassDeletion flags changesets that delete many elements.
+type MassDeletion struct {
+	// Threshold is the number of deleted elements in a changeset
+	// to trigger a finding. Default 500.
+	Threshold int
+}
+
+// Check implements the Rule interface.
+func (r *MassDeletion) Check(d *osm.Diff) Findings {
+	threshold := r.Threshold
+	if threshold == 0 {
+		threshold = 500
+	}
+
+	counts := make(map[osm.ChangesetID]int)
+	for _, c := range Changes(d) {
+		if c.Type == osm.ActionDelete {
+			counts[changesetID(c.New)]++
+		}
+	}
+
+	var result Findings
+	for cid, count := range counts {
+		if count < threshold {
+			continue
+		}
+
+		result = append(result, &Finding{
+			Rule:        "mass_deletion",
+			Severity:    Critical,
+			ChangesetID: cid,
+			Message:     fmt.Sprintf("%d elements deleted", count),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ChangesetID < result[j].ChangesetID
+	})
+
+	return result
+}
+
+// TagRemoval flags modifications that remove important tags.
+type TagRemoval struct {
+	// Keys are the tag keys to check. Default DefaultKeyTags.
+	Keys []string
+}
+
+// Check implements the Rule interface.
+func (r *TagRemoval) Check(d *osm.Diff) Findings {
+	keys := r.Keys
+	if len(keys) == 0 {
+		keys = DefaultKeyTags
+	}
+
+	var result Findings
+	for _, c := range Changes(d) {
+		if c.Type != osm.ActionModify || c.Old == nil {
+			continue
+		}
+
+		old, new := tags(c.Old), tags(c.New)
+		for _, k := range keys {
+			if !old.HasTag(k) || new.HasTag(k) {
+				continue
+			}
+
+			severity := Warning
+			if k == "name" {
+				severity = Info
+			}
+
+			result = append(result, &Finding{
+				Rule:        "tag_removal",
+				Severity:    severity,
+				ID:          c.New.ElementID(),
+				ChangesetID: changesetID(c.New),
+				Message:     fmt.Sprintf("removed %s=%s", k, old.Find(k)),
+			})
+		}
+	}
+
+	return result
+}
+
+// NodeMove flags nodes moved a large distance.
+type NodeMove struct {
+	// Distance in meters to trigger a finding. Default 1000.
+	Distance float64
+}
+
+// Check implements the Rule interface.
+func (r *NodeMove) Check(d *osm.Diff) Findings {
+	distance := r.Distance
+	if distance == 0 {
+		distance = 1000
+	}
+
+	var result Findings
+	for _, c := range Changes(d) {
+		if c.Type != osm.ActionModify || c.Old == nil {
+			continue
+		}
+
+		old, ok := c.Old.(*osm.Node)
+		if !ok {
+			continue
+		}
+
+		new, ok := c.New.(*osm.Node)
+		if !ok {
+			continue
+		}
+
+		dist := geo.Distance(old.Point(), new.Point())
+		if dist < distance {
+			continue
+		}
+
+		result = append(result, &Finding{
+			Rule:        "node_move",
+			Severity:    Warning,
+			ID:          new.ElementID(),
+			ChangesetID: new.ChangesetID,
+			Message:     fmt.Sprintf("moved %.0f meters", dist),
+		})
+	}
+
+	return result
+}
+
+// WayNodeCollapse flags ways that lose most of their nodes.
+type WayNodeCollapse struct {
+	// MinNodes is the minimum number of nodes the old way must have
+	// to be considered. Default 10.
+	MinNodes int
+
+	// Ratio is the fraction of the original nodes below which a finding
+	// is triggered. Default 0.5.
+	Ratio float64
+}
+
+// Check implements the Rule interface.
+func (r *WayNodeCollapse) Check(d *osm.Diff) Findings {
+	minNodes := r.MinNodes
+	if minNodes == 0 {
+		minNodes = 10
+	}
+
+	ratio := r.Ratio
+	if ratio == 0 {
+		ratio = 0.5
+	}
+
+	var result Findings
+	for _, c := range Changes(d) {
+		if c.Type != osm.ActionModify || c.Old == nil {
+			continue
+		}
+
+		old, ok := c.Old.(*osm.Way)
+		if !ok {
+			continue
+		}
+
+		new, ok := c.New.(*osm.Way)
+		if !ok {
+			continue
+		}
+
+		if len(old.Nodes) < minNodes || float64(len(new.Nodes)) >= ratio*float64(len(old.Nodes)) {
+			continue
+		}
+
+		result = append(result, &Finding{
+			Rule:        "way_node_collapse",
+			Severity:    Warning,
+			ID:          new.ElementID(),
+			ChangesetID: new.ChangesetID,
+			Message:     fmt.Sprintf("node count went from %d to %d", len(old.Nodes), len(new.Nodes)),
+		})
+	}
+
+	return result
+}
+
+// MultipolygonBreakage flags multipolygon and boundary relations that lose
+// their type tag, all their outer members or are deleted.
+type MultipolygonBreakage struct{}
+
+// Check implements the Rule interface.
+func (r *MultipolygonBreakage) Check(d *osm.Diff) Findings {
+	var result Findings
+	for _, c := range Changes(d) {
+		if c.Old == nil {
+			continue
+		}
+
+		old, ok := c.Old.(*osm.Relation)
+		if !ok {
+			continue
+		}
+
+		new, ok := c.New.(*osm.Relation)
+		if !ok {
+			continue
+		}
+
+		typ := old.Tags.Find("type")
+		if typ != "multipolygon" && typ != "boundary" {
+			continue
+		}
+
+		var message string
+		switch {
+		case c.Type == osm.ActionDelete:
+			message = fmt.Sprintf("%s deleted", typ)
+		case new.Tags.Find("type") != typ:
+			message = fmt.Sprintf("type=%s removed", typ)
+		case outerCount(old.Members) > 0 && outerCount(new.Members) == 0:
+			message = "all outer members removed"
+		default:
+			continue
+		}
+
+		result = append(result, &Finding{
+			Rule:        "multipolygon_breakage",
+			Severity:    Critical,
+			ID:          new.ElementID(),
+			ChangesetID: new.ChangesetID,
+			Message:     message,
+		})
+	}
+
+	return result
+}
+
+func outerCount(ms osm.Members) int {
+	count := 0
+	for _, m := range ms {
+		if m.Type == osm.TypeWay && (m.Role == "outer" || m.Role == "") {
+			count++
+		}
+	}
+
+	return count
+}
+
+// LargeRelationEdit flags modifications and deletions of relations
+// with many members.
+type LargeRelationEdit struct {
+	// Members is the number of members of the old relation
+	// to trigger a finding. Default 500.
+	Members int
+}
+
+// Check implements the Rule interface.
+func (r *LargeRelationEdit) Check(d *osm.Diff) Findings {
+	members := r.Members
+	if members == 0 {
+		members = 500
+	}
+
+	var result Findings
+	for _, c := range Changes(d) {
+		if c.Old == nil {
+			continue
+		}
+
+		old, ok := c.Old.(*osm.Relation)
+		if !ok || len(old.Members) < members {
+			continue
+		}
+
+		severity := Info
+		if c.Type == osm.ActionDelete {
+			severity = Critical
+		}
+
+		result = append(result, &Finding{
+			Rule:        "large_relation_edit",
+			Severity:    severity,
+			ID:          c.New.ElementID(),
+			ChangesetID: changesetID(c.New),
+			Message:     fmt.Sprintf("%s of relation with %d members", c.Type, len(old.Members)),
+		})
+	}
+
+	return result
+}
@@ -0,0 +1,147 @@
+// Package suspicious defines a rule framework for flagging risky edits
+// in an osm.Diff, for example one created by annotate.Change.
+package suspicious
+
+import (
+	"fmt"
+
+	"github.com/paulmach/osm"
+)
+
+// Severity is the importance of a finding.
+type Severity int
+
+// The supported severities.
+const (
+	Info Severity = iota
+	Warning
+	Critical
+)
+
+// String returns a string representation of the severity.
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Critical:
+		return "critical"
+	}
+
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// A Finding is a potential problem found by a rule.
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+
+	// ID is the element version that triggered the finding. It is zero
+	// for findings about a whole changeset, like mass deletions.
+	ID          osm.ElementID   `json:"id,omitempty"`
+	ChangesetID osm.ChangesetID `json:"changeset"`
+	Message     string          `json:"message"`
+}
+
+// Findings is a set of findings.
+type Findings []*Finding
+
+// A Rule checks a diff for risky edits.
+type Rule interface {
+	Check(*osm.Diff) Findings
+}
+
+// RuleFunc allows a function to be used as a rule.
+type RuleFunc func(*osm.Diff) Findings
+
+// Check calls the function.
+func (f RuleFunc) Check(d *osm.Diff) Findings {
+	return f(d)
+}
+
+// DefaultRules returns the built-in rules with their default thresholds.
+func DefaultRules() []Rule {
+	return []Rule{
+		&MassDeletion{},
+		&TagRemoval{},
+		&NodeMove{},
+		&WayNodeCollapse{},
+		&MultipolygonBreakage{},
+		&LargeRelationEdit{},
+	}
+}
+
+// Check runs all the rules against the diff and returns the findings
+// in rule order. The DefaultRules are used if no rules are provided.
+func Check(d *osm.Diff, rules ...Rule) Findings {
+	if len(rules) == 0 {
+		rules = DefaultRules()
+	}
+
+	var result Findings
+	for _, r := range rules {
+		result = append(result, r.Check(d)...)
+	}
+
+	return result
+}
+
+// A Change is a single element change extracted from a diff action.
+// Old is nil for creates.
+type Change struct {
+	Type osm.ActionType
+	Old  osm.Element
+	New  osm.Element
+}
+
+// Changes returns the element changes in the diff. It is a helper
+// for writing custom rules.
+func Changes(d *osm.Diff) []Change {
+	var result []Change
+	for _, a := range d.Actions {
+		if a.Type == osm.ActionCreate {
+			for _, e := range a.OSM.Elements() {
+				result = append(result, Change{Type: a.Type, New: e})
+			}
+			continue
+		}
+
+		olds := a.Old.Elements()
+		for i, e := range a.New.Elements() {
+			c := Change{Type: a.Type, New: e}
+			if i < len(olds) {
+				c.Old = olds[i]
+			}
+			result = append(result, c)
+		}
+	}
+
+	return result
+}
+
+func changesetID(e osm.Element) osm.ChangesetID {
+	switch e := e.(type) {
+	case *osm.Node:
+		return e.ChangesetID
+	case *osm.Way:
+		return e.ChangesetID
+	case *osm.Relation:
+		return e.ChangesetID
+	}
+
+	return 0
+}
+
+func tags(e osm.Element) osm.Tags {
+	switch e := e.(type) {
+	case *osm.Node:
+		return e.Tags
+	case *osm.Way:
+		return e.Tags
+	case *osm.Relation:
+		return e.Tags
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package suspicious
+
+import (
+	"testing"
+
+	"github.com/paulmach/osm"
+)
+
+func TestCheck(t *testing.T) {
+	diff := &osm.Diff{
+		Actions: osm.Actions{
+			{
+				Type: osm.ActionModify,
+				Old:  &osm.OSM{Nodes: osm.Nodes{{ID: 1, Version: 1, Tags: osm.Tags{{Key: "name", Value: "a"}}}}},
+				New:  &osm.OSM{Nodes: osm.Nodes{{ID: 1, Version: 2, ChangesetID: 5, Lat: 1}}},
+			},
+		},
+	}
+
+	findings := Check(diff)
+	if len(findings) != 2 {
+		t.Fatalf("incorrect findings: %v", findings)
+	}
+
+	if f := findings[0]; f.Rule != "tag_removal" || f.Severity != Info || f.ID != osm.NodeID(1).ElementID(2) || f.ChangesetID != 5 {
+		t.Errorf("incorrect finding: %v", f)
+	}
+
+	if f := findings[1]; f.Rule != "node_move" {
+		t.Errorf("incorrect finding: %v", f)
+	}
+
+	custom := RuleFunc(func(d *osm.Diff) Findings {
+		return Findings{{Rule: "custom"}}
+	})
+
+	findings = Check(diff, custom)
+	if len(findings) != 1 || findings[0].Rule != "custom" {
+		t.Errorf("incorrect findings: %v", findings)
+	}
+}
+
+func TestCheck_mismatchedTypes(t *testing.T) {
+	diff := &osm.Diff{
+		Actions: osm.Actions{
+			{
+				Type: osm.ActionModify,
+				Old:  &osm.OSM{Nodes: osm.Nodes{{ID: 1, Version: 1}}},
+				New:  &osm.OSM{Ways: osm.Ways{{ID: 1, Version: 2}}},
+			},
+			{
+				Type: osm.ActionModify,
+				Old:  &osm.OSM{Ways: osm.Ways{{ID: 2, Version: 1}}},
+				New:  &osm.OSM{Relations: osm.Relations{{ID: 2, Version: 2}}},
+			},
+			{
+				Type: osm.ActionModify,
+				Old:  &osm.OSM{Relations: osm.Relations{{ID: 3, Version: 1}}},
+				New:  &osm.OSM{Nodes: osm.Nodes{{ID: 3, Version: 2}}},
+			},
+		},
+	}
+
+	// should not panic
+	Check(diff)
+}
+
+func TestMassDeletion(t *testing.T) {
+	diff := &osm.Diff{}
+	for i := 0; i < 3; i++ {
+		diff.Actions = append(diff.Actions, osm.Action{
+			Type: osm.ActionDelete,
+			Old:  &osm.OSM{Nodes: osm.Nodes{{ID: osm.NodeID(i), Version: 1}}},
+			New:  &osm.OSM{Nodes: osm.Nodes{{ID: osm.NodeID(i), Version: 2, ChangesetID: 10}}},
+		})
+	}
+
+	if f := (&MassDeletion{}).Check(diff); len(f) != 0 {
+		t.Errorf("should not trigger: %v", f)
+	}
+
+	f := (&MassDeletion{Threshold: 3}).Check(diff)
+	if len(f) != 1 || f[0].ChangesetID != 10 || f[0].Severity != Critical {
+		t.Errorf("incorrect findings: %v", f)
+	}
+}
+
+func TestWayNodeCollapse(t *testing.T) {
+	diff := &osm.Diff{
+		Actions: osm.Actions{{
+			Type: osm.ActionModify,
+			Old:  &osm.OSM{Ways: osm.Ways{{ID: 1, Version: 1, Nodes: make(osm.WayNodes, 10)}}},
+			New:  &osm.OSM{Ways: osm.Ways{{ID: 1, Version: 2, Nodes: make(osm.WayNodes, 2)}}},
+		}},
+	}
+
+	f := (&WayNodeCollapse{}).Check(diff)
+	if len(f) != 1 || f[0].ID != osm.WayID(1).ElementID(2) {
+		t.Errorf("incorrect findings: %v", f)
+	}
+
+	if f := (&WayNodeCollapse{MinNodes: 11}).Check(diff); len(f) != 0 {
+		t.Errorf("should not trigger: %v", f)
+	}
+}
+
+func TestMultipolygonBreakage(t *testing.T) {
+	old := &osm.Relation{
+		ID: 1, Version: 1,
+		Tags:    osm.Tags{{Key: "type", Value: "multipolygon"}},
+		Members: osm.Members{{Type: osm.TypeWay, Ref: 1, Role: "outer"}},
+	}
+
+	cases := []struct {
+		name    string
+		new     *osm.Relation
+		message string
+	}{
+		{
+			name:    "type removed",
+			new:     &osm.Relation{ID: 1, Version: 2, Members: old.Members},
+			message: "type=multipolygon removed",
+		},
+		{
+			name:    "outers removed",
+			new:     &osm.Relation{ID: 1, Version: 2, Tags: old.Tags, Members: osm.Members{{Type: osm.TypeWay, Ref: 1, Role: "inner"}}},
+			message: "all outer members removed",
+		},
+		{
+			name: "no problem",
+			new:  &osm.Relation{ID: 1, Version: 2, Tags: old.Tags, Members: old.Members},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			diff := &osm.Diff{
+				Actions: osm.Actions{{
+					Type: osm.ActionModify,
+					Old:  &osm.OSM{Relations: osm.Relations{old}},
+					New:  &osm.OSM{Relations: osm.Relations{tc.new}},
+				}},
+			}
+
+			f := (&MultipolygonBreakage{}).Check(diff)
+			if tc.message == "" {
+				if len(f) != 0 {
+					t.Errorf("should not trigger: %v", f)
+				}
+				return
+			}
+
+			if len(f) != 1 || f[0].Message != tc.message {
+				t.Errorf("incorrect findings: %v", f)
+			}
+		})
+	}
+}
+
+func TestLargeRelationEdit(t *testing.T) {
+	diff := &osm.Diff{
+		Actions: osm.Actions{{
+			Type: osm.ActionDelete,
+			Old:  &osm.OSM{Relations: osm.Relations{{ID: 1, Version: 1, Members: make(osm.Members, 5)}}},
+			New:  &osm.OSM{Relations: osm.Relations{{ID: 1, Version: 2}}},
+		}},
+	}
+
+	f := (&LargeRelationEdit{Members: 5}).Check(diff)
+	if len(f) != 1 || f[0].Severity != Critical {
+		t.Errorf("incorrect findings: %v", f)
+	}
+}